@@ -0,0 +1,337 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the longest a single download may take unless the Archiver is given an http.Client of its own,
+// so that a stalled media host does not hold up archiving for good
+const DefaultTimeout = 30 * time.Minute
+
+var (
+	// ErrNoMedia indicates that the item has no media to archive
+	ErrNoMedia = errors.New("Item has no media to archive")
+
+	// ErrQuotaExceeded indicates that archiving the media would exceed the user or global quota
+	ErrQuotaExceeded = errors.New("Media archive quota exceeded")
+
+	// ErrLengthMismatch indicates that the downloaded media does not match the length advertised by the feed
+	ErrLengthMismatch = errors.New("Downloaded media does not match the advertised length")
+)
+
+// Archiver downloads the media of podcast items into a BlobStore on behalf of an owner.
+// Interrupted downloads are resumed with range requests and usage is limited by optional quotas
+type Archiver struct {
+	blobs       BlobStore
+	client      *http.Client
+	globalQuota int64
+	userQuota   int64
+
+	// mtx guards the reservations and key locks. Quota checks reserve the bytes a download may write under it, so
+	// that they cannot race, while downloads themselves run concurrently
+	mtx           sync.Mutex
+	reserved      map[string]int64
+	reservedTotal int64
+	downloads     map[string]*keyLock
+}
+
+// keyLock makes sure only one download appends to the partial blob of a key
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Option configures an Archiver
+type Option func(*Archiver)
+
+// GlobalQuota limits the bytes stored for all owners together, 0 means unlimited
+func GlobalQuota(bytes int64) Option {
+	return func(a *Archiver) {
+		a.globalQuota = bytes
+	}
+}
+
+// UserQuota limits the bytes stored for every single owner, 0 means unlimited
+func UserQuota(bytes int64) Option {
+	return func(a *Archiver) {
+		a.userQuota = bytes
+	}
+}
+
+// HTTPClient sets the http.Client used to download media
+func HTTPClient(client *http.Client) Option {
+	return func(a *Archiver) {
+		a.client = client
+	}
+}
+
+// NewArchiver returns an Archiver storing media in the given BlobStore
+func NewArchiver(blobs BlobStore, options ...Option) *Archiver {
+	a := Archiver{
+		blobs:     blobs,
+		client:    &http.Client{Timeout: DefaultTimeout},
+		reserved:  map[string]int64{},
+		downloads: map[string]*keyLock{},
+	}
+	for _, option := range options {
+		option(&a)
+	}
+	return &a
+}
+
+// ownerPrefix returns the key prefix for all blobs of an owner
+func ownerPrefix(owner string) string {
+	return fmt.Sprintf("users/%x/", sha1.Sum([]byte(owner)))
+}
+
+// Key returns the blob key of an item archived for an owner
+func Key(owner string, itemID uint) string {
+	return fmt.Sprintf("%s%d", ownerPrefix(owner), itemID)
+}
+
+// Open returns the archived media of an item
+func (a *Archiver) Open(owner string, itemID uint) (Blob, error) {
+	return a.blobs.Open(Key(owner, itemID))
+}
+
+// Remove deletes the archived media of an item, including partial downloads
+func (a *Archiver) Remove(owner string, itemID uint) error {
+	return a.blobs.Delete(Key(owner, itemID))
+}
+
+// Move hands all archived media of an owner, including partial downloads, to a new owner
+func (a *Archiver) Move(owner, newOwner string) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.blobs.MovePrefix(ownerPrefix(owner), ownerPrefix(newOwner))
+}
+
+// RemoveAll deletes all archived media of an owner, including partial downloads
+func (a *Archiver) RemoveAll(owner string) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.blobs.DeletePrefix(ownerPrefix(owner))
+}
+
+// Usage returns the bytes stored for an owner
+func (a *Archiver) Usage(owner string) (int64, error) {
+	return a.blobs.Usage(ownerPrefix(owner))
+}
+
+// allowance returns how many more bytes may be stored for the owner and whether any quota limits them. Bytes
+// reserved by ongoing downloads count as used
+func (a *Archiver) allowance(owner string) (int64, bool, error) {
+	var allowance int64
+	limited := false
+	limit := func(quota int64, prefix string, reserved int64) error {
+		if quota <= 0 {
+			return nil
+		}
+		used, err := a.blobs.Usage(prefix)
+		if err != nil {
+			return err
+		}
+		left := quota - used - reserved
+		if left < 0 {
+			left = 0
+		}
+		if !limited || left < allowance {
+			allowance, limited = left, true
+		}
+		return nil
+	}
+	if err := limit(a.globalQuota, "", a.reservedTotal); err != nil {
+		return 0, false, err
+	}
+	if err := limit(a.userQuota, ownerPrefix(owner), a.reserved[owner]); err != nil {
+		return 0, false, err
+	}
+	return allowance, limited, nil
+}
+
+// reserve sets aside the bytes a download of expected bytes, offset of which are already stored, may write for
+// the owner and reports whether the download is limited to them. Downloads of unknown length reserve everything
+// the owner has left, a partial download longer than expected reserves nothing
+func (a *Archiver) reserve(owner string, expected, offset int64) (int64, bool, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	allowance, limited, err := a.allowance(owner)
+	if err != nil || !limited {
+		return 0, false, err
+	}
+	bytes := allowance
+	if expected > 0 {
+		bytes = expected - offset
+		if bytes < 0 {
+			bytes = 0
+		}
+	}
+	if bytes > allowance || (expected <= 0 && allowance == 0) {
+		return 0, false, ErrQuotaExceeded
+	}
+	a.reserved[owner] += bytes
+	a.reservedTotal += bytes
+	return bytes, true, nil
+}
+
+// release returns the bytes reserved for the owner
+func (a *Archiver) release(owner string, bytes int64) {
+	if bytes <= 0 {
+		return
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.reserved[owner] -= bytes; a.reserved[owner] <= 0 {
+		delete(a.reserved, owner)
+	}
+	a.reservedTotal -= bytes
+}
+
+// lockKey waits for other downloads of the key to finish and returns the function releasing the key
+func (a *Archiver) lockKey(key string) func() {
+	a.mtx.Lock()
+	lock, ok := a.downloads[key]
+	if !ok {
+		lock = &keyLock{}
+		a.downloads[key] = lock
+	}
+	lock.refs++
+	a.mtx.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		a.mtx.Lock()
+		defer a.mtx.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(a.downloads, key)
+		}
+	}
+}
+
+// Archive downloads the media of the item for the owner, resuming a previous partial download if present.
+// The download is verified against the item's MediaSize when the feed advertises one
+func (a *Archiver) Archive(ctx context.Context, owner string, item podcastmg.PodcastItem) error {
+	if item.MediaURL == "" {
+		return ErrNoMedia
+	}
+	key := Key(owner, item.ID)
+	defer a.lockKey(key)()
+
+	if blob, err := a.blobs.Open(key); err == nil {
+		blob.Close()
+		return nil
+	}
+	expected := item.MediaSize
+	if expected < 0 {
+		expected = 0
+	}
+
+	// The quota is checked before the partial is created, so that a rejected download leaves nothing behind
+	offset, err := a.blobs.PartialSize(key)
+	if err != nil {
+		return err
+	}
+	allowance, limited, err := a.reserve(owner, expected, offset)
+	if err != nil {
+		return err
+	}
+	defer func() { a.release(owner, allowance) }()
+	w, offset, err := a.blobs.AppendPartial(key)
+	if err != nil {
+		return err
+	}
+	defer func() { w.Close() }()
+
+	resp, err := a.get(ctx, item.MediaURL, offset)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			// The server ignored the range, start over
+			w.Close()
+			if err = a.blobs.DiscardPartial(key); err != nil {
+				return err
+			}
+			a.release(owner, allowance)
+			if allowance, limited, err = a.reserve(owner, expected, 0); err != nil {
+				return err
+			}
+			if w, offset, err = a.blobs.AppendPartial(key); err != nil {
+				return err
+			}
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && offset == expected:
+		// Everything was downloaded before the previous attempt was interrupted
+		w.Close()
+		return a.blobs.CommitPartial(key)
+	default:
+		return fmt.Errorf("Unexpected status downloading media: %s", resp.Status)
+	}
+
+	written, err := copyWithAllowance(w, resp.Body, allowance, limited)
+	if err == ErrQuotaExceeded {
+		a.blobs.DiscardPartial(key)
+		if expected > 0 {
+			// Only the advertised length was reserved, the media is longer than that
+			err = ErrLengthMismatch
+		}
+	}
+	if err != nil {
+		return err
+	}
+	total := offset + written
+	if expected > 0 && total != expected {
+		if total > expected {
+			a.blobs.DiscardPartial(key)
+		}
+		return ErrLengthMismatch
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return a.blobs.CommitPartial(key)
+}
+
+// get requests the media, asking for the bytes after offset when resuming
+func (a *Archiver) get(ctx context.Context, url string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return a.client.Do(req.WithContext(ctx))
+}
+
+// copyWithAllowance copies src to dst. A limited copy fails with ErrQuotaExceeded once more than allowance bytes
+// are available
+func copyWithAllowance(dst io.Writer, src io.Reader, allowance int64, limited bool) (int64, error) {
+	if !limited {
+		return io.Copy(dst, src)
+	}
+	written, err := io.Copy(dst, io.LimitReader(src, allowance))
+	if err != nil {
+		return written, err
+	}
+	if written == allowance {
+		var probe [1]byte
+		if n, _ := io.ReadFull(src, probe[:]); n > 0 {
+			return written, ErrQuotaExceeded
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,288 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testMedia = []byte(strings.Repeat("0123456789", 100))
+
+// mediaServer serves testMedia and records the range headers it was asked for
+type mediaServer struct {
+	*httptest.Server
+	mtx    sync.Mutex
+	ranges []string
+}
+
+func newMediaServer(supportRanges bool) *mediaServer {
+	ms := mediaServer{}
+	ms.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms.mtx.Lock()
+		ms.ranges = append(ms.ranges, r.Header.Get("Range"))
+		ms.mtx.Unlock()
+		if !supportRanges {
+			w.Write(testMedia)
+			return
+		}
+		http.ServeContent(w, r, "episode.mp3", time.Now(), bytes.NewReader(testMedia))
+	}))
+	return &ms
+}
+
+func (ms *mediaServer) requests() []string {
+	ms.mtx.Lock()
+	defer ms.mtx.Unlock()
+	return append([]string(nil), ms.ranges...)
+}
+
+func testItem(id uint, url string, length int) podcastmg.PodcastItem {
+	return podcastmg.PodcastItem{ID: id, MediaURL: url, MediaSize: int64(length)}
+}
+
+func readArchived(t *testing.T, a *Archiver, owner string, itemID uint) []byte {
+	blob, err := a.Open(owner, itemID)
+	if err != nil {
+		t.Fatalf("Could not open archived media:%v", err)
+	}
+	defer blob.Close()
+	data, _ := ioutil.ReadAll(blob)
+	return data
+}
+
+func TestArchive(t *testing.T) {
+	ms := newMediaServer(true)
+	defer ms.Close()
+	blobs, cleanup := newTestBlobStore(t)
+	defer cleanup()
+	a := NewArchiver(blobs)
+	ctx := context.Background()
+
+	if err := a.Archive(ctx, "a@test.com", testItem(1, ms.URL, len(testMedia))); err != nil {
+		t.Fatalf("Failed to archive:%v", err)
+	}
+	if data := readArchived(t, a, "a@test.com", 1); !bytes.Equal(data, testMedia) {
+		t.Errorf("Archived media does not match, have %d bytes", len(data))
+	}
+
+	t.Run("Already Archived", func(t *testing.T) {
+		before := len(ms.requests())
+		if err := a.Archive(ctx, "a@test.com", testItem(1, ms.URL, len(testMedia))); err != nil {
+			t.Fatalf("Failed to archive:%v", err)
+		}
+		if after := len(ms.requests()); after != before {
+			t.Errorf("Archived media should not be downloaded again")
+		}
+	})
+
+	t.Run("Other Owner", func(t *testing.T) {
+		if _, err := a.Open("b@test.com", 1); err != ErrBlobNotFound {
+			t.Errorf("Want:%v\tHave:%v", ErrBlobNotFound, err)
+		}
+	})
+
+	t.Run("No Media", func(t *testing.T) {
+		if err := a.Archive(ctx, "a@test.com", testItem(2, "", 0)); err != ErrNoMedia {
+			t.Errorf("Want:%v\tHave:%v", ErrNoMedia, err)
+		}
+	})
+
+	t.Run("Length Mismatch", func(t *testing.T) {
+		if err := a.Archive(ctx, "a@test.com", testItem(3, ms.URL, 10)); err != ErrLengthMismatch {
+			t.Errorf("Want:%v\tHave:%v", ErrLengthMismatch, err)
+		}
+		if _, err := a.Open("a@test.com", 3); err != ErrBlobNotFound {
+			t.Errorf("Mismatched media should not be archived")
+		}
+	})
+
+	t.Run("Unknown Length", func(t *testing.T) {
+		if err := a.Archive(ctx, "a@test.com", testItem(4, ms.URL, 0)); err != nil {
+			t.Fatalf("Failed to archive:%v", err)
+		}
+		if data := readArchived(t, a, "a@test.com", 4); !bytes.Equal(data, testMedia) {
+			t.Errorf("Archived media does not match, have %d bytes", len(data))
+		}
+	})
+
+	t.Run("Move And Remove Owner", func(t *testing.T) {
+		if err := a.Move("a@test.com", "c@test.com"); err != nil {
+			t.Fatalf("Failed to move media:%v", err)
+		}
+		if _, err := a.Open("a@test.com", 1); err != ErrBlobNotFound {
+			t.Errorf("Moved media is still kept for the previous owner")
+		}
+		if data := readArchived(t, a, "c@test.com", 1); !bytes.Equal(data, testMedia) {
+			t.Errorf("Moved media does not match, have %d bytes", len(data))
+		}
+		if err := a.RemoveAll("c@test.com"); err != nil {
+			t.Fatalf("Failed to remove media:%v", err)
+		}
+		if usage, err := a.Usage("c@test.com"); err != nil || usage != 0 {
+			t.Errorf("Removed media is still stored:%d %v", usage, err)
+		}
+	})
+}
+
+func TestArchiveResume(t *testing.T) {
+	type resumeTestCase struct {
+		name          string
+		supportRanges bool
+		wantRange     string
+	}
+	testCases := []resumeTestCase{
+		{"Range Support", true, "bytes=300-"},
+		{"No Range Support", false, "bytes=300-"},
+	}
+	for _, testCase := range testCases {
+		ms := newMediaServer(testCase.supportRanges)
+		blobs, cleanup := newTestBlobStore(t)
+		a := NewArchiver(blobs)
+		writePartial(t, blobs, Key("a@test.com", 1), string(testMedia[:300]))
+
+		if err := a.Archive(context.Background(), "a@test.com", testItem(1, ms.URL, len(testMedia))); err != nil {
+			t.Errorf("%s\tFailed to archive:%v", testCase.name, err)
+		} else if data := readArchived(t, a, "a@test.com", 1); !bytes.Equal(data, testMedia) {
+			t.Errorf("%s\tResumed media does not match, have %d bytes", testCase.name, len(data))
+		}
+		if requests := ms.requests(); len(requests) != 1 || requests[0] != testCase.wantRange {
+			t.Errorf("%s\tRange Want:%s\tHave:%v", testCase.name, testCase.wantRange, requests)
+		}
+		ms.Close()
+		cleanup()
+	}
+}
+
+func TestArchiveQuota(t *testing.T) {
+	ms := newMediaServer(true)
+	defer ms.Close()
+	type quotaTestCase struct {
+		name   string
+		option Option
+		length int
+		want   error
+	}
+	testCases := []quotaTestCase{
+		{"User Quota", UserQuota(500), len(testMedia), ErrQuotaExceeded},
+		{"Global Quota", GlobalQuota(500), len(testMedia), ErrQuotaExceeded},
+		{"Unknown Length", UserQuota(500), 0, ErrQuotaExceeded},
+		{"Within Quota", UserQuota(5000), len(testMedia), nil},
+	}
+	for _, testCase := range testCases {
+		blobs, cleanup := newTestBlobStore(t)
+		a := NewArchiver(blobs, testCase.option)
+		if err := a.Archive(context.Background(), "a@test.com", testItem(1, ms.URL, testCase.length)); err != testCase.want {
+			t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.want, err)
+		}
+		used, _ := a.Usage("a@test.com")
+		if testCase.want != nil && used != 0 {
+			t.Errorf("%s\tRejected media still uses %d bytes", testCase.name, used)
+		}
+		if files, _ := blobs.prefixFiles(ownerPrefix("a@test.com")); testCase.want != nil && len(files) != 0 {
+			t.Errorf("%s\tRejected media left files behind:%v", testCase.name, files)
+		}
+		cleanup()
+	}
+}
+
+func TestArchiveTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	ms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer ms.Close()
+	defer close(stalled)
+	blobs, cleanup := newTestBlobStore(t)
+	defer cleanup()
+	if a := NewArchiver(blobs); a.client.Timeout != DefaultTimeout {
+		t.Errorf("Timeout Want:%v\tHave:%v", DefaultTimeout, a.client.Timeout)
+	}
+	a := NewArchiver(blobs, HTTPClient(&http.Client{Timeout: 50 * time.Millisecond}))
+	if err := a.Archive(context.Background(), "a@test.com", testItem(1, ms.URL, len(testMedia))); err == nil {
+		t.Errorf("Download from a stalled host did not time out")
+	}
+}
+
+func TestArchiveOversizedPartial(t *testing.T) {
+	ms := newMediaServer(true)
+	defer ms.Close()
+	blobs, cleanup := newTestBlobStore(t)
+	defer cleanup()
+	a := NewArchiver(blobs, UserQuota(5000))
+	writePartial(t, blobs, Key("a@test.com", 1), string(testMedia[:300]))
+
+	// A partial longer than the advertised length must not lift the quota
+	if bytes, limited, err := a.reserve("a@test.com", 200, 300); err != nil || !limited || bytes != 0 {
+		t.Errorf("Unexpected reservation:%d %v %v", bytes, limited, err)
+	}
+	a.release("a@test.com", 0)
+	if _, err := copyWithAllowance(ioutil.Discard, strings.NewReader("x"), 0, true); err != ErrQuotaExceeded {
+		t.Errorf("Want:%v\tHave:%v", ErrQuotaExceeded, err)
+	}
+	if err := a.Archive(context.Background(), "a@test.com", testItem(1, ms.URL, 200)); err != ErrLengthMismatch {
+		t.Errorf("Want:%v\tHave:%v", ErrLengthMismatch, err)
+	}
+	if used, _ := a.Usage("a@test.com"); used != 0 {
+		t.Errorf("Rejected media still uses %d bytes", used)
+	}
+}
+
+func TestArchiveConcurrent(t *testing.T) {
+	// The media server holds every response until it is released
+	release := make(chan struct{})
+	started := make(chan struct{}, 4)
+	ms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write(testMedia)
+	}))
+	defer ms.Close()
+	blobs, cleanup := newTestBlobStore(t)
+	defer cleanup()
+	a := NewArchiver(blobs, GlobalQuota(int64(len(testMedia))*3/2))
+
+	results := make(chan error, 2)
+	go func() {
+		results <- a.Archive(context.Background(), "a@test.com", testItem(1, ms.URL, len(testMedia)))
+	}()
+	<-started
+
+	// The quota of the first download is reserved while it is running, a second one does not fit next to it
+	if err := a.Archive(context.Background(), "b@test.com", testItem(1, ms.URL, len(testMedia))); err != ErrQuotaExceeded {
+		t.Errorf("Want:%v\tHave:%v", ErrQuotaExceeded, err)
+	}
+
+	// Downloads of other owners are not held up by the running one
+	go func() {
+		results <- a.Archive(context.Background(), "c@test.com", testItem(2, ms.URL, 0))
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Download waited for the running download")
+	}
+	close(release)
+	var failed int
+	for i := 0; i < 2; i++ {
+		if err := <-results; err == ErrQuotaExceeded {
+			failed++
+		} else if err != nil {
+			t.Errorf("Failed to archive:%v", err)
+		}
+	}
+
+	// The download of unknown length only had what was left next to the first download
+	if failed != 1 {
+		t.Errorf("Failed Want:1\tHave:%d", failed)
+	}
+	if data := readArchived(t, a, "a@test.com", 1); !bytes.Equal(data, testMedia) {
+		t.Errorf("Archived media does not match, have %d bytes", len(data))
+	}
+}
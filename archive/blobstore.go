@@ -0,0 +1,259 @@
+package archive
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrBlobNotFound indicates that no complete blob exists for the key
+	ErrBlobNotFound = errors.New("Blob not found")
+
+	// ErrInvalidKey indicates a key which cannot be stored
+	ErrInvalidKey = errors.New("Invalid blob key")
+)
+
+// partialSuffix marks blobs which are still being downloaded
+const partialSuffix = ".part"
+
+// Blob is a complete stored blob which supports random access
+type Blob interface {
+	io.ReadSeeker
+	io.Closer
+	Size() int64
+	ModTime() time.Time
+}
+
+// BlobStore is an interface that defines the storage needed by the Archiver.
+// Blobs are written as partials which are appended to until they are committed
+type BlobStore interface {
+	Open(key string) (Blob, error)
+	PartialSize(key string) (int64, error)
+	AppendPartial(key string) (w io.WriteCloser, offset int64, err error)
+	DiscardPartial(key string) error
+	CommitPartial(key string) error
+	Delete(key string) error
+	Usage(prefix string) (int64, error)
+	MovePrefix(prefix, newPrefix string) error
+	DeletePrefix(prefix string) error
+}
+
+// FSBlobStore is a BlobStore backed by a directory on the local filesystem
+type FSBlobStore struct {
+	root string
+}
+
+// NewFSBlobStore returns a FSBlobStore rooted at the given directory, creating it if needed
+func NewFSBlobStore(root string) (*FSBlobStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FSBlobStore{root}, nil
+}
+
+// path returns the filesystem path of a key, rejecting keys which escape the root
+func (fs *FSBlobStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if key == "" || clean == "/" || strings.HasSuffix(key, partialSuffix) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(fs.root, filepath.FromSlash(clean)), nil
+}
+
+// Open returns the committed blob for the key
+func (fs *FSBlobStore) Open(key string) (Blob, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return fileBlob{f, info}, nil
+}
+
+// PartialSize returns the bytes written to the partial blob for the key, 0 if there is none
+func (fs *FSBlobStore) PartialSize(key string) (int64, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p + partialSuffix)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// AppendPartial opens the partial blob for the key for appending, returning the bytes already written
+func (fs *FSBlobStore) AppendPartial(key string) (io.WriteCloser, int64, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(p+partialSuffix, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// DiscardPartial removes the partial blob for the key
+func (fs *FSBlobStore) DiscardPartial(key string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p + partialSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CommitPartial turns the partial blob for the key into a complete one
+func (fs *FSBlobStore) CommitPartial(key string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	return os.Rename(p+partialSuffix, p)
+}
+
+// Delete removes the blob and any partial for the key
+func (fs *FSBlobStore) Delete(key string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return fs.DiscardPartial(key)
+}
+
+// Usage returns the bytes used by all blobs, including partials, whose keys start with the prefix
+func (fs *FSBlobStore) Usage(prefix string) (int64, error) {
+	var total int64
+	err := filepath.Walk(fs.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(fs.root, p)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(filepath.ToSlash(rel), strings.TrimPrefix(prefix, "/")) {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// prefixFiles returns the slash separated paths of all blobs, including partials, whose keys start with the prefix
+func (fs *FSBlobStore) prefixFiles(prefix string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(fs.root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(fs.root, p)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); strings.HasPrefix(rel, strings.TrimPrefix(prefix, "/")) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// MovePrefix moves all blobs, including partials, whose keys start with the prefix to keys starting with newPrefix
+func (fs *FSBlobStore) MovePrefix(prefix, newPrefix string) error {
+	if prefix == "" || newPrefix == "" {
+		return ErrInvalidKey
+	}
+	files, err := fs.prefixFiles(prefix)
+	if err != nil {
+		return err
+	}
+	for _, rel := range files {
+		key := strings.TrimSuffix(newPrefix+strings.TrimPrefix(rel, strings.TrimPrefix(prefix, "/")), partialSuffix)
+		p, err := fs.path(key)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(rel, partialSuffix) {
+			p += partialSuffix
+		}
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err = os.Rename(filepath.Join(fs.root, filepath.FromSlash(rel)), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePrefix removes all blobs, including partials, whose keys start with the prefix
+func (fs *FSBlobStore) DeletePrefix(prefix string) error {
+	if prefix == "" {
+		return ErrInvalidKey
+	}
+	files, err := fs.prefixFiles(prefix)
+	if err != nil {
+		return err
+	}
+	for _, rel := range files {
+		if err = os.Remove(filepath.Join(fs.root, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileBlob is a Blob backed by an open file
+type fileBlob struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (b fileBlob) Size() int64 {
+	return b.info.Size()
+}
+
+func (b fileBlob) ModTime() time.Time {
+	return b.info.ModTime()
+}
@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func newTestBlobStore(t *testing.T) (*FSBlobStore, func()) {
+	dir, err := ioutil.TempDir("", "pmg-blobs")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	blobs, err := NewFSBlobStore(dir)
+	if err != nil {
+		t.Fatalf("Could not create blob store:%v", err)
+	}
+	return blobs, func() { os.RemoveAll(dir) }
+}
+
+func writePartial(t *testing.T, blobs BlobStore, key string, data string) {
+	w, _, err := blobs.AppendPartial(key)
+	if err != nil {
+		t.Fatalf("Could not open partial %s:%v", key, err)
+	}
+	w.Write([]byte(data))
+	w.Close()
+}
+
+func TestFSBlobStore(t *testing.T) {
+	blobs, cleanup := newTestBlobStore(t)
+	defer cleanup()
+
+	t.Run("Invalid Keys", func(t *testing.T) {
+		for _, key := range []string{"", "/", "..", "a/b.part"} {
+			if _, _, err := blobs.AppendPartial(key); err != ErrInvalidKey {
+				t.Errorf("Key:%q\tWant:%v\tHave:%v", key, ErrInvalidKey, err)
+			}
+		}
+	})
+
+	t.Run("Partial Lifecycle", func(t *testing.T) {
+		writePartial(t, blobs, "a/1", "hello ")
+		if _, err := blobs.Open("a/1"); err != ErrBlobNotFound {
+			t.Errorf("Partial blobs should not be opened, have:%v", err)
+		}
+		w, offset, err := blobs.AppendPartial("a/1")
+		if err != nil || offset != 6 {
+			t.Fatalf("Offset Want:6\tHave:%d\terr:%v", offset, err)
+		}
+		w.Write([]byte("world"))
+		w.Close()
+		if err = blobs.CommitPartial("a/1"); err != nil {
+			t.Fatalf("Failed to commit:%v", err)
+		}
+		blob, err := blobs.Open("a/1")
+		if err != nil {
+			t.Fatalf("Failed to open committed blob:%v", err)
+		}
+		data, _ := ioutil.ReadAll(blob)
+		blob.Close()
+		if string(data) != "hello world" || blob.Size() != 11 {
+			t.Errorf("Unexpected blob content:%q size:%d", data, blob.Size())
+		}
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		writePartial(t, blobs, "a/2", "1234")
+		writePartial(t, blobs, "b/1", "12")
+		type usageTestCase struct {
+			prefix string
+			want   int64
+		}
+		testCases := []usageTestCase{
+			{"", 17},
+			{"a/", 15},
+			{"b/", 2},
+			{"c/", 0},
+		}
+		for _, testCase := range testCases {
+			if have, err := blobs.Usage(testCase.prefix); err != nil || have != testCase.want {
+				t.Errorf("Prefix:%q\tWant:%d\tHave:%d\terr:%v", testCase.prefix, testCase.want, have, err)
+			}
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := blobs.Delete("a/1"); err != nil {
+			t.Fatalf("Failed to delete:%v", err)
+		}
+		if err := blobs.Delete("a/2"); err != nil {
+			t.Fatalf("Failed to delete partial:%v", err)
+		}
+		if used, _ := blobs.Usage("a/"); used != 0 {
+			t.Errorf("Deleted blobs still use %d bytes", used)
+		}
+	})
+
+	t.Run("Move And Delete Prefix", func(t *testing.T) {
+		writePartial(t, blobs, "c/1", "123")
+		blobs.CommitPartial("c/1")
+		writePartial(t, blobs, "c/2", "45")
+		if err := blobs.MovePrefix("c/", "d/"); err != nil {
+			t.Fatalf("Failed to move prefix:%v", err)
+		}
+		if used, _ := blobs.Usage("c/"); used != 0 {
+			t.Errorf("Moved blobs still use %d bytes", used)
+		}
+		if blob, err := blobs.Open("d/1"); err != nil {
+			t.Errorf("Failed to open moved blob:%v", err)
+		} else {
+			blob.Close()
+		}
+		w, offset, err := blobs.AppendPartial("d/2")
+		if err != nil || offset != 2 {
+			t.Fatalf("Partial was not moved, offset:%d err:%v", offset, err)
+		}
+		w.Close()
+		if err := blobs.DeletePrefix("d/"); err != nil {
+			t.Fatalf("Failed to delete prefix:%v", err)
+		}
+		if used, _ := blobs.Usage("d/"); used != 0 {
+			t.Errorf("Deleted blobs still use %d bytes", used)
+		}
+		if used, _ := blobs.Usage("b/"); used != 2 {
+			t.Errorf("Blobs of other prefixes were touched, b/ uses %d bytes", used)
+		}
+		if err := blobs.DeletePrefix(""); err != ErrInvalidKey {
+			t.Errorf("Want:%v\tHave:%v", ErrInvalidKey, err)
+		}
+	})
+}
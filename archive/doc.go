@@ -0,0 +1,2 @@
+// Package archive downloads podcast media to a pluggable blob store so that episodes outlive their publisher.
+package archive
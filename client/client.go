@@ -0,0 +1,774 @@
+package client
+
+import (
+	"context"
+	"errors"
+	jwt "github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/service"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoCredentials indicates that a token is required but the client has no credentials to acquire one
+	ErrNoCredentials = errors.New("No credentials available to acquire a token")
+)
+
+// tokenRefreshLeeway is how long before expiry a cached token is considered stale
+const tokenRefreshLeeway = time.Minute
+
+// Client is a PodcastManageService that talks to a remote instance over HTTP.
+// Tokens for authenticated calls are acquired from the configured credentials and refreshed when they expire
+type Client struct {
+	endpoints service.Endpoints
+	emailID   string
+	password  string
+
+	mtx   sync.Mutex
+	token string
+}
+
+var _ service.PodcastManageService = (*Client)(nil)
+
+// Option configures a Client
+type Option func(*clientConfig)
+
+type clientConfig struct {
+	emailID       string
+	password      string
+	token         string
+	clientOptions []kithttp.ClientOption
+}
+
+// WithCredentials sets the email and password used to acquire tokens
+func WithCredentials(emailID, password string) Option {
+	return func(c *clientConfig) {
+		c.emailID = emailID
+		c.password = password
+	}
+}
+
+// WithToken sets a previously issued token or a personal access token to use for authenticated calls
+func WithToken(token string) Option {
+	return func(c *clientConfig) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sets the http.Client used to reach the remote instance
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *clientConfig) {
+		c.clientOptions = append(c.clientOptions, kithttp.SetClient(httpClient))
+	}
+}
+
+// New returns a Client for the podcast-manage-svc instance at the given address
+func New(instance string, options ...Option) (*Client, error) {
+	var config clientConfig
+	for _, option := range options {
+		option(&config)
+	}
+	endpoints, err := MakeClientEndpoints(instance, config.clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		endpoints: endpoints,
+		emailID:   config.emailID,
+		password:  config.password,
+		token:     config.token,
+	}, nil
+}
+
+// Token returns the token currently held by the client, which may be empty
+func (c *Client) Token() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.token
+}
+
+// Login acquires a fresh token using the client's credentials
+func (c *Client) Login(ctx context.Context) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.login(ctx)
+}
+
+// login acquires a new token, c.mtx must be held by the caller
+func (c *Client) login(ctx context.Context) error {
+	if c.emailID == "" || c.password == "" {
+		return ErrNoCredentials
+	}
+	token, err := c.GetToken(ctx, c.emailID, c.password)
+	if err != nil {
+		return err
+	}
+	c.token = token
+	return nil
+}
+
+// validToken returns a token which is not about to expire, logging in again if required
+func (c *Client) validToken(ctx context.Context) (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.token != "" && !tokenExpiring(c.token) {
+		return c.token, nil
+	}
+	if c.token != "" && c.password == "" {
+		// Nothing to refresh with, let the server decide
+		return c.token, nil
+	}
+	if err := c.login(ctx); err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+// refreshToken replaces a token rejected by the server, unless another call already did so
+func (c *Client) refreshToken(ctx context.Context, rejected string) (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.token != rejected {
+		return c.token, nil
+	}
+	if err := c.login(ctx); err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+// tokenExpiring checks the expiry claim of the token without verifying its signature
+func tokenExpiring(tokenString string) bool {
+	var claims service.TokenClaims
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, &claims); err != nil {
+		return true
+	}
+	if claims.ExpiresAt == 0 {
+		return false
+	}
+	return time.Now().Add(tokenRefreshLeeway).Unix() >= claims.ExpiresAt
+}
+
+// isTokenError checks whether the server rejected the token of the request
+func isTokenError(err error) bool {
+	switch err {
+	case kitjwt.ErrTokenExpired, kitjwt.ErrTokenInvalid, kitjwt.ErrTokenNotActive, kitjwt.ErrTokenContextMissing, service.ErrTokenRevoked:
+		return true
+	default:
+		return false
+	}
+}
+
+// authenticated invokes the endpoint with a valid token, retrying once with a new token if the server rejects it
+func (c *Client) authenticated(ctx context.Context, e endpoint.Endpoint, request interface{}) (interface{}, error) {
+	token, err := c.validToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response, err := e(context.WithValue(ctx, kitjwt.JWTTokenContextKey, token), request)
+	if !isTokenError(err) || c.password == "" {
+		return response, err
+	}
+	if token, err = c.refreshToken(ctx, token); err != nil {
+		return nil, err
+	}
+	return e(context.WithValue(ctx, kitjwt.JWTTokenContextKey, token), request)
+}
+
+// CreateUser registers a new user on the remote instance
+func (c *Client) CreateUser(ctx context.Context, emailID, password string) error {
+	_, err := c.endpoints.CreateUserEndpoint(ctx, credentialsRequest{emailID, password})
+	return err
+}
+
+// GetToken returns a token for the given credentials, it does not change the token held by the client
+func (c *Client) GetToken(ctx context.Context, emailID, password string) (string, error) {
+	response, err := c.endpoints.GetTokenEndpoint(ctx, credentialsRequest{emailID, password})
+	if err != nil {
+		return "", err
+	}
+	return response.(getTokenResponse).TokenString, nil
+}
+
+// GetUser returns the user from the remote instance
+func (c *Client) GetUser(ctx context.Context, emailID string) (podcastmg.User, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetUserEndpoint, userRequest{emailID})
+	if err != nil {
+		return podcastmg.User{}, err
+	}
+	return response.(getUserResponse).User, nil
+}
+
+// GetPodcastDetails returns the podcast parsed by the remote instance from the feed url
+func (c *Client) GetPodcastDetails(ctx context.Context, url string) (podcastmg.Podcast, error) {
+	response, err := c.endpoints.GetPodcastDetailsEndpoint(ctx, podcastRequest{URL: url})
+	if err != nil {
+		return podcastmg.Podcast{}, err
+	}
+	return response.(getPodcastDetailsResponse).Podcast, nil
+}
+
+// Subscribe subscribes the user to the podcast feed
+func (c *Client) Subscribe(ctx context.Context, emailID, podcastURL string) error {
+	_, err := c.authenticated(ctx, c.endpoints.SubscribeEndpoint, podcastRequest{emailID, podcastURL})
+	return err
+}
+
+// Unsubscribe removes the podcast from the user's subscriptions
+func (c *Client) Unsubscribe(ctx context.Context, emailID, podcastURL string) error {
+	_, err := c.authenticated(ctx, c.endpoints.UnsubscribeEndpoint, podcastRequest{emailID, podcastURL})
+	return err
+}
+
+// UpdatePodcast asks the remote instance to check the subscribed feed for new items
+func (c *Client) UpdatePodcast(ctx context.Context, emailID, podcastURL string) error {
+	_, err := c.authenticated(ctx, c.endpoints.UpdatePodcastEndpoint, podcastRequest{emailID, podcastURL})
+	return err
+}
+
+// GetUserSubscriptions returns the podcasts that the user is subscribed to
+func (c *Client) GetUserSubscriptions(ctx context.Context, emailID string) ([]podcastmg.Podcast, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetUserSubscriptionsEndpoint, userRequest{emailID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(getUserSubscriptionsResponse).Subscriptions, nil
+}
+
+// GetSubscriptionDetails returns the subscribed podcast along with its items
+func (c *Client) GetSubscriptionDetails(ctx context.Context, emailID, podcastURL string) (podcastmg.Podcast, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetSubscriptionDetailsEndpoint, podcastRequest{emailID, podcastURL})
+	if err != nil {
+		return podcastmg.Podcast{}, err
+	}
+	return response.(getSubscriptionDetailsResponse).Podcast, nil
+}
+
+// ArchiveEpisode asks the remote instance to archive the media of an episode
+func (c *Client) ArchiveEpisode(ctx context.Context, emailID string, itemID uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.ArchiveEpisodeEndpoint, episodeRequest{emailID, itemID})
+	return err
+}
+
+// GetEpisodeMedia downloads the archived media of an episode, the returned Blob is held in memory
+func (c *Client) GetEpisodeMedia(ctx context.Context, emailID string, itemID uint) (archive.Blob, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetEpisodeMediaEndpoint, episodeRequest{emailID, itemID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(archive.Blob), nil
+}
+
+// Search finds podcasts and episodes in the user's subscriptions or the whole catalog
+func (c *Client) Search(ctx context.Context, emailID string, query podcastmg.SearchQuery) (podcastmg.SearchResults, error) {
+	request := searchRequest{emailID, query.Terms, query.Scope, query.Limit, query.Offset}
+	response, err := c.authenticated(ctx, c.endpoints.SearchEndpoint, request)
+	if err != nil {
+		return podcastmg.SearchResults{}, err
+	}
+	return response.(searchResponse).Results, nil
+}
+
+// Discover returns a directory list of the remote instance's catalog, podcastURL is only used by the related list
+func (c *Client) Discover(ctx context.Context, list, podcastURL string, limit int) ([]podcastmg.DirectoryEntry, error) {
+	response, err := c.endpoints.DiscoverEndpoint(ctx, discoverRequest{list, podcastURL, limit})
+	if err != nil {
+		return nil, err
+	}
+	return response.(discoverResponse).Podcasts, nil
+}
+
+// GetSubscriptionTotals returns the episode counts, durations and sizes of each of the user's subscriptions
+func (c *Client) GetSubscriptionTotals(ctx context.Context, emailID string) ([]podcastmg.SubscriptionTotals, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetSubscriptionTotalsEndpoint, userRequest{emailID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(getSubscriptionTotalsResponse).Totals, nil
+}
+
+// GetSubscriptionSettings returns the user's settings for a subscribed podcast
+func (c *Client) GetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) (podcastmg.SubscriptionSettings, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetSettingsEndpoint, podcastRequest{emailID, podcastURL})
+	if err != nil {
+		return podcastmg.SubscriptionSettings{}, err
+	}
+	return response.(settingsResponse).Settings, nil
+}
+
+// UpdateSubscriptionSettings replaces the user's settings for a subscribed podcast
+func (c *Client) UpdateSubscriptionSettings(ctx context.Context, emailID, podcastURL string, settings podcastmg.SubscriptionSettings) error {
+	_, err := c.authenticated(ctx, c.endpoints.UpdateSettingsEndpoint, settingsRequest{emailID, podcastURL, settings})
+	return err
+}
+
+// ResetSubscriptionSettings restores the default settings for a subscribed podcast
+func (c *Client) ResetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) error {
+	_, err := c.authenticated(ctx, c.endpoints.ResetSettingsEndpoint, podcastRequest{emailID, podcastURL})
+	return err
+}
+
+// CreateLabel creates a folder or tag for the user
+func (c *Client) CreateLabel(ctx context.Context, emailID, kind, name string) (podcastmg.Label, error) {
+	response, err := c.authenticated(ctx, c.endpoints.CreateLabelEndpoint, labelRequest{EmailID: emailID, Kind: kind, Name: name})
+	if err != nil {
+		return podcastmg.Label{}, err
+	}
+	return response.(labelResponse).Label, nil
+}
+
+// GetLabels returns the user's folders or tags in their order
+func (c *Client) GetLabels(ctx context.Context, emailID, kind string) ([]podcastmg.Label, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetLabelsEndpoint, labelRequest{EmailID: emailID, Kind: kind})
+	if err != nil {
+		return nil, err
+	}
+	return response.(getLabelsResponse).Labels, nil
+}
+
+// RenameLabel renames one of the user's folders or tags
+func (c *Client) RenameLabel(ctx context.Context, emailID string, labelID uint, name string) error {
+	_, err := c.authenticated(ctx, c.endpoints.RenameLabelEndpoint, labelRequest{EmailID: emailID, ID: labelID, Name: name})
+	return err
+}
+
+// ReorderLabels sets the order of the user's folders or tags, labelIDs must list each of them exactly once
+func (c *Client) ReorderLabels(ctx context.Context, emailID, kind string, labelIDs []uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.ReorderLabelsEndpoint, labelRequest{EmailID: emailID, Kind: kind, IDs: labelIDs})
+	return err
+}
+
+// DeleteLabel removes one of the user's folders or tags
+func (c *Client) DeleteLabel(ctx context.Context, emailID string, labelID uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.DeleteLabelEndpoint, labelRequest{EmailID: emailID, ID: labelID})
+	return err
+}
+
+// SetSubscriptionFolder moves a subscription into one of the user's folders, a folderID of 0 removes it from its folder
+func (c *Client) SetSubscriptionFolder(ctx context.Context, emailID, podcastURL string, folderID uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.SetFolderEndpoint, assignLabelsRequest{EmailID: emailID, URL: podcastURL, FolderID: folderID})
+	return err
+}
+
+// SetSubscriptionTags replaces the tags of a subscription
+func (c *Client) SetSubscriptionTags(ctx context.Context, emailID, podcastURL string, tagIDs []uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.SetTagsEndpoint, assignLabelsRequest{EmailID: emailID, URL: podcastURL, TagIDs: tagIDs})
+	return err
+}
+
+// FilterSubscriptions returns the user's subscriptions in the folder and with the tag, a zero id matches any
+func (c *Client) FilterSubscriptions(ctx context.Context, emailID string, folderID, tagID uint) ([]podcastmg.Podcast, error) {
+	response, err := c.authenticated(ctx, c.endpoints.FilterSubscriptionsEndpoint, filterSubscriptionsRequest{emailID, folderID, tagID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(getUserSubscriptionsResponse).Subscriptions, nil
+}
+
+// ExportOPML returns the user's subscriptions as an OPML document with an outline per folder
+func (c *Client) ExportOPML(ctx context.Context, emailID string) (podcastmg.OPML, error) {
+	response, err := c.authenticated(ctx, c.endpoints.ExportOPMLEndpoint, userRequest{emailID})
+	if err != nil {
+		return podcastmg.OPML{}, err
+	}
+	return response.(podcastmg.OPML), nil
+}
+
+// GetQueue returns the user's up-next queue of episodes
+func (c *Client) GetQueue(ctx context.Context, emailID string) (podcastmg.Queue, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetQueueEndpoint, userRequest{emailID})
+	if err != nil {
+		return podcastmg.Queue{}, err
+	}
+	return response.(queueResponse).Queue, nil
+}
+
+// UpdateQueue applies a change to the user's queue if it is still at the given version, otherwise
+// podcastmg.ErrQueueConflict is returned and the queue should be fetched again
+func (c *Client) UpdateQueue(ctx context.Context, emailID string, version int64, op podcastmg.QueueOp) (podcastmg.Queue, error) {
+	response, err := c.authenticated(ctx, c.endpoints.UpdateQueueEndpoint, updateQueueRequest{emailID, version, op})
+	if err != nil {
+		return podcastmg.Queue{}, err
+	}
+	return response.(queueResponse).Queue, nil
+}
+
+// CreatePlaylist creates a playlist for the user, the playlist is a smart playlist if it has rules
+func (c *Client) CreatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) (podcastmg.Playlist, error) {
+	response, err := c.authenticated(ctx, c.endpoints.CreatePlaylistEndpoint, playlistRequest{emailID, playlist})
+	if err != nil {
+		return podcastmg.Playlist{}, err
+	}
+	return response.(playlistResponse).Playlist, nil
+}
+
+// GetPlaylists returns the user's playlists without their episodes
+func (c *Client) GetPlaylists(ctx context.Context, emailID string) ([]podcastmg.Playlist, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetPlaylistsEndpoint, userRequest{emailID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(getPlaylistsResponse).Playlists, nil
+}
+
+// GetPlaylist returns one of the user's playlists along with its episodes
+func (c *Client) GetPlaylist(ctx context.Context, emailID string, playlistID uint) (podcastmg.Playlist, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetPlaylistEndpoint, playlistItemsRequest{EmailID: emailID, ID: playlistID})
+	if err != nil {
+		return podcastmg.Playlist{}, err
+	}
+	return response.(playlistResponse).Playlist, nil
+}
+
+// GetPlaylistFeed returns the playlist of a feed secret along with its episodes, it does not need a token of the client
+func (c *Client) GetPlaylistFeed(ctx context.Context, secret string) (podcastmg.Playlist, error) {
+	response, err := c.endpoints.GetPlaylistFeedEndpoint(ctx, playlistFeedRequest{secret})
+	if err != nil {
+		return podcastmg.Playlist{}, err
+	}
+	return response.(playlistResponse).Playlist, nil
+}
+
+// UpdatePlaylist saves the name and rules of one of the user's playlists
+func (c *Client) UpdatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) error {
+	_, err := c.authenticated(ctx, c.endpoints.UpdatePlaylistEndpoint, playlistRequest{emailID, playlist})
+	return err
+}
+
+// DeletePlaylist removes one of the user's playlists
+func (c *Client) DeletePlaylist(ctx context.Context, emailID string, playlistID uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.DeletePlaylistEndpoint, playlistItemsRequest{EmailID: emailID, ID: playlistID})
+	return err
+}
+
+// SetPlaylistItems replaces the episodes of one of the user's manual playlists
+func (c *Client) SetPlaylistItems(ctx context.Context, emailID string, playlistID uint, itemIDs []uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.SetPlaylistItemsEndpoint, playlistItemsRequest{emailID, playlistID, itemIDs})
+	return err
+}
+
+// CreateWebhook registers a url which receives signed notifications of new episodes, the returned webhook carries its secret
+func (c *Client) CreateWebhook(ctx context.Context, emailID, webhookURL string) (podcastmg.Webhook, error) {
+	response, err := c.authenticated(ctx, c.endpoints.CreateWebhookEndpoint, webhookRequest{EmailID: emailID, URL: webhookURL})
+	if err != nil {
+		return podcastmg.Webhook{}, err
+	}
+	return response.(webhookResponse).Webhook, nil
+}
+
+// GetWebhooks returns the user's webhooks without their secrets
+func (c *Client) GetWebhooks(ctx context.Context, emailID string) ([]podcastmg.Webhook, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetWebhooksEndpoint, webhookRequest{EmailID: emailID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(getWebhooksResponse).Webhooks, nil
+}
+
+// DeleteWebhook removes one of the user's webhooks
+func (c *Client) DeleteWebhook(ctx context.Context, emailID string, webhookID uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.DeleteWebhookEndpoint, webhookRequest{EmailID: emailID, ID: webhookID})
+	return err
+}
+
+// GetWebhookDeliveries returns the latest deliveries of one of the user's webhooks
+func (c *Client) GetWebhookDeliveries(ctx context.Context, emailID string, webhookID uint) ([]podcastmg.WebhookDelivery, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetWebhookDeliveriesEndpoint, webhookRequest{EmailID: emailID, ID: webhookID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(webhookDeliveriesResponse).Deliveries, nil
+}
+
+// RetryWebhookDelivery schedules a delivery for another round of attempts
+func (c *Client) RetryWebhookDelivery(ctx context.Context, emailID string, deliveryID uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.RetryWebhookDeliveryEndpoint, webhookRequest{EmailID: emailID, ID: deliveryID})
+	return err
+}
+
+// GetDigestSchedule returns the user's email digest preferences along with the next scheduled digest
+func (c *Client) GetDigestSchedule(ctx context.Context, emailID string) (podcastmg.DigestSchedule, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetDigestScheduleEndpoint, digestRequest{EmailID: emailID})
+	if err != nil {
+		return podcastmg.DigestSchedule{}, err
+	}
+	return response.(digestResponse).Digest, nil
+}
+
+// UpdateDigestSettings sets how often the user receives the email digest of new episodes
+func (c *Client) UpdateDigestSettings(ctx context.Context, emailID string, settings podcastmg.DigestSettings) (podcastmg.DigestSchedule, error) {
+	response, err := c.authenticated(ctx, c.endpoints.UpdateDigestSettingsEndpoint, digestRequest{emailID, settings})
+	if err != nil {
+		return podcastmg.DigestSchedule{}, err
+	}
+	return response.(digestResponse).Digest, nil
+}
+
+// UnsubscribeDigest turns off the digest of an unsubscribe link, it does not need a token of the client
+func (c *Client) UnsubscribeDigest(ctx context.Context, token string) error {
+	_, err := c.endpoints.UnsubscribeDigestEndpoint(ctx, unsubscribeDigestRequest{token})
+	return err
+}
+
+// VerifyHubIntent sends a hub's verification of a subscribe or unsubscribe request and returns the echoed challenge
+func (c *Client) VerifyHubIntent(ctx context.Context, subscriptionID uint, intent podcastmg.HubIntent, challenge string) (string, error) {
+	response, err := c.endpoints.VerifyHubIntentEndpoint(ctx, hubIntentRequest{subscriptionID, intent, challenge})
+	if err != nil {
+		return "", err
+	}
+	return response.(string), nil
+}
+
+// ReceiveHubContent pushes feed content to a hub subscription the way a hub does, signature is its X-Hub-Signature
+func (c *Client) ReceiveHubContent(ctx context.Context, subscriptionID uint, signature string, content []byte) error {
+	_, err := c.endpoints.ReceiveHubContentEndpoint(ctx, hubContentRequest{subscriptionID, signature, content})
+	return err
+}
+
+// StreamEvents returns the live events of the user's account. The stream ends when the context is done or the
+// server closes it, events missed in between should be caught up on with GetPlaybackStates and GetUserSubscriptions
+func (c *Client) StreamEvents(ctx context.Context, emailID string) (<-chan events.Event, error) {
+	response, err := c.authenticated(ctx, c.endpoints.StreamEventsEndpoint, userRequest{emailID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(chan events.Event), nil
+}
+
+// GetPlaybackStates returns the playback states of the user's episodes which changed after since
+func (c *Client) GetPlaybackStates(ctx context.Context, emailID string, since time.Time) ([]podcastmg.PlaybackState, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetPlaybackStatesEndpoint, playbackStatesRequest{emailID, since})
+	if err != nil {
+		return nil, err
+	}
+	return response.(playbackStatesResponse).States, nil
+}
+
+// UpdatePlaybackState saves the playback state of one of the user's episodes
+func (c *Client) UpdatePlaybackState(ctx context.Context, emailID string, state podcastmg.PlaybackState) (podcastmg.PlaybackState, error) {
+	response, err := c.authenticated(ctx, c.endpoints.UpdatePlaybackStateEndpoint, updatePlaybackRequest{emailID, state})
+	if err != nil {
+		return state, err
+	}
+	return response.(playbackResponse).State, nil
+}
+
+// GetDevices returns the user's devices syncing through the gpodder.net API
+func (c *Client) GetDevices(ctx context.Context, emailID string) ([]podcastmg.Device, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetDevicesEndpoint, userRequest{emailID})
+	if err != nil {
+		return nil, err
+	}
+	return response.([]podcastmg.Device), nil
+}
+
+// UpdateDevice registers one of the user's devices or changes its caption and type
+func (c *Client) UpdateDevice(ctx context.Context, emailID string, device podcastmg.Device) error {
+	_, err := c.authenticated(ctx, c.endpoints.UpdateDeviceEndpoint, deviceRequest{emailID, device})
+	return err
+}
+
+// GetSubscriptionChanges returns the podcasts the user subscribed to or unsubscribed from since the timestamp of
+// an earlier sync, zero returns all subscriptions
+func (c *Client) GetSubscriptionChanges(ctx context.Context, emailID, deviceID string, since int64) (podcastmg.SubscriptionChanges, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetSubscriptionChangesEndpoint, subscriptionChangesRequest{emailID, deviceID, since})
+	if err != nil {
+		return podcastmg.SubscriptionChanges{}, err
+	}
+	return response.(podcastmg.SubscriptionChanges), nil
+}
+
+// UploadSubscriptionChanges sends the subscriptions and unsubscriptions made on a device
+func (c *Client) UploadSubscriptionChanges(ctx context.Context, emailID, deviceID string, changes podcastmg.SubscriptionChanges) (podcastmg.SyncResult, error) {
+	response, err := c.authenticated(ctx, c.endpoints.UploadSubscriptionsEndpoint, uploadSubscriptionsRequest{emailID, deviceID, changes})
+	if err != nil {
+		return podcastmg.SyncResult{}, err
+	}
+	return response.(podcastmg.SyncResult), nil
+}
+
+// GetEpisodeActions returns the episode actions the user's devices uploaded since the query's time, which is sent
+// in whole seconds
+func (c *Client) GetEpisodeActions(ctx context.Context, emailID string, query podcastmg.EpisodeActionQuery) (podcastmg.EpisodeActions, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetEpisodeActionsEndpoint, episodeActionsRequest{emailID, query})
+	if err != nil {
+		return podcastmg.EpisodeActions{}, err
+	}
+	return response.(podcastmg.EpisodeActions), nil
+}
+
+// UploadEpisodeActions sends the episode actions of a device
+func (c *Client) UploadEpisodeActions(ctx context.Context, emailID string, actions []podcastmg.EpisodeAction) (podcastmg.SyncResult, error) {
+	response, err := c.authenticated(ctx, c.endpoints.UploadEpisodeActionsEndpoint, uploadEpisodeActionsRequest{emailID, actions})
+	if err != nil {
+		return podcastmg.SyncResult{}, err
+	}
+	return response.(podcastmg.SyncResult), nil
+}
+
+// Sync returns the changes of the user's account after the token of an earlier sync. An empty token returns the
+// token to start syncing from, it should be asked for before downloading all subscriptions
+func (c *Client) Sync(ctx context.Context, emailID, token string, limit int) (podcastmg.SyncDelta, error) {
+	response, err := c.authenticated(ctx, c.endpoints.SyncEndpoint, syncRequest{emailID, token, limit})
+	if err != nil {
+		return podcastmg.SyncDelta{}, err
+	}
+	return response.(syncResponse).SyncDelta, nil
+}
+
+// UploadChanges sends the changes a device made while it was offline and returns those which were applied
+func (c *Client) UploadChanges(ctx context.Context, emailID, device string, changes []podcastmg.Change) ([]podcastmg.Change, error) {
+	response, err := c.authenticated(ctx, c.endpoints.UploadChangesEndpoint, uploadChangesRequest{emailID, device, changes})
+	if err != nil {
+		return nil, err
+	}
+	return response.(uploadChangesResponse).Applied, nil
+}
+
+// RequestEmailVerification has the remote instance mail the user a new verification link
+func (c *Client) RequestEmailVerification(ctx context.Context, emailID string) error {
+	_, err := c.authenticated(ctx, c.endpoints.RequestVerificationEndpoint, userRequest{emailID})
+	return err
+}
+
+// VerifyEmail verifies the email of a verification link, it does not need a token of the client
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	_, err := c.endpoints.VerifyEmailEndpoint(ctx, verifyEmailRequest{token})
+	return err
+}
+
+// RequestPasswordReset has the remote instance mail a password reset link to the email, it does not need a token
+// of the client
+func (c *Client) RequestPasswordReset(ctx context.Context, emailID string) error {
+	_, err := c.endpoints.RequestPasswordResetEndpoint(ctx, userRequest{emailID})
+	return err
+}
+
+// ResetPassword sets the password of the user a password reset link was sent to, it does not need a token of the
+// client. The credentials of the client are not changed
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	_, err := c.endpoints.ResetPasswordEndpoint(ctx, resetPasswordRequest{token, password})
+	return err
+}
+
+// ChangePassword sets a new password for the user, the credentials of the client are changed along with it
+func (c *Client) ChangePassword(ctx context.Context, emailID, oldPassword, newPassword string) error {
+	_, err := c.authenticated(ctx, c.endpoints.ChangePasswordEndpoint, changePasswordRequest{emailID, oldPassword, newPassword})
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.emailID == emailID && c.password != "" {
+		c.password = newPassword
+	}
+	return nil
+}
+
+// RequestEmailChange has the remote instance mail a link to the new email which changes the user's email once
+// opened
+func (c *Client) RequestEmailChange(ctx context.Context, emailID, password, newEmail string) error {
+	_, err := c.authenticated(ctx, c.endpoints.RequestEmailChangeEndpoint, changeEmailRequest{emailID, password, newEmail})
+	return err
+}
+
+// ConfirmEmailChange changes the email of the user an email change link was sent to, it does not need a token of
+// the client. The credentials and token of the client are not changed, a client of the user has to log in with the
+// new email
+func (c *Client) ConfirmEmailChange(ctx context.Context, token string) error {
+	_, err := c.endpoints.ConfirmEmailChangeEndpoint(ctx, verifyEmailRequest{token})
+	return err
+}
+
+// ExportAccount returns all data the remote instance keeps for the user
+func (c *Client) ExportAccount(ctx context.Context, emailID string) (podcastmg.UserExport, error) {
+	response, err := c.authenticated(ctx, c.endpoints.ExportAccountEndpoint, userRequest{emailID})
+	if err != nil {
+		return podcastmg.UserExport{}, err
+	}
+	return response.(podcastmg.UserExport), nil
+}
+
+// DeleteAccount deletes the user along with all of their data, the client forgets its credentials and token of
+// the user
+func (c *Client) DeleteAccount(ctx context.Context, emailID, password string) error {
+	_, err := c.authenticated(ctx, c.endpoints.DeleteAccountEndpoint, credentialsRequest{emailID, password})
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.emailID == emailID {
+		c.emailID, c.password, c.token = "", "", ""
+	}
+	return nil
+}
+
+// CreateAccessToken creates a personal access token of the user, the returned token carries the token itself which
+// is not returned again
+func (c *Client) CreateAccessToken(ctx context.Context, emailID string, token podcastmg.AccessToken) (podcastmg.AccessToken, error) {
+	request := accessTokenRequest{EmailID: emailID, Name: token.Name, Scopes: token.Scopes, ExpiresAt: token.ExpiresAt}
+	response, err := c.authenticated(ctx, c.endpoints.CreateAccessTokenEndpoint, request)
+	if err != nil {
+		return podcastmg.AccessToken{}, err
+	}
+	return response.(accessTokenResponse).AccessToken, nil
+}
+
+// GetAccessTokens returns the user's personal access tokens without the tokens themselves
+func (c *Client) GetAccessTokens(ctx context.Context, emailID string) ([]podcastmg.AccessToken, error) {
+	response, err := c.authenticated(ctx, c.endpoints.GetAccessTokensEndpoint, accessTokenRequest{EmailID: emailID})
+	if err != nil {
+		return nil, err
+	}
+	return response.(getAccessTokensResponse).AccessTokens, nil
+}
+
+// RevokeAccessToken deletes one of the user's personal access tokens
+func (c *Client) RevokeAccessToken(ctx context.Context, emailID string, tokenID uint) error {
+	_, err := c.authenticated(ctx, c.endpoints.RevokeAccessTokenEndpoint, accessTokenRequest{EmailID: emailID, ID: tokenID})
+	return err
+}
+
+// CheckToken returns an error unless the token of the client is still accepted by the remote instance
+func (c *Client) CheckToken(ctx context.Context) error {
+	_, err := c.authenticated(ctx, c.endpoints.CheckTokenEndpoint, nil)
+	return err
+}
+
+// ExchangeAccessToken returns a short-lived token limited to the scopes of the personal access token, it does not
+// need a token of the client
+func (c *Client) ExchangeAccessToken(ctx context.Context, token string) (string, error) {
+	response, err := c.endpoints.ExchangeAccessTokenEndpoint(ctx, exchangeAccessTokenRequest{token})
+	if err != nil {
+		return "", err
+	}
+	return response.(getTokenResponse).TokenString, nil
+}
+
+// BeginOIDCLogin starts a login with the OpenID Connect provider of the remote instance, the user signs in at the
+// returned AuthURL. It does not need a token of the client
+func (c *Client) BeginOIDCLogin(ctx context.Context) (service.OIDCLogin, error) {
+	response, err := c.endpoints.BeginOIDCLoginEndpoint(ctx, nil)
+	if err != nil {
+		return service.OIDCLogin{}, err
+	}
+	return response.(oidcLoginResponse).OIDCLogin, nil
+}
+
+// CompleteOIDCLogin returns a token of the user once the provider sent them back with the state and code of the
+// login's session. The token is not kept by the client
+func (c *Client) CompleteOIDCLogin(ctx context.Context, session, state, code string) (string, error) {
+	response, err := c.endpoints.CompleteOIDCLoginEndpoint(ctx, completeOIDCLoginRequest{session, state, code})
+	if err != nil {
+		return "", err
+	}
+	return response.(getTokenResponse).TokenString, nil
+}
@@ -0,0 +1,1642 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/log"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/mail"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc/oidctest"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/ratelimit"
+	"github.com/tchaudhry91/podcast-manage-svc/service"
+	"github.com/tchaudhry91/podcast-manage-svc/signing"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSigningString = "client-test-secret"
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+	<title>Client Test Cast</title>
+	<description>A feed served to the client tests</description>
+	<image><url>http://example.com/cast.png</url></image>
+	<item>
+		<title>Episode 1</title>
+		<description>First</description>
+		<pubDate>Mon, 01 Jan 2018 10:00:00 GMT</pubDate>
+		<enclosure url="%[1]s/1.mp3" length="100" type="audio/mpeg"/>
+		<itunes:image href="http://example.com/1.png"/>
+	</item>
+	<item>
+		<title>Episode 2</title>
+		<description>Second</description>
+		<pubDate>Mon, 08 Jan 2018 10:00:00 GMT</pubDate>
+		<enclosure url="%[1]s/2.mp3" length="200" type="audio/mpeg"/>
+		<itunes:image href="http://example.com/2.png"/>
+	</item>
+</channel>
+</rss>`
+
+// testMedia returns the media served for an episode of the test feed
+func testMedia(episode int) []byte {
+	return bytes.Repeat([]byte{byte('0' + episode)}, episode*100)
+}
+
+// testMailer keeps the messages sent by the service
+type testMailer struct {
+	mtx      sync.Mutex
+	messages []mail.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// lastToken returns the recipient of the latest message and the token of the link in it
+func (m *testMailer) lastToken(t *testing.T) (string, string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if len(m.messages) == 0 {
+		t.Fatalf("No message was sent")
+	}
+	msg := m.messages[len(m.messages)-1]
+	match := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(msg.Text)
+	if match == nil {
+		t.Fatalf("No token in message:%s", msg.Text)
+	}
+	return msg.To, match[1]
+}
+
+func (m *testMailer) count() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return len(m.messages)
+}
+
+// testInstance is a podcast-manage-svc handler served over httptest along with a feed to subscribe to
+type testInstance struct {
+	server    *httptest.Server
+	feed      *httptest.Server
+	feedURL   string
+	dir       string
+	mailer    *testMailer
+	keys      *signing.KeySet
+	directory *service.Directory
+}
+
+// testKeys returns the keys of a test instance, signing with the test signing string like a service without keys
+func testKeys() *signing.KeySet {
+	keys, _ := signing.NewKeySet(signing.NewHMACKey("", []byte(testSigningString)))
+	return keys
+}
+
+// newTestInstance serves a service on a fresh database, passwords are hashed at the lowest bcrypt cost unless the
+// options set a hasher
+func newTestInstance(t *testing.T, options ...service.Option) *testInstance {
+	dir, err := ioutil.TempDir("", "pmg-client")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	blobs, err := archive.NewFSBlobStore(path.Join(dir, "media"))
+	if err != nil {
+		t.Fatalf("Could not create blob store:%v", err)
+	}
+	mailer := &testMailer{}
+	keys := testKeys()
+	directory := service.NewDirectory(podcastmg.NewDBStore("sqlite3", path.Join(dir, "client.db")), log.NewNopLogger(), time.Hour, time.Hour)
+	options = append([]service.Option{service.WithSigningKeys(keys), service.WithArchiver(archive.NewArchiver(blobs)), service.WithBroker(events.NewMemoryBroker(16)),
+		service.WithDirectory(directory),
+		service.WithMailer(mailer, "http://pmg.test"), service.WithPasswordHasher(podcastmg.BcryptHasher{Cost: bcrypt.MinCost})}, options...)
+	svc, err := service.NewSQLStorePodcastManageService("sqlite3", path.Join(dir, "client.db"), testSigningString, log.NewNopLogger(),
+		options...)
+	if err != nil {
+		t.Fatalf("Could not create service:%v", err)
+	}
+	var feed *httptest.Server
+	feed = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.mp3":
+			w.Write(testMedia(1))
+		case "/2.mp3":
+			w.Write(testMedia(2))
+		default:
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, testFeed, feed.URL)
+		}
+	}))
+	return &testInstance{
+		server:    httptest.NewServer(service.MakeHTTPHandler(svc, keys, log.NewNopLogger())),
+		feed:      feed,
+		feedURL:   feed.URL + "/feed.xml",
+		dir:       dir,
+		mailer:    mailer,
+		keys:      keys,
+		directory: directory,
+	}
+}
+
+func (ti *testInstance) Close() {
+	ti.server.Close()
+	ti.feed.Close()
+	os.RemoveAll(ti.dir)
+}
+
+func signTestToken(t *testing.T, claims service.TokenClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSigningString))
+	if err != nil {
+		t.Fatalf("Could not sign token:%v", err)
+	}
+	return token
+}
+
+// newTestClient registers the user on the instance and returns a client with the user's credentials
+func newTestClient(t *testing.T, ti *testInstance, email string) *Client {
+	c, err := New(ti.server.URL, WithCredentials(email, "client-pass"))
+	if err != nil {
+		t.Fatalf("Could not create client:%v", err)
+	}
+	if err = c.CreateUser(context.Background(), email, "client-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+	return c
+}
+
+// newSubscribedClient returns the client of newTestClient with the user subscribed to the instance's feed
+func newSubscribedClient(t *testing.T, ti *testInstance, email string) *Client {
+	c := newTestClient(t, ti, email)
+	if err := c.Subscribe(context.Background(), email, ti.feedURL); err != nil {
+		t.Fatalf("Failed to subscribe:%v", err)
+	}
+	return c
+}
+
+func TestClientUser(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newTestClient(t, ti, email)
+
+	t.Run("Podcast Details", func(t *testing.T) {
+		podcast, err := c.GetPodcastDetails(ctx, ti.feedURL)
+		if err != nil {
+			t.Fatalf("Failed to get podcast details:%v", err)
+		}
+		if podcast.Title != "Client Test Cast" || len(podcast.PodcastItems) != 2 {
+			t.Errorf("Unexpected podcast:%v", podcast)
+		}
+	})
+
+	t.Run("User", func(t *testing.T) {
+		user, err := c.GetUser(ctx, email)
+		if err != nil {
+			t.Fatalf("Failed to get user:%v", err)
+		}
+		if user.UserEmail != email {
+			t.Errorf("Email Want:%s\tHave:%s", email, user.UserEmail)
+		}
+		if c.Token() == "" {
+			t.Errorf("Client should hold a token after an authenticated call")
+		}
+	})
+
+	t.Run("Claim Mismatch", func(t *testing.T) {
+		if _, err := c.GetUser(ctx, "someone@else.com"); err != service.ErrInvalidClaim {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInvalidClaim, err)
+		}
+	})
+}
+
+func TestClientSubscriptions(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newTestClient(t, ti, email)
+
+	if err := c.Subscribe(ctx, email, ti.feedURL); err != nil {
+		t.Fatalf("Failed to subscribe:%v", err)
+	}
+	subscriptions, err := c.GetUserSubscriptions(ctx, email)
+	if err != nil {
+		t.Fatalf("Failed to get subscriptions:%v", err)
+	}
+	if len(subscriptions) != 1 || subscriptions[0].URL != ti.feedURL {
+		t.Errorf("Unexpected subscriptions:%v", subscriptions)
+	}
+	if err := c.UpdatePodcast(ctx, email, ti.feedURL); err != nil {
+		t.Errorf("Failed to update podcast:%v", err)
+	}
+	podcast, err := c.GetSubscriptionDetails(ctx, email, ti.feedURL)
+	if err != nil {
+		t.Fatalf("Failed to get subscription details:%v", err)
+	}
+	if len(podcast.PodcastItems) != 2 {
+		t.Errorf("Items Want:2\tHave:%d", len(podcast.PodcastItems))
+	}
+	totals, err := c.GetSubscriptionTotals(ctx, email)
+	if err != nil {
+		t.Fatalf("Failed to get subscription totals:%v", err)
+	}
+	if len(totals) != 1 || totals[0].Episodes != 2 || totals[0].Unplayed != 2 || totals[0].UnplayedSize != 300 {
+		t.Errorf("Unexpected totals:%+v", totals)
+	}
+
+	start, err := c.Sync(ctx, email, "", 0)
+	if err != nil {
+		t.Fatalf("Failed to start sync:%v", err)
+	}
+	if err = c.Unsubscribe(ctx, email, ti.feedURL); err != nil {
+		t.Fatalf("Failed to unsubscribe:%v", err)
+	}
+	if subscriptions, err = c.GetUserSubscriptions(ctx, email); err != nil || len(subscriptions) != 0 {
+		t.Errorf("Unexpected subscriptions after unsubscribing:%+v %v", subscriptions, err)
+	}
+	delta, err := c.Sync(ctx, email, start.Token, 0)
+	if err != nil || len(delta.Changes) != 1 || delta.Changes[0].Kind != podcastmg.ChangeUnsubscribed || delta.Changes[0].PodcastURL != ti.feedURL {
+		t.Errorf("Unexpected sync after unsubscribing:%+v %v", delta, err)
+	}
+	if err = c.Unsubscribe(ctx, email, ti.feedURL); err != nil {
+		t.Errorf("Failed to unsubscribe again:%v", err)
+	}
+	if next, err := c.Sync(ctx, email, delta.Token, 0); err != nil || len(next.Changes) != 0 {
+		t.Errorf("Repeated unsubscribe should not be recorded:%+v %v", next, err)
+	}
+}
+
+func TestClientEpisodeMedia(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	podcast, err := c.GetSubscriptionDetails(ctx, email, ti.feedURL)
+	if err != nil || len(podcast.PodcastItems) != 2 {
+		t.Fatalf("Failed to get subscription details:%v", err)
+	}
+	itemID := podcast.PodcastItems[1].ID
+	if _, err = c.GetEpisodeMedia(ctx, email, itemID); err != service.ErrMediaNotArchived {
+		t.Errorf("Want:%v\tHave:%v", service.ErrMediaNotArchived, err)
+	}
+	if err = c.ArchiveEpisode(ctx, email, itemID); err != nil {
+		t.Fatalf("Failed to archive episode:%v", err)
+	}
+	media, err := c.GetEpisodeMedia(ctx, email, itemID)
+	if err != nil {
+		t.Fatalf("Failed to get episode media:%v", err)
+	}
+	if data, _ := ioutil.ReadAll(media); !bytes.Equal(data, testMedia(2)) {
+		t.Errorf("Media does not match, have %d bytes", len(data))
+	}
+
+	// Range requests are answered with partial content
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/media/%s/%d", ti.server.URL, email, itemID), nil)
+	req.Header.Set("Authorization", "Bearer "+c.Token())
+	req.Header.Set("Range", "bytes=10-19")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Range request failed:%v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || len(data) != 10 {
+		t.Errorf("Range request Status:%d\tBytes:%d", resp.StatusCode, len(data))
+	}
+
+	if err = c.ArchiveEpisode(ctx, email, 9999); err != service.ErrEpisodeFetch {
+		t.Errorf("Want:%v\tHave:%v", service.ErrEpisodeFetch, err)
+	}
+}
+
+func TestClientSearch(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	results, err := c.Search(ctx, email, podcastmg.SearchQuery{Terms: "second"})
+	if err != nil {
+		t.Fatalf("Failed to search:%v", err)
+	}
+	if results.Total != 1 || results.Results[0].Title != "Episode 2" {
+		t.Errorf("Unexpected search results:%v", results)
+	}
+	if _, err = c.Search(ctx, email, podcastmg.SearchQuery{Terms: "second", Scope: "everything"}); err != service.ErrInvalidSearchScope {
+		t.Errorf("Want:%v\tHave:%v", service.ErrInvalidSearchScope, err)
+	}
+}
+
+func TestClientDiscover(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	if _, err := c.Discover(ctx, service.DirectoryPopular, "", 0); err != service.ErrDirectoryNotReady {
+		t.Errorf("Want:%v\tHave:%v", service.ErrDirectoryNotReady, err)
+	}
+	if err := ti.directory.Refresh(); err != nil {
+		t.Fatalf("Failed to refresh directory:%v", err)
+	}
+	for _, list := range []string{service.DirectoryPopular, service.DirectoryTrending, service.DirectoryRecent} {
+		podcasts, err := c.Discover(ctx, list, "", 0)
+		if err != nil {
+			t.Errorf("%s\tFailed to discover:%v", list, err)
+			continue
+		}
+		if len(podcasts) != 1 || podcasts[0].URL != ti.feedURL || podcasts[0].Subscribers != 1 {
+			t.Errorf("%s\tUnexpected podcasts:%v", list, podcasts)
+		}
+	}
+	if podcasts, err := c.Discover(ctx, service.DirectoryRelated, ti.feedURL, 0); err != nil || len(podcasts) != 0 {
+		t.Errorf("Unexpected related podcasts:%v %v", podcasts, err)
+	}
+	if _, err := c.Discover(ctx, service.DirectoryRelated, "", 0); err != service.ErrDirectoryURL {
+		t.Errorf("Want:%v\tHave:%v", service.ErrDirectoryURL, err)
+	}
+	if _, err := c.Discover(ctx, "everything", "", 0); err != service.ErrUnknownDirectory {
+		t.Errorf("Want:%v\tHave:%v", service.ErrUnknownDirectory, err)
+	}
+}
+
+func TestClientSettings(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	settings, err := c.GetSubscriptionSettings(ctx, email, ti.feedURL)
+	if err != nil || settings != podcastmg.DefaultSubscriptionSettings() {
+		t.Fatalf("Unexpected settings:%+v %v", settings, err)
+	}
+	settings.CustomTitle = "Renamed Cast"
+	settings.PlaybackSpeed = 1.25
+	if err = c.UpdateSubscriptionSettings(ctx, email, ti.feedURL, settings); err != nil {
+		t.Fatalf("Failed to update settings:%v", err)
+	}
+	subscriptions, _ := c.GetUserSubscriptions(ctx, email)
+	if len(subscriptions) != 1 || subscriptions[0].Settings == nil || *subscriptions[0].Settings != settings {
+		t.Errorf("Subscriptions should carry the updated settings:%+v", subscriptions)
+	}
+	settings.PlaybackSpeed = 10
+	if err = c.UpdateSubscriptionSettings(ctx, email, ti.feedURL, settings); err != podcastmg.ErrInvalidSettings {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidSettings, err)
+	}
+	if err = c.ResetSubscriptionSettings(ctx, email, ti.feedURL); err != nil {
+		t.Fatalf("Failed to reset settings:%v", err)
+	}
+	if settings, _ = c.GetSubscriptionSettings(ctx, email, ti.feedURL); settings != podcastmg.DefaultSubscriptionSettings() {
+		t.Errorf("Settings Want:%+v\tHave:%+v", podcastmg.DefaultSubscriptionSettings(), settings)
+	}
+	if _, err = c.GetSubscriptionSettings(ctx, email, "http://unknown.test/xml"); err != service.ErrSubscriptionFetch {
+		t.Errorf("Want:%v\tHave:%v", service.ErrSubscriptionFetch, err)
+	}
+}
+
+func TestClientLabels(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	folder, err := c.CreateLabel(ctx, email, podcastmg.LabelFolder, "Tech")
+	if err != nil {
+		t.Fatalf("Failed to create folder:%v", err)
+	}
+	if _, err = c.CreateLabel(ctx, email, podcastmg.LabelFolder, "tech"); err != podcastmg.ErrLabelExists {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrLabelExists, err)
+	}
+	tag, err := c.CreateLabel(ctx, email, podcastmg.LabelTag, "Favourites")
+	if err != nil {
+		t.Fatalf("Failed to create tag:%v", err)
+	}
+	if err = c.SetSubscriptionFolder(ctx, email, ti.feedURL, folder.ID); err != nil {
+		t.Fatalf("Failed to set folder:%v", err)
+	}
+	if err = c.SetSubscriptionTags(ctx, email, ti.feedURL, []uint{tag.ID}); err != nil {
+		t.Fatalf("Failed to set tags:%v", err)
+	}
+	if err = c.SetSubscriptionTags(ctx, email, ti.feedURL, []uint{folder.ID}); err != podcastmg.ErrLabelNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrLabelNotFound, err)
+	}
+	subscriptions, err := c.FilterSubscriptions(ctx, email, folder.ID, tag.ID)
+	if err != nil || len(subscriptions) != 1 || subscriptions[0].Folder == nil || subscriptions[0].Folder.Name != "Tech" {
+		t.Errorf("Unexpected filtered subscriptions:%+v %v", subscriptions, err)
+	}
+	if subscriptions, _ = c.FilterSubscriptions(ctx, email, 0, tag.ID+100); len(subscriptions) != 0 {
+		t.Errorf("Unknown tag should match nothing:%+v", subscriptions)
+	}
+
+	opml, err := c.ExportOPML(ctx, email)
+	if err != nil {
+		t.Fatalf("Failed to export opml:%v", err)
+	}
+	if urls := opml.FeedURLs(); len(urls) != 1 || urls[0] != ti.feedURL {
+		t.Errorf("Unexpected opml feeds:%v", urls)
+	}
+	if len(opml.Body.Outlines) != 1 || opml.Body.Outlines[0].Text != "Tech" {
+		t.Errorf("Feed should be nested in its folder:%+v", opml.Body.Outlines)
+	}
+
+	if err = c.DeleteLabel(ctx, email, folder.ID); err != nil {
+		t.Fatalf("Failed to delete folder:%v", err)
+	}
+	if subscriptions, _ = c.FilterSubscriptions(ctx, email, 0, 0); len(subscriptions) != 1 || subscriptions[0].Folder != nil {
+		t.Errorf("Subscription should be kept out of any folder:%+v", subscriptions)
+	}
+	if err = c.RenameLabel(ctx, email, folder.ID, "Gone"); err != podcastmg.ErrLabelNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrLabelNotFound, err)
+	}
+}
+
+func TestClientQueue(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	podcast, err := c.GetSubscriptionDetails(ctx, email, ti.feedURL)
+	if err != nil || len(podcast.PodcastItems) != 2 {
+		t.Fatalf("Failed to get subscription details:%v", err)
+	}
+	first, second := podcast.PodcastItems[0].ID, podcast.PodcastItems[1].ID
+	queue, err := c.GetQueue(ctx, email)
+	if err != nil || len(queue.Entries) != 0 {
+		t.Fatalf("Unexpected queue:%+v %v", queue, err)
+	}
+	if queue, err = c.UpdateQueue(ctx, email, queue.Version, podcastmg.QueueOp{Action: podcastmg.QueueAdd, ItemID: first}); err != nil {
+		t.Fatalf("Failed to add to queue:%v", err)
+	}
+	stale := queue.Version
+	if queue, err = c.UpdateQueue(ctx, email, queue.Version, podcastmg.QueueOp{Action: podcastmg.QueuePlayNext, ItemID: second}); err != nil {
+		t.Fatalf("Failed to play next:%v", err)
+	}
+	if len(queue.Entries) != 2 || queue.Entries[0].PodcastItemID != second || queue.Entries[0].Item == nil {
+		t.Errorf("Unexpected queue:%+v", queue)
+	}
+	if _, err = c.UpdateQueue(ctx, email, stale, podcastmg.QueueOp{Action: podcastmg.QueueClear}); err != podcastmg.ErrQueueConflict {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrQueueConflict, err)
+	}
+	if _, err = c.UpdateQueue(ctx, email, queue.Version, podcastmg.QueueOp{Action: podcastmg.QueueAdd, ItemID: 9999}); err != service.ErrEpisodeFetch {
+		t.Errorf("Want:%v\tHave:%v", service.ErrEpisodeFetch, err)
+	}
+	if _, err = c.UpdateQueue(ctx, email, queue.Version, podcastmg.QueueOp{Action: podcastmg.QueueClear}); err != nil {
+		t.Errorf("Failed to clear queue:%v", err)
+	}
+}
+
+func TestClientPlaylists(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	smart, err := c.CreatePlaylist(ctx, email, podcastmg.Playlist{Name: "Unplayed", Rules: &podcastmg.PlaylistRules{Unplayed: true, Order: podcastmg.SortOldest}})
+	if err != nil || smart.Kind != podcastmg.PlaylistSmart {
+		t.Fatalf("Failed to create playlist:%+v %v", smart, err)
+	}
+	if smart, err = c.GetPlaylist(ctx, email, smart.ID); err != nil || len(smart.Items) != 2 || smart.Items[0].Title != "Episode 1" {
+		t.Errorf("Unexpected playlist:%+v %v", smart, err)
+	}
+	if _, err = c.CreatePlaylist(ctx, email, podcastmg.Playlist{Name: "x", Rules: &podcastmg.PlaylistRules{Order: "random"}}); err != podcastmg.ErrInvalidRules {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidRules, err)
+	}
+
+	manual, err := c.CreatePlaylist(ctx, email, podcastmg.Playlist{Name: "Picks"})
+	if err != nil {
+		t.Fatalf("Failed to create playlist:%v", err)
+	}
+	if err = c.SetPlaylistItems(ctx, email, manual.ID, []uint{smart.Items[1].ID}); err != nil {
+		t.Fatalf("Failed to set playlist items:%v", err)
+	}
+	if playlists, err := c.GetPlaylists(ctx, email); err != nil || len(playlists) != 2 {
+		t.Errorf("Unexpected playlists:%+v %v", playlists, err)
+	}
+
+	if manual.FeedSecret == "" {
+		t.Fatalf("Playlist created without a feed secret")
+	}
+	if feed, err := c.GetPlaylistFeed(ctx, manual.FeedSecret); err != nil || feed.ID != manual.ID || len(feed.Items) != 1 {
+		t.Errorf("Unexpected playlist feed:%+v %v", feed, err)
+	}
+	if _, err := c.GetPlaylistFeed(ctx, "unknown"); err != podcastmg.ErrPlaylistNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrPlaylistNotFound, err)
+	}
+
+	// Feeds are fetched by podcast apps without the bearer token
+	get := func(format string) (int, string) {
+		resp, err := http.Get(fmt.Sprintf("%s/playlist/feed/%s/%s", ti.server.URL, manual.FeedSecret, format))
+		if err != nil {
+			t.Fatalf("Playlist request failed:%v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+	if status, body := get("rss"); status != http.StatusOK || !strings.Contains(body, "<title>Client Test Cast: Episode 2</title>") {
+		t.Errorf("Unexpected rss Status:%d\n%s", status, body)
+	}
+	if status, body := get("m3u"); status != http.StatusOK || !strings.HasPrefix(body, "#EXTM3U\n#PLAYLIST:Picks\n") || !strings.Contains(body, "Episode 2") {
+		t.Errorf("Unexpected m3u Status:%d\n%s", status, body)
+	}
+
+	if err = c.DeletePlaylist(ctx, email, manual.ID); err != nil {
+		t.Fatalf("Failed to delete playlist:%v", err)
+	}
+	if _, err = c.GetPlaylist(ctx, email, manual.ID); err != podcastmg.ErrPlaylistNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrPlaylistNotFound, err)
+	}
+	if status, _ := get("rss"); status != http.StatusNotFound {
+		t.Errorf("Feed of deleted playlist Status:%d", status)
+	}
+}
+
+func TestClientWebhooks(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	if _, err := c.CreateWebhook(ctx, email, "ftp://hooks.test"); err != podcastmg.ErrInvalidWebhook {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidWebhook, err)
+	}
+	for _, webhookURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://10.1.2.3/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[fd00:ec2::254]/hook",
+		"http://100.64.0.1/hook",
+		"http://localhost/hook",
+		"https://hooks.test/unresolvable",
+	} {
+		if _, err := c.CreateWebhook(ctx, email, webhookURL); err != podcastmg.ErrWebhookAddress {
+			t.Errorf("%s\tWant:%v\tHave:%v", webhookURL, podcastmg.ErrWebhookAddress, err)
+		}
+	}
+	webhook, err := c.CreateWebhook(ctx, email, "https://203.0.113.10/new")
+	if err != nil || webhook.Secret == "" {
+		t.Fatalf("Failed to create webhook:%+v %v", webhook, err)
+	}
+	webhooks, err := c.GetWebhooks(ctx, email)
+	if err != nil || len(webhooks) != 1 || webhooks[0].URL != webhook.URL || webhooks[0].Secret != "" {
+		t.Errorf("Unexpected webhooks:%+v %v", webhooks, err)
+	}
+	if deliveries, err := c.GetWebhookDeliveries(ctx, email, webhook.ID); err != nil || len(deliveries) != 0 {
+		t.Errorf("Unexpected deliveries:%+v %v", deliveries, err)
+	}
+	if err = c.RetryWebhookDelivery(ctx, email, 9999); err != podcastmg.ErrWebhookNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrWebhookNotFound, err)
+	}
+	if err = c.DeleteWebhook(ctx, email, webhook.ID); err != nil {
+		t.Fatalf("Failed to delete webhook:%v", err)
+	}
+	if _, err = c.GetWebhookDeliveries(ctx, email, webhook.ID); err != podcastmg.ErrWebhookNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrWebhookNotFound, err)
+	}
+}
+
+func TestClientDigest(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	schedule, err := c.GetDigestSchedule(ctx, email)
+	if err != nil || schedule.Frequency != podcastmg.DigestOff || schedule.NextAt != nil {
+		t.Fatalf("Unexpected default digest:%+v %v", schedule, err)
+	}
+	if _, err = c.UpdateDigestSettings(ctx, email, podcastmg.DigestSettings{Frequency: "hourly"}); err != podcastmg.ErrInvalidDigestSettings {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidDigestSettings, err)
+	}
+	settings := podcastmg.DigestSettings{Frequency: podcastmg.DigestWeekly, Hour: 7, Weekday: time.Monday}
+	if schedule, err = c.UpdateDigestSettings(ctx, email, settings); err != nil || schedule.DigestSettings != settings {
+		t.Fatalf("Failed to update digest:%+v %v", schedule, err)
+	}
+	if schedule.NextAt == nil || schedule.NextAt.Weekday() != time.Monday || schedule.NextAt.Hour() != 7 {
+		t.Errorf("Unexpected next digest:%v", schedule.NextAt)
+	}
+	if err = c.UnsubscribeDigest(ctx, "unknown"); err != podcastmg.ErrDigestNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrDigestNotFound, err)
+	}
+}
+
+func TestClientHubCallbacks(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	intent := podcastmg.HubIntent{Mode: podcastmg.HubModeSubscribe, Topic: ti.feedURL, LeaseSeconds: 3600}
+	if _, err := c.VerifyHubIntent(ctx, 9999, intent, "challenge"); err != podcastmg.ErrHubSubscriptionNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrHubSubscriptionNotFound, err)
+	}
+	if err := c.ReceiveHubContent(ctx, 9999, "sha256=00", []byte("<rss/>")); err != podcastmg.ErrHubSubscriptionNotFound {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrHubSubscriptionNotFound, err)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.StreamEvents(streamCtx, email)
+	if err != nil {
+		t.Fatalf("Failed to open event stream:%v", err)
+	}
+	receive := func(eventType string) events.Event {
+		select {
+		case event := <-stream:
+			if event.Type != eventType {
+				t.Fatalf("Event Want:%s\tHave:%+v", eventType, event)
+			}
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No %s event received", eventType)
+		}
+		return events.Event{}
+	}
+
+	if err = c.ResetSubscriptionSettings(ctx, email, ti.feedURL); err != nil {
+		t.Fatalf("Failed to reset settings:%v", err)
+	}
+	if event := receive(events.TypeSubscriptions); !strings.Contains(string(event.Data), `"action":"settings"`) {
+		t.Errorf("Unexpected subscription event:%s", event.Data)
+	}
+	otherURL := ti.feed.URL + "/other.xml"
+	if err = c.Subscribe(ctx, email, otherURL); err != nil {
+		t.Fatalf("Failed to subscribe:%v", err)
+	}
+	if event := receive(events.TypeSubscriptions); !strings.Contains(string(event.Data), `"action":"subscribed"`) {
+		t.Errorf("Unexpected subscription event:%s", event.Data)
+	}
+	if err = c.Unsubscribe(ctx, email, otherURL); err != nil {
+		t.Fatalf("Failed to unsubscribe:%v", err)
+	}
+	if event := receive(events.TypeSubscriptions); !strings.Contains(string(event.Data), `"action":"unsubscribed"`) {
+		t.Errorf("Unexpected subscription event:%s", event.Data)
+	}
+
+	podcast, err := c.GetSubscriptionDetails(ctx, email, ti.feedURL)
+	if err != nil || len(podcast.PodcastItems) != 2 {
+		t.Fatalf("Failed to get subscription details:%v", err)
+	}
+	state := podcastmg.PlaybackState{PodcastItemID: podcast.PodcastItems[0].ID, Position: 42, Device: "phone"}
+	if state, err = c.UpdatePlaybackState(ctx, email, state); err != nil || state.UpdatedAt.IsZero() {
+		t.Fatalf("Failed to update playback state:%+v %v", state, err)
+	}
+	if event := receive(events.TypePlayback); !strings.Contains(string(event.Data), `"position":42`) {
+		t.Errorf("Unexpected playback event:%s", event.Data)
+	}
+	state.Position = -1
+	if _, err = c.UpdatePlaybackState(ctx, email, state); err != podcastmg.ErrInvalidPlayback {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidPlayback, err)
+	}
+	states, err := c.GetPlaybackStates(ctx, email, time.Time{})
+	if err != nil || len(states) != 1 || states[0].Position != 42 || states[0].Device != "phone" {
+		t.Errorf("Unexpected playback states:%+v %v", states, err)
+	}
+	if _, err = c.StreamEvents(ctx, "other@test.com"); err != service.ErrInvalidClaim {
+		t.Errorf("Want:%v\tHave:%v", service.ErrInvalidClaim, err)
+	}
+}
+
+func TestClientGpodder(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	if err := c.UpdateDevice(ctx, email, podcastmg.Device{DeviceID: "phone", Caption: "Phone", Type: "mobile"}); err != nil {
+		t.Fatalf("Failed to update device:%v", err)
+	}
+	if err := c.UpdateDevice(ctx, email, podcastmg.Device{DeviceID: "phone", Type: "toaster"}); err != podcastmg.ErrInvalidDevice {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidDevice, err)
+	}
+	devices, err := c.GetDevices(ctx, email)
+	if err != nil || len(devices) != 1 || devices[0].Caption != "Phone" || devices[0].Subscriptions != 1 {
+		t.Errorf("Unexpected devices:%+v %v", devices, err)
+	}
+
+	changes, err := c.GetSubscriptionChanges(ctx, email, "phone", 0)
+	if err != nil || len(changes.Add) != 1 || changes.Add[0] != ti.feedURL || changes.Timestamp == 0 {
+		t.Fatalf("Unexpected subscription changes:%+v %v", changes, err)
+	}
+	since := changes.Timestamp
+	copyURL := ti.feedURL + "?copy"
+	result, err := c.UploadSubscriptionChanges(ctx, email, "laptop", podcastmg.SubscriptionChanges{Add: []string{" " + copyURL, "ftp://cast.test/rss"}})
+	if err != nil || len(result.UpdateURLs) != 2 || result.UpdateURLs[0][1] != copyURL || result.UpdateURLs[1][1] != "" {
+		t.Fatalf("Unexpected sync result:%+v %v", result, err)
+	}
+	// Timestamps are in whole seconds, changes of the second of since may be repeated
+	if changes, err = c.GetSubscriptionChanges(ctx, email, "phone", since); err != nil || len(changes.Add) == 0 || changes.Add[len(changes.Add)-1] != copyURL {
+		t.Errorf("Unexpected subscription changes:%+v %v", changes, err)
+	}
+	if _, err = c.UploadSubscriptionChanges(ctx, email, "laptop", podcastmg.SubscriptionChanges{Remove: []string{copyURL}}); err != nil {
+		t.Fatalf("Failed to upload subscription changes:%v", err)
+	}
+	if changes, err = c.GetSubscriptionChanges(ctx, email, "phone", since); err != nil || len(changes.Remove) != 1 || changes.Remove[0] != copyURL {
+		t.Errorf("Unexpected subscription changes:%+v %v", changes, err)
+	}
+	conflict := podcastmg.SubscriptionChanges{Add: []string{copyURL}, Remove: []string{copyURL}}
+	if _, err = c.UploadSubscriptionChanges(ctx, email, "laptop", conflict); err != podcastmg.ErrInvalidSubscriptionChange {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidSubscriptionChange, err)
+	}
+
+	position := int64(75)
+	actions := []podcastmg.EpisodeAction{{Podcast: ti.feedURL, Episode: ti.feed.URL + "/2.mp3", Device: "laptop",
+		Action: podcastmg.ActionPlay, Timestamp: time.Now(), Position: &position}}
+	if _, err = c.UploadEpisodeActions(ctx, email, actions); err != nil {
+		t.Fatalf("Failed to upload episode actions:%v", err)
+	}
+	uploaded, err := c.GetEpisodeActions(ctx, email, podcastmg.EpisodeActionQuery{Device: "laptop", Aggregated: true})
+	if err != nil || len(uploaded.Actions) != 1 || *uploaded.Actions[0].Position != 75 || uploaded.Timestamp == 0 {
+		t.Errorf("Unexpected episode actions:%+v %v", uploaded, err)
+	}
+	states, err := c.GetPlaybackStates(ctx, email, time.Time{})
+	if err != nil || len(states) != 1 || states[0].Position != 75 || states[0].Device != "laptop" {
+		t.Errorf("Unexpected playback states:%+v %v", states, err)
+	}
+
+	// gpodder clients authenticate with basic auth or the cookie of a login
+	devicesURL := ti.server.URL + "/api/2/devices/" + email + ".json"
+	req, _ := http.NewRequest("GET", devicesURL, nil)
+	req.SetBasicAuth(email, "wrong")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Wrong password was not rejected:%v %v", resp, err)
+	}
+	req, _ = http.NewRequest("POST", ti.server.URL+"/api/2/auth/"+email+"/login.json", nil)
+	req.SetBasicAuth(email, "client-pass")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK || len(resp.Cookies()) != 1 {
+		t.Fatalf("Failed to log in:%v %v", resp, err)
+	}
+	if cookie := resp.Cookies()[0]; cookie.SameSite != http.SameSiteStrictMode || cookie.Secure || !cookie.HttpOnly {
+		t.Errorf("Unexpected session cookie:%+v", cookie)
+	}
+	tlsServer := httptest.NewTLSServer(ti.server.Config.Handler)
+	defer tlsServer.Close()
+	tlsReq, _ := http.NewRequest("POST", tlsServer.URL+"/api/2/auth/"+email+"/login.json", nil)
+	tlsReq.SetBasicAuth(email, "client-pass")
+	if tlsResp, err := tlsServer.Client().Do(tlsReq); err != nil || len(tlsResp.Cookies()) != 1 || !tlsResp.Cookies()[0].Secure {
+		t.Errorf("Session cookie of a TLS login is not secure:%v %v", tlsResp, err)
+	}
+	req, _ = http.NewRequest("GET", devicesURL, nil)
+	req.AddCookie(resp.Cookies()[0])
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Session cookie was not accepted:%v %v", resp, err)
+	}
+}
+
+func TestClientSync(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "client@test.com"
+	c := newSubscribedClient(t, ti, email)
+
+	start, err := c.Sync(ctx, email, "", 0)
+	if err != nil || start.Token == "" || len(start.Changes) != 0 {
+		t.Fatalf("Unexpected start of sync:%+v %v", start, err)
+	}
+	podcast, err := c.GetSubscriptionDetails(ctx, email, ti.feedURL)
+	if err != nil || len(podcast.PodcastItems) != 2 {
+		t.Fatalf("Failed to get subscription details:%v", err)
+	}
+	items := podcast.PodcastItems
+	if _, err = c.UpdatePlaybackState(ctx, email, podcastmg.PlaybackState{PodcastItemID: items[0].ID, Position: 10}); err != nil {
+		t.Fatalf("Failed to update playback state:%v", err)
+	}
+	delta, err := c.Sync(ctx, email, start.Token, 0)
+	if err != nil || len(delta.Changes) != 1 || delta.Changes[0].Kind != podcastmg.ChangeEpisodeState || *delta.Changes[0].Position != 10 {
+		t.Fatalf("Unexpected sync:%+v %v", delta, err)
+	}
+
+	stale, played := int64(1), true
+	changes := []podcastmg.Change{
+		{Kind: podcastmg.ChangeEpisodeState, PodcastItemID: &items[0].ID, Position: &stale, ChangedAt: time.Now().Add(-time.Hour)},
+		{Kind: podcastmg.ChangeEpisodeState, PodcastItemID: &items[1].ID, Played: &played, ChangedAt: time.Now()},
+	}
+	applied, err := c.UploadChanges(ctx, email, "tablet", changes)
+	if err != nil || len(applied) != 1 || *applied[0].PodcastItemID != items[1].ID || applied[0].Device != "tablet" {
+		t.Fatalf("Unexpected applied changes:%+v %v", applied, err)
+	}
+	if next, err := c.Sync(ctx, email, delta.Token, 0); err != nil || len(next.Changes) != 1 || next.Changes[0].Seq != applied[0].Seq {
+		t.Errorf("Unexpected sync:%+v %v", next, err)
+	}
+	if _, err = c.Sync(ctx, email, "yesterday", 0); err != podcastmg.ErrInvalidSyncToken {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidSyncToken, err)
+	}
+	invalid := []podcastmg.Change{{Kind: podcastmg.ChangeSubscribed, PodcastURL: "ftp://cast.test/rss"}}
+	if _, err = c.UploadChanges(ctx, email, "tablet", invalid); err != podcastmg.ErrInvalidChange {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidChange, err)
+	}
+}
+
+func TestClientAccount(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "account@test.com"
+
+	c, err := New(ti.server.URL, WithCredentials(email, "account-pass"))
+	if err != nil {
+		t.Fatalf("Could not create client:%v", err)
+	}
+	if err = c.CreateUser(ctx, "not an email", "account-pass"); err != podcastmg.ErrInvalidEmail {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidEmail, err)
+	}
+	if err = c.CreateUser(ctx, email, "account-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+
+	t.Run("Verify Email", func(t *testing.T) {
+		to, token := ti.mailer.lastToken(t)
+		if to != email {
+			t.Errorf("Recipient Want:%s\tHave:%s", email, to)
+		}
+		if user, err := c.GetUser(ctx, email); err != nil || user.EmailVerified {
+			t.Errorf("Email should not be verified yet:%+v %v", user, err)
+		}
+		if err := c.VerifyEmail(ctx, "unknown"); err != podcastmg.ErrInvalidAccountToken {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidAccountToken, err)
+		}
+		if err := c.VerifyEmail(ctx, token); err != nil {
+			t.Fatalf("Failed to verify email:%v", err)
+		}
+		if user, err := c.GetUser(ctx, email); err != nil || !user.EmailVerified {
+			t.Errorf("Email was not verified:%+v %v", user, err)
+		}
+		if err := c.RequestEmailVerification(ctx, email); err != service.ErrEmailVerified {
+			t.Errorf("Want:%v\tHave:%v", service.ErrEmailVerified, err)
+		}
+	})
+
+	t.Run("Reset Password", func(t *testing.T) {
+		sent := ti.mailer.count()
+		if err := c.RequestPasswordReset(ctx, "nobody@test.com"); err != nil || ti.mailer.count() != sent {
+			t.Errorf("Unknown email should succeed without mail:%v", err)
+		}
+		if err := c.RequestPasswordReset(ctx, email); err != nil {
+			t.Fatalf("Failed to request password reset:%v", err)
+		}
+		_, token := ti.mailer.lastToken(t)
+		resp, err := http.Get(ti.server.URL + service.ResetPasswordPath + "?token=" + token)
+		if err != nil {
+			t.Fatalf("Failed to get reset form:%v", err)
+		}
+		form, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(form), `value="`+token+`"`) {
+			t.Errorf("Reset form does not carry the token:%s", form)
+		}
+		if err = c.ResetPassword(ctx, token, ""); err != podcastmg.ErrEmptyPassword {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrEmptyPassword, err)
+		}
+		if err = c.ResetPassword(ctx, token, "reset-pass"); err != nil {
+			t.Fatalf("Failed to reset password:%v", err)
+		}
+		if err = c.ResetPassword(ctx, token, "again-pass"); err != podcastmg.ErrInvalidAccountToken {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidAccountToken, err)
+		}
+		if _, err = c.GetToken(ctx, email, "reset-pass"); err != nil {
+			t.Errorf("Failed to log in with the new password:%v", err)
+		}
+	})
+
+	t.Run("Change Password", func(t *testing.T) {
+		rc, _ := New(ti.server.URL, WithCredentials(email, "reset-pass"))
+		if err := rc.ChangePassword(ctx, email, "wrong", "changed-pass"); err != service.ErrInvalidPassword {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInvalidPassword, err)
+		}
+		if err := rc.RequestPasswordReset(ctx, email); err != nil {
+			t.Fatalf("Failed to request password reset:%v", err)
+		}
+		_, pending := ti.mailer.lastToken(t)
+		issued := signTestToken(t, service.TokenClaims{
+			EmailID: email,
+			StandardClaims: jwt.StandardClaims{
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				IssuedAt:  time.Now().Add(-time.Minute).Unix(),
+			},
+		})
+		script, err := rc.CreateAccessToken(ctx, email, podcastmg.AccessToken{Name: "script", Scopes: podcastmg.Scopes{podcastmg.ScopeRead}})
+		if err != nil {
+			t.Fatalf("Failed to create access token:%v", err)
+		}
+		if err := rc.ChangePassword(ctx, email, "reset-pass", "changed-pass"); err != nil {
+			t.Fatalf("Failed to change password:%v", err)
+		}
+		if err := rc.ResetPassword(ctx, pending, "stolen-pass"); err != podcastmg.ErrInvalidAccountToken {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidAccountToken, err)
+		}
+
+		// Whoever held a token or an access token from before the change is logged out
+		tc, _ := New(ti.server.URL, WithToken(issued))
+		if err := tc.CheckToken(ctx); err != service.ErrTokenRevoked {
+			t.Errorf("Want:%v\tHave:%v", service.ErrTokenRevoked, err)
+		}
+		if _, err := tc.GetUser(ctx, email); err != service.ErrTokenRevoked {
+			t.Errorf("Want:%v\tHave:%v", service.ErrTokenRevoked, err)
+		}
+		if _, err := rc.ExchangeAccessToken(ctx, script.Token); err != podcastmg.ErrInvalidAccessToken {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidAccessToken, err)
+		}
+		if err := rc.Login(ctx); err != nil {
+			t.Errorf("Client did not keep the changed password:%v", err)
+		}
+		if err := rc.CheckToken(ctx); err != nil {
+			t.Errorf("Token issued after the change was refused:%v", err)
+		}
+	})
+
+	moved := "moved@test.com"
+	t.Run("Change Email", func(t *testing.T) {
+		rc, _ := New(ti.server.URL, WithCredentials(email, "changed-pass"))
+		if err := rc.RequestEmailChange(ctx, email, "wrong", moved); err != service.ErrInvalidPassword {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInvalidPassword, err)
+		}
+		if err := rc.RequestEmailChange(ctx, email, "changed-pass", "not an email"); err != podcastmg.ErrInvalidEmail {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidEmail, err)
+		}
+		if err := rc.RequestEmailChange(ctx, email, "changed-pass", moved); err != nil {
+			t.Fatalf("Failed to request email change:%v", err)
+		}
+		to, token := ti.mailer.lastToken(t)
+		if to != moved {
+			t.Errorf("Recipient Want:%s\tHave:%s", moved, to)
+		}
+		previous := rc.Token()
+		if err := rc.ConfirmEmailChange(ctx, token); err != nil {
+			t.Fatalf("Failed to confirm email change:%v", err)
+		}
+
+		// The previous email is free again, tokens issued for it must not pass for its new owner
+		if err := c.CreateUser(ctx, email, "new-owner-pass"); err != nil {
+			t.Fatalf("Failed to register the previous email:%v", err)
+		}
+		pc, _ := New(ti.server.URL, WithToken(previous))
+		if _, err := pc.GetUser(ctx, email); err != service.ErrTokenRevoked {
+			t.Errorf("Want:%v\tHave:%v", service.ErrTokenRevoked, err)
+		}
+		if err := rc.ConfirmEmailChange(ctx, token); err != podcastmg.ErrInvalidAccountToken {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidAccountToken, err)
+		}
+		if _, err := rc.GetToken(ctx, email, "changed-pass"); err != service.ErrInvalidPassword {
+			t.Errorf("Logged in with the previous email:%v", err)
+		}
+		mc, _ := New(ti.server.URL, WithCredentials(moved, "changed-pass"))
+		if user, err := mc.GetUser(ctx, moved); err != nil || !user.EmailVerified {
+			t.Errorf("Changed email was not verified:%+v %v", user, err)
+		}
+	})
+
+	t.Run("Export And Delete Account", func(t *testing.T) {
+		mc, _ := New(ti.server.URL, WithCredentials(moved, "changed-pass"))
+		export, err := mc.ExportAccount(ctx, moved)
+		if err != nil || export.Profile.Email != moved || !export.Profile.EmailVerified {
+			t.Errorf("Unexpected export:%+v %v", export.Profile, err)
+		}
+		if _, err = mc.ExportAccount(ctx, email); err != service.ErrInvalidClaim {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInvalidClaim, err)
+		}
+		if err = mc.DeleteAccount(ctx, moved, "wrong"); err != service.ErrInvalidPassword {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInvalidPassword, err)
+		}
+		deleted := mc.Token()
+		if err = mc.DeleteAccount(ctx, moved, "changed-pass"); err != nil {
+			t.Fatalf("Failed to delete account:%v", err)
+		}
+		dc, _ := New(ti.server.URL, WithToken(deleted))
+		if err = dc.CheckToken(ctx); err != service.ErrTokenRevoked {
+			t.Errorf("Want:%v\tHave:%v", service.ErrTokenRevoked, err)
+		}
+		if mc.Token() != "" {
+			t.Errorf("Client kept the token of the deleted user")
+		}
+		if _, err = mc.GetToken(ctx, moved, "changed-pass"); err == nil {
+			t.Errorf("Logged in as the deleted user")
+		}
+	})
+}
+
+func TestClientTokens(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "tokens@test.com"
+
+	c, err := New(ti.server.URL)
+	if err != nil {
+		t.Fatalf("Could not create client:%v", err)
+	}
+	if err = c.CreateUser(ctx, email, "token-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+
+	t.Run("No Credentials", func(t *testing.T) {
+		if _, err := c.GetUser(ctx, email); err != ErrNoCredentials {
+			t.Errorf("Want:%v\tHave:%v", ErrNoCredentials, err)
+		}
+	})
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		if _, err := c.GetToken(ctx, email, "wrong"); err != service.ErrInvalidPassword {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInvalidPassword, err)
+		}
+	})
+
+	expired := signTestToken(t, service.TokenClaims{
+		EmailID:        email,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Hour).Unix()},
+	})
+
+	t.Run("Expired Without Credentials", func(t *testing.T) {
+		tc, _ := New(ti.server.URL, WithToken(expired))
+		if _, err := tc.GetUser(ctx, email); err != kitjwt.ErrTokenExpired {
+			t.Errorf("Want:%v\tHave:%v", kitjwt.ErrTokenExpired, err)
+		}
+	})
+
+	t.Run("Expired Refresh", func(t *testing.T) {
+		tc, _ := New(ti.server.URL, WithToken(expired), WithCredentials(email, "token-pass"))
+		if _, err := tc.GetUser(ctx, email); err != nil {
+			t.Fatalf("Expired token should have been refreshed:%v", err)
+		}
+		if tc.Token() == expired {
+			t.Errorf("Client still holds the expired token")
+		}
+	})
+
+	t.Run("Rejected Refresh", func(t *testing.T) {
+		notActive := signTestToken(t, service.TokenClaims{
+			EmailID: email,
+			StandardClaims: jwt.StandardClaims{
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				NotBefore: time.Now().Add(time.Hour).Unix(),
+			},
+		})
+		tc, _ := New(ti.server.URL, WithToken(notActive), WithCredentials(email, "token-pass"))
+		if _, err := tc.GetUser(ctx, email); err != nil {
+			t.Fatalf("Rejected token should have been replaced:%v", err)
+		}
+		if tc.Token() == notActive {
+			t.Errorf("Client still holds the rejected token")
+		}
+	})
+}
+
+func TestClientPasswordRehash(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "rehash@test.com"
+
+	c, _ := New(ti.server.URL)
+	if err := c.CreateUser(ctx, email, "rehash-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+	storedHash := func() string {
+		store := podcastmg.NewDBStore("sqlite3", path.Join(ti.dir, "client.db"))
+		if err := store.Connect(); err != nil {
+			t.Fatalf("Could not connect to the store:%v", err)
+		}
+		defer store.Close()
+		user, err := store.GetUserByEmail(email)
+		if err != nil {
+			t.Fatalf("Could not get user:%v", err)
+		}
+		return user.Password
+	}
+	bcryptHash := storedHash()
+
+	// A second instance on the same database hashes with Argon2id, as after a change of configuration
+	argon := podcastmg.Argon2idHasher{Time: 1, Memory: 1024, Threads: 1}
+	svc, err := service.NewSQLStorePodcastManageService("sqlite3", path.Join(ti.dir, "client.db"), testSigningString, log.NewNopLogger(),
+		service.WithPasswordHasher(argon))
+	if err != nil {
+		t.Fatalf("Could not create service:%v", err)
+	}
+	server := httptest.NewServer(service.MakeHTTPHandler(svc, testKeys(), log.NewNopLogger()))
+	defer server.Close()
+	ac, _ := New(server.URL)
+
+	if _, err = ac.GetToken(ctx, email, "wrong"); err != service.ErrInvalidPassword {
+		t.Errorf("Want:%v\tHave:%v", service.ErrInvalidPassword, err)
+	}
+	if hash := storedHash(); hash != bcryptHash {
+		t.Errorf("Hash was replaced after a wrong password")
+	}
+	if _, err = ac.GetToken(ctx, email, "rehash-pass"); err != nil {
+		t.Fatalf("Failed to log in with the bcrypt hash:%v", err)
+	}
+	argonHash := storedHash()
+	if !strings.HasPrefix(argonHash, "$argon2id$") || argon.Outdated(argonHash) {
+		t.Errorf("Hash was not upgraded to Argon2id:%s", argonHash)
+	}
+	if _, err = ac.GetToken(ctx, email, "rehash-pass"); err != nil || storedHash() != argonHash {
+		t.Errorf("Current hash should be kept:%v", err)
+	}
+	if _, err = c.GetToken(ctx, email, "rehash-pass"); err != nil {
+		t.Errorf("Failed to log in with the Argon2id hash:%v", err)
+	}
+}
+
+func TestClientLoginLimit(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "limited@test.com"
+
+	c, _ := New(ti.server.URL)
+	if err := c.CreateUser(ctx, email, "limited-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+	svc, err := service.NewSQLStorePodcastManageService("sqlite3", path.Join(ti.dir, "client.db"), testSigningString, log.NewNopLogger(),
+		service.WithPasswordHasher(podcastmg.BcryptHasher{Cost: bcrypt.MinCost}))
+	if err != nil {
+		t.Fatalf("Could not create service:%v", err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Rate(100, time.Minute),
+		ratelimit.Lockout(2, time.Minute, time.Hour))
+	svc = service.MakeLoginLimitMiddleware(log.NewNopLogger(), limiter, false, svc)
+	server := httptest.NewServer(service.MakeHTTPHandler(svc, testKeys(), log.NewNopLogger()))
+	defer server.Close()
+	lc, _ := New(server.URL)
+
+	for i := 0; i < 2; i++ {
+		if _, err = lc.GetToken(ctx, email, "wrong"); err != service.ErrInvalidPassword {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInvalidPassword, err)
+		}
+	}
+	if _, err = lc.GetToken(ctx, email, "limited-pass"); err != service.ErrTooManyAttempts {
+		t.Errorf("Locked out account Want:%v\tHave:%v", service.ErrTooManyAttempts, err)
+	}
+	resp, err := http.Post(server.URL+"/login", "application/json",
+		strings.NewReader(`{"email_id":"someone@test.com","password":"guess"}`))
+	if err != nil {
+		t.Fatalf("Failed to log in:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("Locked out client Want:429 after 60s\tHave:%d after %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if _, err = c.GetToken(ctx, email, "limited-pass"); err != nil {
+		t.Errorf("Service without the limiter should not be limited:%v", err)
+	}
+}
+
+func TestClientAccessTokens(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "scripts@test.com"
+
+	c, _ := New(ti.server.URL, WithCredentials(email, "scripts-pass"))
+	if err := c.CreateUser(ctx, email, "scripts-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+	if _, err := c.CreateAccessToken(ctx, email, podcastmg.AccessToken{Name: "backup", Scopes: podcastmg.Scopes{"admin"}}); err != podcastmg.ErrInvalidScope {
+		t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidScope, err)
+	}
+	read, err := c.CreateAccessToken(ctx, email, podcastmg.AccessToken{Name: "backup", Scopes: podcastmg.Scopes{podcastmg.ScopeRead}})
+	if err != nil || !podcastmg.IsAccessToken(read.Token) {
+		t.Fatalf("Failed to create access token:%+v %v", read, err)
+	}
+	expiry := time.Now().Add(time.Hour)
+	write, err := c.CreateAccessToken(ctx, email, podcastmg.AccessToken{Name: "importer",
+		Scopes: podcastmg.Scopes{podcastmg.ScopeSubscriptionsWrite}, ExpiresAt: &expiry})
+	if err != nil {
+		t.Fatalf("Failed to create access token:%v", err)
+	}
+
+	t.Run("Scopes", func(t *testing.T) {
+		rc, _ := New(ti.server.URL, WithToken(read.Token))
+		if _, err := rc.GetUserSubscriptions(ctx, email); err != nil {
+			t.Errorf("Read token should read subscriptions:%v", err)
+		}
+		if err := rc.Subscribe(ctx, email, ti.feedURL); err != service.ErrInsufficientScope {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInsufficientScope, err)
+		}
+		if _, err := rc.GetAccessTokens(ctx, email); err != service.ErrInsufficientScope {
+			t.Errorf("Access tokens should not manage access tokens, Want:%v\tHave:%v", service.ErrInsufficientScope, err)
+		}
+
+		wc, _ := New(ti.server.URL, WithToken(write.Token))
+		if err := wc.Subscribe(ctx, email, ti.feedURL); err != nil {
+			t.Errorf("Write token should subscribe:%v", err)
+		}
+		if _, err := wc.GetUserSubscriptions(ctx, email); err != service.ErrInsufficientScope {
+			t.Errorf("Want:%v\tHave:%v", service.ErrInsufficientScope, err)
+		}
+
+		// Access tokens are accepted as the password of the gpodder.net API
+		req, _ := http.NewRequest("GET", ti.server.URL+"/api/2/devices/"+email+".json", nil)
+		req.SetBasicAuth(email, read.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to get devices:%v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Status Want:%d\tHave:%d", http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	t.Run("Exchange", func(t *testing.T) {
+		token, err := c.ExchangeAccessToken(ctx, write.Token)
+		if err != nil {
+			t.Fatalf("Failed to exchange access token:%v", err)
+		}
+		var claims service.TokenClaims
+		if _, _, err = new(jwt.Parser).ParseUnverified(token, &claims); err != nil {
+			t.Fatalf("Failed to parse token:%v", err)
+		}
+		if claims.EmailID != email || len(claims.Scopes) != 1 || claims.Scopes[0] != podcastmg.ScopeSubscriptionsWrite ||
+			claims.ExpiresAt > expiry.Unix() {
+			t.Errorf("Unexpected claims:%+v", claims)
+		}
+		if _, err = c.ExchangeAccessToken(ctx, "pmg_unknown"); err != podcastmg.ErrInvalidAccessToken {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrInvalidAccessToken, err)
+		}
+	})
+
+	t.Run("List And Revoke", func(t *testing.T) {
+		tokens, err := c.GetAccessTokens(ctx, email)
+		if err != nil || len(tokens) != 2 {
+			t.Fatalf("Failed to list access tokens:%v %v", tokens, err)
+		}
+		if tokens[0].Token != "" || tokens[0].Name != "backup" || tokens[0].LastUsedAt == nil {
+			t.Errorf("Unexpected listed token:%+v", tokens[0])
+		}
+		if err = c.RevokeAccessToken(ctx, email, read.ID); err != nil {
+			t.Fatalf("Failed to revoke access token:%v", err)
+		}
+		if err = c.RevokeAccessToken(ctx, email, read.ID); err != service.ErrAccessTokenNotFound {
+			t.Errorf("Want:%v\tHave:%v", service.ErrAccessTokenNotFound, err)
+		}
+		rc, _ := New(ti.server.URL, WithToken(read.Token))
+		if _, err = rc.GetUserSubscriptions(ctx, email); err != podcastmg.ErrInvalidAccessToken {
+			t.Errorf("Revoked token Want:%v\tHave:%v", podcastmg.ErrInvalidAccessToken, err)
+		}
+	})
+}
+
+// followOIDCLogin signs in at the provider and returns the callback url it redirects the user to
+func followOIDCLogin(t *testing.T, client *http.Client, loginURL string) *url.URL {
+	var callback *url.URL
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Path == service.OIDCCallbackPath {
+			callback = req.URL
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	resp, err := client.Get(loginURL)
+	if err != nil {
+		t.Fatalf("Failed to sign in:%v", err)
+	}
+	resp.Body.Close()
+	if callback == nil {
+		t.Fatalf("Provider did not redirect to the callback:%d", resp.StatusCode)
+	}
+	return callback
+}
+
+func TestClientOIDCLogin(t *testing.T) {
+	idp := oidctest.NewServer("pmg", "pmg-secret")
+	defer idp.Close()
+	ctx := context.Background()
+	provider, err := oidc.Discover(ctx, idp.Config("http://pmg.test"+service.OIDCCallbackPath), nil)
+	if err != nil {
+		t.Fatalf("Failed to discover provider:%v", err)
+	}
+	ti := newTestInstance(t, service.WithOIDC(provider))
+	defer ti.Close()
+	c, _ := New(ti.server.URL)
+
+	// login runs a login of the provider's user through the API and returns the token of the linked user
+	login := func(t *testing.T) (string, error) {
+		started, err := c.BeginOIDCLogin(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin login:%v", err)
+		}
+		callback := followOIDCLogin(t, &http.Client{}, started.AuthURL)
+		return c.CompleteOIDCLogin(ctx, started.Session, callback.Query().Get("state"), callback.Query().Get("code"))
+	}
+
+	t.Run("Create User", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "new-sub", Email: "sso@test.com", EmailVerified: true})
+		token, err := login(t)
+		if err != nil {
+			t.Fatalf("Failed to log in:%v", err)
+		}
+		tc, _ := New(ti.server.URL, WithToken(token))
+		user, err := tc.GetUser(ctx, "sso@test.com")
+		if err != nil || !user.EmailVerified {
+			t.Errorf("Unexpected user:%+v %v", user, err)
+		}
+		if _, err = c.GetToken(ctx, "sso@test.com", ""); err == nil {
+			t.Errorf("Users created by the provider should have no password")
+		}
+	})
+
+	t.Run("Link User", func(t *testing.T) {
+		email := "password-user@test.com"
+		if err := c.CreateUser(ctx, email, "user-pass"); err != nil {
+			t.Fatalf("Failed to register user:%v", err)
+		}
+		idp.SetUser(oidctest.User{Subject: "linked-sub", Email: email, EmailVerified: true})
+
+		// Anyone could have registered the email, the user has to prove to own it first
+		if _, err := login(t); err != podcastmg.ErrUnverifiedAccount {
+			t.Errorf("Want:%v\tHave:%v", podcastmg.ErrUnverifiedAccount, err)
+		}
+		if _, token := ti.mailer.lastToken(t); c.VerifyEmail(ctx, token) != nil {
+			t.Fatalf("Failed to verify email")
+		}
+
+		// Browsers keep the login's session in a cookie
+		jar, _ := cookiejar.New(nil)
+		browser := &http.Client{Jar: jar}
+		callback := followOIDCLogin(t, browser, ti.server.URL+service.OIDCLoginPath)
+		resp, err := browser.Get(ti.server.URL + service.OIDCCallbackPath + "?" + callback.RawQuery)
+		if err != nil {
+			t.Fatalf("Failed to complete login:%v", err)
+		}
+		token, err := decodeGetTokenResponse(ctx, resp)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to complete login:%v", err)
+		}
+		tc, _ := New(ti.server.URL, WithToken(token.(getTokenResponse).TokenString))
+		if _, err = tc.GetUser(ctx, email); err != nil {
+			t.Errorf("Token should belong to the linked user:%v", err)
+		}
+		if _, err = c.GetToken(ctx, email, "user-pass"); err != nil {
+			t.Errorf("Linked user should keep their password:%v", err)
+		}
+	})
+
+	t.Run("Unverified Email", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "unverified-sub", Email: "unverified@test.com"})
+		if _, err := login(t); err != service.ErrEmailNotVerified {
+			t.Errorf("Want:%v\tHave:%v", service.ErrEmailNotVerified, err)
+		}
+	})
+
+	t.Run("Forged State", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "new-sub", Email: "sso@test.com", EmailVerified: true})
+		started, _ := c.BeginOIDCLogin(ctx)
+		callback := followOIDCLogin(t, &http.Client{}, started.AuthURL)
+		if _, err := c.CompleteOIDCLogin(ctx, started.Session, "forged", callback.Query().Get("code")); err != service.ErrOIDCLogin {
+			t.Errorf("Want:%v\tHave:%v", service.ErrOIDCLogin, err)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		plain := newTestInstance(t)
+		defer plain.Close()
+		pc, _ := New(plain.server.URL)
+		if _, err := pc.BeginOIDCLogin(ctx); err != service.ErrOIDCDisabled {
+			t.Errorf("Want:%v\tHave:%v", service.ErrOIDCDisabled, err)
+		}
+	})
+}
+
+func TestClientSigningKeys(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "keys@test.com"
+
+	c, _ := New(ti.server.URL)
+	if err := c.CreateUser(ctx, email, "keys-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+	legacyToken, err := c.GetToken(ctx, email, "keys-pass")
+	if err != nil {
+		t.Fatalf("Failed to log in:%v", err)
+	}
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate RSA key:%v", err)
+	}
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := signing.NewKey("rsa-1", rsaPrivate)
+	rsaVerify, _ := signing.NewVerifyKey("rsa-1", &rsaPrivate.PublicKey)
+	edKey, _ := signing.NewKey("ed-1", edPrivate)
+	legacyKey := signing.NewHMACKey("", []byte(testSigningString))
+
+	// login returns a token of a new login after checking its header
+	login := func(wantAlg, wantKid string) string {
+		token, err := c.GetToken(ctx, email, "keys-pass")
+		if err != nil {
+			t.Fatalf("Failed to log in:%v", err)
+		}
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, &service.TokenClaims{})
+		if err != nil || parsed.Method.Alg() != wantAlg || parsed.Header["kid"] != wantKid {
+			t.Errorf("Token Want:%s %s\tHave:%v %v", wantAlg, wantKid, parsed.Header, err)
+		}
+		return token
+	}
+	// valid checks whether the service accepts the token
+	valid := func(token string) bool {
+		tc, _ := New(ti.server.URL, WithToken(token))
+		_, err := tc.GetUser(ctx, email)
+		return err == nil
+	}
+
+	rotated, _ := signing.NewKeySet(rsaKey, legacyKey)
+	ti.keys.Replace(rotated)
+	rsaToken := login("RS256", "rsa-1")
+
+	rotated, _ = signing.NewKeySet(edKey, rsaVerify, legacyKey)
+	ti.keys.Replace(rotated)
+	edToken := login("EdDSA", "ed-1")
+	for _, token := range []string{legacyToken, rsaToken, edToken} {
+		if !valid(token) {
+			t.Errorf("Token should be valid after the rotation:%s", token)
+		}
+	}
+
+	t.Run("JWKS", func(t *testing.T) {
+		resp, err := http.Get(ti.server.URL + "/.well-known/jwks.json")
+		if err != nil {
+			t.Fatalf("Failed to get JWKS:%v", err)
+		}
+		defer resp.Body.Close()
+		var jwks signing.JSONWebKeySet
+		if err = json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+			t.Fatalf("Failed to decode JWKS:%v", err)
+		}
+		if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "ed-1" || jwks.Keys[1].Kid != "rsa-1" {
+			t.Errorf("Unexpected keys:%v", jwks.Keys)
+		}
+	})
+
+	t.Run("Alg Confusion", func(t *testing.T) {
+		// The RSA public key is published, it must not verify HS256 tokens
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, service.TokenClaims{EmailID: email,
+			StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}})
+		forged.Header["kid"] = "rsa-1"
+		public, _ := x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+		token, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+		if valid(token) {
+			t.Errorf("HS256 token of the RSA key was accepted")
+		}
+	})
+
+	t.Run("Retired Keys", func(t *testing.T) {
+		rotated, _ := signing.NewKeySet(edKey)
+		ti.keys.Replace(rotated)
+		if valid(legacyToken) || valid(rsaToken) {
+			t.Errorf("Tokens of retired keys should be rejected")
+		}
+		if !valid(edToken) {
+			t.Errorf("Token of the active key should be valid")
+		}
+		rc, _ := New(ti.server.URL, WithToken(rsaToken), WithCredentials(email, "keys-pass"))
+		if _, err := rc.GetUser(ctx, email); err != nil {
+			t.Errorf("Token of a retired key should have been replaced:%v", err)
+		}
+	})
+}
+
+func TestClientErrors(t *testing.T) {
+	ti := newTestInstance(t)
+	defer ti.Close()
+	ctx := context.Background()
+	email := "errors@test.com"
+
+	c, _ := New(ti.server.URL)
+	if err := c.CreateUser(ctx, email, "errors-pass"); err != nil {
+		t.Fatalf("Failed to register user:%v", err)
+	}
+	if err := c.CreateUser(ctx, email, "errors-pass"); err != podcastmg.ErrEmailTaken {
+		t.Errorf("Duplicate registration Want:%v\tHave:%v", podcastmg.ErrEmailTaken, err)
+	}
+	if _, err := c.GetPodcastDetails(ctx, "http://127.0.0.1:1/feed.xml"); err != service.ErrPodcastBuild {
+		t.Errorf("Want:%v\tHave:%v", service.ErrPodcastBuild, err)
+	}
+
+	type errorTestCase struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantErr    string
+	}
+	testCases := []errorTestCase{
+		{"Conflict", "POST", "/register", `{"email_id":"errors@test.com","password":"x"}`, http.StatusConflict, "email_taken",
+			podcastmg.ErrEmailTaken.Error()},
+		{"Validation", "POST", "/register", `{"email_id":"not an email","password":"x"}`, http.StatusBadRequest, "invalid_email",
+			podcastmg.ErrInvalidEmail.Error()},
+		{"Malformed", "POST", "/register", `{`, http.StatusBadRequest, "invalid_json", service.ErrJSONUnmarshall.Error()},
+		{"Unauthenticated", "POST", "/subscriptions", `{"email_id":"errors@test.com"}`, http.StatusUnauthorized, "token_missing",
+			kitjwt.ErrTokenContextMissing.Error()},
+		{"Cause Not Sent", "POST", "/podcast", `{"url":"http://127.0.0.1:1/feed.xml"}`, http.StatusInternalServerError,
+			"podcast_build_failed", service.ErrPodcastBuild.Error()},
+		{"Route Not Found", "GET", "/missing", "", http.StatusNotFound, "route_not_found", service.ErrRouteNotFound.Error()},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, ti.server.URL+test.path, strings.NewReader(test.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed:%v", err)
+			}
+			defer resp.Body.Close()
+			var body map[string]string
+			if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode error:%v", err)
+			}
+			if resp.StatusCode != test.wantStatus || body["code"] != test.wantCode || body["err"] != test.wantErr {
+				t.Errorf("Want:%d %s %q\tHave:%d %s %q", test.wantStatus, test.wantCode, test.wantErr, resp.StatusCode,
+					body["code"], body["err"])
+			}
+		})
+	}
+}
+
+func TestClientErrorCodes(t *testing.T) {
+	for _, known := range knownErrors {
+		if code := service.ErrorCode(known); errorsByCode[code] != known {
+			t.Errorf("Error %q is not restored from its code %q", known, code)
+		}
+	}
+
+	// Errors are restored from their code, the message may change
+	type codeTestCase struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}
+	testCases := []codeTestCase{
+		{"Known Code", http.StatusConflict, `{"err":"Label already taken","code":"label_exists"}`, podcastmg.ErrLabelExists},
+		{"Service Code", http.StatusUnauthorized, `{"err":"Revoked","code":"token_revoked"}`, service.ErrTokenRevoked},
+		{"Unknown Code", http.StatusTeapot, `{"err":"Short and stout","code":"teapot"}`,
+			&service.Error{Code: "teapot", Status: http.StatusTeapot, Message: "Short and stout"}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rec.WriteHeader(test.status)
+			rec.WriteString(test.body)
+			err := errorFromResponse(rec.Result())
+			if err != test.wantErr && !reflect.DeepEqual(err, test.wantErr) {
+				t.Errorf("Want:%#v\tHave:%#v", test.wantErr, err)
+			}
+		})
+	}
+}
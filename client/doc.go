@@ -0,0 +1,2 @@
+// Package client provides a Go client for a remote podcast-manage-svc instance.
+package client
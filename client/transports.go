@@ -0,0 +1,1044 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/digest"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/service"
+	"github.com/tchaudhry91/podcast-manage-svc/websub"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxEventSize is the longest line of an event stream the client reads, longer events end the stream
+const maxEventSize = 1 << 20
+
+// knownErrors lists the service errors which are restored from their code when returned by the server
+var knownErrors = []error{
+	service.ErrDBConn,
+	service.ErrUserCreate,
+	service.ErrUserFetch,
+	service.ErrPodcastBuild,
+	service.ErrPodcastUpdate,
+	service.ErrUserUpdate,
+	service.ErrPodcastFetch,
+	service.ErrInvalidPassword,
+	service.ErrInvalidClaim,
+	service.ErrJSONUnmarshall,
+	service.ErrBadRouting,
+	service.ErrEpisodeFetch,
+	service.ErrArchiveDisabled,
+	service.ErrArchive,
+	service.ErrMediaNotArchived,
+	archive.ErrQuotaExceeded,
+	archive.ErrNoMedia,
+	service.ErrSearch,
+	service.ErrInvalidSearchScope,
+	podcastmg.ErrEmptySearch,
+	service.ErrUnknownDirectory,
+	service.ErrDirectoryURL,
+	service.ErrDirectoryDisabled,
+	service.ErrDirectoryNotReady,
+	service.ErrDirectory,
+	service.ErrSubscriptionFetch,
+	service.ErrSubscriptionUpdate,
+	podcastmg.ErrInvalidSettings,
+	service.ErrLabelUpdate,
+	podcastmg.ErrInvalidLabel,
+	podcastmg.ErrLabelExists,
+	podcastmg.ErrLabelNotFound,
+	podcastmg.ErrInvalidOrder,
+	service.ErrQueueFetch,
+	service.ErrQueueUpdate,
+	podcastmg.ErrQueueConflict,
+	podcastmg.ErrInvalidQueueAction,
+	podcastmg.ErrQueuePosition,
+	podcastmg.ErrNotQueued,
+	service.ErrPlaylistUpdate,
+	podcastmg.ErrInvalidPlaylist,
+	podcastmg.ErrInvalidRules,
+	podcastmg.ErrPlaylistNotFound,
+	service.ErrWebhookUpdate,
+	podcastmg.ErrInvalidWebhook,
+	podcastmg.ErrWebhookAddress,
+	podcastmg.ErrTooManyWebhooks,
+	podcastmg.ErrWebhookNotFound,
+	service.ErrDigestUpdate,
+	podcastmg.ErrInvalidDigestSettings,
+	podcastmg.ErrDigestNotFound,
+	service.ErrHubCallback,
+	podcastmg.ErrHubSubscriptionNotFound,
+	podcastmg.ErrInvalidHubIntent,
+	podcastmg.ErrInvalidHubContent,
+	service.ErrEventsDisabled,
+	service.ErrEventStream,
+	service.ErrStreamingUnsupported,
+	service.ErrPlaybackFetch,
+	service.ErrPlaybackUpdate,
+	podcastmg.ErrInvalidPlayback,
+	service.ErrDeviceUpdate,
+	service.ErrSyncFetch,
+	service.ErrSyncUpdate,
+	service.ErrBadQuery,
+	podcastmg.ErrInvalidDevice,
+	podcastmg.ErrInvalidSubscriptionChange,
+	podcastmg.ErrInvalidEpisodeAction,
+	podcastmg.ErrInvalidSyncToken,
+	podcastmg.ErrInvalidChange,
+	service.ErrMailDisabled,
+	service.ErrMailSend,
+	service.ErrEmailVerified,
+	service.ErrAccountUpdate,
+	podcastmg.ErrInvalidEmail,
+	podcastmg.ErrEmptyPassword,
+	podcastmg.ErrInvalidAccountToken,
+	podcastmg.ErrEmailTaken,
+	service.ErrAccountExport,
+	service.ErrAccountDelete,
+	service.ErrTooManyAttempts,
+	service.ErrTokenRevoked,
+	service.ErrInsufficientScope,
+	service.ErrAccessTokenNotFound,
+	service.ErrAccessTokenUpdate,
+	podcastmg.ErrInvalidAccessToken,
+	podcastmg.ErrInvalidScope,
+	podcastmg.ErrInvalidAccessTokenName,
+	podcastmg.ErrInvalidExpiry,
+	podcastmg.ErrTooManyAccessTokens,
+	service.ErrOIDCDisabled,
+	service.ErrOIDCLogin,
+	service.ErrEmailNotVerified,
+	podcastmg.ErrUnverifiedAccount,
+	service.ErrInternal,
+	service.ErrRouteNotFound,
+	service.ErrMethodNotAllowed,
+	kitjwt.ErrTokenContextMissing,
+	kitjwt.ErrTokenInvalid,
+	kitjwt.ErrTokenExpired,
+	kitjwt.ErrTokenMalformed,
+	kitjwt.ErrTokenNotActive,
+	kitjwt.ErrUnexpectedSigningMethod,
+}
+
+// errorsByCode maps the codes the server sends to the known errors
+var errorsByCode = func() map[string]error {
+	byCode := make(map[string]error, len(knownErrors))
+	for _, known := range knownErrors {
+		byCode[service.ErrorCode(known)] = known
+	}
+	return byCode
+}()
+
+// MakeClientEndpoints returns a struct containing all the endpoints of a remote PodcastManageService.
+// The endpoints mirror the ones returned by service.MakeServerEndpoints
+func MakeClientEndpoints(instance string, options ...kithttp.ClientOption) (service.Endpoints, error) {
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	tgt, err := url.Parse(instance)
+	if err != nil {
+		return service.Endpoints{}, err
+	}
+	tgt.Path = strings.TrimSuffix(tgt.Path, "/")
+
+	options = append([]kithttp.ClientOption{kithttp.ClientBefore(kitjwt.ContextToHTTP())}, options...)
+	makeEndpoint := func(path string, dec kithttp.DecodeResponseFunc) endpoint.Endpoint {
+		u := *tgt
+		u.Path = u.Path + path
+		return kithttp.NewClient("POST", &u, kithttp.EncodeJSONRequest, dec, options...).Endpoint()
+	}
+
+	return service.Endpoints{
+		CreateUserEndpoint:             makeEndpoint("/register", decodeStatusResponse),
+		GetUserEndpoint:                makeEndpoint("/user", decodeGetUserResponse),
+		GetPodcastDetailsEndpoint:      makeEndpoint("/podcast", decodeGetPodcastDetailsResponse),
+		SubscribeEndpoint:              makeEndpoint("/subscribe", decodeStatusResponse),
+		UnsubscribeEndpoint:            makeEndpoint("/unsubscribe", decodeStatusResponse),
+		UpdatePodcastEndpoint:          makeEndpoint("/update", decodeStatusResponse),
+		GetUserSubscriptionsEndpoint:   makeEndpoint("/subscriptions", decodeGetUserSubscriptionsResponse),
+		GetSubscriptionDetailsEndpoint: makeEndpoint("/subscription", decodeGetSubscriptionDetailsResponse),
+		GetTokenEndpoint:               makeEndpoint("/login", decodeGetTokenResponse),
+		ArchiveEpisodeEndpoint:         makeEndpoint("/archive", decodeStatusResponse),
+		GetEpisodeMediaEndpoint:        kithttp.NewClient("GET", tgt, encodeGetEpisodeMediaRequest, decodeGetEpisodeMediaResponse, options...).Endpoint(),
+		SearchEndpoint:                 makeEndpoint("/search", decodeSearchResponse),
+		DiscoverEndpoint:               makeEndpoint("/discover", decodeDiscoverResponse),
+		GetSubscriptionTotalsEndpoint:  makeEndpoint("/subscriptions/totals", decodeGetSubscriptionTotalsResponse),
+		GetSettingsEndpoint:            makeEndpoint("/subscription/settings", decodeSettingsResponse),
+		UpdateSettingsEndpoint:         makeEndpoint("/subscription/settings/update", decodeStatusResponse),
+		ResetSettingsEndpoint:          makeEndpoint("/subscription/settings/reset", decodeStatusResponse),
+		CreateLabelEndpoint:            makeEndpoint("/labels/create", decodeLabelResponse),
+		GetLabelsEndpoint:              makeEndpoint("/labels", decodeGetLabelsResponse),
+		RenameLabelEndpoint:            makeEndpoint("/labels/rename", decodeStatusResponse),
+		ReorderLabelsEndpoint:          makeEndpoint("/labels/reorder", decodeStatusResponse),
+		DeleteLabelEndpoint:            makeEndpoint("/labels/delete", decodeStatusResponse),
+		SetFolderEndpoint:              makeEndpoint("/subscription/folder", decodeStatusResponse),
+		SetTagsEndpoint:                makeEndpoint("/subscription/tags", decodeStatusResponse),
+		FilterSubscriptionsEndpoint:    makeEndpoint("/subscriptions/filter", decodeGetUserSubscriptionsResponse),
+		GetQueueEndpoint:               makeEndpoint("/queue", decodeQueueResponse),
+		UpdateQueueEndpoint:            makeEndpoint("/queue/update", decodeQueueResponse),
+		CreatePlaylistEndpoint:         makeEndpoint("/playlists/create", decodePlaylistResponse),
+		GetPlaylistsEndpoint:           makeEndpoint("/playlists", decodeGetPlaylistsResponse),
+		GetPlaylistEndpoint:            makeEndpoint("/playlist", decodePlaylistResponse),
+		GetPlaylistFeedEndpoint:        makeEndpoint("/playlist/feed", decodePlaylistResponse),
+		UpdatePlaylistEndpoint:         makeEndpoint("/playlist/update", decodeStatusResponse),
+		DeletePlaylistEndpoint:         makeEndpoint("/playlist/delete", decodeStatusResponse),
+		SetPlaylistItemsEndpoint:       makeEndpoint("/playlist/items", decodeStatusResponse),
+		CreateWebhookEndpoint:          makeEndpoint("/webhooks/create", decodeWebhookResponse),
+		GetWebhooksEndpoint:            makeEndpoint("/webhooks", decodeGetWebhooksResponse),
+		DeleteWebhookEndpoint:          makeEndpoint("/webhooks/delete", decodeStatusResponse),
+		GetWebhookDeliveriesEndpoint:   makeEndpoint("/webhooks/deliveries", decodeWebhookDeliveriesResponse),
+		RetryWebhookDeliveryEndpoint:   makeEndpoint("/webhooks/deliveries/retry", decodeStatusResponse),
+		GetDigestScheduleEndpoint:      makeEndpoint("/digest", decodeDigestResponse),
+		UpdateDigestSettingsEndpoint:   makeEndpoint("/digest/update", decodeDigestResponse),
+		UnsubscribeDigestEndpoint:      kithttp.NewClient("POST", tgt, encodeUnsubscribeDigestRequest, decodeUnsubscribeDigestResponse, options...).Endpoint(),
+		VerifyHubIntentEndpoint:        kithttp.NewClient("GET", tgt, encodeHubIntentRequest, decodeHubIntentResponse, options...).Endpoint(),
+		ReceiveHubContentEndpoint:      kithttp.NewClient("POST", tgt, encodeHubContentRequest, decodeHubContentResponse, options...).Endpoint(),
+		StreamEventsEndpoint:           kithttp.NewClient("GET", tgt, encodeStreamEventsRequest, decodeEventStreamResponse, append(options, kithttp.BufferedStream(true))...).Endpoint(),
+		GetPlaybackStatesEndpoint:      makeEndpoint("/playback", decodePlaybackStatesResponse),
+		UpdatePlaybackStateEndpoint:    makeEndpoint("/playback/update", decodePlaybackResponse),
+		GetDevicesEndpoint:             kithttp.NewClient("GET", tgt, encodeGetDevicesRequest, decodeDevicesResponse, options...).Endpoint(),
+		UpdateDeviceEndpoint:           kithttp.NewClient("POST", tgt, encodeUpdateDeviceRequest, decodeGpodderStatusResponse, options...).Endpoint(),
+		GetSubscriptionChangesEndpoint: kithttp.NewClient("GET", tgt, encodeSubscriptionChangesRequest, decodeSubscriptionChangesResponse, options...).Endpoint(),
+		UploadSubscriptionsEndpoint:    kithttp.NewClient("POST", tgt, encodeUploadSubscriptionsRequest, decodeSyncResultResponse, options...).Endpoint(),
+		GetEpisodeActionsEndpoint:      kithttp.NewClient("GET", tgt, encodeEpisodeActionsRequest, decodeEpisodeActionsResponse, options...).Endpoint(),
+		UploadEpisodeActionsEndpoint:   kithttp.NewClient("POST", tgt, encodeUploadEpisodeActionsRequest, decodeSyncResultResponse, options...).Endpoint(),
+		SyncEndpoint:                   kithttp.NewClient("GET", tgt, encodeSyncRequest, decodeSyncResponse, options...).Endpoint(),
+		UploadChangesEndpoint:          kithttp.NewClient("POST", tgt, encodeUploadChangesRequest, decodeUploadChangesResponse, options...).Endpoint(),
+		RequestVerificationEndpoint:    makeEndpoint(service.VerifyEmailPath+"/request", decodeStatusResponse),
+		VerifyEmailEndpoint:            kithttp.NewClient("GET", tgt, encodeVerifyEmailRequest, decodeVerifyEmailResponse, options...).Endpoint(),
+		RequestPasswordResetEndpoint:   makeEndpoint("/password/forgot", decodeStatusResponse),
+		ResetPasswordEndpoint:          makeEndpoint(service.ResetPasswordPath, decodeStatusResponse),
+		ChangePasswordEndpoint:         makeEndpoint("/password/change", decodeStatusResponse),
+		RequestEmailChangeEndpoint:     makeEndpoint("/email/change", decodeStatusResponse),
+		ConfirmEmailChangeEndpoint:     kithttp.NewClient("GET", tgt, encodeConfirmEmailChangeRequest, decodeVerifyEmailResponse, options...).Endpoint(),
+		ExportAccountEndpoint:          kithttp.NewClient("GET", tgt, encodeExportAccountRequest, decodeExportAccountResponse, options...).Endpoint(),
+		DeleteAccountEndpoint:          makeEndpoint("/account/delete", decodeStatusResponse),
+		CreateAccessTokenEndpoint:      makeEndpoint("/tokens/create", decodeAccessTokenResponse),
+		GetAccessTokensEndpoint:        makeEndpoint("/tokens", decodeGetAccessTokensResponse),
+		RevokeAccessTokenEndpoint:      makeEndpoint("/tokens/revoke", decodeStatusResponse),
+		ExchangeAccessTokenEndpoint:    makeEndpoint("/tokens/exchange", decodeGetTokenResponse),
+		CheckTokenEndpoint:             makeEndpoint("/token/check", decodeStatusResponse),
+		BeginOIDCLoginEndpoint:         makeEndpoint(service.OIDCLoginPath, decodeOIDCLoginResponse),
+		CompleteOIDCLoginEndpoint:      makeEndpoint(service.OIDCCallbackPath, decodeGetTokenResponse),
+		ExportOPMLEndpoint:             kithttp.NewClient("GET", tgt, encodeExportOPMLRequest, decodeExportOPMLResponse, options...).Endpoint(),
+	}, nil
+}
+
+// encodeGetEpisodeMediaRequest sets the media path on the request, the base path is kept from the instance url
+func encodeGetEpisodeMediaRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(episodeRequest)
+	req.URL.Path = req.URL.Path + "/media/" + url.PathEscape(r.EmailID) + "/" + strconv.FormatUint(uint64(r.ItemID), 10)
+	return nil
+}
+
+// decodeGetEpisodeMediaResponse reads the whole media into memory
+func decodeGetEpisodeMediaResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return mediaBlob{bytes.NewReader(data), modTime}, nil
+}
+
+// encodeExportOPMLRequest sets the opml path on the request, the base path is kept from the instance url
+func encodeExportOPMLRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(userRequest)
+	req.URL.Path = req.URL.Path + "/opml/" + url.PathEscape(r.EmailID)
+	return nil
+}
+
+// decodeExportOPMLResponse parses the OPML document written by the server
+func decodeExportOPMLResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+	return podcastmg.ParseOPML(resp.Body)
+}
+
+// encodeUnsubscribeDigestRequest sets the unsubscribe path and token on the request, the base path is kept from the instance url
+func encodeUnsubscribeDigestRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(unsubscribeDigestRequest)
+	req.URL.Path = req.URL.Path + digest.UnsubscribePath
+	req.URL.RawQuery = url.Values{"token": {r.Token}}.Encode()
+	return nil
+}
+
+// decodeUnsubscribeDigestResponse checks the status of the plain text confirmation written by the server
+func decodeUnsubscribeDigestResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+	return statusResponse{Status: true}, nil
+}
+
+// encodeHubIntentRequest sets the callback path and the hub.* parameters of a verification on the request
+func encodeHubIntentRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(hubIntentRequest)
+	req.URL.Path = req.URL.Path + websub.CallbackPath + "/" + strconv.FormatUint(uint64(r.ID), 10)
+	query := url.Values{"hub.mode": {r.Mode}, "hub.topic": {r.Topic}, "hub.challenge": {r.Challenge}}
+	if r.LeaseSeconds > 0 {
+		query.Set("hub.lease_seconds", strconv.Itoa(r.LeaseSeconds))
+	}
+	if r.Reason != "" {
+		query.Set("hub.reason", r.Reason)
+	}
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// decodeHubIntentResponse reads the challenge echoed by the server
+func decodeHubIntentResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+	challenge, err := ioutil.ReadAll(resp.Body)
+	return string(challenge), err
+}
+
+// encodeHubContentRequest sends the content as the raw body of the request along with its signature
+func encodeHubContentRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(hubContentRequest)
+	req.URL.Path = req.URL.Path + websub.CallbackPath + "/" + strconv.FormatUint(uint64(r.ID), 10)
+	req.Header.Set(websub.HeaderSignature, r.Signature)
+	req.Body = ioutil.NopCloser(bytes.NewReader(r.Content))
+	req.ContentLength = int64(len(r.Content))
+	return nil
+}
+
+// decodeHubContentResponse checks that the server accepted the pushed content
+func decodeHubContentResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, errorFromResponse(resp)
+	}
+	return statusResponse{Status: true}, nil
+}
+
+// encodeStreamEventsRequest sets the events path on the request, the base path is kept from the instance url
+func encodeStreamEventsRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(userRequest)
+	req.URL.Path = req.URL.Path + "/events/" + url.PathEscape(r.EmailID)
+	req.Header.Set("Accept", "text/event-stream")
+	return nil
+}
+
+// decodeEventStreamResponse passes the server-sent events of the response on to the returned channel, which is
+// closed once the server ends the stream or the request's context is done
+func decodeEventStreamResponse(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, errorFromResponse(resp)
+	}
+	stream := make(chan events.Event)
+	go func() {
+		defer close(stream)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64<<10), maxEventSize)
+		var data []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "data:") {
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+			if line != "" || len(data) == 0 {
+				continue
+			}
+			var event events.Event
+			err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event)
+			data = nil
+			if err != nil {
+				continue
+			}
+			select {
+			case stream <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return stream, nil
+}
+
+func decodePlaybackStatesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response playbackStatesResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodePlaybackResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response playbackResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+// encodeSyncRequest sets the sync path, token and limit on the request, the base path is kept from the instance url
+func encodeSyncRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(syncRequest)
+	req.URL.Path = req.URL.Path + "/sync/" + url.PathEscape(r.EmailID)
+	query := url.Values{}
+	if r.Token != "" {
+		query.Set("since", r.Token)
+	}
+	if r.Limit > 0 {
+		query.Set("limit", strconv.Itoa(r.Limit))
+	}
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// encodeUploadChangesRequest sets the sync path on the request and sends the device's changes
+func encodeUploadChangesRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(uploadChangesRequest)
+	req.URL.Path = req.URL.Path + "/sync/" + url.PathEscape(r.EmailID)
+	return kithttp.EncodeJSONRequest(ctx, req, r)
+}
+
+func decodeSyncResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response syncResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeUploadChangesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response uploadChangesResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+// encodeVerifyEmailRequest sets the verification path and token on the request, the base path is kept from the instance url
+func encodeVerifyEmailRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(verifyEmailRequest)
+	req.URL.Path = req.URL.Path + service.VerifyEmailPath
+	req.URL.RawQuery = url.Values{"token": {r.Token}}.Encode()
+	return nil
+}
+
+// decodeVerifyEmailResponse checks the status of the plain text confirmation written by the server
+func decodeVerifyEmailResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+	return statusResponse{Status: true}, nil
+}
+
+// encodeConfirmEmailChangeRequest sets the email change path and token on the request, the base path is kept from the instance url
+func encodeConfirmEmailChangeRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(verifyEmailRequest)
+	req.URL.Path = req.URL.Path + service.ChangeEmailPath
+	req.URL.RawQuery = url.Values{"token": {r.Token}}.Encode()
+	return nil
+}
+
+// encodeExportAccountRequest sets the account export path on the request, the base path is kept from the instance url
+func encodeExportAccountRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(userRequest)
+	req.URL.Path = req.URL.Path + "/account/" + url.PathEscape(r.EmailID) + "/export"
+	return nil
+}
+
+// decodeExportAccountResponse parses the export written by the server
+func decodeExportAccountResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+	var export podcastmg.UserExport
+	err := json.NewDecoder(resp.Body).Decode(&export)
+	return export, err
+}
+
+func decodeAccessTokenResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response accessTokenResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetAccessTokensResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getAccessTokensResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeOIDCLoginResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response oidcLoginResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+// encodeGetDevicesRequest sets the gpodder.net devices path on the request
+func encodeGetDevicesRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(userRequest)
+	req.URL.Path = req.URL.Path + "/api/2/devices/" + url.PathEscape(r.EmailID) + ".json"
+	return nil
+}
+
+// encodeUpdateDeviceRequest sets the gpodder.net path of the device and sends its caption and type
+func encodeUpdateDeviceRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(deviceRequest)
+	req.URL.Path = req.URL.Path + "/api/2/devices/" + url.PathEscape(r.EmailID) + "/" + url.PathEscape(r.Device.DeviceID) + ".json"
+	return kithttp.EncodeJSONRequest(ctx, req, r.Device)
+}
+
+// encodeSubscriptionChangesRequest sets the gpodder.net subscriptions path of the device and the since timestamp
+func encodeSubscriptionChangesRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(subscriptionChangesRequest)
+	req.URL.Path = req.URL.Path + "/api/2/subscriptions/" + url.PathEscape(r.EmailID) + "/" + url.PathEscape(r.DeviceID) + ".json"
+	req.URL.RawQuery = url.Values{"since": {strconv.FormatInt(r.Since, 10)}}.Encode()
+	return nil
+}
+
+// encodeUploadSubscriptionsRequest sets the gpodder.net subscriptions path of the device and sends the changes
+func encodeUploadSubscriptionsRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(uploadSubscriptionsRequest)
+	req.URL.Path = req.URL.Path + "/api/2/subscriptions/" + url.PathEscape(r.EmailID) + "/" + url.PathEscape(r.DeviceID) + ".json"
+	return kithttp.EncodeJSONRequest(ctx, req, r.Changes)
+}
+
+// encodeEpisodeActionsRequest sets the gpodder.net episodes path and the query's parameters on the request
+func encodeEpisodeActionsRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(episodeActionsRequest)
+	req.URL.Path = req.URL.Path + "/api/2/episodes/" + url.PathEscape(r.EmailID) + ".json"
+	query := url.Values{"aggregated": {strconv.FormatBool(r.Query.Aggregated)}}
+	if !r.Query.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(r.Query.Since.Unix(), 10))
+	}
+	if r.Query.Podcast != "" {
+		query.Set("podcast", r.Query.Podcast)
+	}
+	if r.Query.Device != "" {
+		query.Set("device", r.Query.Device)
+	}
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// encodeUploadEpisodeActionsRequest sets the gpodder.net episodes path and sends the actions
+func encodeUploadEpisodeActionsRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(uploadEpisodeActionsRequest)
+	req.URL.Path = req.URL.Path + "/api/2/episodes/" + url.PathEscape(r.EmailID) + ".json"
+	return kithttp.EncodeJSONRequest(ctx, req, r.Actions)
+}
+
+func decodeDevicesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var devices []podcastmg.Device
+	err := decodeResponseInto(resp, &devices)
+	return devices, err
+}
+
+func decodeGpodderStatusResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response struct{}
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeSubscriptionChangesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var changes podcastmg.SubscriptionChanges
+	err := decodeResponseInto(resp, &changes)
+	return changes, err
+}
+
+func decodeSyncResultResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var result podcastmg.SyncResult
+	err := decodeResponseInto(resp, &result)
+	return result, err
+}
+
+func decodeEpisodeActionsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var actions podcastmg.EpisodeActions
+	err := decodeResponseInto(resp, &actions)
+	return actions, err
+}
+
+// decodeResponseInto parses the response body into response, translating non-OK responses to errors
+func decodeResponseInto(resp *http.Response, response interface{}) error {
+	if resp.StatusCode != http.StatusOK {
+		return errorFromResponse(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// errorFromResponse rebuilds the error encoded by the server, returning the service error of the code sent where
+// it is known. Other errors are returned as a *service.Error with the code and status sent by the server
+func errorFromResponse(resp *http.Response) error {
+	var body struct {
+		Err  string `json:"err"`
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Err == "" {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+	if known, ok := errorsByCode[body.Code]; ok {
+		return known
+	}
+	return &service.Error{Code: body.Code, Status: resp.StatusCode, Message: body.Err}
+}
+
+func decodeStatusResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response statusResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetUserResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getUserResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetPodcastDetailsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getPodcastDetailsResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetUserSubscriptionsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getUserSubscriptionsResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetSubscriptionDetailsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getSubscriptionDetailsResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetTokenResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getTokenResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeSearchResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response searchResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeDiscoverResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response discoverResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetSubscriptionTotalsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getSubscriptionTotalsResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeSettingsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response settingsResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeLabelResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response labelResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetLabelsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getLabelsResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeQueueResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response queueResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodePlaylistResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response playlistResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetPlaylistsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getPlaylistsResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeWebhookResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response webhookResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeGetWebhooksResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getWebhooksResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeWebhookDeliveriesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response webhookDeliveriesResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+func decodeDigestResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response digestResponse
+	err := decodeResponseInto(resp, &response)
+	return response, err
+}
+
+type credentialsRequest struct {
+	EmailID  string `json:"email_id"`
+	Password string `json:"password"`
+}
+
+type userRequest struct {
+	EmailID string `json:"email_id"`
+}
+
+type podcastRequest struct {
+	EmailID string `json:"email_id,omitempty"`
+	URL     string `json:"url"`
+}
+
+type episodeRequest struct {
+	EmailID string `json:"email_id"`
+	ItemID  uint   `json:"item_id"`
+}
+
+type searchRequest struct {
+	EmailID string `json:"email_id"`
+	Query   string `json:"query"`
+	Scope   string `json:"scope"`
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+}
+
+type searchResponse struct {
+	Results podcastmg.SearchResults `json:"results"`
+	Err     string                  `json:"err,omitempty"`
+}
+
+type discoverRequest struct {
+	List  string `json:"list"`
+	URL   string `json:"url,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+type discoverResponse struct {
+	Podcasts []podcastmg.DirectoryEntry `json:"podcasts"`
+	Err      string                     `json:"err,omitempty"`
+}
+
+type getSubscriptionTotalsResponse struct {
+	Totals []podcastmg.SubscriptionTotals `json:"totals"`
+	Err    string                         `json:"err,omitempty"`
+}
+
+type settingsRequest struct {
+	EmailID  string                         `json:"email_id"`
+	URL      string                         `json:"url"`
+	Settings podcastmg.SubscriptionSettings `json:"settings"`
+}
+
+type settingsResponse struct {
+	Settings podcastmg.SubscriptionSettings `json:"settings"`
+	Err      string                         `json:"err,omitempty"`
+}
+
+type labelRequest struct {
+	EmailID string `json:"email_id"`
+	Kind    string `json:"kind,omitempty"`
+	ID      uint   `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	IDs     []uint `json:"ids,omitempty"`
+}
+
+type labelResponse struct {
+	Label podcastmg.Label `json:"label"`
+	Err   string          `json:"err,omitempty"`
+}
+
+type getLabelsResponse struct {
+	Labels []podcastmg.Label `json:"labels"`
+	Err    string            `json:"err,omitempty"`
+}
+
+type assignLabelsRequest struct {
+	EmailID  string `json:"email_id"`
+	URL      string `json:"url"`
+	FolderID uint   `json:"folder_id,omitempty"`
+	TagIDs   []uint `json:"tag_ids"`
+}
+
+type filterSubscriptionsRequest struct {
+	EmailID  string `json:"email_id"`
+	FolderID uint   `json:"folder_id,omitempty"`
+	TagID    uint   `json:"tag_id,omitempty"`
+}
+
+type updateQueueRequest struct {
+	EmailID string `json:"email_id"`
+	Version int64  `json:"version"`
+	podcastmg.QueueOp
+}
+
+type queueResponse struct {
+	Queue podcastmg.Queue `json:"queue"`
+	Err   string          `json:"err,omitempty"`
+}
+
+type playlistRequest struct {
+	EmailID  string             `json:"email_id"`
+	Playlist podcastmg.Playlist `json:"playlist"`
+}
+
+type playlistItemsRequest struct {
+	EmailID string `json:"email_id"`
+	ID      uint   `json:"id"`
+	ItemIDs []uint `json:"item_ids,omitempty"`
+}
+
+type playlistFeedRequest struct {
+	Secret string `json:"secret"`
+}
+
+type playlistResponse struct {
+	Playlist podcastmg.Playlist `json:"playlist"`
+	Err      string             `json:"err,omitempty"`
+}
+
+type getPlaylistsResponse struct {
+	Playlists []podcastmg.Playlist `json:"playlists"`
+	Err       string               `json:"err,omitempty"`
+}
+
+type webhookRequest struct {
+	EmailID string `json:"email_id"`
+	URL     string `json:"url,omitempty"`
+	ID      uint   `json:"id,omitempty"`
+}
+
+type webhookResponse struct {
+	Webhook podcastmg.Webhook `json:"webhook"`
+	Err     string            `json:"err,omitempty"`
+}
+
+type getWebhooksResponse struct {
+	Webhooks []podcastmg.Webhook `json:"webhooks"`
+	Err      string              `json:"err,omitempty"`
+}
+
+type webhookDeliveriesResponse struct {
+	Deliveries []podcastmg.WebhookDelivery `json:"deliveries"`
+	Err        string                      `json:"err,omitempty"`
+}
+
+type digestRequest struct {
+	EmailID string `json:"email_id"`
+	podcastmg.DigestSettings
+}
+
+type digestResponse struct {
+	Digest podcastmg.DigestSchedule `json:"digest"`
+	Err    string                   `json:"err,omitempty"`
+}
+
+type hubIntentRequest struct {
+	ID uint
+	podcastmg.HubIntent
+	Challenge string
+}
+
+type hubContentRequest struct {
+	ID        uint
+	Signature string
+	Content   []byte
+}
+
+type playbackStatesRequest struct {
+	EmailID string    `json:"email_id"`
+	Since   time.Time `json:"since"`
+}
+
+type playbackStatesResponse struct {
+	States []podcastmg.PlaybackState `json:"states"`
+	Err    string                    `json:"err,omitempty"`
+}
+
+type updatePlaybackRequest struct {
+	EmailID string `json:"email_id"`
+	podcastmg.PlaybackState
+}
+
+type playbackResponse struct {
+	State podcastmg.PlaybackState `json:"state"`
+	Err   string                  `json:"err,omitempty"`
+}
+
+type deviceRequest struct {
+	EmailID string
+	Device  podcastmg.Device
+}
+
+type subscriptionChangesRequest struct {
+	EmailID  string
+	DeviceID string
+	Since    int64
+}
+
+type uploadSubscriptionsRequest struct {
+	EmailID  string
+	DeviceID string
+	Changes  podcastmg.SubscriptionChanges
+}
+
+type episodeActionsRequest struct {
+	EmailID string
+	Query   podcastmg.EpisodeActionQuery
+}
+
+type uploadEpisodeActionsRequest struct {
+	EmailID string
+	Actions []podcastmg.EpisodeAction
+}
+
+type syncRequest struct {
+	EmailID string
+	Token   string
+	Limit   int
+}
+
+type syncResponse struct {
+	podcastmg.SyncDelta
+	Err string `json:"err,omitempty"`
+}
+
+type uploadChangesRequest struct {
+	EmailID string             `json:"-"`
+	Device  string             `json:"device"`
+	Changes []podcastmg.Change `json:"changes"`
+}
+
+type uploadChangesResponse struct {
+	Applied []podcastmg.Change `json:"applied"`
+	Err     string             `json:"err,omitempty"`
+}
+
+type verifyEmailRequest struct {
+	Token string
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	EmailID     string `json:"email_id"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type changeEmailRequest struct {
+	EmailID  string `json:"email_id"`
+	Password string `json:"password"`
+	NewEmail string `json:"new_email"`
+}
+
+type accessTokenRequest struct {
+	EmailID   string     `json:"email_id"`
+	ID        uint       `json:"id,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type accessTokenResponse struct {
+	AccessToken podcastmg.AccessToken `json:"access_token"`
+	Err         string                `json:"err,omitempty"`
+}
+
+type getAccessTokensResponse struct {
+	AccessTokens []podcastmg.AccessToken `json:"access_tokens"`
+	Err          string                  `json:"err,omitempty"`
+}
+
+type exchangeAccessTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type oidcLoginResponse struct {
+	service.OIDCLogin
+	Err string `json:"err,omitempty"`
+}
+
+type completeOIDCLoginRequest struct {
+	Session string `json:"session"`
+	State   string `json:"state"`
+	Code    string `json:"code"`
+}
+
+type unsubscribeDigestRequest struct {
+	Token string
+}
+
+type statusResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+type getUserResponse struct {
+	User podcastmg.User `json:"user"`
+	Err  string         `json:"err,omitempty"`
+}
+
+type getPodcastDetailsResponse struct {
+	Podcast podcastmg.Podcast
+	Err     string `json:"err,omitempty"`
+}
+
+type getUserSubscriptionsResponse struct {
+	Subscriptions []podcastmg.Podcast `json:"subscriptions"`
+	Error         string              `json:"error"`
+}
+
+type getSubscriptionDetailsResponse struct {
+	Podcast podcastmg.Podcast `json:"podcast"`
+	Err     string            `json:"err"`
+}
+
+type getTokenResponse struct {
+	TokenString string `json:"token_string"`
+	Err         string `json:"err,omitempty"`
+}
+
+// mediaBlob is an archive.Blob holding media downloaded from the instance
+type mediaBlob struct {
+	*bytes.Reader
+	modTime time.Time
+}
+
+func (b mediaBlob) Close() error {
+	return nil
+}
+
+func (b mediaBlob) ModTime() time.Time {
+	return b.modTime
+}
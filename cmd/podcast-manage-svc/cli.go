@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/tchaudhry91/podcast-manage-svc/client"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/service"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	// ErrNoInstance indicates that no instance was configured for a client command
+	ErrNoInstance = errors.New("No instance configured, pass -instance or run login")
+
+	// ErrNotLoggedIn indicates that a client command needs a token but none is cached
+	ErrNotLoggedIn = errors.New("Not logged in, run login first")
+
+	// ErrSessionExpired indicates that the cached token is no longer accepted by the instance
+	ErrSessionExpired = errors.New("Session expired, run login again")
+)
+
+// command is a client subcommand of the binary
+type command struct {
+	args  string
+	usage string
+	run   func(cf *commandFlags, args []string) error
+}
+
+func commands() map[string]command {
+	return map[string]command{
+		"register":    {"", "Register a new user on the instance", runRegister},
+		"login":       {"", "Log in and cache the token in the config file", runLogin},
+		"subscribe":   {"<feed-url>...", "Subscribe to podcast feeds", runSubscribe},
+		"unsubscribe": {"<feed-url>...", "Unsubscribe from podcast feeds", runUnsubscribe},
+		"list":        {"", "List subscriptions", runList},
+		"episodes":    {"<feed-url>", "List the episodes of a subscription", runEpisodes},
+		"refresh":     {"[feed-url]...", "Check subscriptions for new episodes, all of them if none are given", runRefresh},
+		"import-opml": {"<file>", "Subscribe to all feeds of an OPML file", runImportOPML},
+		"export-opml": {"", "Write subscriptions as an OPML file to stdout, folders become outlines", runExportOPML},
+	}
+}
+
+// commandFlags are the flags shared by all client subcommands
+type commandFlags struct {
+	fs         *flag.FlagSet
+	configPath string
+	instance   string
+	output     string
+	email      string
+	password   string
+}
+
+func newCommandFlags(name string, cmd command) *commandFlags {
+	cf := commandFlags{fs: flag.NewFlagSet(name, flag.ExitOnError)}
+	cf.fs.StringVar(&cf.configPath, "config", defaultConfigPath(), "Path of the client config file")
+	cf.fs.StringVar(&cf.instance, "instance", "", "Address of the podcast-manage-svc instance, overrides the config file")
+	cf.fs.StringVar(&cf.output, "o", "table", "Output format, table or json")
+	cf.fs.StringVar(&cf.email, "email", "", "Email of the user, for register and login")
+	cf.fs.StringVar(&cf.password, "password", "", "Password of the user, for register and login. Read from stdin if empty")
+	cf.fs.Usage = func() {
+		fmt.Fprintf(cf.fs.Output(), "Usage: %s %s [flags] %s\n%s\n\n", os.Args[0], name, cmd.args, cmd.usage)
+		cf.fs.PrintDefaults()
+	}
+	return &cf
+}
+
+// runCommand parses the flags of the named subcommand and runs it
+func runCommand(name string, args []string) error {
+	cmd := commands()[name]
+	cf := newCommandFlags(name, cmd)
+	cf.fs.Parse(args)
+	if cf.output != "table" && cf.output != "json" {
+		return fmt.Errorf("Unknown output format: %s", cf.output)
+	}
+	return cmd.run(cf, cf.fs.Args())
+}
+
+// printCommands prints the available client subcommands
+func printCommands(w io.Writer) {
+	var names []string
+	for name := range commands() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "\nClient commands, run '%s <command> -h' for details:\n", os.Args[0])
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands()[name].usage)
+	}
+	tw.Flush()
+}
+
+// session is a configured client along with the config it was built from
+type session struct {
+	config cliConfig
+	client *client.Client
+}
+
+// newSession builds a client from the config file and flags, requireToken demands a cached token
+func (cf *commandFlags) newSession(requireToken bool) (*session, error) {
+	config, err := loadConfig(cf.configPath)
+	if err != nil {
+		return nil, err
+	}
+	if cf.instance != "" {
+		config.Instance = cf.instance
+	}
+	if config.Instance == "" {
+		return nil, ErrNoInstance
+	}
+	if requireToken && config.Token == "" {
+		return nil, ErrNotLoggedIn
+	}
+	c, err := client.New(config.Instance, client.WithToken(config.Token))
+	if err != nil {
+		return nil, err
+	}
+	return &session{config, c}, nil
+}
+
+// credentials returns the email and password from the flags, prompting for the password if needed
+func (cf *commandFlags) credentials() (string, string, error) {
+	if cf.email == "" {
+		return "", "", errors.New("Email is required, pass -email")
+	}
+	if cf.password != "" {
+		return cf.email, cf.password, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", "", errors.New("Password cannot be empty")
+	}
+	return cf.email, password, nil
+}
+
+// sessionError turns token rejections and revocations into a hint to log in again
+func sessionError(err error) error {
+	switch {
+	case err == kitjwt.ErrTokenExpired, err == kitjwt.ErrTokenInvalid, err == kitjwt.ErrTokenNotActive:
+		return ErrSessionExpired
+	case errors.Is(err, service.ErrTokenRevoked):
+		return ErrSessionExpired
+	default:
+		return err
+	}
+}
+
+// printOutput writes v as JSON or calls table with a tabwriter according to the output flag
+func (cf *commandFlags) printOutput(v interface{}, table func(w io.Writer)) error {
+	if cf.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+// feedResult is the outcome of an operation on a single feed
+type feedResult struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+// printFeedResults prints per-feed results and returns an error if any of them failed
+func (cf *commandFlags) printFeedResults(results []feedResult) error {
+	err := cf.printOutput(results, func(w io.Writer) {
+		fmt.Fprintln(w, "FEED\tSTATUS\tERROR")
+		for _, result := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", result.URL, result.Status, result.Err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Err != "" {
+			return errors.New("Some feeds failed")
+		}
+	}
+	return nil
+}
+
+// forEachFeed applies op to every feed url and collects the results
+func forEachFeed(urls []string, status string, op func(url string) error) []feedResult {
+	var results []feedResult
+	for _, url := range urls {
+		result := feedResult{URL: url, Status: status}
+		if err := op(url); err != nil {
+			result.Status = "failed"
+			result.Err = sessionError(err).Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func runRegister(cf *commandFlags, args []string) error {
+	s, err := cf.newSession(false)
+	if err != nil {
+		return err
+	}
+	email, password, err := cf.credentials()
+	if err != nil {
+		return err
+	}
+	if err = s.client.CreateUser(context.Background(), email, password); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Registered %s, run login to start a session\n", email)
+	return nil
+}
+
+func runLogin(cf *commandFlags, args []string) error {
+	s, err := cf.newSession(false)
+	if err != nil {
+		return err
+	}
+	email, password, err := cf.credentials()
+	if err != nil {
+		return err
+	}
+	token, err := s.client.GetToken(context.Background(), email, password)
+	if err != nil {
+		return err
+	}
+	s.config.EmailID = email
+	s.config.Token = token
+	if err = saveConfig(cf.configPath, s.config); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Logged in as %s\n", email)
+	return nil
+}
+
+func runSubscribe(cf *commandFlags, args []string) error {
+	if len(args) == 0 {
+		return errors.New("At least one feed url is required")
+	}
+	s, err := cf.newSession(true)
+	if err != nil {
+		return err
+	}
+	results := forEachFeed(args, "subscribed", func(url string) error {
+		return s.client.Subscribe(context.Background(), s.config.EmailID, url)
+	})
+	return cf.printFeedResults(results)
+}
+
+func runUnsubscribe(cf *commandFlags, args []string) error {
+	if len(args) == 0 {
+		return errors.New("At least one feed url is required")
+	}
+	s, err := cf.newSession(true)
+	if err != nil {
+		return err
+	}
+	results := forEachFeed(args, "unsubscribed", func(url string) error {
+		return s.client.Unsubscribe(context.Background(), s.config.EmailID, url)
+	})
+	return cf.printFeedResults(results)
+}
+
+func runList(cf *commandFlags, args []string) error {
+	s, err := cf.newSession(true)
+	if err != nil {
+		return err
+	}
+	subscriptions, err := s.client.GetUserSubscriptions(context.Background(), s.config.EmailID)
+	if err != nil {
+		return sessionError(err)
+	}
+	return cf.printOutput(subscriptions, func(w io.Writer) {
+		fmt.Fprintln(w, "TITLE\tURL")
+		for _, podcast := range subscriptions {
+			fmt.Fprintf(w, "%s\t%s\n", podcast.Title, podcast.URL)
+		}
+	})
+}
+
+func runEpisodes(cf *commandFlags, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Exactly one feed url is required")
+	}
+	s, err := cf.newSession(true)
+	if err != nil {
+		return err
+	}
+	podcast, err := s.client.GetSubscriptionDetails(context.Background(), s.config.EmailID, args[0])
+	if err != nil {
+		return sessionError(err)
+	}
+	return cf.printOutput(podcast.PodcastItems, func(w io.Writer) {
+		fmt.Fprintln(w, "PUBLISHED\tTITLE\tPLAYED\tMEDIA")
+		for _, item := range podcast.PodcastItems {
+			published := ""
+			if item.Published != nil {
+				published = item.Published.Format("2006-01-02")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", published, item.Title, item.Played, item.MediaURL)
+		}
+	})
+}
+
+func runRefresh(cf *commandFlags, args []string) error {
+	s, err := cf.newSession(true)
+	if err != nil {
+		return err
+	}
+	urls := args
+	if len(urls) == 0 {
+		subscriptions, err := s.client.GetUserSubscriptions(context.Background(), s.config.EmailID)
+		if err != nil {
+			return sessionError(err)
+		}
+		for _, podcast := range subscriptions {
+			urls = append(urls, podcast.URL)
+		}
+	}
+	results := forEachFeed(urls, "refreshed", func(url string) error {
+		return s.client.UpdatePodcast(context.Background(), s.config.EmailID, url)
+	})
+	return cf.printFeedResults(results)
+}
+
+func runImportOPML(cf *commandFlags, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Exactly one OPML file is required")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	opml, err := podcastmg.ParseOPML(f)
+	if err != nil {
+		return err
+	}
+	s, err := cf.newSession(true)
+	if err != nil {
+		return err
+	}
+	results := forEachFeed(opml.FeedURLs(), "subscribed", func(url string) error {
+		return s.client.Subscribe(context.Background(), s.config.EmailID, url)
+	})
+	return cf.printFeedResults(results)
+}
+
+func runExportOPML(cf *commandFlags, args []string) error {
+	s, err := cf.newSession(true)
+	if err != nil {
+		return err
+	}
+	opml, err := s.client.ExportOPML(context.Background(), s.config.EmailID)
+	if err != nil {
+		return sessionError(err)
+	}
+	if _, err = io.WriteString(os.Stdout, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(os.Stdout)
+	enc.Indent("", "  ")
+	if err = enc.Encode(opml); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout)
+	return err
+}
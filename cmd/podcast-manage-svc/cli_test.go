@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/tchaudhry91/podcast-manage-svc/service"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCLIFlags(t *testing.T) {
+	type flagsTestCase struct {
+		name         string
+		args         []string
+		wantInstance string
+		wantOutput   string
+		wantEmail    string
+		wantArgs     []string
+	}
+	testCases := []flagsTestCase{
+		{"Defaults", []string{"https://feed.test/rss"}, "", "table", "", []string{"https://feed.test/rss"}},
+		{"Flags Before Arguments", []string{"-instance", "pmg.test", "-o", "json", "-email", "a@test.com", "one", "two"},
+			"pmg.test", "json", "a@test.com", []string{"one", "two"}},
+		{"Flags After Arguments", []string{"one", "-o", "json"}, "", "table", "", []string{"one", "-o", "json"}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			cf := newCommandFlags("subscribe", commands()["subscribe"])
+			if err := cf.fs.Parse(test.args); err != nil {
+				t.Fatalf("Failed to parse flags:%v", err)
+			}
+			if cf.instance != test.wantInstance || cf.output != test.wantOutput || cf.email != test.wantEmail ||
+				!reflect.DeepEqual(cf.fs.Args(), test.wantArgs) {
+				t.Errorf("Want:%s %s %s %v\tHave:%s %s %s %v", test.wantInstance, test.wantOutput, test.wantEmail, test.wantArgs,
+					cf.instance, cf.output, cf.email, cf.fs.Args())
+			}
+		})
+	}
+}
+
+func TestCLICommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmg-cli")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	config := path.Join(dir, "config.json")
+
+	// None of the cases reach the instance, they fail on their arguments or the config first
+	type commandTestCase struct {
+		name    string
+		command string
+		args    []string
+		wantErr string
+	}
+	testCases := []commandTestCase{
+		{"Unknown Output", "list", []string{"-o", "xml"}, "Unknown output format: xml"},
+		{"No Instance", "list", nil, ErrNoInstance.Error()},
+		{"Not Logged In", "list", []string{"-instance", "127.0.0.1:1"}, ErrNotLoggedIn.Error()},
+		{"Subscribe Without Feeds", "subscribe", nil, "At least one feed url is required"},
+		{"Unsubscribe Without Feeds", "unsubscribe", nil, "At least one feed url is required"},
+		{"Episodes Of Two Feeds", "episodes", []string{"one", "two"}, "Exactly one feed url is required"},
+		{"Import Without File", "import-opml", nil, "Exactly one OPML file is required"},
+		{"Register Without Email", "register", []string{"-instance", "127.0.0.1:1"}, "Email is required, pass -email"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := runCommand(test.command, append([]string{"-config", config}, test.args...))
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("Want:%s\tHave:%v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCLISessionError(t *testing.T) {
+	other := errors.New("Connection refused")
+	type sessionTestCase struct {
+		name string
+		err  error
+		want error
+	}
+	testCases := []sessionTestCase{
+		{"Expired Token", kitjwt.ErrTokenExpired, ErrSessionExpired},
+		{"Invalid Token", kitjwt.ErrTokenInvalid, ErrSessionExpired},
+		{"Token Not Active", kitjwt.ErrTokenNotActive, ErrSessionExpired},
+		{"Revoked Token", service.ErrTokenRevoked, ErrSessionExpired},
+		{"Revoked Token With Cause", service.ErrTokenRevoked.Wrap(other), ErrSessionExpired},
+		{"Service Error", service.ErrPodcastBuild, service.ErrPodcastBuild},
+		{"Other Error", other, other},
+		{"No Error", nil, nil},
+	}
+	for _, test := range testCases {
+		if err := sessionError(test.err); err != test.want {
+			t.Errorf("%s\tWant:%v\tHave:%v", test.name, test.want, err)
+		}
+	}
+
+	// Feeds failing on a revoked token are reported with the hint to log in again
+	results := forEachFeed([]string{"one", "two"}, "subscribed", func(url string) error {
+		if url == "two" {
+			return service.ErrTokenRevoked
+		}
+		return nil
+	})
+	want := []feedResult{{URL: "one", Status: "subscribed"}, {URL: "two", Status: "failed", Err: ErrSessionExpired.Error()}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Want:%+v\tHave:%+v", want, results)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// cliConfig is persisted between command invocations and holds the instance and the cached token
+type cliConfig struct {
+	Instance string `json:"instance"`
+	EmailID  string `json:"email_id"`
+	Token    string `json:"token"`
+}
+
+// defaultConfigPath returns the location of the config file in the user's home directory
+func defaultConfigPath() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "podcast-manage-svc", "config.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "podcast-manage-svc", "config.json")
+}
+
+// loadConfig reads the config file, a missing file results in an empty config
+func loadConfig(configPath string) (cliConfig, error) {
+	var config cliConfig
+	data, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
+
+// saveConfig writes the config file, readable only by the user since it holds the token
+func saveConfig(configPath string, config cliConfig) error {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configPath, data, 0600)
+}
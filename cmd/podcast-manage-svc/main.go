@@ -1,15 +1,41 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/go-kit/kit/log"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/digest"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/mail"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/ratelimit"
 	"github.com/tchaudhry91/podcast-manage-svc/service"
+	"github.com/tchaudhry91/podcast-manage-svc/signing"
+	"github.com/tchaudhry91/podcast-manage-svc/webhook"
+	"github.com/tchaudhry91/podcast-manage-svc/websub"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
+	// Client subcommands talk to a running instance instead of serving
+	if len(os.Args) > 1 {
+		if _, ok := commands()[os.Args[1]]; ok {
+			if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var (
 		httpAddr         = flag.String("http.addr", ":8080", "HTTP listen address")
 		dbDialect        = flag.String("db.dialect", "postgres", "Dialect of the Database to talk to")
@@ -19,7 +45,47 @@ func main() {
 		dbName           = flag.String("db.name", "podcastmg", "Name of the database to connect to")
 		dbSSLMode        = flag.String("db.sslmode", "disable", "SSLMode enable/disable when applicable")
 		svcSigningSecret = flag.String("svc.signingSharedSecret", "", "Token Signing Secret for the service")
+		jwtKeyDir        = flag.String("jwt.keyDir", "", "Directory of <kid>.pem RSA or Ed25519 keys signing tokens, the private key whose kid sorts last signs. Reloaded on SIGHUP")
+		archiveDir       = flag.String("archive.dir", "", "Directory to archive episode media in, archiving is disabled if empty")
+		archiveUserQuota = flag.Int64("archive.userQuota", 0, "Bytes of archived media allowed per user, 0 for unlimited")
+		archiveQuota     = flag.Int64("archive.globalQuota", 0, "Bytes of archived media allowed in total, 0 for unlimited")
+		archiveTimeout   = flag.Duration("archive.timeout", archive.DefaultTimeout, "Longest time a single media download may take")
+		dirRefresh       = flag.Duration("directory.refresh", 15*time.Minute, "Interval after which the podcast directory is recomputed")
+		dirTrending      = flag.Duration("directory.trendingWindow", 7*24*time.Hour, "Period of new subscriptions counted towards trending podcasts")
+		hookAttempts     = flag.Int("webhooks.attempts", 8, "Attempts at a webhook delivery before it is dead-lettered")
+		hookBackoff      = flag.Duration("webhooks.backoff", 30*time.Second, "Delay after the first failed webhook delivery, doubled for every further attempt")
+		hookInterval     = flag.Duration("webhooks.interval", 10*time.Second, "Interval at which the webhook outbox is checked for due deliveries")
+		svcBaseURL       = flag.String("svc.baseURL", "http://localhost:8080", "Public url of the service, used in the links of emails")
+		mailSMTP         = flag.String("mail.smtp", "", "Address (host:port) of the SMTP server sending emails")
+		mailUser         = flag.String("mail.user", "", "User to authenticate with at the SMTP server, no authentication if empty")
+		mailPassword     = flag.String("mail.password", "", "Password to authenticate with at the SMTP server")
+		mailFrom         = flag.String("mail.from", "podcasts@localhost", "Sender address of emails")
+		mailDir          = flag.String("mail.dir", "", "Directory to write emails into instead of sending them, used when no SMTP server is set")
+		digestInterval   = flag.Duration("digest.interval", time.Minute, "Interval at which due email digests are sent")
+		websubEnabled    = flag.Bool("websub.enabled", false, "Subscribe to the WebSub hubs of feeds, callbacks are served under svc.baseURL which has to be public")
+		websubLease      = flag.Duration("websub.lease", 10*24*time.Hour, "Lease asked for in hub subscriptions, they are renewed before it expires")
+		websubRetry      = flag.Duration("websub.retry", time.Hour, "Delay after which a hub request which was not verified is sent again")
+		eventsBuffer     = flag.Int("events.buffer", 64, "Events held for each live event stream, streams falling further behind are closed")
+		passwordHasher   = flag.String("password.hasher", "bcrypt", "Algorithm hashing new passwords, bcrypt or argon2id. Older hashes are replaced on login")
+		bcryptCost       = flag.Int("password.bcryptCost", bcrypt.DefaultCost, "Cost of bcrypt password hashes")
+		argon2Time       = flag.Uint("password.argon2Time", 3, "Passes over memory of argon2id password hashes")
+		argon2Memory     = flag.Uint("password.argon2Memory", 64*1024, "KiB of memory used by argon2id password hashes")
+		argon2Threads    = flag.Uint("password.argon2Threads", 4, "Threads computing argon2id password hashes")
+		loginAttempts    = flag.Int("login.attempts", 10, "Password checks allowed per account and per client address within login.window")
+		loginWindow      = flag.Duration("login.window", time.Minute, "Window in which login.attempts are allowed")
+		loginThreshold   = flag.Int("login.lockoutThreshold", 5, "Wrong passwords after which an account or client address is locked out")
+		loginLockout     = flag.Duration("login.lockout", time.Minute, "Lockout after login.lockoutThreshold wrong passwords, doubled for every further one")
+		loginMaxLockout  = flag.Duration("login.maxLockout", time.Hour, "Longest lockout after wrong passwords")
+		loginForwarded   = flag.Bool("login.forwardedFor", false, "Take client addresses from X-Forwarded-For, only to be set behind a proxy setting the header")
+		oidcIssuer       = flag.String("oidc.issuer", "", "Issuer url of the OpenID Connect provider users may log in with, disabled if empty")
+		oidcClientID     = flag.String("oidc.clientID", "", "Client id of the service at the OpenID Connect provider")
+		oidcClientSecret = flag.String("oidc.clientSecret", "", "Client secret of the service at the OpenID Connect provider")
 	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		printCommands(flag.CommandLine.Output())
+	}
 	flag.Parse()
 
 	var logger log.Logger
@@ -31,28 +97,144 @@ func main() {
 
 	dbConnString := BuildDBConnString(*dbDialect, *dbHostname, *dbUser, *dbPassword, *dbName, *dbSSLMode)
 
+	// Emails are logged if neither an SMTP server nor a mail directory is set
+	var mailer mail.Mailer = mail.NewLogMailer(log.With(logger, "component", "mail"))
+	if *mailSMTP != "" {
+		mailer = mail.NewSMTPMailer(*mailSMTP, *mailFrom, *mailUser, *mailPassword)
+	} else if *mailDir != "" {
+		mailer = mail.NewFileMailer(*mailDir, *mailFrom)
+	}
+
+	var hasher podcastmg.PasswordHasher
+	switch *passwordHasher {
+	case "bcrypt":
+		hasher = podcastmg.BcryptHasher{Cost: *bcryptCost}
+	case "argon2id":
+		hasher = podcastmg.Argon2idHasher{Time: uint32(*argon2Time), Memory: uint32(*argon2Memory), Threads: uint8(*argon2Threads)}
+	default:
+		logger.Log("err", "unknown password hasher "+*passwordHasher)
+		panic("Could not create password hasher")
+	}
+
+	// Tokens signed with the shared secret carry no kid, they stay valid alongside the keys of jwt.keyDir until
+	// they expire. The secret is retired by leaving it empty, a key to sign with is required either way
+	var legacyKeys []signing.Key
+	if *svcSigningSecret != "" {
+		legacyKeys = append(legacyKeys, signing.NewHMACKey("", []byte(*svcSigningSecret)))
+	}
+	var keys *signing.KeySet
+	var err error
+	switch {
+	case *jwtKeyDir != "":
+		keys, err = signing.LoadDir(*jwtKeyDir, legacyKeys...)
+	case len(legacyKeys) > 0:
+		keys, err = signing.NewKeySet(legacyKeys[0])
+	default:
+		err = signing.ErrNoSigningKey
+	}
+	if err != nil {
+		logger.Log("err", err.Error())
+		panic("Could not load signing keys")
+	}
+	if *jwtKeyDir != "" {
+		go reloadKeys(keys, *jwtKeyDir, legacyKeys, log.With(logger, "component", "signing"))
+	}
+
+	// The podcast directory is computed in the background with a store of its own, once the service migrated the DB
+	directory := service.NewDirectory(podcastmg.NewDBStore(*dbDialect, dbConnString), log.With(logger, "component", "directory"),
+		*dirRefresh, *dirTrending)
+
+	// Live events are passed within this process, replicas behind a load balancer need a shared events.Broker
+	options := []service.Option{
+		service.WithDirectory(directory),
+		service.WithBroker(events.NewMemoryBroker(*eventsBuffer)),
+		service.WithMailer(mailer, *svcBaseURL),
+		service.WithPasswordHasher(hasher),
+		service.WithSigningKeys(keys),
+	}
+	if *archiveDir != "" {
+		blobs, err := archive.NewFSBlobStore(*archiveDir)
+		if err != nil {
+			logger.Log("err", err.Error())
+			panic("Could not create media archive")
+		}
+		archiver := archive.NewArchiver(blobs, archive.UserQuota(*archiveUserQuota), archive.GlobalQuota(*archiveQuota),
+			archive.HTTPClient(&http.Client{Timeout: *archiveTimeout}))
+		options = append(options, service.WithArchiver(archiver))
+	}
+
+	// The provider sends users back to the callback under svc.baseURL, it has to be registered with the provider
+	if *oidcIssuer != "" {
+		config := oidc.Config{Issuer: *oidcIssuer, ClientID: *oidcClientID, ClientSecret: *oidcClientSecret,
+			RedirectURL: *svcBaseURL + service.OIDCCallbackPath}
+		provider, err := oidc.Discover(context.Background(), config, &http.Client{Timeout: 30 * time.Second})
+		if err != nil {
+			logger.Log("err", err.Error())
+			panic("Could not discover OpenID Connect provider")
+		}
+		options = append(options, service.WithOIDC(provider))
+	}
+
 	// Base Service
 	var svc service.PodcastManageService
 	{
 		var err error
-		svc, err = service.NewSQLStorePodcastManageService(*dbDialect, dbConnString, *svcSigningSecret, logger)
+		svc, err = service.NewSQLStorePodcastManageService(*dbDialect, dbConnString, *svcSigningSecret, logger, options...)
 		if err != nil {
 			logger.Log("err", err.Error())
 			panic("Could not create service")
 		}
 	}
 
+	go directory.Run(context.Background())
+
+	// Webhook deliveries are sent in the background with a store of their own
+	dispatcher := webhook.NewDispatcher(podcastmg.NewDBStore(*dbDialect, dbConnString), log.With(logger, "component", "webhooks"),
+		webhook.MaxAttempts(*hookAttempts), webhook.Backoff(*hookBackoff, 6*time.Hour), webhook.PollInterval(*hookInterval))
+	go dispatcher.Run(context.Background())
+
+	digests := digest.NewSender(podcastmg.NewDBStore(*dbDialect, dbConnString), mailer, *svcBaseURL, log.With(logger, "component", "digest"),
+		digest.PollInterval(*digestInterval))
+	go digests.Run(context.Background())
+
+	// Hubs reach the service through svc.baseURL, it must be public for push updates
+	if *websubEnabled {
+		subscriber := websub.NewSubscriber(podcastmg.NewDBStore(*dbDialect, dbConnString), *svcBaseURL, log.With(logger, "component", "websub"),
+			websub.Lease(*websubLease), websub.Retry(*websubRetry))
+		go subscriber.Run(context.Background())
+	}
+
 	// Middlewares
+	// Login attempts are counted within this process, replicas behind a load balancer need a shared ratelimit.Store
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Rate(*loginAttempts, *loginWindow),
+		ratelimit.Lockout(*loginThreshold, *loginLockout, *loginMaxLockout))
+	svc = service.MakeLoginLimitMiddleware(log.With(logger, "component", "login"), limiter, *loginForwarded, svc)
 	svc = service.MakeNewLoggingMiddleware(logger, svc)
 
 	var h http.Handler
 	{
-		h = service.MakeHTTPHandler(svc, *svcSigningSecret, logger)
+		h = service.MakeHTTPHandler(svc, keys, logger)
 	}
 
 	http.ListenAndServe(*httpAddr, h)
 }
 
+// reloadKeys loads the keys of the directory again on every SIGHUP, keys are rotated by adding the file of the new
+// key and removing those of keys whose tokens expired. The current keys are kept if the directory fails to load
+func reloadKeys(keys *signing.KeySet, dir string, legacyKeys []signing.Key, logger log.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		reloaded, err := signing.LoadDir(dir, legacyKeys...)
+		if err != nil {
+			logger.Log("err", err)
+			continue
+		}
+		keys.Replace(reloaded)
+		logger.Log("keys", "reload", "dir", dir)
+	}
+}
+
 // BuildDBConnString returns a GORM connection string from the given parameters
 func BuildDBConnString(dialect, hostname, user, password, name, sslmode string) (connString string) {
 	switch dialect {
@@ -0,0 +1,2 @@
+// Package digest emails users a daily or weekly summary of the new episodes of their subscriptions.
+package digest
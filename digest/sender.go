@@ -0,0 +1,204 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/tchaudhry91/podcast-manage-svc/mail"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// UnsubscribePath is the path of the service's unsubscribe links, the digest token is passed in the token query parameter
+const UnsubscribePath = "/digest/unsubscribe"
+
+var funcs = map[string]interface{}{
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format("Jan 2, 2006")
+	},
+}
+
+var textTemplate = texttemplate.Must(texttemplate.New("text").Funcs(funcs).Parse(`{{.Count}} new episode{{if ne .Count 1}}s{{end}} from your subscriptions
+
+{{range .Podcasts}}{{.Title}}
+{{range .Episodes}}  - {{.Title}}{{with date .Published}} ({{.}}){{end}}{{with .MediaURL}}
+    {{.}}{{end}}
+{{end}}
+{{end}}You receive this {{.Frequency}} digest because you turned it on.
+Unsubscribe: {{.UnsubscribeURL}}
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<body>
+<h1>{{.Count}} new episode{{if ne .Count 1}}s{{end}} from your subscriptions</h1>
+{{range .Podcasts}}<h2>{{.Title}}</h2>
+<ul>
+{{range .Episodes}}<li>{{if .MediaURL}}<a href="{{.MediaURL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}{{with date .Published}} <small>{{.}}</small>{{end}}</li>
+{{end}}</ul>
+{{end}}<p><small>You receive this {{.Frequency}} digest because you turned it on. <a href="{{.UnsubscribeURL}}">Unsubscribe</a></small></p>
+</body>
+</html>
+`))
+
+// Podcast is a podcast of a digest with its new episodes
+type Podcast struct {
+	Title    string
+	URL      string
+	Episodes []podcastmg.PlaylistItem
+}
+
+// Digest is the content of a digest email
+type Digest struct {
+	Frequency      string
+	Count          int
+	Podcasts       []Podcast
+	UnsubscribeURL string
+}
+
+// New returns the digest of the episodes, which are grouped by podcast in the order given
+func New(frequency string, episodes []podcastmg.PlaylistItem, unsubscribeURL string) Digest {
+	digest := Digest{Frequency: frequency, Count: len(episodes), UnsubscribeURL: unsubscribeURL}
+	for _, episode := range episodes {
+		if n := len(digest.Podcasts); n == 0 || digest.Podcasts[n-1].URL != episode.PodcastURL {
+			digest.Podcasts = append(digest.Podcasts, Podcast{Title: episode.PodcastTitle, URL: episode.PodcastURL})
+		}
+		podcast := &digest.Podcasts[len(digest.Podcasts)-1]
+		podcast.Episodes = append(podcast.Episodes, episode)
+	}
+	return digest
+}
+
+// Message returns the digest as an email to the given address with plain text and HTML bodies
+func (digest Digest) Message(to string) (mail.Message, error) {
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, digest); err != nil {
+		return mail.Message{}, err
+	}
+	if err := htmlTemplate.Execute(&html, digest); err != nil {
+		return mail.Message{}, err
+	}
+	subject := fmt.Sprintf("Your %s podcast digest: %d new episode", digest.Frequency, digest.Count)
+	if digest.Count != 1 {
+		subject += "s"
+	}
+	return mail.Message{
+		To:      to,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + digest.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// UnsubscribeURL returns the link turning off the digest with the given token on the service at baseURL
+func UnsubscribeURL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + UnsubscribePath + "?token=" + url.QueryEscape(token)
+}
+
+// Sender emails the digests which are due. A digest without new episodes is skipped, a digest which could not
+// be sent lists its episodes again in the next digest
+type Sender struct {
+	store    podcastmg.Store
+	mailer   mail.Mailer
+	baseURL  string
+	logger   log.Logger
+	interval time.Duration
+	batch    int
+	now      func() time.Time
+}
+
+// Option configures a Sender
+type Option func(*Sender)
+
+// PollInterval sets the interval at which Run checks for due digests
+func PollInterval(interval time.Duration) Option {
+	return func(s *Sender) {
+		s.interval = interval
+	}
+}
+
+// NewSender returns a Sender for the digests of the store, unsubscribe links point to the service at baseURL.
+// The store is connected for every round of digests, it should not be shared with the service
+func NewSender(store podcastmg.Store, mailer mail.Mailer, baseURL string, logger log.Logger, options ...Option) *Sender {
+	s := Sender{
+		store:    store,
+		mailer:   mailer,
+		baseURL:  baseURL,
+		logger:   logger,
+		interval: time.Minute,
+		batch:    50,
+		now:      time.Now,
+	}
+	for _, option := range options {
+		option(&s)
+	}
+	return &s
+}
+
+// Run sends due digests every poll interval until the context is done
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SendDue(ctx); err != nil {
+			s.logger.Log("err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue sends every due digest and returns the number of emails sent
+func (s *Sender) SendDue(ctx context.Context) (int, error) {
+	if err := s.store.Connect(); err != nil {
+		return 0, err
+	}
+	defer s.store.Close()
+
+	now := s.now()
+	due, err := s.store.ClaimDueDigests(now, s.batch)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, digest := range due {
+		since := now.AddDate(0, 0, -7)
+		if digest.LastSentAt != nil {
+			since = *digest.LastSentAt
+		}
+		episodes, err := s.store.GetNewEpisodes(digest.UserID, since, now, podcastmg.MaxDigestItems)
+		if err != nil {
+			return sent, err
+		}
+		if len(episodes) > 0 {
+			msg, err := New(digest.Frequency, episodes, UnsubscribeURL(s.baseURL, digest.Token)).Message(digest.UserEmail)
+			if err == nil {
+				err = s.mailer.Send(ctx, msg)
+			}
+			if err != nil {
+				s.logger.Log("user", digest.UserEmail, "episodes", len(episodes), "err", err)
+				continue
+			}
+			sent++
+		}
+		if err = s.store.MarkDigestSent(digest.UserID, now); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,104 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/tchaudhry91/podcast-manage-svc/mail"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder is a Mailer keeping the messages it is asked to send
+type recorder struct {
+	messages []mail.Message
+	err      error
+}
+
+func (r *recorder) Send(ctx context.Context, msg mail.Message) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func TestSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmg-digest")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	store := podcastmg.NewDBStore("sqlite3", path.Join(dir, "digest.db"))
+
+	email := "digest@test.com"
+	enabled := time.Now().Add(-time.Hour)
+	published := time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC)
+	var schedule podcastmg.DigestSchedule
+	func() {
+		store.Connect()
+		defer store.Close()
+		store.Migrate()
+		user := podcastmg.User{UserEmail: email, Password: "x", Podcasts: []podcastmg.Podcast{
+			{Title: "Alpha Cast", URL: "alpha.test/xml", PodcastItems: []podcastmg.PodcastItem{
+				{Title: "Alpha Old", CreatedAt: enabled.Add(-time.Minute)},
+				{Title: "Alpha New", MediaURL: "https://media.test/alpha.mp3", Published: &published, CreatedAt: enabled.Add(time.Minute)},
+			}},
+			{Title: "Beta Cast", URL: "beta.test/xml", PodcastItems: []podcastmg.PodcastItem{
+				{Title: "Beta <New>", CreatedAt: enabled.Add(time.Minute)},
+			}},
+		}}
+		if err = store.CreateUser(&user); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+		if err = store.Database.Model(&podcastmg.Subscription{}).Where("user_id = ?", user.ID).UpdateColumn("notifications", true).Error; err != nil {
+			t.Fatalf("Failed to enable notifications:%v", err)
+		}
+		if schedule, err = store.SetDigestSettings(email, podcastmg.DigestSettings{Frequency: podcastmg.DigestDaily}, enabled); err != nil {
+			t.Fatalf("Failed to set digest settings:%v", err)
+		}
+	}()
+
+	mailer := recorder{err: errors.New("SMTP unavailable")}
+	now := *schedule.NextAt
+	s := NewSender(store, &mailer, "https://podcasts.test/", log.NewNopLogger())
+	s.now = func() time.Time { return now }
+	send := func(want int) {
+		if sent, err := s.SendDue(context.Background()); err != nil || sent != want {
+			t.Fatalf("Sent Want:%d\tHave:%d %v", want, sent, err)
+		}
+	}
+
+	// A digest which failed is sent with the same episodes the next day
+	send(0)
+	mailer.err = nil
+	send(0)
+	now = now.Add(24 * time.Hour)
+	send(1)
+	now = now.Add(24 * time.Hour)
+	send(0)
+
+	msg := mailer.messages[0]
+	unsubscribe := "https://podcasts.test/digest/unsubscribe?token=" + schedule.Token
+	if msg.To != email || msg.Subject != "Your daily podcast digest: 2 new episodes" || msg.Headers["List-Unsubscribe"] != "<"+unsubscribe+">" {
+		t.Errorf("Unexpected message:%+v", msg)
+	}
+	wantText := "2 new episodes from your subscriptions\n\n" +
+		"Alpha Cast\n  - Alpha New (Jan 2, 2018)\n    https://media.test/alpha.mp3\n\n" +
+		"Beta Cast\n  - Beta <New>\n\n" +
+		"You receive this daily digest because you turned it on.\nUnsubscribe: " + unsubscribe + "\n"
+	if msg.Text != wantText {
+		t.Errorf("Text Want:%q\tHave:%q", wantText, msg.Text)
+	}
+	for _, want := range []string{`<a href="https://media.test/alpha.mp3">Alpha New</a>`, "Beta &lt;New&gt;", `<a href="` + unsubscribe + `">Unsubscribe</a>`} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("HTML does not contain %q:%s", want, msg.HTML)
+		}
+	}
+}
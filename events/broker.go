@@ -0,0 +1,128 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// TypeNewEpisodes is the event sent when new episodes of one of the user's subscriptions are found
+	TypeNewEpisodes = "episodes.new"
+
+	// TypeSubscriptions is the event sent when the user subscribes, unsubscribes or changes a subscription
+	TypeSubscriptions = "subscriptions.changed"
+
+	// TypePlayback is the event sent when the playback state of an episode changes on one of the user's devices
+	TypePlayback = "playback.changed"
+
+	// SubscriptionAdded is the action of a TypeSubscriptions event for a new subscription
+	SubscriptionAdded = "subscribed"
+
+	// SubscriptionRemoved is the action of a TypeSubscriptions event for a removed subscription
+	SubscriptionRemoved = "unsubscribed"
+
+	// SubscriptionSettings is the action of a TypeSubscriptions event for changed settings
+	SubscriptionSettings = "settings"
+
+	// SubscriptionFolder is the action of a TypeSubscriptions event for a subscription moved to another folder
+	SubscriptionFolder = "folder"
+
+	// SubscriptionTags is the action of a TypeSubscriptions event for a subscription with changed tags
+	SubscriptionTags = "tags"
+)
+
+// Event is an update of a user's account. Data holds the JSON encoded details of the event type, so that
+// events can be passed between processes unchanged
+type Event struct {
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// SubscriptionChange is the data of TypeSubscriptions events
+type SubscriptionChange struct {
+	Action string `json:"action"`
+	URL    string `json:"url"`
+}
+
+// New returns an event of the given type with the JSON encoding of data
+func New(eventType string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: eventType, Time: time.Now().UTC(), Data: raw}, nil
+}
+
+// Broker passes the events of each user to the user's subscribed streams. A broker backed by a shared
+// message bus lets several replicas of the service stream each other's events
+type Broker interface {
+	// Publish sends the event to the user's streams without waiting for them to receive it
+	Publish(userEmail string, event Event) error
+
+	// Subscribe returns the stream of the user's events, which is closed once the context is done
+	Subscribe(ctx context.Context, userEmail string) (<-chan Event, error)
+}
+
+// MemoryBroker is a Broker for the streams of a single process
+type MemoryBroker struct {
+	mtx         sync.Mutex
+	buffer      int
+	subscribers map[string]map[chan Event]struct{}
+}
+
+// NewMemoryBroker returns a MemoryBroker which holds up to buffer events for each stream. A stream which
+// falls further behind is closed, so that its reader reconnects and refetches rather than miss events silently
+func NewMemoryBroker(buffer int) *MemoryBroker {
+	return &MemoryBroker{
+		buffer:      buffer,
+		subscribers: map[string]map[chan Event]struct{}{},
+	}
+}
+
+// Publish sends the event to the user's streams
+func (broker *MemoryBroker) Publish(userEmail string, event Event) error {
+	broker.mtx.Lock()
+	defer broker.mtx.Unlock()
+	for stream := range broker.subscribers[userEmail] {
+		select {
+		case stream <- event:
+		default:
+			broker.remove(userEmail, stream)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a stream of the user's events until the context is done
+func (broker *MemoryBroker) Subscribe(ctx context.Context, userEmail string) (<-chan Event, error) {
+	stream := make(chan Event, broker.buffer)
+	broker.mtx.Lock()
+	if broker.subscribers[userEmail] == nil {
+		broker.subscribers[userEmail] = map[chan Event]struct{}{}
+	}
+	broker.subscribers[userEmail][stream] = struct{}{}
+	broker.mtx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		broker.mtx.Lock()
+		defer broker.mtx.Unlock()
+		broker.remove(userEmail, stream)
+	}()
+	return stream, nil
+}
+
+// remove closes the stream unless it was removed before, the lock must be held
+func (broker *MemoryBroker) remove(userEmail string, stream chan Event) {
+	if _, ok := broker.subscribers[userEmail][stream]; !ok {
+		return
+	}
+	delete(broker.subscribers[userEmail], stream)
+	if len(broker.subscribers[userEmail]) == 0 {
+		delete(broker.subscribers, userEmail)
+	}
+	close(stream)
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, stream <-chan Event) (Event, bool) {
+	select {
+	case event, ok := <-stream:
+		return event, ok
+	case <-time.After(time.Second):
+		t.Fatalf("No event received")
+	}
+	return Event{}, false
+}
+
+func TestMemoryBroker(t *testing.T) {
+	broker := NewMemoryBroker(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, _ := broker.Subscribe(ctx, "events@test.com")
+	second, _ := broker.Subscribe(ctx, "events@test.com")
+	other, _ := broker.Subscribe(ctx, "other@test.com")
+
+	event, err := New(TypeSubscriptions, SubscriptionChange{Action: SubscriptionAdded, URL: "https://cast.test/rss"})
+	if err != nil {
+		t.Fatalf("Failed to create event:%v", err)
+	}
+	if string(event.Data) != `{"action":"subscribed","url":"https://cast.test/rss"}` {
+		t.Errorf("Unexpected event data:%s", event.Data)
+	}
+	broker.Publish("events@test.com", event)
+	for _, stream := range []<-chan Event{first, second} {
+		if have, ok := receive(t, stream); !ok || have.Type != TypeSubscriptions {
+			t.Errorf("Unexpected event:%+v %v", have, ok)
+		}
+	}
+	select {
+	case have := <-other:
+		t.Errorf("Event of another user received:%+v", have)
+	default:
+	}
+
+	// A stream falling behind by more than the buffer is closed after the buffered events
+	for i := 0; i < 3; i++ {
+		broker.Publish("events@test.com", event)
+		receive(t, second)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := receive(t, first); !ok {
+			t.Fatalf("Buffered event %d missing", i)
+		}
+	}
+	if _, ok := receive(t, first); ok {
+		t.Errorf("Stream which fell behind was not closed")
+	}
+
+	// Streams are closed when their context is done
+	cancel()
+	if _, ok := receive(t, other); ok {
+		t.Errorf("Stream was not closed with its context")
+	}
+	if _, ok := receive(t, second); ok {
+		t.Errorf("Stream was not closed with its context")
+	}
+	if err = broker.Publish("events@test.com", event); err != nil {
+		t.Errorf("Failed to publish without streams:%v", err)
+	}
+}
@@ -0,0 +1,2 @@
+// Package events carries updates of a user's account to the service's live event streams through a pluggable broker.
+package events
@@ -0,0 +1,2 @@
+// Package mail sends multipart text and HTML emails through a pluggable Mailer, with SMTP, file and log implementations.
+package mail
@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an optional HTML body
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Mailer sends messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// oneLine keeps header values from starting new headers
+var oneLine = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// Bytes returns the message as an RFC 5322 email from the given sender
+func (msg Message) Bytes(from string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         date.Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+	}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", oneLine.Replace(key), oneLine.Replace(headers[key]))
+	}
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		return buf.Bytes(), writeQuotedPrintable(&buf, msg.Text)
+	}
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ contentType, body string }{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+		fmt.Fprintf(&buf, "--%s\r\nContent-Type: %s; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", boundary, part.contentType)
+		if err = writeQuotedPrintable(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, body string) error {
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func newBoundary() (string, error) {
+	boundary := make([]byte, 16)
+	if _, err := rand.Read(boundary); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(boundary), nil
+}
+
+// SMTPMailer sends messages through an SMTP server
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer returns a Mailer for the SMTP server at addr (host:port). PLAIN authentication is used when a username is given
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	mailer := SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &mailer
+}
+
+// Send delivers the message to the SMTP server
+func (mailer *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := msg.Bytes(mailer.from, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(mailer.addr, mailer.auth, mailer.from, []string{msg.To}, data)
+}
+
+// FileMailer writes every message as an .eml file into a directory instead of sending it
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer returns a Mailer writing messages into dir
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send writes the message to a file named after the time and the recipient
+func (mailer *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := msg.Bytes(mailer.from, now)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, msg.To))
+	return ioutil.WriteFile(filepath.Join(mailer.dir, name), data, 0600)
+}
+
+// LogMailer logs the recipient and subject of every message instead of sending it
+type LogMailer struct {
+	logger log.Logger
+}
+
+// NewLogMailer returns a Mailer logging messages to logger
+func NewLogMailer(logger log.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// Send logs the message
+func (mailer *LogMailer) Send(ctx context.Context, msg Message) error {
+	return mailer.logger.Log("mail", "send", "to", msg.To, "subject", msg.Subject)
+}
@@ -0,0 +1,74 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := Message{
+		To:      "listener@test.com",
+		Subject: "Neue Folgen für dich",
+		Text:    "Two new episodes\r\nInjected: header",
+		HTML:    "<p>Two new episodes</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://podcasts.test/unsubscribe>\r\nBcc: spy@test.com"},
+	}
+	data, err := msg.Bytes("digest@podcasts.test", time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to build message:%v", err)
+	}
+	parsed, err := netmail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to parse message:%v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != msg.Subject || parsed.Header.Get("To") != msg.To || parsed.Header.Get("Bcc") != "" {
+		t.Errorf("Unexpected headers:%v", parsed.Header)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Unexpected content type:%s %v", mediaType, err)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("Missing %s part:%v", want.contentType, err)
+		}
+		body, _ := ioutil.ReadAll(quotedprintable.NewReader(part))
+		if mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mediaType != want.contentType || string(body) != want.body {
+			t.Errorf("Part Want:%s %q\tHave:%s %q", want.contentType, want.body, mediaType, body)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmg-mail")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	mailer := NewFileMailer(dir, "digest@podcasts.test")
+	if err = mailer.Send(context.Background(), Message{To: "../listener@test.com", Subject: "Hello", Text: "Hi"}); err != nil {
+		t.Fatalf("Failed to send:%v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Unexpected files:%v", files)
+	}
+	data, _ := ioutil.ReadFile(files[0])
+	parsed, err := netmail.ReadMessage(bytes.NewReader(data))
+	if err != nil || parsed.Header.Get("From") != "digest@podcasts.test" || parsed.Header.Get("Subject") != "Hello" {
+		t.Errorf("Unexpected message:%s %v", data, err)
+	}
+}
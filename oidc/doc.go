@@ -0,0 +1,2 @@
+// Package oidc signs users in with an OpenID Connect provider through the authorization code flow, verifying the ID tokens it issues against the keys it publishes.
+package oidc
@@ -0,0 +1,184 @@
+// Package oidctest runs a local OpenID Connect provider for tests of logins through package oidc.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// User is the user the provider signs in, the provider asks no questions
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// login is an authorization code waiting to be exchanged
+type login struct {
+	user        User
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Server is an OpenID Connect provider with a single registered client, it signs in its User at the
+// authorization endpoint without asking
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	key *rsa.PrivateKey
+	kid string
+
+	mtx    sync.Mutex
+	user   User
+	logins map[string]login
+}
+
+// NewServer starts a provider with a client of the id and secret, it signs ID tokens with a new RSA key
+func NewServer(clientID, clientSecret string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{ClientID: clientID, ClientSecret: clientSecret, key: key, kid: "test-key", logins: map[string]login{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Config returns the registration of the client with the redirect url
+func (s *Server) Config(redirectURL string) oidc.Config {
+	return oidc.Config{Issuer: s.URL, ClientID: s.ClientID, ClientSecret: s.ClientSecret, RedirectURL: redirectURL}
+}
+
+// SetUser sets the user signed in by following logins
+func (s *Server) SetUser(user User) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.user = user
+}
+
+// SignIDToken signs an ID token with the claims using the provider's key, tests use it for tokens the provider
+// would not issue
+func (s *Server) SignIDToken(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) discovery(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+// authorize signs in the user and sends them back to the client's redirect uri with an authorization code
+func (s *Server) authorize(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("client_id") != s.ClientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code, err := oidc.NewSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.mtx.Lock()
+	s.logins[code] = login{s.user, query.Get("nonce"), query.Get("code_challenge"), query.Get("redirect_uri")}
+	s.mtx.Unlock()
+
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, req, redirect.String(), http.StatusFound)
+}
+
+// token exchanges an authorization code once for an ID token of the signed in user
+func (s *Server) token(w http.ResponseWriter, req *http.Request) {
+	clientID, clientSecret, ok := req.BasicAuth()
+	if !ok || clientID != s.ClientID || clientSecret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := req.PostFormValue("code")
+	s.mtx.Lock()
+	l, ok := s.logins[code]
+	delete(s.logins, code)
+	s.mtx.Unlock()
+
+	verifier := sha256.Sum256([]byte(req.PostFormValue("code_verifier")))
+	if !ok || req.PostFormValue("grant_type") != "authorization_code" || req.PostFormValue("redirect_uri") != l.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != l.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	now := time.Now()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": code,
+		"token_type":   "Bearer",
+		"id_token": s.SignIDToken(jwt.MapClaims{
+			"iss":            s.URL,
+			"sub":            l.user.Subject,
+			"aud":            s.ClientID,
+			"exp":            now.Add(time.Hour).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          l.nonce,
+			"email":          l.user.Email,
+			"email_verified": l.user.EmailVerified,
+		}),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, req *http.Request) {
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": s.kid,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   encode(s.key.N),
+			"e":   encode(big.NewInt(int64(s.key.E))),
+		}},
+	})
+}
@@ -0,0 +1,353 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDiscovery indicates a provider whose configuration could not be fetched or lacks required endpoints
+	ErrDiscovery = errors.New("Failed to discover OpenID Connect provider")
+
+	// ErrExchange indicates an authorization code which the provider did not exchange for an ID token
+	ErrExchange = errors.New("Failed to exchange authorization code")
+
+	// ErrInvalidIDToken indicates an ID token which is not signed by the provider, was issued for another client or
+	// login, or has expired
+	ErrInvalidIDToken = errors.New("Invalid ID token")
+)
+
+const (
+	// keysRefresh is the least time between fetches of the provider's keys, an ID token signed with an unknown key
+	// fetches them again at most this often
+	keysRefresh = time.Minute
+
+	// clockSkew is the leeway given to the provider's clock when checking the times of an ID token
+	clockSkew = time.Minute
+
+	// maxResponse is the largest response read from the provider
+	maxResponse = 1 << 20
+)
+
+// Config is the registration of the service as a client of the provider
+type Config struct {
+	// Issuer is the url of the provider, its configuration is read from /.well-known/openid-configuration below it
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the callback of the service the provider sends users back to with an authorization code
+	RedirectURL string
+
+	// Scopes are requested along with openid, they default to email
+	Scopes []string
+}
+
+// Identity is a user signed in by the provider
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider is an OpenID Connect provider the service is registered with
+type Provider struct {
+	config                Config
+	client                *http.Client
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+	now                   func() time.Time
+
+	mtx         sync.Mutex
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// discoveryDocument is the part of the provider's configuration used by the service
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover reads the configuration of the provider at the config's issuer. The client sends all requests to the
+// provider, http.DefaultClient if nil
+func Discover(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"email"}
+	}
+	p := &Provider{config: config, client: client, now: time.Now, keys: map[string]interface{}{}}
+
+	var doc discoveryDocument
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Issuer != config.Issuer || doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, ErrDiscovery
+	}
+	p.authorizationEndpoint, p.tokenEndpoint, p.jwksURI = doc.AuthorizationEndpoint, doc.TokenEndpoint, doc.JWKSURI
+	return p, nil
+}
+
+// getJSON decodes the response to a GET of the url into v
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(v)
+}
+
+// NewSecret returns a random secret for the state, nonce and code verifier of a login
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// AuthCodeURL returns the url of the provider the user is sent to for signing in. The state is returned to the
+// redirect url, the nonce is kept in the ID token and the verifier proves the login to the provider (PKCE)
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authorizationEndpoint + separator + query.Encode()
+}
+
+// tokenResponse is the provider's response to an exchange of an authorization code
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades the authorization code of a login for its ID token and returns the identity it names. The
+// verifier and nonce are the ones the login was started with
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest("POST", p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Identity{}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return Identity{}, err
+	}
+	var token tokenResponse
+	if err = json.Unmarshal(body, &token); err != nil || resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		if token.Error != "" {
+			return Identity{}, fmt.Errorf("%v: %s %s", ErrExchange, token.Error, token.ErrorDescription)
+		}
+		return Identity{}, ErrExchange
+	}
+	return p.Verify(ctx, token.IDToken, nonce)
+}
+
+// audience is the aud claim, which is either a single client or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// idTokenClaims are the claims of an ID token checked by the service
+type idTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+}
+
+// Valid is checked by Verify against the provider's configuration, the parser's checks are not needed
+func (c *idTokenClaims) Valid() error {
+	return nil
+}
+
+// Verify checks that the ID token was signed by the provider for the login with the nonce and returns the identity
+// it names
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Identity, error) {
+	var claims idTokenClaims
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}}
+	_, err := parser.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return Identity{}, ErrInvalidIDToken
+	}
+	now := p.now()
+	switch {
+	case claims.Issuer != p.config.Issuer, claims.Subject == "", claims.Nonce != nonce:
+		return Identity{}, ErrInvalidIDToken
+	case !now.Before(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+		return Identity{}, ErrInvalidIDToken
+	case claims.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return Identity{}, ErrInvalidIDToken
+	}
+	for _, aud := range claims.Audience {
+		if aud == p.config.ClientID {
+			return Identity{claims.Issuer, claims.Subject, claims.Email, claims.EmailVerified}, nil
+		}
+	}
+	return Identity{}, ErrInvalidIDToken
+}
+
+// key returns the provider's public key with the id, fetching the provider's keys again if it is unknown. A token
+// without key id may be signed with the only key of the provider
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	if p.now().Sub(p.keysFetched) < keysRefresh {
+		return nil, ErrInvalidIDToken
+	}
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys, p.keysFetched = keys, p.now()
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+// lookup returns the cached key with the id, p.mtx must be held by the caller
+func (p *Provider) lookup(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// jsonWebKey is a public key of the provider's key set
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys returns the signing keys of the provider's key set by id, keys of unsupported types are skipped
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURI, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key := jwk.publicKey(); key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the RSA or ECDSA key, nil if the key is malformed or of another type
+func (jwk jsonWebKey) publicKey() interface{} {
+	decode := func(s string) *big.Int {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil
+		}
+		return new(big.Int).SetBytes(b)
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, e := decode(jwk.N), decode(jwk.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		x, y := decode(jwk.X), decode(jwk.Y)
+		if !ok || x == nil || y == nil || !curve.IsOnCurve(x, y) {
+			return nil
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package oidc_test
+
+import (
+	"context"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// authorize follows the authorization url to the provider and returns the code it redirects back with
+func authorize(t *testing.T, authURL, wantState string) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Failed to authorize:%v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("Unexpected authorization response:%d %v", resp.StatusCode, err)
+	}
+	if state := location.Query().Get("state"); state != wantState {
+		t.Fatalf("State Want:%s\tHave:%s", wantState, state)
+	}
+	return location.Query().Get("code")
+}
+
+func TestProviderLogin(t *testing.T) {
+	idp := oidctest.NewServer("client", "secret")
+	defer idp.Close()
+	idp.SetUser(oidctest.User{Subject: "sub-1", Email: "user@test.com", EmailVerified: true})
+	ctx := context.Background()
+
+	if _, err := oidc.Discover(ctx, oidc.Config{Issuer: idp.URL + "/other"}, nil); err == nil {
+		t.Errorf("Discovery of an unknown issuer should fail")
+	}
+	p, err := oidc.Discover(ctx, idp.Config("https://svc.test/callback"), nil)
+	if err != nil {
+		t.Fatalf("Failed to discover provider:%v", err)
+	}
+
+	code := authorize(t, p.AuthCodeURL("state", "nonce", "verifier"), "state")
+	if _, err = p.Exchange(ctx, code, "other-verifier", "nonce"); err == nil {
+		t.Errorf("Exchange with the wrong verifier should fail")
+	}
+	code = authorize(t, p.AuthCodeURL("state", "nonce", "verifier"), "state")
+	identity, err := p.Exchange(ctx, code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Failed to exchange code:%v", err)
+	}
+	want := oidc.Identity{Issuer: idp.URL, Subject: "sub-1", Email: "user@test.com", EmailVerified: true}
+	if identity != want {
+		t.Errorf("Identity Want:%+v\tHave:%+v", want, identity)
+	}
+	if _, err = p.Exchange(ctx, code, "verifier", "nonce"); err == nil {
+		t.Errorf("Codes should only be exchanged once")
+	}
+}
+
+func TestProviderVerify(t *testing.T) {
+	idp := oidctest.NewServer("client", "secret")
+	defer idp.Close()
+	ctx := context.Background()
+	p, err := oidc.Discover(ctx, idp.Config("https://svc.test/callback"), nil)
+	if err != nil {
+		t.Fatalf("Failed to discover provider:%v", err)
+	}
+
+	now := time.Now()
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{"iss": idp.URL, "sub": "sub-1", "aud": []string{"other", "client"}, "nonce": "nonce",
+			"exp": now.Add(time.Hour).Unix(), "iat": now.Unix()}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	type verifyTestCase struct {
+		name  string
+		token string
+		valid bool
+	}
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("secret"))
+	testCases := []verifyTestCase{
+		{"Valid", idp.SignIDToken(claims(nil)), true},
+		{"Issuer", idp.SignIDToken(claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.test" })), false},
+		{"Audience", idp.SignIDToken(claims(func(c jwt.MapClaims) { c["aud"] = "other" })), false},
+		{"Nonce", idp.SignIDToken(claims(func(c jwt.MapClaims) { c["nonce"] = "replayed" })), false},
+		{"Expired", idp.SignIDToken(claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() })), false},
+		{"Subject", idp.SignIDToken(claims(func(c jwt.MapClaims) { delete(c, "sub") })), false},
+		{"Signing Method", hmacToken, false},
+		{"Malformed", "not.a.token", false},
+	}
+	for _, test := range testCases {
+		if _, err := p.Verify(ctx, test.token, "nonce"); (err == nil) != test.valid {
+			t.Errorf("%s Valid Want:%v\tHave:%v", test.name, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package podcastmg
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeRead lets an access token read the user's subscriptions, episodes, queue, playlists and playback states
+	ScopeRead = "read"
+
+	// ScopeSubscriptionsWrite lets an access token subscribe, unsubscribe and change subscriptions
+	ScopeSubscriptionsWrite = "subscriptions:write"
+
+	// AccessTokenPrefix starts every access token, telling them apart from the JWTs issued on login
+	AccessTokenPrefix = "pmg_"
+
+	// MaxAccessTokens is the number of access tokens a user may hold
+	MaxAccessTokens = 50
+)
+
+var (
+	// ErrInvalidAccessToken indicates an access token which is unknown, revoked or expired
+	ErrInvalidAccessToken = errors.New("Invalid, revoked or expired access token")
+
+	// ErrInvalidScope indicates an access token without scopes or with an unknown scope
+	ErrInvalidScope = errors.New("Invalid access token scope")
+
+	// ErrInvalidAccessTokenName indicates an access token without a name
+	ErrInvalidAccessTokenName = errors.New("Access token name cannot be empty")
+
+	// ErrInvalidExpiry indicates an access token which would expire before it is created
+	ErrInvalidExpiry = errors.New("Access token expiry must be in the future")
+
+	// ErrTooManyAccessTokens indicates that the user holds MaxAccessTokens already
+	ErrTooManyAccessTokens = errors.New("Too many access tokens")
+)
+
+// Scopes are the scopes of an access token, stored as a JSON array
+type Scopes []string
+
+// Value implements driver.Valuer
+func (scopes Scopes) Value() (driver.Value, error) {
+	return jsonValue([]string(scopes))
+}
+
+// Scan implements sql.Scanner
+func (scopes *Scopes) Scan(src interface{}) error {
+	return jsonScan(src, (*[]string)(scopes))
+}
+
+// Has reports whether the scopes include the scope
+func (scopes Scopes) Has(scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessToken is a named token the user created for scripts, it grants its scopes until it expires or is revoked.
+// Only the SHA-256 hash of the token is stored, Token is set only when the token is created
+type AccessToken struct {
+	ID         uint       `gorm:"primary_key" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	Scopes     Scopes     `gorm:"type:text" json:"scopes"`
+	Hash       string     `gorm:"not null;unique_index" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Token      string     `gorm:"-" json:"token,omitempty"`
+}
+
+// IsAccessToken reports whether the bearer token is an access token rather than a JWT
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// Validate trims the name and checks the name, scopes and expiry of a token to be created at now
+func (token *AccessToken) Validate(now time.Time) error {
+	token.Name = strings.TrimSpace(token.Name)
+	if token.Name == "" {
+		return ErrInvalidAccessTokenName
+	}
+	if len(token.Scopes) == 0 {
+		return ErrInvalidScope
+	}
+	var scopes Scopes
+	for _, scope := range token.Scopes {
+		if scope != ScopeRead && scope != ScopeSubscriptionsWrite {
+			return ErrInvalidScope
+		}
+		if !scopes.Has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	token.Scopes = scopes
+	if token.ExpiresAt != nil && !token.ExpiresAt.After(now) {
+		return ErrInvalidExpiry
+	}
+	return nil
+}
+
+// CreateAccessToken creates an access token for the user and sets its Token, which is not kept
+func (dbStore *DBStore) CreateAccessToken(userEmail string, token *AccessToken, now time.Time) error {
+	if err := token.Validate(now); err != nil {
+		return err
+	}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	var count int
+	if err = dbStore.Database.Model(&AccessToken{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= MaxAccessTokens {
+		return ErrTooManyAccessTokens
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	token.ID, token.UserID, token.CreatedAt, token.LastUsedAt = 0, userID, now, nil
+	token.Token = AccessTokenPrefix + secret
+	token.Hash = hashAccountToken(token.Token)
+	if err = dbStore.Database.Create(token).Error; err != nil {
+		token.Token = ""
+		return err
+	}
+	return nil
+}
+
+// GetAccessTokens returns the user's access tokens, without the tokens themselves
+func (dbStore *DBStore) GetAccessTokens(userEmail string) ([]AccessToken, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []AccessToken{}
+	err = dbStore.Database.Where("user_id = ?", userID).Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteAccessToken revokes one of the user's access tokens
+func (dbStore *DBStore) DeleteAccessToken(userEmail string, tokenID uint) error {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	result := dbStore.Database.Where("id = ? AND user_id = ?", tokenID, userID).Delete(&AccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AuthenticateAccessToken returns a valid access token along with the email of its user and records its use
+func (dbStore *DBStore) AuthenticateAccessToken(token string, now time.Time) (AccessToken, string, error) {
+	var accessToken AccessToken
+	if !IsAccessToken(token) {
+		return accessToken, "", ErrInvalidAccessToken
+	}
+	err := dbStore.Database.Where("hash = ?", hashAccountToken(token)).First(&accessToken).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return accessToken, "", ErrInvalidAccessToken
+	}
+	if err != nil {
+		return accessToken, "", err
+	}
+	if accessToken.ExpiresAt != nil && !now.Before(*accessToken.ExpiresAt) {
+		return accessToken, "", ErrInvalidAccessToken
+	}
+	var user User
+	if err = dbStore.Database.Where("id = ?", accessToken.UserID).First(&user).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return accessToken, "", ErrInvalidAccessToken
+		}
+		return accessToken, "", err
+	}
+	accessToken.LastUsedAt = &now
+	err = dbStore.Database.Model(&AccessToken{}).Where("id = ?", accessToken.ID).Update("last_used_at", now).Error
+	return accessToken, user.UserEmail, err
+}
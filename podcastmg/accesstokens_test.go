@@ -0,0 +1,89 @@
+package podcastmg
+
+import (
+	"github.com/jinzhu/gorm"
+	"testing"
+	"time"
+)
+
+func TestAccessTokenValidate(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	type validateTestCase struct {
+		token AccessToken
+		err   error
+	}
+	testCases := []validateTestCase{
+		{AccessToken{Name: "backup", Scopes: Scopes{ScopeRead}}, nil},
+		{AccessToken{Name: "sync", Scopes: Scopes{ScopeRead, ScopeSubscriptionsWrite}, ExpiresAt: &future}, nil},
+		{AccessToken{Name: "  ", Scopes: Scopes{ScopeRead}}, ErrInvalidAccessTokenName},
+		{AccessToken{Name: "none"}, ErrInvalidScope},
+		{AccessToken{Name: "admin", Scopes: Scopes{"admin"}}, ErrInvalidScope},
+		{AccessToken{Name: "old", Scopes: Scopes{ScopeRead}, ExpiresAt: &past}, ErrInvalidExpiry},
+	}
+	for _, test := range testCases {
+		if err := test.token.Validate(now); err != test.err {
+			t.Errorf("%q Error Want:%v\tHave:%v", test.token.Name, test.err, err)
+		}
+	}
+	token := AccessToken{Name: " dup ", Scopes: Scopes{ScopeRead, ScopeRead}}
+	if token.Validate(now); token.Name != "dup" || len(token.Scopes) != 1 {
+		t.Errorf("Name and scopes were not normalized:%+v", token)
+	}
+}
+
+func TestAccessTokens(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "access-tokens@test.com"
+	if err := store.CreateUser(&User{UserEmail: email, Password: "hash"}); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	now := time.Now()
+	expiry := now.Add(time.Hour)
+
+	token := AccessToken{Name: "script", Scopes: Scopes{ScopeRead}, ExpiresAt: &expiry}
+	if err := store.CreateAccessToken(email, &token, now); err != nil {
+		t.Fatalf("Failed to create access token:%v", err)
+	}
+	if !IsAccessToken(token.Token) || token.Hash == token.Token {
+		t.Fatalf("Unexpected token:%+v", token)
+	}
+
+	tokens, err := store.GetAccessTokens(email)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("Failed to list access tokens:%v %v", tokens, err)
+	}
+	if tokens[0].Token != "" || !tokens[0].Scopes.Has(ScopeRead) || tokens[0].LastUsedAt != nil {
+		t.Errorf("Unexpected listed token:%+v", tokens[0])
+	}
+
+	authenticated, owner, err := store.AuthenticateAccessToken(token.Token, now)
+	if err != nil || owner != email || authenticated.ID != token.ID {
+		t.Fatalf("Failed to authenticate access token:%+v %s %v", authenticated, owner, err)
+	}
+	if tokens, _ = store.GetAccessTokens(email); tokens[0].LastUsedAt == nil {
+		t.Errorf("Use of the token was not recorded")
+	}
+	if _, _, err = store.AuthenticateAccessToken(token.Token, expiry); err != ErrInvalidAccessToken {
+		t.Errorf("Expired token Want:%v\tHave:%v", ErrInvalidAccessToken, err)
+	}
+	if _, _, err = store.AuthenticateAccessToken(AccessTokenPrefix+"unknown", now); err != ErrInvalidAccessToken {
+		t.Errorf("Unknown token Want:%v\tHave:%v", ErrInvalidAccessToken, err)
+	}
+
+	// Tokens can only be revoked by their user
+	other := "access-tokens-other@test.com"
+	store.CreateUser(&User{UserEmail: other, Password: "hash"})
+	if err = store.DeleteAccessToken(other, token.ID); !gorm.IsRecordNotFoundError(err) {
+		t.Errorf("Revoke by another user Want:%v\tHave:%v", gorm.ErrRecordNotFound, err)
+	}
+	if err = store.DeleteAccessToken(email, token.ID); err != nil {
+		t.Fatalf("Failed to revoke access token:%v", err)
+	}
+	if _, _, err = store.AuthenticateAccessToken(token.Token, now); err != ErrInvalidAccessToken {
+		t.Errorf("Revoked token Want:%v\tHave:%v", ErrInvalidAccessToken, err)
+	}
+}
@@ -0,0 +1,302 @@
+package podcastmg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"net/mail"
+	"time"
+)
+
+const (
+	// TokenVerifyEmail is the purpose of tokens confirming that the user receives mail at their email address
+	TokenVerifyEmail = "verify_email"
+
+	// TokenResetPassword is the purpose of tokens letting the user set a new password without the old one
+	TokenResetPassword = "reset_password"
+
+	// TokenChangeEmail is the purpose of tokens confirming that the user receives mail at the email they change to
+	TokenChangeEmail = "change_email"
+)
+
+var (
+	// ErrInvalidEmail indicates an email which is not a plain address such as user@example.com
+	ErrInvalidEmail = errors.New("Invalid email address")
+
+	// ErrEmptyPassword indicates an attempt to set an empty password
+	ErrEmptyPassword = errors.New("Password cannot be empty")
+
+	// ErrInvalidAccountToken indicates a verification or password reset token which is unknown, used or expired
+	ErrInvalidAccountToken = errors.New("Invalid or expired token")
+
+	// ErrEmailTaken indicates a change to an email which belongs to another user
+	ErrEmailTaken = errors.New("Email is already registered")
+)
+
+// AccountToken is a single use token mailed to the user. Only the SHA-256 hash of the token is stored, Email is
+// the address it was sent to so that a token does not outlive a change of the user's email
+type AccountToken struct {
+	ID        uint       `gorm:"primary_key"`
+	CreatedAt time.Time  `gorm:"not null"`
+	UserID    uint       `gorm:"not null;index"`
+	Purpose   string     `gorm:"not null"`
+	Hash      string     `gorm:"not null;unique_index"`
+	Email     string     `gorm:"not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"index"`
+}
+
+// ValidateEmail checks that the email is a plain address without a display name
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// hashAccountToken returns the stored hash of a token, the tokens are random so a fast hash does not weaken them
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAccountToken issues a token of the purpose for the user which expires after ttl, the user's earlier
+// tokens of the same purpose are revoked. The token is returned, only its hash is stored
+func (dbStore *DBStore) CreateAccountToken(userEmail, purpose string, ttl time.Duration, now time.Time) (string, error) {
+	return dbStore.createAccountToken(userEmail, purpose, userEmail, ttl, now)
+}
+
+// CreateEmailChangeToken issues a token which changes the user's email to newEmail once it is used, see
+// CreateAccountToken. ErrEmailTaken is returned if newEmail belongs to another user
+func (dbStore *DBStore) CreateEmailChangeToken(userEmail, newEmail string, ttl time.Duration, now time.Time) (string, error) {
+	if err := ValidateEmail(newEmail); err != nil {
+		return "", err
+	}
+	taken, err := dbStore.emailTaken(newEmail)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		return "", ErrEmailTaken
+	}
+	return dbStore.createAccountToken(userEmail, TokenChangeEmail, newEmail, ttl, now)
+}
+
+// emailTaken reports whether a user has the email, deleted users included as they still hold it in the table
+func (dbStore *DBStore) emailTaken(email string) (bool, error) {
+	var count int
+	err := dbStore.Database.Unscoped().Model(&User{}).Where("user_email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+// createAccountToken issues a token of the purpose for the user which was sent to email
+func (dbStore *DBStore) createAccountToken(userEmail, purpose, email string, ttl time.Duration, now time.Time) (string, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return "", err
+	}
+	token, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	err = dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := revokeAccountTokens(tx, userID, now, purpose); err != nil {
+			return err
+		}
+		return tx.Create(&AccountToken{
+			CreatedAt: now,
+			UserID:    userID,
+			Purpose:   purpose,
+			Hash:      hashAccountToken(token),
+			Email:     email,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// revokeAccountTokens marks the user's unused tokens of the purposes as used, all of them if no purpose is given
+func revokeAccountTokens(tx *gorm.DB, userID uint, now time.Time, purposes ...string) error {
+	query := tx.Model(&AccountToken{}).Where("user_id = ? AND used_at IS NULL", userID)
+	if len(purposes) > 0 {
+		query = query.Where("purpose IN (?)", purposes)
+	}
+	return query.Update("used_at", now).Error
+}
+
+// useAccountToken marks a token of the purpose as used and returns it. The update only matches an unused token,
+// so a token presented twice at the same time is still only accepted once
+func useAccountToken(tx *gorm.DB, token, purpose string, now time.Time) (AccountToken, error) {
+	var accountToken AccountToken
+	err := tx.Where("hash = ? AND purpose = ?", hashAccountToken(token), purpose).First(&accountToken).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return accountToken, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return accountToken, err
+	}
+	if accountToken.UsedAt != nil || !now.Before(accountToken.ExpiresAt) {
+		return accountToken, ErrInvalidAccountToken
+	}
+	result := tx.Model(&AccountToken{}).Where("id = ? AND used_at IS NULL", accountToken.ID).Update("used_at", now)
+	if result.Error != nil {
+		return accountToken, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return accountToken, ErrInvalidAccountToken
+	}
+	accountToken.UsedAt = &now
+	return accountToken, nil
+}
+
+// VerifyEmail uses a verification token and marks the email it was sent to as verified
+func (dbStore *DBStore) VerifyEmail(token string, now time.Time) error {
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		accountToken, err := useAccountToken(tx, token, TokenVerifyEmail, now)
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&User{}).Where("id = ? AND user_email = ?", accountToken.UserID, accountToken.Email).
+			Update("email_verified", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrInvalidAccountToken
+		}
+		return nil
+	})
+}
+
+// ResetPassword uses a password reset token and sets the user's password to the hash. Receiving the token
+// proves that the user owns their email, so it is marked as verified as well. Whoever knew the old password is
+// logged out, see revokeSessions
+func (dbStore *DBStore) ResetPassword(token, passwordHash string, now time.Time) error {
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		accountToken, err := useAccountToken(tx, token, TokenResetPassword, now)
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&User{}).Where("id = ? AND user_email = ?", accountToken.UserID, accountToken.Email).
+			Updates(map[string]interface{}{"password": passwordHash, "email_verified": true})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrInvalidAccountToken
+		}
+		if err = revokeSessions(tx, accountToken.UserID, now); err != nil {
+			return err
+		}
+		return revokeAccountTokens(tx, accountToken.UserID, now)
+	})
+}
+
+// ChangePassword sets the user's password to the hash and revokes the user's outstanding verification and
+// password reset tokens along with their sessions, see revokeSessions
+func (dbStore *DBStore) ChangePassword(userEmail, passwordHash string, now time.Time) error {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).Update("password", passwordHash).Error; err != nil {
+			return err
+		}
+		if err := revokeSessions(tx, userID, now); err != nil {
+			return err
+		}
+		return revokeAccountTokens(tx, userID, now)
+	})
+}
+
+// revokeSessions deletes the user's access tokens and sets their TokensValidAfter, so that tokens issued before
+// now are refused
+func revokeSessions(tx *gorm.DB, userID uint, now time.Time) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&AccessToken{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&User{}).Where("id = ?", userID).UpdateColumn("tokens_valid_after", now).Error
+}
+
+// RehashPassword replaces the user's password hash with a new hash of the same password. Nothing is changed if the
+// password was changed since oldHash was read, the later password wins
+func (dbStore *DBStore) RehashPassword(userEmail, oldHash, newHash string) error {
+	return dbStore.Database.Model(&User{}).Where("user_email = ? AND password = ?", userEmail, oldHash).
+		Update("password", newHash).Error
+}
+
+// ChangeEmail uses an email change token and sets the user's email to the address it was sent to, which is
+// verified by receiving it. The user's previous and new emails are returned. Outstanding tokens were sent to
+// or for the previous email, so they are revoked
+func (dbStore *DBStore) ChangeEmail(token string, now time.Time) (string, string, error) {
+	var previous, email string
+	err := dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		accountToken, err := useAccountToken(tx, token, TokenChangeEmail, now)
+		if err != nil {
+			return err
+		}
+		var user User
+		if err = tx.Where("id = ?", accountToken.UserID).First(&user).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrInvalidAccountToken
+			}
+			return err
+		}
+		var count int
+		if err = tx.Unscoped().Model(&User{}).Where("user_email = ?", accountToken.Email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrEmailTaken
+		}
+		previous, email = user.UserEmail, accountToken.Email
+		err = tx.Model(&user).Updates(map[string]interface{}{"user_email": email, "email_verified": true}).Error
+		if err != nil {
+			return err
+		}
+		return revokeAccountTokens(tx, user.ID, now)
+	})
+	return previous, email, err
+}
+
+// purgeUser deletes the user and everything kept for them: their copies of podcasts with episodes, subscription
+// settings, labels, queue, playlists, webhooks with deliveries, digest, playback states, devices, episode
+// actions, change log, account tokens, access tokens and linked identities. Soft-deleted rows are removed as well
+func purgeUser(tx *gorm.DB, userID uint) error {
+	podcasts := "SELECT podcast_id FROM subscriptions WHERE user_id = ? AND podcast_id NOT IN " +
+		"(SELECT podcast_id FROM subscriptions WHERE user_id <> ?)"
+	items := "SELECT id FROM podcast_items WHERE podcast_id IN (" + podcasts + ")"
+	deletes := []struct {
+		model interface{}
+		query string
+	}{
+		{&Enclosure{}, "podcast_item_id IN (" + items + ")"},
+		{&PodcastItem{}, "podcast_id IN (" + podcasts + ")"},
+		{&Podcast{}, "id IN (" + podcasts + ")"},
+	}
+	for _, d := range deletes {
+		if err := tx.Unscoped().Where(d.query, userID, userID).Delete(d.model).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)", userID).Delete(&WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("playlist_id IN (SELECT id FROM playlists WHERE user_id = ?)", userID).Delete(&PlaylistEntry{}).Error; err != nil {
+		return err
+	}
+	owned := []interface{}{&Subscription{}, &SubscriptionTag{}, &Label{}, &Queue{}, &QueueEntry{}, &Playlist{}, &Webhook{},
+		&DigestSchedule{}, &PlaybackState{}, &Device{}, &EpisodeAction{}, &Change{}, &ChangeLog{}, &AccountToken{}, &AccessToken{}, &Identity{}}
+	for _, model := range owned {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where("id = ?", userID).Delete(&User{}).Error
+}
@@ -0,0 +1,280 @@
+package podcastmg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateEmail(t *testing.T) {
+	type emailTestCase struct {
+		email string
+		valid bool
+	}
+	testCases := []emailTestCase{
+		{"user@example.com", true},
+		{"first.last+tag@mail.example.org", true},
+		{"not an email", false},
+		{"Name <user@example.com>", false},
+		{" user@example.com", false},
+		{"user@", false},
+		{"", false},
+	}
+	for _, test := range testCases {
+		if err := ValidateEmail(test.email); (err == nil) != test.valid {
+			t.Errorf("%q Valid Want:%v\tHave:%v", test.email, test.valid, err)
+		}
+	}
+	if _, err := NewUser("not an email", "password"); err != ErrInvalidEmail {
+		t.Errorf("Error Want:%v\tHave:%v", ErrInvalidEmail, err)
+	}
+}
+
+func TestAccountTokens(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "tokens@test.com"
+	if err := store.CreateUser(&User{UserEmail: email, Password: "old-hash"}); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	now := time.Now()
+
+	// Tokens are single use and a new token revokes the earlier ones of its purpose
+	first, err := store.CreateAccountToken(email, TokenVerifyEmail, time.Hour, now)
+	if err != nil {
+		t.Fatalf("Failed to create token:%v", err)
+	}
+	second, err := store.CreateAccountToken(email, TokenVerifyEmail, time.Hour, now)
+	if err != nil || second == first {
+		t.Fatalf("Failed to create a second token:%v", err)
+	}
+	var stored AccountToken
+	if err = store.Database.Where("hash = ?", hashAccountToken(second)).First(&stored).Error; err != nil || stored.Hash == second {
+		t.Errorf("Token was not stored hashed:%+v %v", stored, err)
+	}
+	if err = store.VerifyEmail(first, now); err != ErrInvalidAccountToken {
+		t.Errorf("Revoked token Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	if err = store.ResetPassword(second, "new-hash", now); err != ErrInvalidAccountToken {
+		t.Errorf("Token of another purpose Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	if err = store.VerifyEmail(second, now); err != nil {
+		t.Fatalf("Failed to verify email:%v", err)
+	}
+	if err = store.VerifyEmail(second, now); err != ErrInvalidAccountToken {
+		t.Errorf("Used token Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	if user, _ := store.GetUserByEmail(email); !user.EmailVerified {
+		t.Errorf("Email was not verified")
+	}
+
+	expired, _ := store.CreateAccountToken(email, TokenResetPassword, time.Hour, now.Add(-2*time.Hour))
+	if err = store.ResetPassword(expired, "new-hash", now); err != ErrInvalidAccountToken {
+		t.Errorf("Expired token Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	reset, _ := store.CreateAccountToken(email, TokenResetPassword, time.Hour, now)
+	if err = store.ResetPassword(reset, "reset-hash", now); err != nil {
+		t.Fatalf("Failed to reset password:%v", err)
+	}
+	if user, _ := store.GetUserByEmail(email); user.Password != "reset-hash" {
+		t.Errorf("Password Want:%s\tHave:%s", "reset-hash", user.Password)
+	}
+
+	// Changing the password revokes the outstanding tokens and the user's sessions
+	pending, _ := store.CreateAccountToken(email, TokenResetPassword, time.Hour, now)
+	if err = store.CreateAccessToken(email, &AccessToken{Name: "script", Scopes: Scopes{ScopeRead}}, now); err != nil {
+		t.Fatalf("Failed to create access token:%v", err)
+	}
+	changed := now.Add(time.Minute)
+	if err = store.ChangePassword(email, "changed-hash", changed); err != nil {
+		t.Fatalf("Failed to change password:%v", err)
+	}
+	if err = store.ResetPassword(pending, "stolen-hash", now); err != ErrInvalidAccountToken {
+		t.Errorf("Token issued before the change Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	user, _ := store.GetUserByEmail(email)
+	if user.Password != "changed-hash" {
+		t.Errorf("Password Want:%s\tHave:%s", "changed-hash", user.Password)
+	}
+	if user.TokensValidAfter == nil || !user.TokensValidAfter.Equal(changed) {
+		t.Errorf("TokensValidAfter Want:%v\tHave:%v", changed, user.TokensValidAfter)
+	}
+	if tokens, err := store.GetAccessTokens(email); err != nil || len(tokens) != 0 {
+		t.Errorf("Access tokens should be revoked:%+v %v", tokens, err)
+	}
+	if _, err = store.CreateAccountToken("nobody@test.com", TokenResetPassword, time.Hour, now); err == nil {
+		t.Errorf("Created a token for an unknown user")
+	}
+
+	// A rehash is dropped when the password changed in the meantime
+	if err = store.RehashPassword(email, "reset-hash", "rehashed"); err != nil {
+		t.Errorf("Failed to rehash password:%v", err)
+	}
+	if user, _ := store.GetUserByEmail(email); user.Password != "changed-hash" {
+		t.Errorf("Password Want:%s\tHave:%s", "changed-hash", user.Password)
+	}
+	if err = store.RehashPassword(email, "changed-hash", "rehashed"); err != nil {
+		t.Errorf("Failed to rehash password:%v", err)
+	}
+	if user, _ := store.GetUserByEmail(email); user.Password != "rehashed" {
+		t.Errorf("Password Want:%s\tHave:%s", "rehashed", user.Password)
+	}
+}
+
+func TestAccountEmailChange(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email, newEmail := "changer@test.com", "changed@test.com"
+	for _, u := range []string{email, "holder@test.com"} {
+		if err := store.CreateUser(&User{UserEmail: u, Password: "x"}); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+	}
+	if err := store.CreateUser(&User{UserEmail: "holder@test.com", Password: "x"}); err != ErrEmailTaken {
+		t.Errorf("Error Want:%v	Have:%v", ErrEmailTaken, err)
+	}
+	now := time.Now()
+
+	type emailChangeTestCase struct {
+		name     string
+		newEmail string
+		wantErr  error
+	}
+	testCases := []emailChangeTestCase{
+		{"Invalid Email", "not an email", ErrInvalidEmail},
+		{"Taken Email", "holder@test.com", ErrEmailTaken},
+		{"Own Email", email, ErrEmailTaken},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := store.CreateEmailChangeToken(email, test.newEmail, time.Hour, now); err != test.wantErr {
+				t.Errorf("Error Want:%v\tHave:%v", test.wantErr, err)
+			}
+		})
+	}
+
+	// The email is taken between issuing the token and using it
+	raced, err := store.CreateEmailChangeToken(email, "racer@test.com", time.Hour, now)
+	if err != nil {
+		t.Fatalf("Failed to create token:%v", err)
+	}
+	if err = store.CreateUser(&User{UserEmail: "racer@test.com", Password: "x"}); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	if _, _, err = store.ChangeEmail(raced, now); err != ErrEmailTaken {
+		t.Errorf("Error Want:%v\tHave:%v", ErrEmailTaken, err)
+	}
+
+	pending, _ := store.CreateAccountToken(email, TokenResetPassword, time.Hour, now)
+	token, err := store.CreateEmailChangeToken(email, newEmail, time.Hour, now)
+	if err != nil {
+		t.Fatalf("Failed to create token:%v", err)
+	}
+	if err = store.VerifyEmail(token, now); err != ErrInvalidAccountToken {
+		t.Errorf("Token of another purpose Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	previous, changed, err := store.ChangeEmail(token, now)
+	if err != nil || previous != email || changed != newEmail {
+		t.Fatalf("Failed to change email:%s %s %v", previous, changed, err)
+	}
+	if _, _, err = store.ChangeEmail(token, now); err != ErrInvalidAccountToken {
+		t.Errorf("Used token Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	if err = store.ResetPassword(pending, "stolen-hash", now); err != ErrInvalidAccountToken {
+		t.Errorf("Token issued before the change Want:%v\tHave:%v", ErrInvalidAccountToken, err)
+	}
+	user, err := store.GetUserByEmail(newEmail)
+	if err != nil || !user.EmailVerified {
+		t.Errorf("Changed email was not verified:%+v %v", user, err)
+	}
+	if _, err = store.GetUserByEmail(email); err == nil {
+		t.Errorf("Previous email still finds the user")
+	}
+}
+
+func TestAccountExportAndDelete(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "leaver@test.com"
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "Leaver Cast", URL: "leavercast.test/xml", PodcastItems: []PodcastItem{{Title: "One", MediaURL: "leavercast.test/1.mp3"}, {Title: "Two"}}},
+	}}
+	other := User{UserEmail: "stayer@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Stayer Cast", URL: "stayercast.test/xml", PodcastItems: []PodcastItem{{Title: "Stays"}}},
+	}}
+	for _, u := range []*User{&user, &other} {
+		if err := store.CreateUser(u); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+	}
+	items := user.Podcasts[0].PodcastItems
+	folder := Label{Kind: LabelFolder, Name: "News"}
+	if err := store.CreateLabel(email, &folder); err != nil {
+		t.Fatalf("Failed to create label:%v", err)
+	}
+	if err := store.SetSubscriptionFolder(email, "leavercast.test/xml", folder.ID); err != nil {
+		t.Fatalf("Failed to set folder:%v", err)
+	}
+	if err := store.SavePlaybackState(email, &PlaybackState{PodcastItemID: items[0].ID, Position: 90, Device: "phone"}); err != nil {
+		t.Fatalf("Failed to save playback state:%v", err)
+	}
+	if _, err := store.UpdateQueue(email, 0, QueueOp{Action: QueueAdd, ItemID: items[1].ID}); err != nil {
+		t.Fatalf("Failed to queue episode:%v", err)
+	}
+	if err := store.CreateWebhook(email, &Webhook{URL: "https://203.0.113.10/leaver"}); err != nil {
+		t.Fatalf("Failed to create webhook:%v", err)
+	}
+
+	now := time.Now()
+	export, err := store.ExportUser(email, now)
+	if err != nil {
+		t.Fatalf("Failed to export user:%v", err)
+	}
+	if export.Profile.Email != email || !export.ExportedAt.Equal(now) {
+		t.Errorf("Unexpected profile:%+v", export.Profile)
+	}
+	if len(export.Subscriptions) != 1 || export.Subscriptions[0].URL != "leavercast.test/xml" || export.Subscriptions[0].Folder != "News" {
+		t.Errorf("Unexpected subscriptions:%+v", export.Subscriptions)
+	}
+	wantState := ExportEpisode{PodcastURL: "leavercast.test/xml", Title: "One", MediaURL: "leavercast.test/1.mp3"}
+	if len(export.EpisodeStates) != 1 || export.EpisodeStates[0].ExportEpisode != wantState || export.EpisodeStates[0].Position != 90 {
+		t.Errorf("Unexpected episode states:%+v", export.EpisodeStates)
+	}
+	if len(export.Queue) != 1 || export.Queue[0].Title != "Two" {
+		t.Errorf("Unexpected queue:%+v", export.Queue)
+	}
+	if len(export.Webhooks) != 1 || export.Webhooks[0].URL != "https://203.0.113.10/leaver" {
+		t.Errorf("Unexpected webhooks:%+v", export.Webhooks)
+	}
+
+	if err = store.DeleteUserByEmail(email); err != nil {
+		t.Fatalf("Failed to delete user:%v", err)
+	}
+	var count int
+	store.Database.Unscoped().Model(&User{}).Where("user_email = ?", email).Count(&count)
+	if count != 0 {
+		t.Errorf("User was only soft-deleted")
+	}
+	for _, model := range []interface{}{&Label{}, &PlaybackState{}, &QueueEntry{}, &Webhook{}, &Subscription{}} {
+		store.Database.Model(model).Where("user_id = ?", user.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("%T rows were kept:%d", model, count)
+		}
+	}
+	store.Database.Unscoped().Model(&PodcastItem{}).Where("podcast_id = ?", user.Podcasts[0].ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Episodes of the user's podcast were kept:%d", count)
+	}
+	if _, err = store.GetUserByEmail("stayer@test.com"); err != nil {
+		t.Errorf("Other user was deleted:%v", err)
+	}
+	store.Database.Model(&PodcastItem{}).Where("podcast_id = ?", other.Podcasts[0].ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Episodes of another user's podcast Want:1\tHave:%d", count)
+	}
+}
@@ -0,0 +1,280 @@
+package podcastmg
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ChangeSubscribed records that the user subscribed to the podcast at PodcastURL
+	ChangeSubscribed = "subscribed"
+
+	// ChangeUnsubscribed records that the user unsubscribed from the podcast at PodcastURL
+	ChangeUnsubscribed = "unsubscribed"
+
+	// ChangeEpisodeState records the playback position and played flag of an episode
+	ChangeEpisodeState = "episode"
+
+	// ChangeNewEpisode records an episode found in the feed of one of the user's subscriptions
+	ChangeNewEpisode = "new_episode"
+)
+
+var (
+	// ErrInvalidSyncToken indicates a sync token which was not issued by the service
+	ErrInvalidSyncToken = errors.New("Invalid sync token")
+
+	// ErrInvalidChange indicates an uploaded change of an unknown kind, without its podcast url or episode, or
+	// with a negative position. New episodes cannot be uploaded
+	ErrInvalidChange = errors.New("Invalid change")
+)
+
+// Change is an entry of the user's change log. Seq increases with every change of the user, so the Seq of the
+// last change a device has seen is all it needs to ask for the changes it missed. ChangedAt is when the change
+// was made on its device, later changes win over earlier ones
+type Change struct {
+	ID            uint64    `gorm:"primary_key" json:"-"`
+	UserID        uint      `gorm:"not null;unique_index:idx_changes_user_seq" json:"-"`
+	Seq           uint64    `gorm:"not null;unique_index:idx_changes_user_seq" json:"seq"`
+	Kind          string    `gorm:"not null" json:"kind"`
+	PodcastURL    string    `json:"podcast_url,omitempty"`
+	PodcastItemID *uint     `gorm:"index" json:"item_id,omitempty"`
+	Position      *int64    `json:"position,omitempty"`
+	Played        *bool     `json:"played,omitempty"`
+	Device        string    `json:"device,omitempty"`
+	ChangedAt     time.Time `gorm:"not null" json:"changed_at"`
+}
+
+// ChangeLog holds the Seq of the latest change of the user's change log. Recording a change increases it, which
+// locks the row until the change is committed. Changes of a user thus become visible in the order of their Seq
+// and a device which has seen a Seq cannot miss an earlier change committed later
+type ChangeLog struct {
+	UserID uint   `gorm:"primary_key;auto_increment:false"`
+	Seq    uint64 `gorm:"not null;default:0"`
+}
+
+// SyncDelta holds the changes after a sync token and the token to ask from next time. More is set when the
+// changes were cut off at the requested limit
+type SyncDelta struct {
+	Changes []Change `json:"changes"`
+	Token   string   `json:"token"`
+	More    bool     `json:"more"`
+}
+
+// Validate checks that an uploaded change names what it changes
+func (change Change) Validate() error {
+	switch change.Kind {
+	case ChangeSubscribed, ChangeUnsubscribed:
+		if strings.TrimSpace(change.PodcastURL) == "" {
+			return ErrInvalidChange
+		}
+	case ChangeEpisodeState:
+		if change.PodcastItemID == nil || (change.Position == nil && change.Played == nil) {
+			return ErrInvalidChange
+		}
+		if change.Position != nil && *change.Position < 0 {
+			return ErrInvalidChange
+		}
+	default:
+		return ErrInvalidChange
+	}
+	return nil
+}
+
+// syncToken returns the token of the change log after seq
+func syncToken(seq uint64) string {
+	return strconv.FormatUint(seq, 10)
+}
+
+// recordChange appends the change to the user's change log, setting its Seq. It has to run in a transaction, the
+// user's change log stays locked until it is committed
+func recordChange(tx *gorm.DB, userID uint, change *Change) error {
+	log := ChangeLog{UserID: userID}
+	if err := tx.Where(ChangeLog{UserID: userID}).FirstOrCreate(&log).Error; err != nil {
+		return err
+	}
+	update := tx.Model(&ChangeLog{}).Where("user_id = ?", userID).UpdateColumn("seq", gorm.Expr("seq + 1"))
+	if update.Error != nil {
+		return update.Error
+	}
+	if err := tx.Where("user_id = ?", userID).First(&log).Error; err != nil {
+		return err
+	}
+	change.ID, change.UserID, change.Seq = 0, userID, log.Seq
+	if change.ChangedAt.IsZero() {
+		change.ChangedAt = time.Now()
+	}
+	return tx.Create(change).Error
+}
+
+// recordSubscriptionChanges appends a change of the kind for each of the podcast urls to the user's change log
+func recordSubscriptionChanges(tx *gorm.DB, userID uint, kind, device string, podcastURLs []string) error {
+	now := time.Now()
+	for _, podcastURL := range podcastURLs {
+		change := Change{Kind: kind, PodcastURL: podcastURL, Device: device, ChangedAt: now}
+		if err := recordChange(tx, userID, &change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordChange appends a change the service made on the user's behalf to the user's change log
+func (dbStore *DBStore) RecordChange(userEmail string, change *Change) error {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		return recordChange(tx, userID, change)
+	})
+}
+
+// GetChanges returns up to limit changes of the user's change log after the token, oldest first, along with the
+// token to ask from next time. An empty token returns no changes but the token of the latest change, it is where
+// a device which just downloaded all of the user's subscriptions starts syncing from
+func (dbStore *DBStore) GetChanges(userEmail, token string, limit int) (SyncDelta, error) {
+	delta := SyncDelta{Changes: []Change{}, Token: token}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return delta, err
+	}
+	if token == "" {
+		var log ChangeLog
+		err = dbStore.Database.Where("user_id = ?", userID).First(&log).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return delta, err
+		}
+		delta.Token = syncToken(log.Seq)
+		return delta, nil
+	}
+	seq, err := strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return delta, ErrInvalidSyncToken
+	}
+	err = dbStore.Database.Where("user_id = ? AND seq > ?", userID, seq).Order("seq").Limit(limit + 1).
+		Find(&delta.Changes).Error
+	if err != nil {
+		return delta, err
+	}
+	if len(delta.Changes) > limit {
+		delta.Changes, delta.More = delta.Changes[:limit], true
+	}
+	if len(delta.Changes) > 0 {
+		delta.Token = syncToken(delta.Changes[len(delta.Changes)-1].Seq)
+	}
+	return delta, nil
+}
+
+// latestChange returns the latest change of the user's change log matching the query, a zero change if none does
+func latestChange(db *gorm.DB, userID uint, query string, args ...interface{}) (Change, error) {
+	var change Change
+	err := db.Where("user_id = ?", userID).Where(query, args...).Order("changed_at DESC, seq DESC").First(&change).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return change, nil
+	}
+	return change, err
+}
+
+// UploadChanges applies the changes a device made while it was offline. Every change is checked against the
+// latest change of the same podcast or episode, and skipped if that one was made later. podcasts holds the
+// podcasts to subscribe to by url, a subscription to a podcast the user is not subscribed to without one is
+// skipped. The applied changes are returned
+// with their Seq set
+func (dbStore *DBStore) UploadChanges(userEmail, device string, changes []Change, podcasts map[string]Podcast) ([]Change, error) {
+	for _, change := range changes {
+		if err := change.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if device != "" && !deviceIDPattern.MatchString(device) {
+		return nil, ErrInvalidDevice
+	}
+	user, err := dbStore.GetUserByEmail(userEmail)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Change
+	err = dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		applied = []Change{}
+		for _, change := range changes {
+			change.Device = device
+			if change.ChangedAt.IsZero() {
+				change.ChangedAt = time.Now()
+			}
+			recorded, err := applyChange(tx, &user, change, podcasts)
+			if err != nil {
+				return err
+			}
+			if recorded != nil {
+				applied = append(applied, *recorded)
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// applyChange applies an uploaded change unless a later change of the same podcast or episode is known,
+// returning the recorded change if it was applied
+func applyChange(tx *gorm.DB, user *User, change Change, podcasts map[string]Podcast) (*Change, error) {
+	if change.Kind == ChangeEpisodeState {
+		latest, err := latestChange(tx, user.ID, "kind = ? AND podcast_item_id = ?", ChangeEpisodeState, *change.PodcastItemID)
+		if err != nil || latest.ChangedAt.After(change.ChangedAt) {
+			return nil, err
+		}
+		var item PodcastItem
+		err = tx.Select("podcast_items.*").Joins("JOIN subscriptions ON subscriptions.podcast_id = podcast_items.podcast_id").
+			Where("subscriptions.user_id = ? AND podcast_items.id = ?", user.ID, *change.PodcastItemID).First(&item).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		state := PlaybackState{UserID: user.ID, PodcastItemID: item.ID}
+		if err = tx.Where(&state).First(&state).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+		if change.Position != nil {
+			state.Position = *change.Position
+		}
+		if change.Played != nil {
+			state.Played = *change.Played
+		}
+		state.Device = change.Device
+		recorded, err := savePlaybackState(tx, &state, item, change.ChangedAt)
+		return &recorded, err
+	}
+
+	podcastURL := strings.TrimSpace(change.PodcastURL)
+	latest, err := latestChange(tx, user.ID, "kind IN (?) AND podcast_url = ?", []string{ChangeSubscribed, ChangeUnsubscribed}, podcastURL)
+	if err != nil || latest.ChangedAt.After(change.ChangedAt) {
+		return nil, err
+	}
+	if change.Kind == ChangeSubscribed && !user.CheckSubscription(Podcast{URL: podcastURL}) {
+		podcast, ok := podcasts[podcastURL]
+		if !ok {
+			return nil, nil
+		}
+		if err = tx.Model(user).Association("Podcasts").Append(&podcast).Error; err != nil {
+			return nil, err
+		}
+		user.Podcasts = append(user.Podcasts, podcast)
+	} else if change.Kind == ChangeUnsubscribed {
+		if err = unsubscribe(tx, user.ID, []string{podcastURL}); err != nil {
+			return nil, err
+		}
+		user.RemoveSubscription(Podcast{URL: podcastURL})
+	}
+	change.PodcastURL = podcastURL
+	return &change, recordChange(tx, user.ID, &change)
+}
+
+// unsubscribe soft-deletes the user's copies of the podcasts at the urls
+func unsubscribe(tx *gorm.DB, userID uint, podcastURLs []string) error {
+	return tx.Where("id IN (SELECT podcast_id FROM subscriptions WHERE user_id = ?) AND url IN (?)", userID, podcastURLs).
+		Delete(&Podcast{}).Error
+}
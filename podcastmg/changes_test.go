@@ -0,0 +1,137 @@
+package podcastmg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChanges(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "changes@test.com"
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "Change Cast", URL: "https://change.test/rss", PodcastItems: []PodcastItem{{Title: "One"}, {Title: "Two"}}},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	items := user.Podcasts[0].PodcastItems
+	kinds := func(changes []Change) []string {
+		have := []string{}
+		for _, change := range changes {
+			have = append(have, change.Kind)
+		}
+		return have
+	}
+
+	start, err := store.GetChanges(email, "", 10)
+	if err != nil || len(start.Changes) != 0 || start.Token == "" {
+		t.Fatalf("Unexpected start of change log:%+v %v", start, err)
+	}
+	if err = store.SavePlaybackState(email, &PlaybackState{PodcastItemID: items[0].ID, Position: 100}); err != nil {
+		t.Fatalf("Failed to save playback state:%v", err)
+	}
+	if err = store.ApplySubscriptionChanges(email, "phone", []Podcast{{Title: "Added Cast", URL: "https://added.change.test/rss"}}, nil); err != nil {
+		t.Fatalf("Failed to apply subscription changes:%v", err)
+	}
+	podcast, err := store.GetPodcastBySubscription(email, "https://change.test/rss")
+	if err != nil {
+		t.Fatalf("Failed to get podcast:%v", err)
+	}
+	podcast.PodcastItems = append(podcast.PodcastItems, PodcastItem{Title: "Three"})
+	if err = store.savePodcastUpdate(user.ID, &podcast, len(podcast.PodcastItems)-1); err != nil {
+		t.Fatalf("Failed to save podcast update:%v", err)
+	}
+
+	delta, err := store.GetChanges(email, start.Token, 10)
+	want := []string{ChangeEpisodeState, ChangeSubscribed, ChangeNewEpisode}
+	if err != nil || !reflect.DeepEqual(kinds(delta.Changes), want) || delta.More {
+		t.Fatalf("Changes Want:%v\tHave:%+v %v", want, delta, err)
+	}
+	if delta.Changes[0].Seq >= delta.Changes[1].Seq || delta.Changes[1].Device != "phone" || *delta.Changes[0].Position != 100 {
+		t.Errorf("Unexpected changes:%+v", delta.Changes)
+	}
+
+	// Every user's change log counts on its own, changes of others leave no gaps
+	other := User{UserEmail: "other.changes@test.com", Password: "x"}
+	if err = store.CreateUser(&other); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	if err = store.RecordChange(other.UserEmail, &Change{Kind: ChangeSubscribed, PodcastURL: "https://other.change.test/rss"}); err != nil {
+		t.Fatalf("Failed to record change:%v", err)
+	}
+	for i, change := range delta.Changes {
+		if change.Seq != uint64(i+1) {
+			t.Errorf("Seq Want:%d\tHave:%d", i+1, change.Seq)
+		}
+	}
+	if others, err := store.GetChanges(other.UserEmail, "0", 10); err != nil || len(others.Changes) != 1 || others.Changes[0].Seq != 1 {
+		t.Errorf("Unexpected changes of another user:%+v %v", others, err)
+	}
+	page, err := store.GetChanges(email, start.Token, 1)
+	if err != nil || len(page.Changes) != 1 || !page.More {
+		t.Errorf("Unexpected page of changes:%+v %v", page, err)
+	}
+	if page, err = store.GetChanges(email, page.Token, 10); err != nil || len(page.Changes) != 2 || page.Token != delta.Token {
+		t.Errorf("Unexpected next page of changes:%+v %v", page, err)
+	}
+	if _, err = store.GetChanges(email, "yesterday", 10); err != ErrInvalidSyncToken {
+		t.Errorf("Error Want:%v\tHave:%v", ErrInvalidSyncToken, err)
+	}
+
+	// Uploaded changes lose against later changes of the same podcast or episode
+	position, played := int64(5), true
+	past, now := time.Now().Add(-time.Hour), time.Now()
+	upload := []Change{
+		{Kind: ChangeEpisodeState, PodcastItemID: &items[0].ID, Position: &position, ChangedAt: past},
+		{Kind: ChangeEpisodeState, PodcastItemID: &items[1].ID, Played: &played, ChangedAt: now},
+		{Kind: ChangeSubscribed, PodcastURL: "https://uploaded.change.test/rss", ChangedAt: now},
+		{Kind: ChangeUnsubscribed, PodcastURL: "https://added.change.test/rss", ChangedAt: past},
+		{Kind: ChangeSubscribed, PodcastURL: "https://unbuilt.change.test/rss", ChangedAt: now},
+	}
+	podcasts := map[string]Podcast{"https://uploaded.change.test/rss": {Title: "Uploaded Cast", URL: "https://uploaded.change.test/rss"}}
+	applied, err := store.UploadChanges(email, "laptop", upload, podcasts)
+	if err != nil || !reflect.DeepEqual(kinds(applied), []string{ChangeEpisodeState, ChangeSubscribed}) {
+		t.Fatalf("Unexpected applied changes:%+v %v", applied, err)
+	}
+	if applied[0].Seq <= delta.Changes[2].Seq || applied[1].Seq <= applied[0].Seq || applied[1].Device != "laptop" {
+		t.Errorf("Unexpected applied changes:%+v", applied)
+	}
+	if item, err := store.GetPodcastItemBySubscription(email, items[1].ID); err != nil || !item.Played {
+		t.Errorf("Episode was not marked played:%+v %v", item, err)
+	}
+	states, _ := store.GetPlaybackStates(email, time.Time{})
+	if len(states) != 2 || states[0].Position != 100 {
+		t.Errorf("Stale change moved playback state:%+v", states)
+	}
+
+	unsubscribe := []Change{{Kind: ChangeUnsubscribed, PodcastURL: "https://added.change.test/rss", ChangedAt: time.Now()}}
+	if applied, err = store.UploadChanges(email, "laptop", unsubscribe, nil); err != nil || len(applied) != 1 {
+		t.Fatalf("Unexpected applied changes:%+v %v", applied, err)
+	}
+	if user, err = store.GetUserByEmail(email); err != nil || len(user.Podcasts) != 2 ||
+		user.CheckSubscription(Podcast{URL: "https://added.change.test/rss"}) {
+		t.Errorf("Unexpected subscriptions:%+v %v", user.Podcasts, err)
+	}
+
+	type invalidTestCase struct {
+		name   string
+		change Change
+	}
+	testCases := []invalidTestCase{
+		{"Unknown Kind", Change{Kind: "renamed", PodcastURL: "https://change.test/rss"}},
+		{"New Episode", Change{Kind: ChangeNewEpisode, PodcastItemID: &items[0].ID}},
+		{"Missing URL", Change{Kind: ChangeSubscribed, PodcastURL: " "}},
+		{"Missing State", Change{Kind: ChangeEpisodeState, PodcastItemID: &items[0].ID}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := store.UploadChanges(email, "laptop", []Change{test.change}, nil); err != ErrInvalidChange {
+				t.Errorf("Error Want:%v\tHave:%v", ErrInvalidChange, err)
+			}
+		})
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres" // Postgres driver for gorm
+	"io"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Store is an interface that defines the methods needed for a podcast-manage service datastore
@@ -17,9 +21,79 @@ type Store interface {
 	UpdateUser(*User) error
 	DeleteUserByEmail(string) error
 	GetPodcastByID(uint) (Podcast, error)
+	GetPodcastItemBySubscription(userEmail string, itemID uint) (PodcastItem, error)
 	UpdatePodcastBySubscription(userEmail string, podcastURL string) error
 	GetPodcastBySubscription(userEmail string, podcastURL string) (Podcast, error)
 	CreatePodcast(*Podcast) error
+	Search(SearchQuery) (SearchResults, error)
+	GetSubscriptionTotals(userEmail string) ([]SubscriptionTotals, error)
+	GetSubscription(userEmail string, podcastURL string) (Subscription, error)
+	GetSubscriptions(userEmail string) ([]Subscription, error)
+	UpdateSubscription(*Subscription) error
+	CreateLabel(userEmail string, label *Label) error
+	GetLabels(userEmail, kind string) ([]Label, error)
+	RenameLabel(userEmail string, labelID uint, name string) error
+	ReorderLabels(userEmail, kind string, labelIDs []uint) error
+	DeleteLabel(userEmail string, labelID uint) error
+	SetSubscriptionFolder(userEmail, podcastURL string, folderID uint) error
+	SetSubscriptionTags(userEmail, podcastURL string, tagIDs []uint) error
+	GetSubscriptionTags(userEmail string) ([]SubscriptionTag, error)
+	GetQueue(userEmail string) (Queue, error)
+	UpdateQueue(userEmail string, version int64, op QueueOp) (Queue, error)
+	CreatePlaylist(userEmail string, playlist *Playlist) error
+	GetPlaylists(userEmail string) ([]Playlist, error)
+	GetPlaylist(userEmail string, playlistID uint) (Playlist, error)
+	GetPlaylistFeed(secret string) (Playlist, error)
+	UpdatePlaylist(userEmail string, playlist *Playlist) error
+	DeletePlaylist(userEmail string, playlistID uint) error
+	SetPlaylistItems(userEmail string, playlistID uint, itemIDs []uint) error
+	CreateWebhook(userEmail string, webhook *Webhook) error
+	GetWebhooks(userEmail string) ([]Webhook, error)
+	DeleteWebhook(userEmail string, webhookID uint) error
+	GetWebhookDeliveries(userEmail string, webhookID uint, limit int) ([]WebhookDelivery, error)
+	RetryWebhookDelivery(userEmail string, deliveryID uint) error
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]DueDelivery, error)
+	SaveWebhookDelivery(delivery *WebhookDelivery) error
+	GetDigestSchedule(userEmail string) (DigestSchedule, error)
+	SetDigestSettings(userEmail string, settings DigestSettings, now time.Time) (DigestSchedule, error)
+	UnsubscribeDigest(token string) error
+	ClaimDueDigests(now time.Time, limit int) ([]DueDigest, error)
+	MarkDigestSent(userID uint, sentAt time.Time) error
+	GetNewEpisodes(userID uint, since, until time.Time, limit int) ([]PlaylistItem, error)
+	ClaimHubRenewals(now time.Time, retry time.Duration, limit int) ([]DueHubSubscription, error)
+	SaveHubSubscription(subscription *HubSubscription) error
+	GetHubSubscription(subscriptionID uint) (HubSubscription, error)
+	VerifyHubIntent(subscriptionID uint, intent HubIntent, now time.Time) error
+	IngestHubContent(subscriptionID uint, content io.Reader) (int, error)
+	SavePlaybackState(userEmail string, state *PlaybackState) error
+	GetPlaybackStates(userEmail string, since time.Time) ([]PlaybackState, error)
+	GetDevices(userEmail string) ([]Device, error)
+	UpdateDevice(userEmail string, device *Device) error
+	GetSubscriptionChanges(userEmail, deviceID string, since time.Time) (SubscriptionChanges, error)
+	ApplySubscriptionChanges(userEmail, deviceID string, add []Podcast, remove []string) error
+	AddEpisodeActions(userEmail string, actions []EpisodeAction, now time.Time) ([]PlaybackState, error)
+	GetEpisodeActions(userEmail string, query EpisodeActionQuery) ([]EpisodeAction, error)
+	RecordChange(userEmail string, change *Change) error
+	GetChanges(userEmail, token string, limit int) (SyncDelta, error)
+	UploadChanges(userEmail, device string, changes []Change, podcasts map[string]Podcast) ([]Change, error)
+	CreateAccountToken(userEmail, purpose string, ttl time.Duration, now time.Time) (string, error)
+	VerifyEmail(token string, now time.Time) error
+	ResetPassword(token, passwordHash string, now time.Time) error
+	ChangePassword(userEmail, passwordHash string, now time.Time) error
+	RehashPassword(userEmail, oldHash, newHash string) error
+	CreateEmailChangeToken(userEmail, newEmail string, ttl time.Duration, now time.Time) (string, error)
+	ChangeEmail(token string, now time.Time) (string, string, error)
+	ExportUser(userEmail string, now time.Time) (UserExport, error)
+	CreateAccessToken(userEmail string, token *AccessToken, now time.Time) error
+	GetAccessTokens(userEmail string) ([]AccessToken, error)
+	DeleteAccessToken(userEmail string, tokenID uint) error
+	AuthenticateAccessToken(token string, now time.Time) (AccessToken, string, error)
+	LinkIdentity(issuer, subject, email string, now time.Time) (User, bool, error)
+	GetIdentities(userEmail string) ([]Identity, error)
+	PopularPodcasts(limit int) ([]DirectoryEntry, error)
+	TrendingPodcasts(since time.Time, limit int) ([]DirectoryEntry, error)
+	RecentPodcasts(limit int) ([]DirectoryEntry, error)
+	RelatedPodcasts(podcastURL string, limit int) ([]DirectoryEntry, error)
 }
 
 // Connect creates a connection to the database based on the Store's config. This must be called before any other datastore operations
@@ -44,15 +118,59 @@ func (dbStore *DBStore) Close() error {
 
 // Migrate creates database tables and constraints based on the models. This does not delete old structures
 func (dbStore *DBStore) Migrate() error {
-	if err := dbStore.Database.AutoMigrate(&Podcast{}, &User{}, &PodcastItem{}).Error; err != nil {
+	if err := dbStore.Database.AutoMigrate(&Podcast{}, &Subscription{}, &User{}, &PodcastItem{}, &Enclosure{}, &Label{}, &SubscriptionTag{}, &Queue{}, &QueueEntry{}, &Playlist{}, &PlaylistEntry{}, &Webhook{}, &WebhookDelivery{}, &DigestSchedule{}, &HubSubscription{}, &PlaybackState{}, &Device{}, &EpisodeAction{}, &Change{}, &ChangeLog{}, &AccountToken{}, &AccessToken{}, &Identity{}).Error; err != nil {
 		return err
 	}
-	return nil
+	if err := dbStore.migrateMediaLength(); err != nil {
+		return err
+	}
+	// Label names are unique per user and kind regardless of case, which struct tags cannot declare
+	if err := dbStore.Database.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_labels_user_kind_name ON labels (user_id, kind, lower(name))").Error; err != nil {
+		return err
+	}
+	return dbStore.migrateSearch()
+}
+
+// migrateMediaLength moves the string media_length of older databases into media_size and drops the column
+func (dbStore *DBStore) migrateMediaLength() error {
+	if !dbStore.Database.Dialect().HasColumn("podcast_items", "media_length") {
+		return nil
+	}
+	rows, err := dbStore.Database.Table("podcast_items").Select("id, media_length").Where("media_length IS NOT NULL").Rows()
+	if err != nil {
+		return err
+	}
+	sizes := map[uint]int64{}
+	for rows.Next() {
+		var id uint
+		var length *string
+		if err = rows.Scan(&id, &length); err != nil {
+			rows.Close()
+			return err
+		}
+		if length == nil {
+			continue
+		}
+		if size, err := strconv.ParseInt(strings.TrimSpace(*length), 10, 64); err == nil && size > 0 {
+			sizes[id] = size
+		}
+	}
+	rows.Close()
+	for id, size := range sizes {
+		if err = dbStore.Database.Table("podcast_items").Where("id = ?", id).UpdateColumn("media_size", size).Error; err != nil {
+			return err
+		}
+	}
+	if dbStore.dialect == "sqlite3" {
+		// Older SQLite versions cannot drop columns, the emptied column is left in place
+		return dbStore.Database.Exec("UPDATE podcast_items SET media_length = NULL").Error
+	}
+	return dbStore.Database.Model(&PodcastItem{}).DropColumn("media_length").Error
 }
 
 // DropExistingTables removes old tables completely from the database
 func (dbStore *DBStore) DropExistingTables() {
-	dbStore.Database.DropTableIfExists(&Podcast{}, &User{}, &PodcastItem{}, "subscriptions")
+	dbStore.Database.DropTableIfExists(&Podcast{}, &User{}, &PodcastItem{}, &Enclosure{}, &Label{}, &SubscriptionTag{}, &Queue{}, &QueueEntry{}, &Playlist{}, &PlaylistEntry{}, &Webhook{}, &WebhookDelivery{}, &DigestSchedule{}, &HubSubscription{}, &PlaybackState{}, &Device{}, &EpisodeAction{}, &Change{}, &ChangeLog{}, &AccountToken{}, &AccessToken{}, &Identity{}, "subscriptions")
 }
 
 // CleanStore clears the database's existing tables
@@ -60,9 +178,16 @@ func (dbStore *DBStore) CleanStore() {
 	dbStore.DropExistingTables()
 }
 
-// CreateUser creates a user in the database, returns err if user exists
+// CreateUser creates a user in the database, returns ErrEmailTaken if user exists
 func (dbStore *DBStore) CreateUser(user *User) error {
-	if err := dbStore.Database.Create(user).Error; err != nil {
+	taken, err := dbStore.emailTaken(user.UserEmail)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+	if err = dbStore.Database.Create(user).Error; err != nil {
 		return err
 	}
 	return nil
@@ -88,15 +213,14 @@ func (dbStore *DBStore) UpdateUser(user *User) error {
 	return nil
 }
 
-// DeleteUser soft-deletes the particular row in the database
+// DeleteUser removes the user from the database along with all data kept for them, see purgeUser
 func (dbStore *DBStore) DeleteUser(user *User) error {
-	if err := dbStore.Database.Delete(user).Error; err != nil {
-		return err
-	}
-	return nil
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		return purgeUser(tx, user.ID)
+	})
 }
 
-// DeleteUserByEmail deletes a user row in database based on the emailId
+// DeleteUserByEmail removes a user and all of their data from the database based on the emailId
 func (dbStore *DBStore) DeleteUserByEmail(email string) error {
 	user, err := dbStore.GetUserByEmail(email)
 	if err != nil {
@@ -115,33 +239,109 @@ func (dbStore *DBStore) CreatePodcast(podcast *Podcast) error {
 
 // GetPodcastBySubscription returns a populated podcast with items for the for the user subscription
 func (dbStore *DBStore) GetPodcastBySubscription(userEmail string, podcastURL string) (Podcast, error) {
+	_, podcast, err := dbStore.podcastBySubscription(userEmail, podcastURL)
+	return podcast, err
+}
+
+// podcastBySubscription returns the user along with the populated podcast of the user's subscription
+func (dbStore *DBStore) podcastBySubscription(userEmail string, podcastURL string) (User, Podcast, error) {
 	var podcast Podcast
 	var user User
 	if err := dbStore.Database.Where("user_email = ?", userEmail).Find(&user).Error; err != nil {
-		return podcast, err
+		return user, podcast, err
 	}
 	if err := dbStore.Database.Model(&user).Related(&podcast, "Podcasts").Where("url = ?", podcastURL).Error; err != nil {
-		return podcast, err
+		return user, podcast, err
 	}
 	if err := dbStore.Database.Model(&podcast).Related(&podcast.PodcastItems, "PodcastItems").Error; err != nil {
-		return podcast, err
+		return user, podcast, err
 	}
-	return podcast, nil
+	if err := dbStore.loadEnclosures(&podcast); err != nil {
+		return user, podcast, err
+	}
+	return user, podcast, nil
 }
 
-// UpdatePodcastBySubcription updates a podcast by checking for new items in the feed
+// UpdatePodcastBySubcription updates a podcast by checking for new items in the feed. New items are
+// announced to the user's webhooks and appended to the user's queue if the subscription has AutoQueue set
 func (dbStore *DBStore) UpdatePodcastBySubscription(userEmail string, podcastURL string) error {
-	podcast, err := dbStore.GetPodcastBySubscription(userEmail, podcastURL)
+	user, podcast, err := dbStore.podcastBySubscription(userEmail, podcastURL)
 	if err != nil {
 		return err
 	}
+	known := len(podcast.PodcastItems)
 	err = podcast.Update()
 	if err != nil {
 		return err
 	}
-	if err = dbStore.Database.Save(&podcast).Error; err != nil {
+	return dbStore.savePodcastUpdate(user.ID, &podcast, known)
+}
+
+// savePodcastUpdate saves a podcast of the user's subscription whose items past known are new, recording them in
+// the user's change log, announcing them to the subscriber's webhooks and hook if the subscription has Notifications set and
+// appending them to the subscriber's queue if it has AutoQueue set.
+// The items are saved in one transaction with the changes and deliveries, so that none of them is lost or sent twice
+func (dbStore *DBStore) savePodcastUpdate(userID uint, podcast *Podcast, known int) error {
+	if len(podcast.PodcastItems) == known {
+		return dbStore.Database.Save(podcast).Error
+	}
+
+	// Update adds the newest item first, they are passed on in the order they were published
+	var subscription Subscription
+	var newItems []PodcastItem
+	err := dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(podcast).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND podcast_id = ?", userID, podcast.ID).First(&subscription).Error; err != nil {
+			return err
+		}
+		var newItemIDs []uint
+		for i := len(podcast.PodcastItems) - 1; i >= known; i-- {
+			newItems = append(newItems, podcast.PodcastItems[i])
+			newItemIDs = append(newItemIDs, podcast.PodcastItems[i].ID)
+		}
+		now := time.Now()
+		for i := range newItems {
+			change := Change{Kind: ChangeNewEpisode, PodcastURL: podcast.URL, PodcastItemID: &newItems[i].ID, ChangedAt: now}
+			if err := recordChange(tx, subscription.UserID, &change); err != nil {
+				return err
+			}
+		}
+		if subscription.Notifications {
+			if err := enqueueNewEpisodes(tx, subscription.UserID, *podcast, newItems); err != nil {
+				return err
+			}
+		}
+		if subscription.AutoQueue {
+			return appendToQueue(tx, subscription.UserID, newItemIDs)
+		}
+		return nil
+	})
+	if err != nil || !subscription.Notifications {
+		return err
+	}
+	return dbStore.notifyNewEpisodes(subscription.UserID, *podcast, newItems)
+}
+
+// NewEpisodesHook is called with the user's email and the new episodes found for one of the user's subscriptions
+type NewEpisodesHook func(userEmail string, payload NewEpisodesPayload)
+
+// OnNewEpisodes sets the hook called after the new episodes of a subscription were saved
+func (dbStore *DBStore) OnNewEpisodes(hook NewEpisodesHook) {
+	dbStore.newEpisodes = hook
+}
+
+// notifyNewEpisodes passes the new items of the user's podcast on to the new episodes hook, if one is set
+func (dbStore *DBStore) notifyNewEpisodes(userID uint, podcast Podcast, newItems []PodcastItem) error {
+	if dbStore.newEpisodes == nil {
+		return nil
+	}
+	var user User
+	if err := dbStore.Database.Select("user_email").Where("id = ?", userID).First(&user).Error; err != nil {
 		return err
 	}
+	dbStore.newEpisodes(user.UserEmail, newEpisodesPayload(podcast, newItems))
 	return nil
 }
 
@@ -154,15 +354,56 @@ func (dbStore *DBStore) GetPodcastByID(podcastID uint) (Podcast, error) {
 	if err := dbStore.Database.Model(&podcast).Related(&podcast.PodcastItems, "PodcastItems").Error; err != nil {
 		return podcast, err
 	}
+	if err := dbStore.loadEnclosures(&podcast); err != nil {
+		return podcast, err
+	}
 	return podcast, nil
 }
 
+// GetPodcastItemBySubscription returns a podcast item if it belongs to one of the user's subscriptions
+func (dbStore *DBStore) GetPodcastItemBySubscription(userEmail string, itemID uint) (PodcastItem, error) {
+	var item PodcastItem
+	err := dbStore.Database.
+		Joins("JOIN subscriptions ON subscriptions.podcast_id = podcast_items.podcast_id").
+		Joins("JOIN users ON users.id = subscriptions.user_id").
+		Where("users.user_email = ? AND podcast_items.id = ?", userEmail, itemID).
+		First(&item).Error
+	if err != nil {
+		return item, err
+	}
+	return item, nil
+}
+
+// loadEnclosures populates the enclosures of the podcast's items
+func (dbStore *DBStore) loadEnclosures(podcast *Podcast) error {
+	if len(podcast.PodcastItems) == 0 {
+		return nil
+	}
+	var enclosures []Enclosure
+	err := dbStore.Database.Select("enclosures.*").Joins("JOIN podcast_items ON podcast_items.id = enclosures.podcast_item_id").
+		Where("podcast_items.podcast_id = ?", podcast.ID).Order("enclosures.id").Find(&enclosures).Error
+	if err != nil {
+		return err
+	}
+	index := map[uint]int{}
+	for i, item := range podcast.PodcastItems {
+		index[item.ID] = i
+	}
+	for _, enclosure := range enclosures {
+		if i, ok := index[enclosure.PodcastItemID]; ok {
+			podcast.PodcastItems[i].Enclosures = append(podcast.PodcastItems[i].Enclosures, enclosure)
+		}
+	}
+	return nil
+}
+
 // NewDBStore returns a new DBStore with the dialect and connection string set
 func NewDBStore(dialect string, connectionString string) *DBStore {
 	dbStore := DBStore{
 		dialect,
 		connectionString,
 		nil,
+		nil,
 	}
 	return &dbStore
 }
@@ -172,4 +413,5 @@ type DBStore struct {
 	dialect          string
 	connectionString string
 	Database         *gorm.DB
+	newEpisodes      NewEpisodesHook
 }
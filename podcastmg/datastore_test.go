@@ -22,6 +22,7 @@ func init() {
 		*dbDialect,
 		*dbConnectionString,
 		nil,
+		nil,
 	}
 	if *dbDialect == "sqlite3" {
 		os.Remove(*dbConnectionString)
@@ -68,6 +69,7 @@ func TestDBMigration(t *testing.T) {
 		"podcast_items",
 		"users",
 		"subscriptions",
+		"enclosures",
 	}
 	store.Connect()
 	err := store.Migrate()
@@ -92,3 +94,111 @@ func TestDBMigration(t *testing.T) {
 		t.Errorf("Migrating closed store should return error, but did not")
 	}
 }
+
+func TestMediaLengthMigration(t *testing.T) {
+	store.Connect()
+	defer store.Close()
+	store.Migrate()
+
+	item := PodcastItem{Title: "Old Item"}
+	store.Database.Create(&item)
+	store.Database.Exec("ALTER TABLE podcast_items ADD COLUMN media_length varchar(255)")
+	store.Database.Exec("UPDATE podcast_items SET media_length = ? WHERE id = ?", "1234", item.ID)
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate DB:%v", err)
+	}
+	if *dbDialect != "sqlite3" && store.Database.Dialect().HasColumn("podcast_items", "media_length") {
+		t.Errorf("Migration should have dropped media_length")
+	}
+	var migrated PodcastItem
+	store.Database.First(&migrated, item.ID)
+	if migrated.MediaSize != 1234 {
+		t.Errorf("MediaSize Want:1234\tHave:%d", migrated.MediaSize)
+	}
+}
+
+// enableNotifications opts all subscriptions of the user in to new episode notifications
+func enableNotifications(t *testing.T, userID uint) {
+	if err := store.Database.Model(&Subscription{}).Where("user_id = ?", userID).UpdateColumn("notifications", true).Error; err != nil {
+		t.Fatalf("Failed to enable notifications:%v", err)
+	}
+}
+
+func TestNewEpisodesHook(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	user := User{UserEmail: "hook@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Hook Cast", URL: "hookcast.test/xml", PodcastItems: []PodcastItem{{Title: "One"}}},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	var emails []string
+	var payloads []NewEpisodesPayload
+	store.OnNewEpisodes(func(userEmail string, payload NewEpisodesPayload) {
+		emails = append(emails, userEmail)
+		payloads = append(payloads, payload)
+	})
+	defer store.OnNewEpisodes(nil)
+
+	podcast := user.Podcasts[0]
+	if err := store.savePodcastUpdate(user.ID, &podcast, 1); err != nil {
+		t.Fatalf("Failed to save podcast:%v", err)
+	}
+	if len(payloads) != 0 {
+		t.Errorf("Hook called without new episodes:%+v", payloads)
+	}
+	podcast.PodcastItems = append(podcast.PodcastItems, PodcastItem{Title: "Four"})
+	if err := store.savePodcastUpdate(user.ID, &podcast, 1); err != nil {
+		t.Fatalf("Failed to save podcast:%v", err)
+	}
+	if len(payloads) != 0 {
+		t.Errorf("Hook called without notifications:%+v", payloads)
+	}
+	enableNotifications(t, user.ID)
+	podcast.PodcastItems = append(podcast.PodcastItems, PodcastItem{Title: "Three"}, PodcastItem{Title: "Two"})
+	if err := store.savePodcastUpdate(user.ID, &podcast, 2); err != nil {
+		t.Fatalf("Failed to save podcast:%v", err)
+	}
+	if len(payloads) != 1 || emails[0] != user.UserEmail || payloads[0].Podcast.Title != "Hook Cast" ||
+		len(payloads[0].Episodes) != 2 || payloads[0].Episodes[0].Title != "Two" {
+		t.Errorf("Unexpected hook calls:%v %+v", emails, payloads)
+	}
+}
+
+func TestPodcastUpdateRollback(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	user := User{UserEmail: "rollback@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Rollback Cast", URL: "rollbackcast.test/xml", PodcastItems: []PodcastItem{{Title: "One"}}},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	if err := store.Database.Create(&Webhook{UserID: user.ID, URL: "https://203.0.113.10/hook", Secret: "s"}).Error; err != nil {
+		t.Fatalf("Failed to create webhook:%v", err)
+	}
+	enableNotifications(t, user.ID)
+
+	// A failing outbox insert leaves neither the new items nor their changes behind
+	store.Database.DropTable(&WebhookDelivery{})
+	podcast := user.Podcasts[0]
+	podcast.PodcastItems = append(podcast.PodcastItems, PodcastItem{Title: "Two"})
+	if err := store.savePodcastUpdate(user.ID, &podcast, 1); err == nil {
+		t.Fatalf("Update should fail without the outbox")
+	}
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate DB:%v", err)
+	}
+	var items, changes int
+	store.Database.Model(&PodcastItem{}).Where("podcast_id = ?", podcast.ID).Count(&items)
+	store.Database.Model(&Change{}).Where("user_id = ?", user.ID).Count(&changes)
+	if items != 1 || changes != 0 {
+		t.Errorf("Items Want:1\tHave:%d\tChanges Want:0\tHave:%d", items, changes)
+	}
+}
@@ -0,0 +1,180 @@
+package podcastmg
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	// DigestOff disables the email digest
+	DigestOff = "off"
+
+	// DigestDaily sends the email digest every day at the scheduled hour
+	DigestDaily = "daily"
+
+	// DigestWeekly sends the email digest every week on the scheduled weekday and hour
+	DigestWeekly = "weekly"
+
+	// MaxDigestItems is the largest number of episodes listed in a digest
+	MaxDigestItems = 200
+)
+
+var (
+	// ErrInvalidDigestSettings indicates an unknown digest frequency or an hour or weekday out of range
+	ErrInvalidDigestSettings = errors.New("Invalid digest settings")
+
+	// ErrDigestNotFound indicates an unsubscribe token which does not belong to any digest
+	ErrDigestNotFound = errors.New("Digest not found")
+)
+
+// DigestSettings are the user's preferences for the email digest of new episodes. Hours are in UTC
+type DigestSettings struct {
+	Frequency string       `gorm:"not null;default:'off'" json:"frequency"`
+	Hour      int          `gorm:"not null;default:0" json:"hour"`
+	Weekday   time.Weekday `gorm:"not null;default:0" json:"weekday"`
+}
+
+// Validate checks the frequency and that the hour and weekday are within range
+func (settings DigestSettings) Validate() error {
+	switch settings.Frequency {
+	case DigestOff, DigestDaily, DigestWeekly:
+	default:
+		return ErrInvalidDigestSettings
+	}
+	if settings.Hour < 0 || settings.Hour > 23 || settings.Weekday < time.Sunday || settings.Weekday > time.Saturday {
+		return ErrInvalidDigestSettings
+	}
+	return nil
+}
+
+// Next returns the first scheduled time of the digest after the given time, nil if the digest is off
+func (settings DigestSettings) Next(after time.Time) *time.Time {
+	if settings.Frequency != DigestDaily && settings.Frequency != DigestWeekly {
+		return nil
+	}
+	after = after.UTC()
+	next := time.Date(after.Year(), after.Month(), after.Day(), settings.Hour, 0, 0, 0, time.UTC)
+	if settings.Frequency == DigestWeekly {
+		next = next.AddDate(0, 0, (int(settings.Weekday)-int(next.Weekday())+7)%7)
+	}
+	for !next.After(after) {
+		if settings.Frequency == DigestWeekly {
+			next = next.AddDate(0, 0, 7)
+		} else {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return &next
+}
+
+// DigestSchedule is the user's email digest. Token identifies the digest in unsubscribe links
+type DigestSchedule struct {
+	UserID uint `gorm:"primary_key;auto_increment:false" json:"-"`
+	DigestSettings
+	Token      string     `gorm:"not null;unique_index" json:"-"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	NextAt     *time.Time `gorm:"index" json:"next_at,omitempty"`
+}
+
+// DueDigest is a digest which is due to be sent along with the email of its user
+type DueDigest struct {
+	DigestSchedule
+	UserEmail string
+}
+
+// GetDigestSchedule returns the user's email digest, a user who never set it up has it turned off
+func (dbStore *DBStore) GetDigestSchedule(userEmail string) (DigestSchedule, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return DigestSchedule{}, err
+	}
+	schedule := DigestSchedule{UserID: userID, DigestSettings: DigestSettings{Frequency: DigestOff}}
+	err = dbStore.Database.Where("user_id = ?", userID).First(&schedule).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return schedule, nil
+	}
+	return schedule, err
+}
+
+// SetDigestSettings saves the user's digest preferences and schedules the next digest after now.
+// The first digest lists the episodes found since the digest was turned on
+func (dbStore *DBStore) SetDigestSettings(userEmail string, settings DigestSettings, now time.Time) (DigestSchedule, error) {
+	if err := settings.Validate(); err != nil {
+		return DigestSchedule{}, err
+	}
+	schedule, err := dbStore.GetDigestSchedule(userEmail)
+	if err != nil {
+		return schedule, err
+	}
+	if schedule.Token == "" {
+		if schedule.Token, err = newSecret(); err != nil {
+			return schedule, err
+		}
+	}
+	if schedule.Frequency == DigestOff || schedule.LastSentAt == nil {
+		schedule.LastSentAt = &now
+	}
+	schedule.DigestSettings = settings
+	schedule.NextAt = settings.Next(now)
+	return schedule, dbStore.Database.Save(&schedule).Error
+}
+
+// UnsubscribeDigest turns off the digest identified by the unsubscribe token
+func (dbStore *DBStore) UnsubscribeDigest(token string) error {
+	if token == "" {
+		return ErrDigestNotFound
+	}
+	update := dbStore.Database.Model(&DigestSchedule{}).Where("token = ?", token).
+		Updates(map[string]interface{}{"frequency": DigestOff, "next_at": gorm.Expr("NULL")})
+	if update.Error != nil {
+		return update.Error
+	}
+	if update.RowsAffected == 0 {
+		return ErrDigestNotFound
+	}
+	return nil
+}
+
+// ClaimDueDigests returns up to limit digests which are due at now and moves each to its next scheduled time,
+// so that every digest is claimed by a single sender
+func (dbStore *DBStore) ClaimDueDigests(now time.Time, limit int) ([]DueDigest, error) {
+	var due []DueDigest
+	err := dbStore.Database.Table("digest_schedules").
+		Select("digest_schedules.*, users.user_email").
+		Joins("JOIN users ON users.id = digest_schedules.user_id AND users.deleted_at IS NULL").
+		Where("digest_schedules.frequency <> ? AND digest_schedules.next_at <= ?", DigestOff, now).
+		Order("digest_schedules.next_at").Limit(limit).Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+	claimed := []DueDigest{}
+	for _, digest := range due {
+		claim := dbStore.Database.Model(&DigestSchedule{}).
+			Where("user_id = ? AND frequency <> ? AND next_at <= ?", digest.UserID, DigestOff, now).
+			UpdateColumn("next_at", digest.Next(now))
+		if claim.Error != nil {
+			return claimed, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			claimed = append(claimed, digest)
+		}
+	}
+	return claimed, nil
+}
+
+// MarkDigestSent records that the user's digest listed the episodes found up to sentAt
+func (dbStore *DBStore) MarkDigestSent(userID uint, sentAt time.Time) error {
+	return dbStore.Database.Model(&DigestSchedule{}).Where("user_id = ?", userID).UpdateColumn("last_sent_at", sentAt).Error
+}
+
+// GetNewEpisodes returns up to limit episodes of the user's subscriptions with notifications found after since and
+// up to until, grouped by podcast with the newest episodes first
+func (dbStore *DBStore) GetNewEpisodes(userID uint, since, until time.Time, limit int) ([]PlaylistItem, error) {
+	items := []PlaylistItem{}
+	err := dbStore.subscribedItems(userID).Where("subscriptions.notifications = ?", true).
+		Where("podcast_items.created_at > ? AND podcast_items.created_at <= ?", since, until).
+		Order("podcasts.title, podcasts.id, podcast_items.published DESC, podcast_items.id DESC").
+		Limit(limit).Find(&items).Error
+	return items, err
+}
@@ -0,0 +1,110 @@
+package podcastmg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestNext(t *testing.T) {
+	// Friday
+	after := time.Date(2018, 1, 5, 10, 30, 0, 0, time.UTC)
+	type nextTestCase struct {
+		name     string
+		settings DigestSettings
+		want     time.Time
+	}
+	testCases := []nextTestCase{
+		{"Daily Later Today", DigestSettings{Frequency: DigestDaily, Hour: 18}, time.Date(2018, 1, 5, 18, 0, 0, 0, time.UTC)},
+		{"Daily Tomorrow", DigestSettings{Frequency: DigestDaily, Hour: 8}, time.Date(2018, 1, 6, 8, 0, 0, 0, time.UTC)},
+		{"Weekly Later This Week", DigestSettings{Frequency: DigestWeekly, Hour: 7, Weekday: time.Sunday}, time.Date(2018, 1, 7, 7, 0, 0, 0, time.UTC)},
+		{"Weekly Today", DigestSettings{Frequency: DigestWeekly, Hour: 11, Weekday: time.Friday}, time.Date(2018, 1, 5, 11, 0, 0, 0, time.UTC)},
+		{"Weekly Next Week", DigestSettings{Frequency: DigestWeekly, Hour: 10, Weekday: time.Friday}, time.Date(2018, 1, 12, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if have := test.settings.Next(after); have == nil || !have.Equal(test.want) {
+				t.Errorf("Want:%v\tHave:%v", test.want, have)
+			}
+		})
+	}
+	if next := (DigestSettings{Frequency: DigestOff}).Next(after); next != nil {
+		t.Errorf("Digest turned off is scheduled at %v", next)
+	}
+}
+
+func TestDigestSchedule(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "digest@test.com"
+	enabled := time.Now().Add(-time.Hour)
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "Digest Cast", URL: "digestcast.test/xml", PodcastItems: []PodcastItem{
+			{Title: "Old", CreatedAt: enabled.Add(-time.Hour)},
+			{Title: "New", CreatedAt: enabled.Add(time.Minute)},
+		}},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	schedule, err := store.GetDigestSchedule(email)
+	if err != nil || schedule.Frequency != DigestOff || schedule.NextAt != nil {
+		t.Fatalf("Unexpected default schedule:%+v %v", schedule, err)
+	}
+	if _, err = store.SetDigestSettings(email, DigestSettings{Frequency: "hourly"}, enabled); err != ErrInvalidDigestSettings {
+		t.Errorf("Error Want:%v\tHave:%v", ErrInvalidDigestSettings, err)
+	}
+	if _, err = store.SetDigestSettings(email, DigestSettings{Frequency: DigestDaily, Hour: 24}, enabled); err != ErrInvalidDigestSettings {
+		t.Errorf("Error Want:%v\tHave:%v", ErrInvalidDigestSettings, err)
+	}
+	settings := DigestSettings{Frequency: DigestDaily, Hour: enabled.UTC().Hour()}
+	if schedule, err = store.SetDigestSettings(email, settings, enabled); err != nil {
+		t.Fatalf("Failed to set digest settings:%v", err)
+	}
+	if schedule.Token == "" || schedule.NextAt == nil || !schedule.NextAt.Equal(*settings.Next(enabled)) {
+		t.Fatalf("Unexpected schedule:%+v", schedule)
+	}
+
+	// The digest is claimed once when it is due
+	if due, err := store.ClaimDueDigests(enabled, 10); err != nil || len(due) != 0 {
+		t.Errorf("Unexpected due digests before schedule:%+v %v", due, err)
+	}
+	now := schedule.NextAt.Add(time.Minute)
+	due, err := store.ClaimDueDigests(now, 10)
+	if err != nil || len(due) != 1 || due[0].UserEmail != email || !due[0].LastSentAt.Equal(enabled) {
+		t.Fatalf("Unexpected due digests:%+v %v", due, err)
+	}
+	if again, err := store.ClaimDueDigests(now, 10); err != nil || len(again) != 0 {
+		t.Errorf("Digest was claimed twice:%+v %v", again, err)
+	}
+
+	// Only subscriptions with notifications turned on are part of the digest
+	episodes, err := store.GetNewEpisodes(due[0].UserID, enabled, now, MaxDigestItems)
+	if err != nil || len(episodes) != 0 {
+		t.Errorf("Unexpected episodes without notifications:%+v %v", episodes, err)
+	}
+	enableNotifications(t, user.ID)
+	episodes, err = store.GetNewEpisodes(due[0].UserID, enabled, now, MaxDigestItems)
+	if err != nil || len(episodes) != 1 || episodes[0].Title != "New" || episodes[0].PodcastTitle != "Digest Cast" {
+		t.Errorf("Unexpected new episodes:%+v %v", episodes, err)
+	}
+	if err = store.MarkDigestSent(due[0].UserID, now); err != nil {
+		t.Fatalf("Failed to mark digest sent:%v", err)
+	}
+	if episodes, err = store.GetNewEpisodes(due[0].UserID, now, now.Add(time.Hour), MaxDigestItems); err != nil || len(episodes) != 0 {
+		t.Errorf("Unexpected episodes after digest:%+v %v", episodes, err)
+	}
+
+	// Unsubscribe links turn the digest off
+	if err = store.UnsubscribeDigest("unknown"); err != ErrDigestNotFound {
+		t.Errorf("Error Want:%v\tHave:%v", ErrDigestNotFound, err)
+	}
+	if err = store.UnsubscribeDigest(schedule.Token); err != nil {
+		t.Fatalf("Failed to unsubscribe:%v", err)
+	}
+	if schedule, err = store.GetDigestSchedule(email); err != nil || schedule.Frequency != DigestOff || schedule.NextAt != nil {
+		t.Errorf("Unexpected schedule after unsubscribe:%+v %v", schedule, err)
+	}
+}
@@ -0,0 +1,121 @@
+package podcastmg
+
+import (
+	"time"
+)
+
+// DirectoryEntry is a podcast of the shared catalog along with its subscription statistics
+type DirectoryEntry struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageURL    string    `json:"image_url"`
+	URL         string    `json:"url"`
+	Subscribers int       `json:"subscribers"`
+	Growth      int       `json:"growth,omitempty"`
+	Shared      int       `json:"shared_subscribers,omitempty"`
+	FirstSeen   time.Time `json:"first_seen"`
+}
+
+// directoryRow is an aggregate over all copies of a podcast, PodcastID is the oldest copy
+type directoryRow struct {
+	URL         string
+	PodcastID   uint
+	Subscribers int
+	Growth      int
+	Shared      int
+}
+
+// Podcasts are stored once per subscriber, directory queries aggregate the copies by feed url
+const directorySelect = "podcasts.url AS url, min(podcasts.id) AS podcast_id, count(DISTINCT subscriptions.user_id) AS subscribers"
+
+const directoryJoins = "JOIN subscriptions ON subscriptions.podcast_id = podcasts.id " +
+	"JOIN users ON users.id = subscriptions.user_id AND users.deleted_at IS NULL"
+
+// PopularPodcasts returns the podcasts with the most subscribers
+func (dbStore *DBStore) PopularPodcasts(limit int) ([]DirectoryEntry, error) {
+	var rows []directoryRow
+	err := dbStore.Database.Table("podcasts").Select(directorySelect).Joins(directoryJoins).
+		Where("podcasts.deleted_at IS NULL").Group("podcasts.url").
+		Order("subscribers DESC, podcast_id").Limit(limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return dbStore.directoryEntries(rows)
+}
+
+// TrendingPodcasts returns the podcasts which gained the most subscriptions since the given time
+func (dbStore *DBStore) TrendingPodcasts(since time.Time, limit int) ([]DirectoryEntry, error) {
+	var rows []directoryRow
+	err := dbStore.Database.Table("podcasts").
+		Select(directorySelect+", sum(CASE WHEN podcasts.created_at >= ? THEN 1 ELSE 0 END) AS growth", since).
+		Joins(directoryJoins).Where("podcasts.deleted_at IS NULL").Group("podcasts.url").
+		Having("sum(CASE WHEN podcasts.created_at >= ? THEN 1 ELSE 0 END) > 0", since).
+		Order("growth DESC, subscribers DESC, podcast_id").Limit(limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return dbStore.directoryEntries(rows)
+}
+
+// RecentPodcasts returns the podcasts most recently added to the catalog
+func (dbStore *DBStore) RecentPodcasts(limit int) ([]DirectoryEntry, error) {
+	var rows []directoryRow
+	err := dbStore.Database.Table("podcasts").Select(directorySelect).Joins(directoryJoins).
+		Where("podcasts.deleted_at IS NULL").Group("podcasts.url").
+		Order("podcast_id DESC").Limit(limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return dbStore.directoryEntries(rows)
+}
+
+// RelatedPodcasts returns the podcasts most often subscribed to by the subscribers of the given podcast
+func (dbStore *DBStore) RelatedPodcasts(podcastURL string, limit int) ([]DirectoryEntry, error) {
+	var rows []directoryRow
+	err := dbStore.Database.Table("podcasts").
+		Select(directorySelect+", count(DISTINCT subscribers.user_id) AS shared").
+		Joins(directoryJoins).
+		Joins("LEFT JOIN (SELECT subscriptions.user_id FROM subscriptions JOIN podcasts ON podcasts.id = subscriptions.podcast_id "+
+			"WHERE podcasts.url = ? AND podcasts.deleted_at IS NULL) subscribers ON subscribers.user_id = subscriptions.user_id", podcastURL).
+		Where("podcasts.deleted_at IS NULL AND podcasts.url <> ?", podcastURL).Group("podcasts.url").
+		Having("count(DISTINCT subscribers.user_id) > 0").
+		Order("shared DESC, subscribers DESC, podcast_id").Limit(limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return dbStore.directoryEntries(rows)
+}
+
+// directoryEntries fills the aggregated rows with the details of the oldest copy of each podcast
+func (dbStore *DBStore) directoryEntries(rows []directoryRow) ([]DirectoryEntry, error) {
+	if len(rows) == 0 {
+		return []DirectoryEntry{}, nil
+	}
+	var ids []uint
+	for _, row := range rows {
+		ids = append(ids, row.PodcastID)
+	}
+	var podcasts []Podcast
+	if err := dbStore.Database.Where("id IN (?)", ids).Find(&podcasts).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uint]Podcast{}
+	for _, podcast := range podcasts {
+		byID[podcast.ID] = podcast
+	}
+	entries := make([]DirectoryEntry, 0, len(rows))
+	for _, row := range rows {
+		podcast := byID[row.PodcastID]
+		entries = append(entries, DirectoryEntry{
+			Title:       podcast.Title,
+			Description: podcast.Description,
+			ImageURL:    podcast.ImageURL,
+			URL:         row.URL,
+			Subscribers: row.Subscribers,
+			Growth:      row.Growth,
+			Shared:      row.Shared,
+			FirstSeen:   podcast.CreatedAt,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,87 @@
+package podcastmg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func directoryTestPodcast(title string) Podcast {
+	return Podcast{Title: title, URL: strings.ToLower(title) + ".test/xml"}
+}
+
+func directoryTitles(entries []DirectoryEntry) string {
+	var titles []string
+	for _, entry := range entries {
+		titles = append(titles, entry.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestDirectory(t *testing.T) {
+	store.Connect()
+	store.DropExistingTables()
+	store.Migrate()
+	defer store.Close()
+
+	// Every subscriber holds its own copy of a podcast
+	subscriptions := map[string][]string{
+		"dir1@test.com": {"Alpha", "Beta", "Gamma"},
+		"dir2@test.com": {"Alpha", "Beta"},
+		"dir3@test.com": {"Alpha", "Delta"},
+	}
+	for _, email := range []string{"dir1@test.com", "dir2@test.com", "dir3@test.com"} {
+		user := User{UserEmail: email, Password: "x"}
+		for _, title := range subscriptions[email] {
+			user.Podcasts = append(user.Podcasts, directoryTestPodcast(title))
+		}
+		if err := store.CreateUser(&user); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+	}
+	// Only the Delta and one Beta subscription are recent
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	store.Database.Model(&Podcast{}).Where("url <> ?", "delta.test/xml").UpdateColumn("created_at", old)
+	var beta Podcast
+	store.Database.Where("url = ?", "beta.test/xml").Order("id DESC").First(&beta)
+	store.Database.Model(&beta).UpdateColumn("created_at", time.Now())
+
+	type directoryTestCase struct {
+		name   string
+		list   func() ([]DirectoryEntry, error)
+		titles string
+	}
+	testCases := []directoryTestCase{
+		{"Popular", func() ([]DirectoryEntry, error) { return store.PopularPodcasts(10) }, "Alpha,Beta,Gamma,Delta"},
+		{"Popular Limited", func() ([]DirectoryEntry, error) { return store.PopularPodcasts(2) }, "Alpha,Beta"},
+		{"Trending", func() ([]DirectoryEntry, error) { return store.TrendingPodcasts(time.Now().Add(-time.Hour), 10) }, "Beta,Delta"},
+		{"Recent", func() ([]DirectoryEntry, error) { return store.RecentPodcasts(10) }, "Delta,Gamma,Beta,Alpha"},
+		{"Related", func() ([]DirectoryEntry, error) { return store.RelatedPodcasts("beta.test/xml", 10) }, "Alpha,Gamma"},
+		{"Related Unknown", func() ([]DirectoryEntry, error) { return store.RelatedPodcasts("unknown.test/xml", 10) }, ""},
+	}
+	for _, testCase := range testCases {
+		entries, err := testCase.list()
+		if err != nil {
+			t.Errorf("%s\tFailed to list directory:%v", testCase.name, err)
+			continue
+		}
+		if titles := directoryTitles(entries); titles != testCase.titles {
+			t.Errorf("%s\tWant:%s\tHave:%s", testCase.name, testCase.titles, titles)
+		}
+	}
+
+	t.Run("Counts", func(t *testing.T) {
+		popular, _ := store.PopularPodcasts(1)
+		if len(popular) != 1 || popular[0].Subscribers != 3 || popular[0].URL != "alpha.test/xml" {
+			t.Errorf("Unexpected popular entry:%v", popular)
+		}
+		related, _ := store.RelatedPodcasts("beta.test/xml", 1)
+		if len(related) != 1 || related[0].Shared != 2 || related[0].Subscribers != 3 {
+			t.Errorf("Unexpected related entry:%v", related)
+		}
+		trending, _ := store.TrendingPodcasts(time.Now().Add(-time.Hour), 1)
+		if len(trending) != 1 || trending[0].Growth != 1 || trending[0].Subscribers != 2 {
+			t.Errorf("Unexpected trending entry:%v", trending)
+		}
+	})
+}
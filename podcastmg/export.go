@@ -0,0 +1,208 @@
+package podcastmg
+
+import (
+	"time"
+)
+
+// UserExport is everything kept for a user, in a form which is readable without the service. Episodes are
+// named by their podcast and media urls since item ids only mean something to this service
+type UserExport struct {
+	ExportedAt    time.Time            `json:"exported_at"`
+	Profile       ExportProfile        `json:"profile"`
+	Subscriptions []ExportSubscription `json:"subscriptions"`
+	EpisodeStates []ExportEpisodeState `json:"episode_states"`
+	Queue         []ExportEpisode      `json:"queue"`
+	Playlists     []ExportPlaylist     `json:"playlists"`
+	Labels        []Label              `json:"labels"`
+	Webhooks      []ExportWebhook      `json:"webhooks"`
+	Digest        DigestSettings       `json:"digest"`
+	Devices       []Device             `json:"devices"`
+	AccessTokens  []AccessToken        `json:"access_tokens"`
+	Identities    []Identity           `json:"identities"`
+}
+
+// ExportProfile is the user's account
+type ExportProfile struct {
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExportSubscription is a subscribed podcast along with the user's settings, folder and tags for it
+type ExportSubscription struct {
+	URL      string               `json:"url"`
+	Title    string               `json:"title"`
+	Settings SubscriptionSettings `json:"settings"`
+	Folder   string               `json:"folder,omitempty"`
+	Tags     []string             `json:"tags,omitempty"`
+}
+
+// ExportEpisode names an episode by its podcast
+type ExportEpisode struct {
+	PodcastURL string `json:"podcast_url"`
+	Title      string `json:"title"`
+	MediaURL   string `json:"media_url,omitempty"`
+}
+
+// ExportEpisodeState is the playback state of an episode
+type ExportEpisodeState struct {
+	ExportEpisode
+	Position  int64     `json:"position"`
+	Played    bool      `json:"played"`
+	Device    string    `json:"device,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportPlaylist is a playlist with the rules of a smart playlist or the episodes of a manual one
+type ExportPlaylist struct {
+	Name     string          `json:"name"`
+	Kind     string          `json:"kind"`
+	Rules    *PlaylistRules  `json:"rules,omitempty"`
+	Episodes []ExportEpisode `json:"episodes,omitempty"`
+}
+
+// ExportWebhook is a webhook without its secret
+type ExportWebhook struct {
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportEpisodes returns the episodes with the given ids by id, episodes of podcasts the user unsubscribed from
+// included
+func (dbStore *DBStore) exportEpisodes(itemIDs []uint) (map[uint]ExportEpisode, error) {
+	episodes := map[uint]ExportEpisode{}
+	if len(itemIDs) == 0 {
+		return episodes, nil
+	}
+	var rows []struct {
+		ID uint
+		ExportEpisode
+	}
+	err := dbStore.Database.Table("podcast_items").
+		Select("podcast_items.id, podcasts.url AS podcast_url, podcast_items.title, podcast_items.media_url").
+		Joins("JOIN podcasts ON podcasts.id = podcast_items.podcast_id").
+		Where("podcast_items.id IN (?)", itemIDs).Scan(&rows).Error
+	for _, row := range rows {
+		episodes[row.ID] = row.ExportEpisode
+	}
+	return episodes, err
+}
+
+// ExportUser returns all data kept for the user
+func (dbStore *DBStore) ExportUser(userEmail string, now time.Time) (UserExport, error) {
+	export := UserExport{ExportedAt: now, Subscriptions: []ExportSubscription{}, EpisodeStates: []ExportEpisodeState{},
+		Queue: []ExportEpisode{}, Playlists: []ExportPlaylist{}, Webhooks: []ExportWebhook{}}
+	user, err := dbStore.GetUserByEmail(userEmail)
+	if err != nil {
+		return export, err
+	}
+	export.Profile = ExportProfile{Email: user.UserEmail, EmailVerified: user.EmailVerified, CreatedAt: user.CreatedAt}
+
+	if err = dbStore.Database.Where("user_id = ?", user.ID).Order("kind, position, id").Find(&export.Labels).Error; err != nil {
+		return export, err
+	}
+	labels := map[uint]string{}
+	for _, label := range export.Labels {
+		labels[label.ID] = label.Name
+	}
+	subscriptions, err := dbStore.GetSubscriptions(userEmail)
+	if err != nil {
+		return export, err
+	}
+	byPodcast := map[uint]Subscription{}
+	for _, subscription := range subscriptions {
+		byPodcast[subscription.PodcastID] = subscription
+	}
+	tags, err := dbStore.GetSubscriptionTags(userEmail)
+	if err != nil {
+		return export, err
+	}
+	tagsByPodcast := map[uint][]string{}
+	for _, tag := range tags {
+		tagsByPodcast[tag.PodcastID] = append(tagsByPodcast[tag.PodcastID], labels[tag.LabelID])
+	}
+	for _, podcast := range user.Podcasts {
+		subscription := ExportSubscription{URL: podcast.URL, Title: podcast.Title, Settings: DefaultSubscriptionSettings(),
+			Tags: tagsByPodcast[podcast.ID]}
+		if settings, ok := byPodcast[podcast.ID]; ok {
+			subscription.Settings = settings.SubscriptionSettings
+			if settings.FolderID != nil {
+				subscription.Folder = labels[*settings.FolderID]
+			}
+		}
+		export.Subscriptions = append(export.Subscriptions, subscription)
+	}
+
+	var states []PlaybackState
+	if err = dbStore.Database.Where("user_id = ?", user.ID).Order("updated_at, podcast_item_id").Find(&states).Error; err != nil {
+		return export, err
+	}
+	var queue []QueueEntry
+	if err = dbStore.Database.Where("user_id = ?", user.ID).Order("position").Find(&queue).Error; err != nil {
+		return export, err
+	}
+	var playlists []Playlist
+	if err = dbStore.Database.Where("user_id = ?", user.ID).Order("id").Find(&playlists).Error; err != nil {
+		return export, err
+	}
+	playlistIDs := []uint{}
+	for _, playlist := range playlists {
+		playlistIDs = append(playlistIDs, playlist.ID)
+	}
+	var entries []PlaylistEntry
+	if err = dbStore.Database.Where("playlist_id IN (?)", playlistIDs).Order("playlist_id, position").Find(&entries).Error; err != nil {
+		return export, err
+	}
+
+	itemIDs := []uint{}
+	for _, state := range states {
+		itemIDs = append(itemIDs, state.PodcastItemID)
+	}
+	for _, entry := range queue {
+		itemIDs = append(itemIDs, entry.PodcastItemID)
+	}
+	for _, entry := range entries {
+		itemIDs = append(itemIDs, entry.PodcastItemID)
+	}
+	episodes, err := dbStore.exportEpisodes(itemIDs)
+	if err != nil {
+		return export, err
+	}
+	for _, state := range states {
+		export.EpisodeStates = append(export.EpisodeStates, ExportEpisodeState{ExportEpisode: episodes[state.PodcastItemID],
+			Position: state.Position, Played: state.Played, Device: state.Device, UpdatedAt: state.UpdatedAt})
+	}
+	for _, entry := range queue {
+		export.Queue = append(export.Queue, episodes[entry.PodcastItemID])
+	}
+	for _, playlist := range playlists {
+		exported := ExportPlaylist{Name: playlist.Name, Kind: playlist.Kind, Rules: playlist.Rules}
+		for _, entry := range entries {
+			if entry.PlaylistID == playlist.ID {
+				exported.Episodes = append(exported.Episodes, episodes[entry.PodcastItemID])
+			}
+		}
+		export.Playlists = append(export.Playlists, exported)
+	}
+
+	var webhooks []Webhook
+	if err = dbStore.Database.Where("user_id = ?", user.ID).Order("id").Find(&webhooks).Error; err != nil {
+		return export, err
+	}
+	for _, webhook := range webhooks {
+		export.Webhooks = append(export.Webhooks, ExportWebhook{URL: webhook.URL, CreatedAt: webhook.CreatedAt})
+	}
+	digest, err := dbStore.GetDigestSchedule(userEmail)
+	if err != nil {
+		return export, err
+	}
+	export.Digest = digest.DigestSettings
+	if export.Devices, err = dbStore.GetDevices(userEmail); err != nil {
+		return export, err
+	}
+	if export.AccessTokens, err = dbStore.GetAccessTokens(userEmail); err != nil {
+		return export, err
+	}
+	export.Identities, err = dbStore.GetIdentities(userEmail)
+	return export, err
+}
@@ -0,0 +1,442 @@
+package podcastmg
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ActionDownload records that an episode was downloaded on a device
+	ActionDownload = "download"
+
+	// ActionPlay records the position an episode was played to, it moves the episode's playback state
+	ActionPlay = "play"
+
+	// ActionDelete records that the download of an episode was deleted from a device
+	ActionDelete = "delete"
+
+	// ActionNew marks an episode as new again, it resets the episode's playback state
+	ActionNew = "new"
+
+	// ActionFlattr records a donation for an episode, it is kept for gpodder clients only
+	ActionFlattr = "flattr"
+
+	// actionTimeFormat is the format of episode action timestamps in the gpodder.net API, always in UTC
+	actionTimeFormat = "2006-01-02T15:04:05"
+)
+
+var (
+	// ErrInvalidDevice indicates a device id with other characters than letters, digits, dots, dashes and
+	// underscores, or an unknown device type
+	ErrInvalidDevice = errors.New("Invalid device")
+
+	// ErrInvalidSubscriptionChange indicates a subscription change which adds and removes the same podcast
+	ErrInvalidSubscriptionChange = errors.New("A podcast cannot be added and removed at once")
+
+	// ErrInvalidEpisodeAction indicates an episode action with an unknown action, a missing podcast or episode,
+	// or a play action without a position
+	ErrInvalidEpisodeAction = errors.New("Invalid episode action")
+)
+
+var (
+	deviceIDPattern = regexp.MustCompile(`^[\w.-]+$`)
+	deviceTypes     = map[string]bool{"desktop": true, "laptop": true, "mobile": true, "server": true, "other": true}
+	actionTypes     = map[string]bool{ActionDownload: true, ActionPlay: true, ActionDelete: true, ActionNew: true, ActionFlattr: true}
+)
+
+// Device is one of the user's podcast apps which syncs through the gpodder.net API. All devices of a user share
+// the user's subscriptions, Subscriptions is their number
+type Device struct {
+	ID            uint      `gorm:"primary_key" json:"-"`
+	CreatedAt     time.Time `json:"-"`
+	UpdatedAt     time.Time `json:"-"`
+	UserID        uint      `gorm:"not null;unique_index:idx_devices_user_device" json:"-"`
+	DeviceID      string    `gorm:"not null;unique_index:idx_devices_user_device" json:"id"`
+	Caption       string    `gorm:"not null;default:''" json:"caption"`
+	Type          string    `gorm:"not null;default:'other'" json:"type"`
+	Subscriptions int       `gorm:"-" json:"subscriptions"`
+}
+
+// SubscriptionChanges are the podcast urls added to and removed from the user's subscriptions since a timestamp
+type SubscriptionChanges struct {
+	Add       []string `json:"add"`
+	Remove    []string `json:"remove"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// SyncResult answers an upload of subscription changes or episode actions with the timestamp to sync from next
+// and the urls which were rewritten, an empty new url means that the url was ignored
+type SyncResult struct {
+	Timestamp  int64       `json:"timestamp"`
+	UpdateURLs [][2]string `json:"update_urls"`
+}
+
+// EpisodeAction is something a device did with an episode, identified by its podcast's feed url and its media url.
+// Started, Position and Total are in seconds and only used by play actions
+type EpisodeAction struct {
+	ID            uint      `gorm:"primary_key" json:"-"`
+	CreatedAt     time.Time `gorm:"index" json:"-"`
+	UserID        uint      `gorm:"not null;index" json:"-"`
+	PodcastItemID *uint     `json:"-"`
+	Podcast       string    `gorm:"not null" json:"podcast"`
+	Episode       string    `gorm:"not null" json:"episode"`
+	Device        string    `json:"device,omitempty"`
+	Action        string    `gorm:"not null" json:"action"`
+	Timestamp     time.Time `json:"timestamp"`
+	Started       *int64    `json:"started,omitempty"`
+	Position      *int64    `json:"position,omitempty"`
+	Total         *int64    `json:"total,omitempty"`
+}
+
+// EpisodeActions are the episode actions uploaded since a timestamp
+type EpisodeActions struct {
+	Actions   []EpisodeAction `json:"actions"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+// EpisodeActionQuery selects the episode actions uploaded since a time, optionally only those of one podcast or
+// device. Aggregated keeps only the latest action of each episode
+type EpisodeActionQuery struct {
+	Since      time.Time
+	Podcast    string
+	Device     string
+	Aggregated bool
+}
+
+// Validate checks the device id and type, an empty type is taken as other
+func (device Device) Validate() error {
+	if !deviceIDPattern.MatchString(device.DeviceID) {
+		return ErrInvalidDevice
+	}
+	if device.Type != "" && !deviceTypes[device.Type] {
+		return ErrInvalidDevice
+	}
+	return nil
+}
+
+// Validate checks that a podcast is not both added and removed
+func (changes SubscriptionChanges) Validate() error {
+	added := map[string]bool{}
+	for _, url := range changes.Add {
+		added[strings.TrimSpace(url)] = true
+	}
+	for _, url := range changes.Remove {
+		if added[strings.TrimSpace(url)] {
+			return ErrInvalidSubscriptionChange
+		}
+	}
+	return nil
+}
+
+// Validate checks the action type, that the episode is named and that play actions carry a position
+func (action EpisodeAction) Validate() error {
+	if !actionTypes[strings.ToLower(action.Action)] || action.Podcast == "" || action.Episode == "" {
+		return ErrInvalidEpisodeAction
+	}
+	if strings.ToLower(action.Action) == ActionPlay && action.Position == nil {
+		return ErrInvalidEpisodeAction
+	}
+	if action.Device != "" && !deviceIDPattern.MatchString(action.Device) {
+		return ErrInvalidEpisodeAction
+	}
+	return nil
+}
+
+// MarshalJSON writes the timestamp in the format of the gpodder.net API
+func (action EpisodeAction) MarshalJSON() ([]byte, error) {
+	type episodeAction EpisodeAction
+	return json.Marshal(struct {
+		episodeAction
+		Timestamp string `json:"timestamp"`
+	}{episodeAction(action), action.Timestamp.UTC().Format(actionTimeFormat)})
+}
+
+// UnmarshalJSON reads timestamps in the format of the gpodder.net API, RFC 3339 or as seconds since the epoch
+func (action *EpisodeAction) UnmarshalJSON(data []byte) error {
+	type episodeAction EpisodeAction
+	wire := struct {
+		*episodeAction
+		Timestamp json.RawMessage `json:"timestamp"`
+	}{episodeAction: (*episodeAction)(action)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	action.Timestamp = time.Time{}
+	raw := strings.TrimSpace(string(wire.Timestamp))
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		action.Timestamp = time.Unix(seconds, 0).UTC()
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(wire.Timestamp, &text); err != nil {
+		return err
+	}
+	for _, layout := range []string{actionTimeFormat, "2006-01-02T15:04:05.999999999", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, text); err == nil {
+			action.Timestamp = t.UTC()
+			return nil
+		}
+	}
+	return ErrInvalidEpisodeAction
+}
+
+// ensureDevice registers the device of the user if it is not known yet
+func ensureDevice(db *gorm.DB, userID uint, deviceID string) error {
+	if deviceID == "" {
+		return nil
+	}
+	if !deviceIDPattern.MatchString(deviceID) {
+		return ErrInvalidDevice
+	}
+	device := Device{UserID: userID, DeviceID: deviceID, Type: "other"}
+	return db.Where(Device{UserID: userID, DeviceID: deviceID}).FirstOrCreate(&device).Error
+}
+
+// subscribedCount returns the number of podcasts the user is subscribed to
+func (dbStore *DBStore) subscribedCount(userID uint) (int, error) {
+	var count int
+	err := dbStore.Database.Model(&Podcast{}).Joins("JOIN subscriptions ON subscriptions.podcast_id = podcasts.id").
+		Where("subscriptions.user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// GetDevices returns the user's devices
+func (dbStore *DBStore) GetDevices(userEmail string) ([]Device, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return nil, err
+	}
+	devices := []Device{}
+	if err = dbStore.Database.Where("user_id = ?", userID).Order("device_id").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	count, err := dbStore.subscribedCount(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		devices[i].Subscriptions = count
+	}
+	return devices, nil
+}
+
+// UpdateDevice registers the user's device or changes its caption and type, empty fields are left unchanged
+func (dbStore *DBStore) UpdateDevice(userEmail string, device *Device) error {
+	if err := device.Validate(); err != nil {
+		return err
+	}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	if err = ensureDevice(dbStore.Database, userID, device.DeviceID); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{}
+	if device.Caption != "" {
+		updates["caption"] = device.Caption
+	}
+	if device.Type != "" {
+		updates["type"] = device.Type
+	}
+	query := dbStore.Database.Model(&Device{}).Where("user_id = ? AND device_id = ?", userID, device.DeviceID)
+	if len(updates) > 0 {
+		if err = query.Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return query.First(device).Error
+}
+
+// GetSubscriptionChanges returns the podcast urls the user subscribed to or unsubscribed from since the given time,
+// registering the device if it is new. A podcast which was removed and added again is only listed as added
+func (dbStore *DBStore) GetSubscriptionChanges(userEmail, deviceID string, since time.Time) (SubscriptionChanges, error) {
+	changes := SubscriptionChanges{Add: []string{}, Remove: []string{}}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return changes, err
+	}
+	if err = ensureDevice(dbStore.Database, userID, deviceID); err != nil {
+		return changes, err
+	}
+	var current []Podcast
+	err = dbStore.Database.Select("podcasts.url, podcasts.created_at").
+		Joins("JOIN subscriptions ON subscriptions.podcast_id = podcasts.id").
+		Where("subscriptions.user_id = ?", userID).Order("podcasts.created_at, podcasts.id").Find(&current).Error
+	if err != nil {
+		return changes, err
+	}
+	subscribed := map[string]bool{}
+	for _, podcast := range current {
+		subscribed[podcast.URL] = true
+		if !podcast.CreatedAt.Before(since) {
+			changes.Add = append(changes.Add, podcast.URL)
+		}
+	}
+	if since.IsZero() {
+		return changes, nil
+	}
+	var removed []string
+	err = dbStore.Database.Unscoped().Model(&Podcast{}).
+		Joins("JOIN subscriptions ON subscriptions.podcast_id = podcasts.id").
+		Where("subscriptions.user_id = ? AND podcasts.deleted_at >= ?", userID, since).
+		Order("podcasts.deleted_at").Pluck("podcasts.url", &removed).Error
+	if err != nil {
+		return changes, err
+	}
+	for _, url := range removed {
+		if !subscribed[url] {
+			subscribed[url] = true
+			changes.Remove = append(changes.Remove, url)
+		}
+	}
+	return changes, nil
+}
+
+// ApplySubscriptionChanges subscribes the user to the podcasts and unsubscribes the podcast urls, registering
+// the device if it is new. Podcasts the user is already subscribed to are skipped. The changes are recorded in
+// the user's change log
+func (dbStore *DBStore) ApplySubscriptionChanges(userEmail, deviceID string, add []Podcast, remove []string) error {
+	user, err := dbStore.GetUserByEmail(userEmail)
+	if err != nil {
+		return err
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := ensureDevice(tx, user.ID, deviceID); err != nil {
+			return err
+		}
+		var added, removed []string
+		for i := range add {
+			if user.CheckSubscription(add[i]) {
+				continue
+			}
+			if err := tx.Model(&user).Association("Podcasts").Append(&add[i]).Error; err != nil {
+				return err
+			}
+			user.Podcasts = append(user.Podcasts, add[i])
+			added = append(added, add[i].URL)
+		}
+		for _, podcastURL := range remove {
+			if user.CheckSubscription(Podcast{URL: podcastURL}) {
+				removed = append(removed, podcastURL)
+			}
+		}
+		if len(removed) > 0 {
+			if err := unsubscribe(tx, user.ID, removed); err != nil {
+				return err
+			}
+		}
+		if err := recordSubscriptionChanges(tx, user.ID, ChangeSubscribed, deviceID, added); err != nil {
+			return err
+		}
+		return recordSubscriptionChanges(tx, user.ID, ChangeUnsubscribed, deviceID, removed)
+	})
+}
+
+// AddEpisodeActions records the episode actions of the user and applies play and new actions of subscribed episodes
+// to their playback state, unless the state changed after the action. The changed playback states are returned
+func (dbStore *DBStore) AddEpisodeActions(userEmail string, actions []EpisodeAction, now time.Time) ([]PlaybackState, error) {
+	for _, action := range actions {
+		if err := action.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return nil, err
+	}
+	var changed []PlaybackState
+	err = dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		changed = nil
+		for i := range actions {
+			action := &actions[i]
+			action.ID, action.UserID, action.Action = 0, userID, strings.ToLower(action.Action)
+			if action.Timestamp.IsZero() {
+				action.Timestamp = now
+			}
+			if err := ensureDevice(tx, userID, action.Device); err != nil {
+				return err
+			}
+			var item PodcastItem
+			err := tx.Select("podcast_items.*").Joins("JOIN podcasts ON podcasts.id = podcast_items.podcast_id").
+				Joins("JOIN subscriptions ON subscriptions.podcast_id = podcasts.id").
+				Where("subscriptions.user_id = ? AND podcasts.deleted_at IS NULL AND podcasts.url = ? AND podcast_items.media_url = ?",
+					userID, action.Podcast, action.Episode).First(&item).Error
+			switch {
+			case err == nil:
+				action.PodcastItemID = &item.ID
+			case !gorm.IsRecordNotFoundError(err):
+				return err
+			}
+			if err = tx.Create(action).Error; err != nil {
+				return err
+			}
+			if action.PodcastItemID == nil || (action.Action != ActionPlay && action.Action != ActionNew) {
+				continue
+			}
+			state := PlaybackState{UserID: userID, PodcastItemID: item.ID}
+			err = tx.Where(&state).First(&state).Error
+			switch {
+			case err == nil && state.UpdatedAt.After(action.Timestamp):
+				continue
+			case err != nil && !gorm.IsRecordNotFoundError(err):
+				return err
+			}
+			state.Position, state.Played, state.Device = 0, false, action.Device
+			if action.Action == ActionPlay {
+				state.Position = *action.Position
+				state.Played = action.Total != nil && *action.Total > 0 && *action.Position >= *action.Total
+			}
+			if _, err = savePlaybackState(tx, &state, item, action.Timestamp); err != nil {
+				return err
+			}
+			changed = append(changed, state)
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// GetEpisodeActions returns the episode actions the user uploaded since the query's time, oldest first
+func (dbStore *DBStore) GetEpisodeActions(userEmail string, query EpisodeActionQuery) ([]EpisodeAction, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return nil, err
+	}
+	db := dbStore.Database.Where("user_id = ? AND created_at >= ?", userID, query.Since)
+	if query.Podcast != "" {
+		db = db.Where("podcast = ?", query.Podcast)
+	}
+	if query.Device != "" {
+		db = db.Where("device = ?", query.Device)
+	}
+	actions := []EpisodeAction{}
+	if err = db.Order("id").Find(&actions).Error; err != nil {
+		return nil, err
+	}
+	if !query.Aggregated {
+		return actions, nil
+	}
+	latest := map[[2]string]int{}
+	aggregated := []EpisodeAction{}
+	for _, action := range actions {
+		key := [2]string{action.Podcast, action.Episode}
+		index, ok := latest[key]
+		switch {
+		case !ok:
+			latest[key] = len(aggregated)
+			aggregated = append(aggregated, action)
+		case !action.Timestamp.Before(aggregated[index].Timestamp):
+			aggregated[index] = action
+		}
+	}
+	return aggregated, nil
+}
@@ -0,0 +1,147 @@
+package podcastmg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEpisodeActionJSON(t *testing.T) {
+	type actionTestCase struct {
+		name    string
+		json    string
+		want    time.Time
+		wantErr bool
+	}
+	testCases := []actionTestCase{
+		{"gpodder", `{"timestamp":"2009-12-12T09:00:00"}`, time.Date(2009, 12, 12, 9, 0, 0, 0, time.UTC), false},
+		{"RFC 3339", `{"timestamp":"2009-12-12T10:00:00+01:00"}`, time.Date(2009, 12, 12, 9, 0, 0, 0, time.UTC), false},
+		{"Fraction", `{"timestamp":"2009-12-12T09:00:00.5"}`, time.Date(2009, 12, 12, 9, 0, 0, 5e8, time.UTC), false},
+		{"Epoch", `{"timestamp":1260608400}`, time.Date(2009, 12, 12, 9, 0, 0, 0, time.UTC), false},
+		{"Missing", `{}`, time.Time{}, false},
+		{"Invalid", `{"timestamp":"yesterday"}`, time.Time{}, true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			var action EpisodeAction
+			err := json.Unmarshal([]byte(test.json), &action)
+			if (err != nil) != test.wantErr || !action.Timestamp.Equal(test.want) {
+				t.Errorf("Want:%v\tHave:%v %v", test.want, action.Timestamp, err)
+			}
+		})
+	}
+
+	position := int64(120)
+	action := EpisodeAction{Podcast: "https://cast.test/rss", Episode: "https://cast.test/1.mp3", Action: ActionPlay,
+		Timestamp: time.Date(2009, 12, 12, 10, 0, 0, 0, time.FixedZone("CET", 3600)), Position: &position}
+	data, err := json.Marshal(action)
+	want := `{"podcast":"https://cast.test/rss","episode":"https://cast.test/1.mp3","action":"play","position":120,"timestamp":"2009-12-12T09:00:00"}`
+	if err != nil || string(data) != want {
+		t.Errorf("Want:%s\tHave:%s %v", want, data, err)
+	}
+}
+
+func TestGpodder(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "gpodder@test.com"
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "Kept Cast", URL: "https://kept.test/rss", PodcastItems: []PodcastItem{
+			{Title: "One", MediaURL: "https://kept.test/1.mp3"},
+		}},
+		{Title: "Removed Cast", URL: "https://removed.test/rss"},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	// Devices are registered on first use and keep fields which are not updated
+	if _, err := store.GetSubscriptionChanges(email, "phone", time.Time{}); err != nil {
+		t.Fatalf("Failed to get subscription changes:%v", err)
+	}
+	device := Device{DeviceID: "phone", Caption: "My Phone", Type: "mobile"}
+	if err := store.UpdateDevice(email, &device); err != nil {
+		t.Fatalf("Failed to update device:%v", err)
+	}
+	if err := store.UpdateDevice(email, &Device{DeviceID: "phone", Caption: "Phone"}); err != nil {
+		t.Fatalf("Failed to update device:%v", err)
+	}
+	if err := store.UpdateDevice(email, &Device{DeviceID: "bad id"}); err != ErrInvalidDevice {
+		t.Errorf("Error Want:%v\tHave:%v", ErrInvalidDevice, err)
+	}
+	devices, err := store.GetDevices(email)
+	if err != nil || len(devices) != 1 || devices[0].Caption != "Phone" || devices[0].Type != "mobile" || devices[0].Subscriptions != 2 {
+		t.Errorf("Unexpected devices:%+v %v", devices, err)
+	}
+
+	changes, err := store.GetSubscriptionChanges(email, "phone", time.Time{})
+	if err != nil || !reflect.DeepEqual(changes.Add, []string{"https://kept.test/rss", "https://removed.test/rss"}) || len(changes.Remove) != 0 {
+		t.Fatalf("Unexpected subscription changes:%+v %v", changes, err)
+	}
+	since := time.Now()
+	add := []Podcast{{Title: "Added Cast", URL: "https://added.test/rss"}, {Title: "Kept Cast", URL: "https://kept.test/rss"}}
+	if err = store.ApplySubscriptionChanges(email, "laptop", add, []string{"https://removed.test/rss"}); err != nil {
+		t.Fatalf("Failed to apply subscription changes:%v", err)
+	}
+	changes, err = store.GetSubscriptionChanges(email, "phone", since)
+	if err != nil || !reflect.DeepEqual(changes.Add, []string{"https://added.test/rss"}) ||
+		!reflect.DeepEqual(changes.Remove, []string{"https://removed.test/rss"}) {
+		t.Errorf("Unexpected subscription changes:%+v %v", changes, err)
+	}
+	if devices, _ = store.GetDevices(email); len(devices) != 2 || devices[0].DeviceID != "laptop" || devices[0].Subscriptions != 2 {
+		t.Errorf("Unexpected devices:%+v", devices)
+	}
+
+	// Play actions of subscribed episodes move their playback state unless it changed later
+	item := user.Podcasts[0].PodcastItems[0]
+	now := time.Now()
+	position, total, stale := int64(600), int64(600), int64(10)
+	actions := []EpisodeAction{
+		{Podcast: "https://kept.test/rss", Episode: item.MediaURL, Device: "phone", Action: "download", Timestamp: now.Add(-2 * time.Minute)},
+		{Podcast: "https://kept.test/rss", Episode: item.MediaURL, Device: "phone", Action: "PLAY", Timestamp: now.Add(-time.Minute), Position: &position, Total: &total},
+		{Podcast: "https://unknown.test/rss", Episode: "https://unknown.test/1.mp3", Action: ActionPlay, Position: &position},
+	}
+	states, err := store.AddEpisodeActions(email, actions, now)
+	if err != nil || len(states) != 1 || states[0].Position != 600 || !states[0].Played || states[0].Device != "phone" {
+		t.Fatalf("Unexpected playback states:%+v %v", states, err)
+	}
+	if states, err = store.AddEpisodeActions(email, []EpisodeAction{
+		{Podcast: "https://kept.test/rss", Episode: item.MediaURL, Action: ActionPlay, Timestamp: now.Add(-time.Hour), Position: &stale},
+	}, now); err != nil || len(states) != 0 {
+		t.Errorf("Stale play action changed playback state:%+v %v", states, err)
+	}
+	if _, err = store.AddEpisodeActions(email, []EpisodeAction{{Podcast: "https://kept.test/rss", Episode: item.MediaURL, Action: ActionPlay}}, now); err != ErrInvalidEpisodeAction {
+		t.Errorf("Error Want:%v\tHave:%v", ErrInvalidEpisodeAction, err)
+	}
+	if item, err = store.GetPodcastItemBySubscription(email, item.ID); err != nil || !item.Played {
+		t.Errorf("Episode was not marked played:%+v %v", item, err)
+	}
+
+	type queryTestCase struct {
+		name  string
+		query EpisodeActionQuery
+		want  []string
+	}
+	testCases := []queryTestCase{
+		{"All", EpisodeActionQuery{Since: since}, []string{"download", "play", "play", "play"}},
+		{"Podcast", EpisodeActionQuery{Since: since, Podcast: "https://unknown.test/rss"}, []string{"play"}},
+		{"Device", EpisodeActionQuery{Since: since, Device: "phone"}, []string{"download", "play"}},
+		{"Aggregated", EpisodeActionQuery{Since: since, Aggregated: true}, []string{"play", "play"}},
+		{"Later", EpisodeActionQuery{Since: time.Now().Add(time.Second)}, []string{}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			actions, err := store.GetEpisodeActions(email, test.query)
+			have := []string{}
+			for _, action := range actions {
+				have = append(have, action.Action)
+			}
+			if err != nil || !reflect.DeepEqual(have, test.want) {
+				t.Errorf("Want:%v\tHave:%v %v", test.want, have, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package podcastmg
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+var (
+	// ErrInvalidIdentity indicates an identity without an issuer or subject
+	ErrInvalidIdentity = errors.New("Identity needs an issuer and a subject")
+
+	// ErrUnverifiedAccount indicates an identity whose email belongs to a user who has not verified it. Anyone may
+	// have registered the email, so the identity is not linked until the user proves to own it
+	ErrUnverifiedAccount = errors.New("Email of the existing account has to be verified before linking")
+)
+
+// Identity links a user to their account with an OpenID Connect provider, which names the account by the
+// provider's issuer and the subject it issued
+type Identity struct {
+	ID        uint      `gorm:"primary_key" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Issuer    string    `gorm:"not null;unique_index:idx_identity_subject" json:"issuer"`
+	Subject   string    `gorm:"not null;unique_index:idx_identity_subject" json:"subject"`
+}
+
+// LinkIdentity returns the user linked to the identity. An identity seen for the first time is linked to the user
+// with the email, the provider verified, and the user is created without a password if there is none. Users who
+// have not verified their email are not linked, ErrUnverifiedAccount is returned. created reports whether the user
+// was created
+func (dbStore *DBStore) LinkIdentity(issuer, subject, email string, now time.Time) (user User, created bool, err error) {
+	if issuer == "" || subject == "" {
+		return user, false, ErrInvalidIdentity
+	}
+	err = dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		var identity Identity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+		if err == nil {
+			return tx.Where("id = ?", identity.UserID).First(&user).Error
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+		if err = ValidateEmail(email); err != nil {
+			return err
+		}
+		err = tx.Where("user_email = ?", email).First(&user).Error
+		switch {
+		case gorm.IsRecordNotFoundError(err):
+			user = User{UserEmail: email, EmailVerified: true}
+			if err = tx.Create(&user).Error; err != nil {
+				return err
+			}
+			created = true
+		case err != nil:
+			return err
+		case !user.EmailVerified:
+			return ErrUnverifiedAccount
+		}
+		identity = Identity{CreatedAt: now, UserID: user.ID, Issuer: issuer, Subject: subject}
+		return tx.Create(&identity).Error
+	})
+	return user, created, err
+}
+
+// GetIdentities returns the identities linked to the user
+func (dbStore *DBStore) GetIdentities(userEmail string) ([]Identity, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return nil, err
+	}
+	identities := []Identity{}
+	err = dbStore.Database.Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	return identities, err
+}
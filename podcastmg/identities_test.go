@@ -0,0 +1,58 @@
+package podcastmg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkIdentity(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	now := time.Now()
+	existing := "linked@test.com"
+	if err := store.CreateUser(&User{UserEmail: existing, Password: "hash"}); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	// Whoever registered the email first may not own it, the user has to verify it before an identity is linked
+	if _, _, err := store.LinkIdentity("https://idp.test", "sub-1", existing, now); err != ErrUnverifiedAccount {
+		t.Fatalf("Want:%v\tHave:%v", ErrUnverifiedAccount, err)
+	}
+	if err := store.Database.Model(&User{}).Where("user_email = ?", existing).Update("email_verified", true).Error; err != nil {
+		t.Fatalf("Failed to verify email:%v", err)
+	}
+
+	// An identity seen for the first time is linked to the user with its email
+	user, created, err := store.LinkIdentity("https://idp.test", "sub-1", existing, now)
+	if err != nil || created || user.UserEmail != existing {
+		t.Fatalf("Failed to link identity:%+v %v %v", user, created, err)
+	}
+
+	// A linked identity keeps its user when the provider reports another email
+	user, created, err = store.LinkIdentity("https://idp.test", "sub-1", "renamed@test.com", now)
+	if err != nil || created || user.UserEmail != existing {
+		t.Errorf("Identity lost its user:%+v %v %v", user, created, err)
+	}
+
+	// Users are created for unknown emails, the same subject of another issuer is another identity
+	user, created, err = store.LinkIdentity("https://other.test", "sub-1", "new@test.com", now)
+	if err != nil || !created || user.UserEmail != "new@test.com" || !user.EmailVerified || user.Password != "" {
+		t.Fatalf("Failed to create user:%+v %v %v", user, created, err)
+	}
+	if err = user.ComparePassword(""); err == nil {
+		t.Errorf("A user without password should not log in with an empty one")
+	}
+
+	identities, err := store.GetIdentities(existing)
+	if err != nil || len(identities) != 1 || identities[0].Subject != "sub-1" {
+		t.Errorf("Unexpected identities:%v %v", identities, err)
+	}
+	if _, _, err = store.LinkIdentity("https://idp.test", "sub-2", "not an email", now); err != ErrInvalidEmail {
+		t.Errorf("Want:%v\tHave:%v", ErrInvalidEmail, err)
+	}
+	if _, _, err = store.LinkIdentity("", "sub-3", existing, now); err != ErrInvalidIdentity {
+		t.Errorf("Want:%v\tHave:%v", ErrInvalidIdentity, err)
+	}
+}
@@ -0,0 +1,266 @@
+package podcastmg
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	// LabelFolder is the kind of labels grouping subscriptions into folders, a subscription is in at most one folder
+	LabelFolder = "folder"
+
+	// LabelTag is the kind of labels tagging subscriptions, a subscription may carry any number of tags
+	LabelTag = "tag"
+)
+
+var (
+	// ErrInvalidLabel indicates a label with an unknown kind or an empty name
+	ErrInvalidLabel = errors.New("Invalid folder or tag")
+
+	// ErrLabelExists indicates that the user already has a folder or tag of the same name
+	ErrLabelExists = errors.New("Folder or tag already exists")
+
+	// ErrLabelNotFound indicates a folder or tag which does not exist or belongs to another user
+	ErrLabelNotFound = errors.New("Folder or tag not found")
+
+	// ErrInvalidOrder indicates a reordering which does not list each of the user's folders or tags exactly once
+	ErrInvalidOrder = errors.New("Order must list each folder or tag exactly once")
+)
+
+// Label is a user defined folder or tag for organizing subscriptions
+type Label struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Kind      string    `gorm:"not null" json:"kind"`
+	Name      string    `gorm:"not null" json:"name"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+}
+
+// SubscriptionTag assigns a tag Label to one of the user's subscriptions
+type SubscriptionTag struct {
+	UserID    uint `gorm:"primary_key;auto_increment:false"`
+	PodcastID uint `gorm:"primary_key;auto_increment:false"`
+	LabelID   uint `gorm:"primary_key;auto_increment:false;index"`
+}
+
+// validLabel checks the kind and normalizes the name of a label
+func validLabel(kind, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if (kind != LabelFolder && kind != LabelTag) || name == "" {
+		return name, ErrInvalidLabel
+	}
+	return name, nil
+}
+
+// userID returns the id of the user with the given email
+func (dbStore *DBStore) userID(userEmail string) (uint, error) {
+	var user User
+	if err := dbStore.Database.Select("id").Where("user_email = ?", userEmail).First(&user).Error; err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// labelExists reports whether the user has another label of the kind with the name
+func (dbStore *DBStore) labelExists(userID uint, kind, name string, except uint) (bool, error) {
+	var count int
+	err := dbStore.Database.Model(&Label{}).
+		Where("user_id = ? AND kind = ? AND lower(name) = lower(?) AND id <> ?", userID, kind, name, except).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// labelWriteError returns ErrLabelExists for a failed write of a label whose name was taken meanwhile, the unique
+// index on the names refuses it. Other errors are returned as they are
+func (dbStore *DBStore) labelWriteError(err error, userID uint, kind, name string, except uint) error {
+	if err == nil {
+		return nil
+	}
+	if exists, existsErr := dbStore.labelExists(userID, kind, name, except); existsErr == nil && exists {
+		return ErrLabelExists
+	}
+	return err
+}
+
+// CreateLabel creates a folder or tag for the user, placed after the existing ones of its kind
+func (dbStore *DBStore) CreateLabel(userEmail string, label *Label) error {
+	name, err := validLabel(label.Kind, label.Name)
+	if err != nil {
+		return err
+	}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	if exists, err := dbStore.labelExists(userID, label.Kind, name, 0); err != nil || exists {
+		if err == nil {
+			err = ErrLabelExists
+		}
+		return err
+	}
+	var count int
+	if err = dbStore.Database.Model(&Label{}).Where("user_id = ? AND kind = ?", userID, label.Kind).Count(&count).Error; err != nil {
+		return err
+	}
+	label.UserID, label.Name, label.Position = userID, name, count
+	return dbStore.labelWriteError(dbStore.Database.Create(label).Error, userID, label.Kind, name, 0)
+}
+
+// GetLabels returns the user's folders or tags in their order
+func (dbStore *DBStore) GetLabels(userEmail, kind string) ([]Label, error) {
+	labels := []Label{}
+	err := dbStore.Database.Select("labels.*").Joins("JOIN users ON users.id = labels.user_id").
+		Where("users.user_email = ? AND labels.kind = ?", userEmail, kind).
+		Order("labels.position, labels.id").Find(&labels).Error
+	return labels, err
+}
+
+// GetLabel returns one of the user's folders or tags
+func (dbStore *DBStore) GetLabel(userEmail string, labelID uint) (Label, error) {
+	var label Label
+	err := dbStore.Database.Select("labels.*").Joins("JOIN users ON users.id = labels.user_id").
+		Where("users.user_email = ? AND labels.id = ?", userEmail, labelID).First(&label).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return label, ErrLabelNotFound
+	}
+	return label, err
+}
+
+// RenameLabel renames one of the user's folders or tags
+func (dbStore *DBStore) RenameLabel(userEmail string, labelID uint, name string) error {
+	label, err := dbStore.GetLabel(userEmail, labelID)
+	if err != nil {
+		return err
+	}
+	if name, err = validLabel(label.Kind, name); err != nil {
+		return err
+	}
+	if exists, err := dbStore.labelExists(label.UserID, label.Kind, name, label.ID); err != nil || exists {
+		if err == nil {
+			err = ErrLabelExists
+		}
+		return err
+	}
+	err = dbStore.Database.Model(&label).UpdateColumn("name", name).Error
+	return dbStore.labelWriteError(err, label.UserID, label.Kind, name, label.ID)
+}
+
+// ReorderLabels sets the order of the user's folders or tags, labelIDs must list each of them exactly once
+func (dbStore *DBStore) ReorderLabels(userEmail, kind string, labelIDs []uint) error {
+	labels, err := dbStore.GetLabels(userEmail, kind)
+	if err != nil {
+		return err
+	}
+	if len(labels) != len(labelIDs) {
+		return ErrInvalidOrder
+	}
+	positions := map[uint]int{}
+	for position, id := range labelIDs {
+		if _, ok := positions[id]; ok {
+			return ErrInvalidOrder
+		}
+		positions[id] = position
+	}
+	for _, label := range labels {
+		if _, ok := positions[label.ID]; !ok {
+			return ErrInvalidOrder
+		}
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		for id, position := range positions {
+			if err := tx.Model(&Label{}).Where("id = ?", id).UpdateColumn("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteLabel removes one of the user's folders or tags along with its assignments
+func (dbStore *DBStore) DeleteLabel(userEmail string, labelID uint) error {
+	label, err := dbStore.GetLabel(userEmail, labelID)
+	if err != nil {
+		return err
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Subscription{}).Where("user_id = ? AND folder_id = ?", label.UserID, label.ID).
+			UpdateColumn("folder_id", gorm.Expr("NULL")).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("label_id = ?", label.ID).Delete(&SubscriptionTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&label).Error; err != nil {
+			return err
+		}
+		// Close the gap left in the order of the remaining labels
+		return tx.Model(&Label{}).Where("user_id = ? AND kind = ? AND position > ?", label.UserID, label.Kind, label.Position).
+			UpdateColumn("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+// SetSubscriptionFolder moves the user's subscription into the folder, a folderID of 0 removes it from its folder
+func (dbStore *DBStore) SetSubscriptionFolder(userEmail, podcastURL string, folderID uint) error {
+	subscription, err := dbStore.GetSubscription(userEmail, podcastURL)
+	if err != nil {
+		return err
+	}
+	var folder interface{} = gorm.Expr("NULL")
+	if folderID != 0 {
+		label, err := dbStore.GetLabel(userEmail, folderID)
+		if err != nil {
+			return err
+		}
+		if label.Kind != LabelFolder {
+			return ErrLabelNotFound
+		}
+		folder = label.ID
+	}
+	return dbStore.Database.Model(&Subscription{}).
+		Where("user_id = ? AND podcast_id = ?", subscription.UserID, subscription.PodcastID).
+		UpdateColumn("folder_id", folder).Error
+}
+
+// SetSubscriptionTags replaces the tags of the user's subscription
+func (dbStore *DBStore) SetSubscriptionTags(userEmail, podcastURL string, tagIDs []uint) error {
+	subscription, err := dbStore.GetSubscription(userEmail, podcastURL)
+	if err != nil {
+		return err
+	}
+	seen := map[uint]bool{}
+	for _, id := range tagIDs {
+		label, err := dbStore.GetLabel(userEmail, id)
+		if err != nil {
+			return err
+		}
+		if label.Kind != LabelTag {
+			return ErrLabelNotFound
+		}
+		seen[id] = true
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND podcast_id = ?", subscription.UserID, subscription.PodcastID).Delete(&SubscriptionTag{}).Error
+		if err != nil {
+			return err
+		}
+		for id := range seen {
+			tag := SubscriptionTag{UserID: subscription.UserID, PodcastID: subscription.PodcastID, LabelID: id}
+			if err := tx.Create(&tag).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetSubscriptionTags returns the tag assignments of all of the user's subscriptions
+func (dbStore *DBStore) GetSubscriptionTags(userEmail string) ([]SubscriptionTag, error) {
+	var tags []SubscriptionTag
+	err := dbStore.Database.Select("subscription_tags.*").Joins("JOIN users ON users.id = subscription_tags.user_id").
+		Where("users.user_email = ?", userEmail).Order("subscription_tags.label_id").Find(&tags).Error
+	return tags, err
+}
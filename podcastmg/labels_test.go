@@ -0,0 +1,115 @@
+package podcastmg
+
+import (
+	"errors"
+	"testing"
+)
+
+func labelNames(labels []Label) []string {
+	var names []string
+	for _, label := range labels {
+		names = append(names, label.Name)
+	}
+	return names
+}
+
+func TestLabels(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "labels@test.com"
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "Label Cast", URL: "labelcast.test/xml"},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	create := func(kind, name string) Label {
+		label := Label{Kind: kind, Name: name}
+		if err := store.CreateLabel(email, &label); err != nil {
+			t.Fatalf("Failed to create %s %s:%v", kind, name, err)
+		}
+		return label
+	}
+	tech, news := create(LabelFolder, "Tech"), create(LabelFolder, " News ")
+	work, fun := create(LabelTag, "work"), create(LabelTag, "fun")
+
+	type labelErrorTestCase struct {
+		name string
+		err  error
+		want error
+	}
+	errorCases := []labelErrorTestCase{
+		{"Duplicate", store.CreateLabel(email, &Label{Kind: LabelFolder, Name: "tech"}), ErrLabelExists},
+		{"Empty Name", store.CreateLabel(email, &Label{Kind: LabelTag, Name: " "}), ErrInvalidLabel},
+		{"Unknown Kind", store.CreateLabel(email, &Label{Kind: "shelf", Name: "x"}), ErrInvalidLabel},
+		{"Same Name Other Kind", store.CreateLabel(email, &Label{Kind: LabelTag, Name: "Tech"}), nil},
+		{"Rename Duplicate", store.RenameLabel(email, news.ID, "TECH"), ErrLabelExists},
+		{"Rename Other User", store.RenameLabel("nobody@test.com", news.ID, "Other"), ErrLabelNotFound},
+		{"Reorder Missing", store.ReorderLabels(email, LabelFolder, []uint{news.ID}), ErrInvalidOrder},
+		{"Reorder Repeated", store.ReorderLabels(email, LabelFolder, []uint{news.ID, news.ID}), ErrInvalidOrder},
+		{"Folder As Tag", store.SetSubscriptionTags(email, "labelcast.test/xml", []uint{tech.ID}), ErrLabelNotFound},
+		{"Tag As Folder", store.SetSubscriptionFolder(email, "labelcast.test/xml", work.ID), ErrLabelNotFound},
+	}
+	for _, testCase := range errorCases {
+		if testCase.err != testCase.want {
+			t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.want, testCase.err)
+		}
+	}
+
+	// A label saved between the check for its name and the write is refused by the unique index
+	if err := store.Database.Create(&Label{UserID: tech.UserID, Kind: LabelFolder, Name: "TECH"}).Error; err == nil {
+		t.Errorf("Duplicate label was saved")
+	}
+	if err := store.labelWriteError(errors.New("constraint failed"), tech.UserID, LabelFolder, "tech", 0); err != ErrLabelExists {
+		t.Errorf("Want:%v\tHave:%v", ErrLabelExists, err)
+	}
+
+	if err := store.RenameLabel(email, news.ID, "World News"); err != nil {
+		t.Errorf("Failed to rename folder:%v", err)
+	}
+	if err := store.ReorderLabels(email, LabelFolder, []uint{news.ID, tech.ID}); err != nil {
+		t.Errorf("Failed to reorder folders:%v", err)
+	}
+	folders, _ := store.GetLabels(email, LabelFolder)
+	if names := labelNames(folders); len(names) != 2 || names[0] != "World News" || names[1] != "Tech" {
+		t.Errorf("Unexpected folders:%v", names)
+	}
+
+	if err := store.SetSubscriptionFolder(email, "labelcast.test/xml", tech.ID); err != nil {
+		t.Errorf("Failed to assign folder:%v", err)
+	}
+	if err := store.SetSubscriptionTags(email, "labelcast.test/xml", []uint{work.ID, fun.ID, work.ID}); err != nil {
+		t.Errorf("Failed to assign tags:%v", err)
+	}
+	subscription, _ := store.GetSubscription(email, "labelcast.test/xml")
+	if subscription.FolderID == nil || *subscription.FolderID != tech.ID {
+		t.Errorf("Folder Want:%d\tHave:%v", tech.ID, subscription.FolderID)
+	}
+	if tags, _ := store.GetSubscriptionTags(email); len(tags) != 2 {
+		t.Errorf("Tags Want:2\tHave:%v", tags)
+	}
+
+	// Deleting labels removes their assignments and closes the gap in the order
+	if err := store.DeleteLabel(email, tech.ID); err != nil {
+		t.Errorf("Failed to delete folder:%v", err)
+	}
+	if err := store.DeleteLabel(email, work.ID); err != nil {
+		t.Errorf("Failed to delete tag:%v", err)
+	}
+	if subscription, _ = store.GetSubscription(email, "labelcast.test/xml"); subscription.FolderID != nil {
+		t.Errorf("Deleted folder is still assigned:%v", *subscription.FolderID)
+	}
+	if tags, _ := store.GetSubscriptionTags(email); len(tags) != 1 || tags[0].LabelID != fun.ID {
+		t.Errorf("Unexpected tags after delete:%v", tags)
+	}
+	tags, _ := store.GetLabels(email, LabelTag)
+	if len(tags) != 2 || tags[0].Name != "fun" || tags[0].Position != 0 || tags[1].Position != 1 {
+		t.Errorf("Unexpected tags:%+v", tags)
+	}
+	if err := store.SetSubscriptionFolder(email, "labelcast.test/xml", 0); err != nil {
+		t.Errorf("Failed to clear folder:%v", err)
+	}
+}
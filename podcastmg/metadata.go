@@ -0,0 +1,231 @@
+package podcastmg
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrMetadataScan indicates a metadata column holding something other than JSON text
+	ErrMetadataScan = errors.New("Metadata column is not JSON text")
+
+	// ErrInvalidDuration indicates an itunes:duration in none of the HH:MM:SS, MM:SS or seconds formats
+	ErrInvalidDuration = errors.New("Invalid duration")
+)
+
+// podcastNamespace is the prefix gofeed files the Podcasting 2.0 namespace elements under
+const podcastNamespace = "podcast"
+
+// StringList is a list of strings stored as a JSON column
+type StringList []string
+
+// Value implements driver.Valuer
+func (list StringList) Value() (driver.Value, error) {
+	return jsonValue(list)
+}
+
+// Scan implements sql.Scanner
+func (list *StringList) Scan(src interface{}) error {
+	return jsonScan(src, list)
+}
+
+// Funding is a podcast:funding link to support the show
+type Funding struct {
+	URL  string `json:"url"`
+	Text string `json:"text,omitempty"`
+}
+
+// Fundings is a list of Funding stored as a JSON column
+type Fundings []Funding
+
+// Value implements driver.Valuer
+func (fundings Fundings) Value() (driver.Value, error) {
+	return jsonValue(fundings)
+}
+
+// Scan implements sql.Scanner
+func (fundings *Fundings) Scan(src interface{}) error {
+	return jsonScan(src, fundings)
+}
+
+// Person is a podcast:person credited on a podcast or episode
+type Person struct {
+	Name  string `json:"name"`
+	Role  string `json:"role,omitempty"`
+	Group string `json:"group,omitempty"`
+	Image string `json:"image,omitempty"`
+	Href  string `json:"href,omitempty"`
+}
+
+// Persons is a list of Person stored as a JSON column
+type Persons []Person
+
+// Value implements driver.Valuer
+func (persons Persons) Value() (driver.Value, error) {
+	return jsonValue(persons)
+}
+
+// Scan implements sql.Scanner
+func (persons *Persons) Scan(src interface{}) error {
+	return jsonScan(src, persons)
+}
+
+// Transcript is a podcast:transcript of an episode
+type Transcript struct {
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+	Language string `json:"language,omitempty"`
+	Rel      string `json:"rel,omitempty"`
+}
+
+// Transcripts is a list of Transcript stored as a JSON column
+type Transcripts []Transcript
+
+// Value implements driver.Valuer
+func (transcripts Transcripts) Value() (driver.Value, error) {
+	return jsonValue(transcripts)
+}
+
+// Scan implements sql.Scanner
+func (transcripts *Transcripts) Scan(src interface{}) error {
+	return jsonScan(src, transcripts)
+}
+
+// jsonValue stores empty lists as NULL and everything else as JSON text
+func jsonValue(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" || string(data) == "[]" {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func jsonScan(src interface{}, v interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, v)
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	}
+	return ErrMetadataScan
+}
+
+// applyFeedMetadata copies the iTunes and podcast namespace metadata of the feed onto the podcast
+func applyFeedMetadata(podcast *Podcast, feed *gofeed.Feed) {
+	podcast.Language = feed.Language
+	if itunes := feed.ITunesExt; itunes != nil {
+		podcast.Author = itunes.Author
+		podcast.Explicit = parseExplicit(itunes.Explicit)
+		podcast.Type = itunes.Type
+		for _, category := range itunes.Categories {
+			for ; category != nil; category = category.Subcategory {
+				podcast.Categories = append(podcast.Categories, category.Text)
+			}
+		}
+	}
+	if podcast.Author == "" && feed.Author != nil {
+		podcast.Author = feed.Author.Name
+	}
+
+	namespace := feed.Extensions[podcastNamespace]
+	if locked := firstExtension(namespace, "locked"); locked != nil {
+		podcast.Locked = strings.TrimSpace(locked.Value) == "yes"
+	}
+	for _, funding := range namespace["funding"] {
+		podcast.Funding = append(podcast.Funding, Funding{URL: funding.Attrs["url"], Text: strings.TrimSpace(funding.Value)})
+	}
+	podcast.Persons = parsePersons(namespace["person"])
+}
+
+// applyItemMetadata copies the iTunes and podcast namespace metadata of the feed item onto the podcast item
+func applyItemMetadata(podcastItem *PodcastItem, item *gofeed.Item) {
+	if itunes := item.ITunesExt; itunes != nil {
+		podcastItem.Author = itunes.Author
+		podcastItem.Explicit = parseExplicit(itunes.Explicit)
+		podcastItem.ITunesDuration = itunes.Duration
+		podcastItem.Duration, _ = ParseDuration(itunes.Duration)
+		podcastItem.Season, _ = strconv.Atoi(strings.TrimSpace(itunes.Season))
+		podcastItem.Episode, _ = strconv.Atoi(strings.TrimSpace(itunes.Episode))
+		podcastItem.EpisodeType = itunes.EpisodeType
+	}
+	if podcastItem.Author == "" && item.Author != nil {
+		podcastItem.Author = item.Author.Name
+	}
+
+	namespace := item.Extensions[podcastNamespace]
+	if chapters := firstExtension(namespace, "chapters"); chapters != nil {
+		podcastItem.ChaptersURL = chapters.Attrs["url"]
+		podcastItem.ChaptersType = chapters.Attrs["type"]
+	}
+	for _, transcript := range namespace["transcript"] {
+		podcastItem.Transcripts = append(podcastItem.Transcripts, Transcript{
+			URL:      transcript.Attrs["url"],
+			Type:     transcript.Attrs["type"],
+			Language: transcript.Attrs["language"],
+			Rel:      transcript.Attrs["rel"],
+		})
+	}
+	podcastItem.Persons = parsePersons(namespace["person"])
+}
+
+func parsePersons(extensions []ext.Extension) Persons {
+	var persons Persons
+	for _, person := range extensions {
+		persons = append(persons, Person{
+			Name:  strings.TrimSpace(person.Value),
+			Role:  person.Attrs["role"],
+			Group: person.Attrs["group"],
+			Image: person.Attrs["img"],
+			Href:  person.Attrs["href"],
+		})
+	}
+	return persons
+}
+
+func firstExtension(namespace map[string][]ext.Extension, name string) *ext.Extension {
+	if len(namespace[name]) == 0 {
+		return nil
+	}
+	return &namespace[name][0]
+}
+
+// ParseDuration returns the seconds of an itunes:duration given as HH:MM:SS, MM:SS or seconds.
+// Fractions of a second are dropped
+func ParseDuration(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, ErrInvalidDuration
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, ErrInvalidDuration
+	}
+	var seconds int64
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			part = strings.SplitN(part, ".", 2)[0]
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, ErrInvalidDuration
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// parseExplicit reads the values of itunes:explicit, which feeds publish as yes/no or true/false
+func parseExplicit(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true", "explicit":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package podcastmg
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const metadataTestFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:podcast="https://podcastindex.org/namespace/1.0">
+<channel>
+	<title>Metadata Cast</title>
+	<description>A feed with every kind of metadata</description>
+	<language>en-us</language>
+	<itunes:author>Jane Host</itunes:author>
+	<itunes:explicit>yes</itunes:explicit>
+	<itunes:type>serial</itunes:type>
+	<itunes:category text="Technology"/>
+	<itunes:category text="Society &amp; Culture"><itunes:category text="Documentary"/></itunes:category>
+	<podcast:locked owner="jane@test.com">yes</podcast:locked>
+	<podcast:funding url="https://donate.test">Support the show</podcast:funding>
+	<podcast:person role="host" img="https://img.test/jane.png">Jane Host</podcast:person>
+	<item>
+		<title>Chapter One</title>
+		<description>The first part</description>
+		<pubDate>Mon, 01 Jan 2018 10:00:00 GMT</pubDate>
+		<enclosure url="https://media.test/1.mp3" length="100" type="audio/mpeg"/>
+		<enclosure url="https://media.test/1.ogg" length=" 80 " type="audio/ogg"/>
+		<itunes:duration>01:02:03</itunes:duration>
+		<itunes:explicit>false</itunes:explicit>
+		<itunes:season>2</itunes:season>
+		<itunes:episode>7</itunes:episode>
+		<itunes:episodeType>full</itunes:episodeType>
+		<podcast:chapters url="https://media.test/1.json" type="application/json+chapters"/>
+		<podcast:transcript url="https://media.test/1.vtt" type="text/vtt" language="en"/>
+		<podcast:transcript url="https://media.test/1.srt" type="application/srt" rel="captions"/>
+		<podcast:person role="guest" group="cast" href="https://guest.test">Sam Guest</podcast:person>
+	</item>
+</channel>
+</rss>`
+
+func TestFeedMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, metadataTestFeed)
+	}))
+	defer server.Close()
+
+	podcast, err := BuildPodcastFromURL(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to build podcast:%v", err)
+	}
+	if len(podcast.PodcastItems) != 1 {
+		t.Fatalf("Items Want:1\tHave:%d", len(podcast.PodcastItems))
+	}
+
+	wantPodcast := Podcast{
+		Author:     "Jane Host",
+		Language:   "en-us",
+		Categories: StringList{"Technology", "Society & Culture", "Documentary"},
+		Explicit:   true,
+		Type:       "serial",
+		Locked:     true,
+		Funding:    Fundings{{URL: "https://donate.test", Text: "Support the show"}},
+		Persons:    Persons{{Name: "Jane Host", Role: "host", Image: "https://img.test/jane.png"}},
+	}
+	wantItem := PodcastItem{
+		MediaURL:       "https://media.test/1.mp3",
+		MediaSize:      100,
+		MediaType:      "audio/mpeg",
+		Duration:       3723,
+		ITunesDuration: "01:02:03",
+		Season:         2,
+		Episode:        7,
+		EpisodeType:    "full",
+		ChaptersURL:    "https://media.test/1.json",
+		ChaptersType:   "application/json+chapters",
+		Transcripts: Transcripts{
+			{URL: "https://media.test/1.vtt", Type: "text/vtt", Language: "en"},
+			{URL: "https://media.test/1.srt", Type: "application/srt", Rel: "captions"},
+		},
+		Persons: Persons{{Name: "Sam Guest", Role: "guest", Group: "cast", Href: "https://guest.test"}},
+	}
+
+	checkMetadata := func(t *testing.T, podcast Podcast) {
+		havePodcast := Podcast{
+			Author:     podcast.Author,
+			Language:   podcast.Language,
+			Categories: podcast.Categories,
+			Explicit:   podcast.Explicit,
+			Type:       podcast.Type,
+			Locked:     podcast.Locked,
+			Funding:    podcast.Funding,
+			Persons:    podcast.Persons,
+		}
+		if !reflect.DeepEqual(havePodcast, wantPodcast) {
+			t.Errorf("Podcast Want:%+v\tHave:%+v", wantPodcast, havePodcast)
+		}
+		item := podcast.PodcastItems[0]
+		haveItem := PodcastItem{
+			MediaURL:       item.MediaURL,
+			MediaSize:      item.MediaSize,
+			MediaType:      item.MediaType,
+			Duration:       item.Duration,
+			Author:         item.Author,
+			Explicit:       item.Explicit,
+			ITunesDuration: item.ITunesDuration,
+			Season:         item.Season,
+			Episode:        item.Episode,
+			EpisodeType:    item.EpisodeType,
+			ChaptersURL:    item.ChaptersURL,
+			ChaptersType:   item.ChaptersType,
+			Transcripts:    item.Transcripts,
+			Persons:        item.Persons,
+		}
+		if !reflect.DeepEqual(haveItem, wantItem) {
+			t.Errorf("Item Want:%+v\tHave:%+v", wantItem, haveItem)
+		}
+		var enclosures []Enclosure
+		for _, enclosure := range item.Enclosures {
+			enclosures = append(enclosures, Enclosure{URL: enclosure.URL, Size: enclosure.Size, Type: enclosure.Type})
+		}
+		wantEnclosures := []Enclosure{
+			{URL: "https://media.test/1.mp3", Size: 100, Type: "audio/mpeg"},
+			{URL: "https://media.test/1.ogg", Size: 80, Type: "audio/ogg"},
+		}
+		if !reflect.DeepEqual(enclosures, wantEnclosures) {
+			t.Errorf("Enclosures Want:%+v\tHave:%+v", wantEnclosures, enclosures)
+		}
+	}
+	checkMetadata(t, podcast)
+
+	t.Run("Stored", func(t *testing.T) {
+		store.Connect()
+		store.Migrate()
+		defer store.Close()
+		if err := store.CreatePodcast(&podcast); err != nil {
+			t.Fatalf("Failed to create podcast:%v", err)
+		}
+		stored, err := store.GetPodcastByID(podcast.ID)
+		if err != nil || len(stored.PodcastItems) != 1 {
+			t.Fatalf("Failed to get podcast:%v", err)
+		}
+		checkMetadata(t, stored)
+	})
+}
+
+func TestParseDuration(t *testing.T) {
+	type durationTestCase struct {
+		value string
+		want  int64
+		err   error
+	}
+	testCases := []durationTestCase{
+		{"01:02:03", 3723, nil},
+		{"62:03", 3723, nil},
+		{"3723", 3723, nil},
+		{" 3723.6 ", 3723, nil},
+		{"1:00:00:00", 0, ErrInvalidDuration},
+		{"10:75", 0, ErrInvalidDuration},
+		{"an hour", 0, ErrInvalidDuration},
+		{"", 0, ErrInvalidDuration},
+	}
+	for _, testCase := range testCases {
+		if have, err := ParseDuration(testCase.value); have != testCase.want || err != testCase.err {
+			t.Errorf("%q\tWant:%d %v\tHave:%d %v", testCase.value, testCase.want, testCase.err, have, err)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package podcastmg
 import (
 	"errors"
 	"github.com/jinzhu/gorm"
-	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
@@ -14,19 +13,32 @@ type User struct {
 	Password   string `gorm:"not null;" json:"-"`
 	admin      bool
 	Podcasts   []Podcast `gorm:"many2many:subscriptions;" json:"-"`
+
+	// EmailVerified is set once the user followed a verification or password reset link sent to UserEmail
+	EmailVerified bool `gorm:"not null;default:false" json:"email_verified"`
+
+	// TokensValidAfter is when the user's password was last changed, tokens issued before are no longer accepted
+	TokensValidAfter *time.Time `json:"-"`
 }
 
-// NewUser constructs a User struct with the given email and password
+// NewUser constructs a User struct with the given email and password, hashed by DefaultPasswordHasher
 func NewUser(email, password string) (User, error) {
+	return NewUserWithHasher(email, password, DefaultPasswordHasher)
+}
+
+// NewUserWithHasher constructs a User struct with the given email and password, hashed by the hasher
+func NewUserWithHasher(email, password string, hasher PasswordHasher) (User, error) {
 	var user User
 	if email == "" || password == "" {
 		return user, errors.New("Email or password cannot be empty for user")
 	}
-	passwordHashBytes, err := bcrypt.GenerateFromPassword([]byte(password), 15)
+	if err := ValidateEmail(email); err != nil {
+		return user, err
+	}
+	passwordHash, err := HashPassword(hasher, password)
 	if err != nil {
 		return user, err
 	}
-	passwordHash := string(passwordHashBytes)
 	return User{
 		UserEmail: email,
 		admin:     false,
@@ -34,6 +46,14 @@ func NewUser(email, password string) (User, error) {
 	}, nil
 }
 
+// HashPassword returns the hash of a password made by the hasher to be stored as a user's Password
+func HashPassword(hasher PasswordHasher, password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	return hasher.Hash(password)
+}
+
 // Podcast is a struct containing information relevant to a particular podcast
 type Podcast struct {
 	gorm.Model   `json:"-"`
@@ -42,6 +62,23 @@ type Podcast struct {
 	Description  string        `json:"description"`
 	ImageURL     string        `json:"image_url"`
 	URL          string        `gorm:"not null;" json:"url"`
+	Author       string        `json:"author"`
+	Language     string        `json:"language"`
+	Categories   StringList    `gorm:"type:text" json:"categories,omitempty"`
+	Explicit     bool          `json:"explicit"`
+	Type         string        `json:"type"`
+	Locked       bool          `json:"locked"`
+	Funding      Fundings      `gorm:"type:text" json:"funding,omitempty"`
+	Persons      Persons       `gorm:"type:text" json:"persons,omitempty"`
+
+	// Hub is the WebSub hub advertised by the feed, it pushes the feed's updates under Topic
+	Hub   string `json:"hub,omitempty"`
+	Topic string `gorm:"index" json:"topic,omitempty"`
+
+	// Settings, Folder and Tags are the subscriber's settings and labels when the podcast is listed as a subscription
+	Settings *SubscriptionSettings `gorm:"-" json:"settings,omitempty"`
+	Folder   *Label                `gorm:"-" json:"folder,omitempty"`
+	Tags     []Label               `gorm:"-" json:"tags,omitempty"`
 }
 
 // NewPodcast constructs a Podcast struct with the given parameters
@@ -57,32 +94,57 @@ func NewPodcast(title, description, imageURL, feedURL string, items []PodcastIte
 
 // PodcastItem is a struct representing a single item in a given podcast
 type PodcastItem struct {
-	gorm.Model  `json:"-"`
-	PodcastID   uint       `gorm:"index" json:"podcast_id"`
-	Title       string     `json:"title"`
-	Content     string     `json:"content"`
-	Description string     `json:"description"`
-	MediaURL    string     `json:"media_url"`
-	MediaLength string     `json:"media_length"`
-	ImageURL    string     `json:"image_url"`
-	Played      bool       `json:"played"`
-	Published   *time.Time `json:"published"`
+	ID             uint        `gorm:"primary_key" json:"id"`
+	CreatedAt      time.Time   `json:"-"`
+	UpdatedAt      time.Time   `json:"-"`
+	DeletedAt      *time.Time  `sql:"index" json:"-"`
+	PodcastID      uint        `gorm:"index" json:"podcast_id"`
+	Title          string      `json:"title"`
+	Content        string      `json:"content"`
+	Description    string      `json:"description"`
+	MediaURL       string      `json:"media_url"`
+	MediaSize      int64       `json:"media_size"`
+	MediaType      string      `json:"media_type"`
+	Duration       int64       `json:"duration"`
+	Enclosures     []Enclosure `json:"enclosures,omitempty"`
+	ImageURL       string      `json:"image_url"`
+	Played         bool        `json:"played"`
+	Published      *time.Time  `json:"published"`
+	Author         string      `json:"author"`
+	Explicit       bool        `json:"explicit"`
+	ITunesDuration string      `json:"itunes_duration"`
+	Season         int         `json:"season,omitempty"`
+	Episode        int         `json:"episode,omitempty"`
+	EpisodeType    string      `json:"episode_type"`
+	ChaptersURL    string      `json:"chapters_url,omitempty"`
+	ChaptersType   string      `json:"chapters_type,omitempty"`
+	Transcripts    Transcripts `gorm:"type:text" json:"transcripts,omitempty"`
+	Persons        Persons     `gorm:"type:text" json:"persons,omitempty"`
 }
 
 // NewPodcastItem constructs a PodcastItem struct with the given values
-func NewPodcastItem(title, description, content, mediaURL, imageURL, mediaLength string, published *time.Time) PodcastItem {
+func NewPodcastItem(title, description, content, mediaURL, imageURL string, mediaSize int64, published *time.Time) PodcastItem {
 	return PodcastItem{
 		Title:       title,
 		Description: description,
 		Content:     content,
 		MediaURL:    mediaURL,
-		MediaLength: mediaLength,
+		MediaSize:   mediaSize,
 		ImageURL:    imageURL,
 		Played:      false,
 		Published:   published,
 	}
 }
 
+// Enclosure is a media file attached to a PodcastItem, the first one is also kept on the item itself
+type Enclosure struct {
+	ID            uint   `gorm:"primary_key" json:"-"`
+	PodcastItemID uint   `gorm:"index" json:"-"`
+	URL           string `json:"url"`
+	Size          int64  `json:"size"`
+	Type          string `json:"type"`
+}
+
 // GetParentID returns the PodcastID of the podcast that the Item is a part of
 func (podcastItem *PodcastItem) GetParentID() uint {
 	return podcastItem.PodcastID
@@ -95,11 +157,12 @@ func (podcast *Podcast) GetItems() []PodcastItem {
 
 // Update adds new items to the podcast from the feed
 func (podcast *Podcast) Update() error {
-	newItems, err := GetNewItems(podcast.URL, podcast.PodcastItems)
+	feed, err := parseFeed(podcast.URL)
 	if err != nil {
 		return err
 	}
-	podcast.PodcastItems = append(podcast.PodcastItems, newItems...)
+	podcast.Hub, podcast.Topic = feedHub(feed, podcast.URL)
+	podcast.PodcastItems = append(podcast.PodcastItems, newFeedItems(feed, podcast.PodcastItems)...)
 	return nil
 }
 
@@ -150,5 +213,5 @@ func (user *User) GetUserEmail() string {
 
 // ComparePassword compares the user's hashed password to the given password, returns nil on success
 func (user *User) ComparePassword(password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	return VerifyPassword(user.Password, password)
 }
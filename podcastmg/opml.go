@@ -0,0 +1,86 @@
+package podcastmg
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// OPML is an outline document, commonly used to exchange lists of podcast subscriptions
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OPMLHead `xml:"head"`
+	Body    OPMLBody `xml:"body"`
+}
+
+// OPMLHead holds the metadata of an OPML document
+type OPMLHead struct {
+	Title string `xml:"title,omitempty"`
+}
+
+// OPMLBody holds the outlines of an OPML document
+type OPMLBody struct {
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// OPMLOutline is a single outline entry, which is either a feed or a group of nested outlines
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// NewOPML builds an OPML document of the subscriptions, podcasts in a folder are nested in an outline per folder.
+// Folders are listed in the given order before the podcasts which are not in any folder
+func NewOPML(title string, subscriptions []Podcast, folders []Label) OPML {
+	opml := OPML{Version: "2.0", Head: OPMLHead{Title: title}}
+	index := map[uint]int{}
+	for _, folder := range folders {
+		index[folder.ID] = len(opml.Body.Outlines)
+		opml.Body.Outlines = append(opml.Body.Outlines, OPMLOutline{Text: folder.Name, Title: folder.Name})
+	}
+	var unfiled []OPMLOutline
+	for _, podcast := range subscriptions {
+		text := podcast.Title
+		if podcast.Settings != nil && podcast.Settings.CustomTitle != "" {
+			text = podcast.Settings.CustomTitle
+		}
+		outline := OPMLOutline{Text: text, Title: text, Type: "rss", XMLURL: podcast.URL}
+		if podcast.Folder != nil {
+			if i, ok := index[podcast.Folder.ID]; ok {
+				opml.Body.Outlines[i].Outlines = append(opml.Body.Outlines[i].Outlines, outline)
+				continue
+			}
+		}
+		unfiled = append(unfiled, outline)
+	}
+	opml.Body.Outlines = append(opml.Body.Outlines, unfiled...)
+	return opml
+}
+
+// ParseOPML reads an OPML document
+func ParseOPML(r io.Reader) (OPML, error) {
+	var opml OPML
+	if err := xml.NewDecoder(r).Decode(&opml); err != nil {
+		return opml, err
+	}
+	return opml, nil
+}
+
+// FeedURLs returns the feed urls of all outlines in the document, including nested ones
+func (opml *OPML) FeedURLs() []string {
+	return collectFeedURLs(opml.Body.Outlines, nil)
+}
+
+func collectFeedURLs(outlines []OPMLOutline, urls []string) []string {
+	for _, outline := range outlines {
+		if outline.XMLURL != "" {
+			urls = append(urls, outline.XMLURL)
+		}
+		urls = collectFeedURLs(outline.Outlines, urls)
+	}
+	return urls
+}
@@ -0,0 +1,78 @@
+package podcastmg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOPMLFeedURLs(t *testing.T) {
+	type opmlTestCase struct {
+		name string
+		doc  string
+		want []string
+		err  bool
+	}
+	testCases := []opmlTestCase{
+		{"Flat", `<opml version="2.0"><body>
+			<outline text="A" type="rss" xmlUrl="http://a.com/feed"/>
+			<outline text="B" type="rss" xmlUrl="http://b.com/feed"/>
+			</body></opml>`, []string{"http://a.com/feed", "http://b.com/feed"}, false},
+		{"Nested", `<opml version="1.0"><body>
+			<outline text="Tech">
+				<outline text="A" xmlUrl="http://a.com/feed"/>
+				<outline text="Deeper"><outline text="C" xmlUrl="http://c.com/feed"/></outline>
+			</outline>
+			<outline text="B" xmlUrl="http://b.com/feed"/>
+			</body></opml>`, []string{"http://a.com/feed", "http://c.com/feed", "http://b.com/feed"}, false},
+		{"Empty", `<opml version="2.0"><body></body></opml>`, nil, false},
+		{"Invalid", `not xml at all`, nil, true},
+	}
+	for _, testCase := range testCases {
+		opml, err := ParseOPML(strings.NewReader(testCase.doc))
+		if err != nil {
+			if !testCase.err {
+				t.Errorf("%s\tUnexpected error:%v", testCase.name, err)
+			}
+			continue
+		}
+		if testCase.err {
+			t.Errorf("%s\tShould have errored but did not", testCase.name)
+		}
+		have := opml.FeedURLs()
+		if strings.Join(have, ",") != strings.Join(testCase.want, ",") {
+			t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.want, have)
+		}
+	}
+}
+
+func TestNewOPML(t *testing.T) {
+	folders := []Label{{ID: 2, Kind: LabelFolder, Name: "News"}, {ID: 1, Kind: LabelFolder, Name: "Tech"}}
+	subscriptions := []Podcast{
+		{Title: "A", URL: "http://a.com/feed", Folder: &folders[1]},
+		{Title: "B", URL: "http://b.com/feed"},
+		{Title: "C", URL: "http://c.com/feed", Folder: &folders[0], Settings: &SubscriptionSettings{CustomTitle: "My C"}},
+	}
+	opml := NewOPML("Subscriptions", subscriptions, folders)
+
+	var outline func(OPMLOutline) string
+	outline = func(o OPMLOutline) string {
+		var children []string
+		for _, child := range o.Outlines {
+			children = append(children, outline(child))
+		}
+		if len(children) > 0 {
+			return o.Text + "[" + strings.Join(children, ",") + "]"
+		}
+		return o.Text
+	}
+	var have []string
+	for _, o := range opml.Body.Outlines {
+		have = append(have, outline(o))
+	}
+	if want := "News[My C],Tech[A],B"; strings.Join(have, ",") != want {
+		t.Errorf("Want:%s\tHave:%s", want, strings.Join(have, ","))
+	}
+	if urls := opml.FeedURLs(); strings.Join(urls, ",") != "http://c.com/feed,http://a.com/feed,http://b.com/feed" {
+		t.Errorf("Unexpected feed urls:%v", urls)
+	}
+}
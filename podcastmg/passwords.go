@@ -0,0 +1,181 @@
+package podcastmg
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	// argon2idPrefix starts Argon2id hashes in the PHC string format
+	argon2idPrefix = "$argon2id$"
+
+	// argon2idSaltLength is the length in bytes of the salts of Argon2id hashes
+	argon2idSaltLength = 16
+
+	// argon2idKeyLength is the length in bytes of the keys of Argon2id hashes
+	argon2idKeyLength = 32
+)
+
+var (
+	// ErrPasswordMismatch indicates a password which does not match the user's hash
+	ErrPasswordMismatch = errors.New("Password does not match")
+
+	// ErrUnknownPasswordHash indicates a stored password hash of a format none of the hashers knows
+	ErrUnknownPasswordHash = errors.New("Unknown password hash format")
+)
+
+// PasswordHasher hashes passwords for storage. The hashes describe the algorithm and parameters they were made
+// with, so any hasher verifies the hashes of any other through VerifyPassword
+type PasswordHasher interface {
+	// Hash returns the hash of the password to be stored as a user's Password
+	Hash(password string) (string, error)
+
+	// Outdated reports whether the hash was not made by the hasher with its current parameters and should be
+	// replaced the next time the password is known
+	Outdated(hash string) bool
+}
+
+// DefaultPasswordHasher is the hasher of NewUser and of services which are not given one
+var DefaultPasswordHasher PasswordHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+
+// VerifyPassword checks the password against a hash made by any of the hashers, returns nil on a match
+func VerifyPassword(hash, password string) error {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return verifyArgon2id(hash, password)
+	case strings.HasPrefix(hash, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+	return ErrUnknownPasswordHash
+}
+
+// BcryptHasher hashes passwords with bcrypt at the given cost, costs below bcrypt.MinCost use bcrypt.DefaultCost
+type BcryptHasher struct {
+	Cost int
+}
+
+// cost returns the cost bcrypt hashes with
+func (h BcryptHasher) cost() int {
+	if h.Cost < bcrypt.MinCost {
+		return bcrypt.DefaultCost
+	}
+	return h.Cost
+}
+
+// Hash returns the bcrypt hash of the password
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Outdated reports whether the hash is not a bcrypt hash of the hasher's cost
+func (h BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost()
+}
+
+// Argon2idHasher hashes passwords with Argon2id, Memory is in KiB. Zero parameters take the values of
+// DefaultArgon2idHasher
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultArgon2idHasher uses the parameters recommended by RFC 9106 for memory constrained environments
+var DefaultArgon2idHasher = Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// params returns the hasher with the defaults filled in
+func (h Argon2idHasher) params() Argon2idHasher {
+	if h.Time == 0 {
+		h.Time = DefaultArgon2idHasher.Time
+	}
+	if h.Memory == 0 {
+		h.Memory = DefaultArgon2idHasher.Memory
+	}
+	if h.Threads == 0 {
+		h.Threads = DefaultArgon2idHasher.Threads
+	}
+	return h
+}
+
+// Hash returns the Argon2id hash of the password in the PHC string format
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	h = h.params()
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, argon2idKeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Outdated reports whether the hash is not an Argon2id hash of the hasher's parameters
+func (h Argon2idHasher) Outdated(hash string) bool {
+	params, _, key, err := parseArgon2id(hash)
+	return err != nil || params != h.params() || len(key) != argon2idKeyLength
+}
+
+// parseArgon2id returns the parameters, salt and key of an Argon2id hash
+func parseArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil || params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	return params, salt, key, nil
+}
+
+// verifyArgon2id checks the password against an Argon2id hash
+func verifyArgon2id(hash, password string) error {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// newSecret returns a random hex encoded secret, for signing keys and for tokens which stand in for the user's
+// credentials
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
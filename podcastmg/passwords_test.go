@@ -0,0 +1,59 @@
+package podcastmg
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	fastBcrypt := BcryptHasher{Cost: bcrypt.MinCost}
+	fastArgon := Argon2idHasher{Time: 1, Memory: 1024, Threads: 1}
+
+	type hasherTestCase struct {
+		name   string
+		hasher PasswordHasher
+		other  PasswordHasher
+	}
+	testCases := []hasherTestCase{
+		{"Bcrypt", fastBcrypt, BcryptHasher{Cost: bcrypt.MinCost + 1}},
+		{"Argon2id", fastArgon, Argon2idHasher{Time: 2, Memory: 1024, Threads: 1}},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := test.hasher.Hash("secret")
+			if err != nil {
+				t.Fatalf("Failed to hash password:%v", err)
+			}
+			if again, _ := test.hasher.Hash("secret"); again == hash {
+				t.Errorf("Hashes of the same password should be salted")
+			}
+			if err = VerifyPassword(hash, "secret"); err != nil {
+				t.Errorf("Failed to verify password:%v", err)
+			}
+			if err = VerifyPassword(hash, "wrong"); err != ErrPasswordMismatch {
+				t.Errorf("Want:%v\tHave:%v", ErrPasswordMismatch, err)
+			}
+			if test.hasher.Outdated(hash) {
+				t.Errorf("Hash of the hasher should be current")
+			}
+			if !test.other.Outdated(hash) {
+				t.Errorf("Hash of other parameters should be outdated")
+			}
+		})
+	}
+
+	argonHash, _ := fastArgon.Hash("secret")
+	bcryptHash, _ := fastBcrypt.Hash("secret")
+	if !fastBcrypt.Outdated(argonHash) || !fastArgon.Outdated(bcryptHash) {
+		t.Errorf("Hashes of other algorithms should be outdated")
+	}
+	if err := VerifyPassword("plain", "plain"); err != ErrUnknownPasswordHash {
+		t.Errorf("Want:%v\tHave:%v", ErrUnknownPasswordHash, err)
+	}
+	if _, err := HashPassword(fastArgon, ""); err != ErrEmptyPassword {
+		t.Errorf("Want:%v\tHave:%v", ErrEmptyPassword, err)
+	}
+	if user, err := NewUserWithHasher("hasher@test.com", "secret", fastArgon); err != nil || user.ComparePassword("secret") != nil {
+		t.Errorf("User was not created with the hasher:%+v %v", user, err)
+	}
+}
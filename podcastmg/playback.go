@@ -0,0 +1,74 @@
+package podcastmg
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// ErrInvalidPlayback indicates a playback state with a negative position
+var ErrInvalidPlayback = errors.New("Invalid playback position")
+
+// PlaybackState is where the user stopped listening to an episode, in seconds, and whether it was played.
+// Device names the device which reported the state, so that it can ignore its own updates
+type PlaybackState struct {
+	UserID        uint      `gorm:"primary_key;auto_increment:false" json:"-"`
+	PodcastItemID uint      `gorm:"primary_key;auto_increment:false" json:"item_id"`
+	Position      int64     `gorm:"not null;default:0" json:"position"`
+	Played        bool      `gorm:"not null;default:false" json:"played"`
+	Device        string    `json:"device,omitempty"`
+	UpdatedAt     time.Time `gorm:"index" json:"updated_at"`
+}
+
+// Validate checks that the position is not negative
+func (state PlaybackState) Validate() error {
+	if state.Position < 0 {
+		return ErrInvalidPlayback
+	}
+	return nil
+}
+
+// SavePlaybackState records the playback state of an episode of the user's subscriptions, the latest state
+// wins. The episode is marked as played or unplayed along with it
+func (dbStore *DBStore) SavePlaybackState(userEmail string, state *PlaybackState) error {
+	if err := state.Validate(); err != nil {
+		return err
+	}
+	item, err := dbStore.GetPodcastItemBySubscription(userEmail, state.PodcastItemID)
+	if err != nil {
+		return err
+	}
+	if state.UserID, err = dbStore.userID(userEmail); err != nil {
+		return err
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		_, err := savePlaybackState(tx, state, item, time.Now())
+		return err
+	})
+}
+
+// savePlaybackState saves the playback state, marks its episode as played or unplayed and records the change
+// made at changedAt in the user's change log
+func savePlaybackState(tx *gorm.DB, state *PlaybackState, item PodcastItem, changedAt time.Time) (Change, error) {
+	change := Change{Kind: ChangeEpisodeState, PodcastItemID: &item.ID, Position: &state.Position, Played: &state.Played,
+		Device: state.Device, ChangedAt: changedAt}
+	if err := tx.Save(state).Error; err != nil {
+		return change, err
+	}
+	if err := tx.Model(&item).UpdateColumn("played", state.Played).Error; err != nil {
+		return change, err
+	}
+	return change, recordChange(tx, state.UserID, &change)
+}
+
+// GetPlaybackStates returns the playback states of the user's episodes which changed after since, oldest first
+func (dbStore *DBStore) GetPlaybackStates(userEmail string, since time.Time) ([]PlaybackState, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return nil, err
+	}
+	states := []PlaybackState{}
+	err = dbStore.Database.Where("user_id = ? AND updated_at > ?", userID, since).
+		Order("updated_at, podcast_item_id").Find(&states).Error
+	return states, err
+}
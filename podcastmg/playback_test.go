@@ -0,0 +1,72 @@
+package podcastmg
+
+import (
+	"github.com/jinzhu/gorm"
+	"testing"
+	"time"
+)
+
+func TestPlayback(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "playback@test.com"
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "Playback Cast", URL: "playbackcast.test/xml", PodcastItems: []PodcastItem{{Title: "One"}, {Title: "Two"}}},
+	}}
+	other := User{UserEmail: "notplayback@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Other Cast", URL: "otherplaybackcast.test/xml", PodcastItems: []PodcastItem{{Title: "Other"}}},
+	}}
+	for _, u := range []*User{&user, &other} {
+		if err := store.CreateUser(u); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+	}
+	items := user.Podcasts[0].PodcastItems
+	start := time.Now().Add(-time.Second)
+
+	type playbackTestCase struct {
+		name    string
+		state   PlaybackState
+		wantErr error
+	}
+	testCases := []playbackTestCase{
+		{"Position", PlaybackState{PodcastItemID: items[0].ID, Position: 120, Device: "phone"}, nil},
+		{"Played", PlaybackState{PodcastItemID: items[1].ID, Position: 1800, Played: true, Device: "laptop"}, nil},
+		{"Later Position", PlaybackState{PodcastItemID: items[0].ID, Position: 300, Device: "laptop"}, nil},
+		{"Negative Position", PlaybackState{PodcastItemID: items[0].ID, Position: -1}, ErrInvalidPlayback},
+		{"Other User's Episode", PlaybackState{PodcastItemID: other.Podcasts[0].PodcastItems[0].ID}, gorm.ErrRecordNotFound},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := store.SavePlaybackState(email, &test.state); err != test.wantErr {
+				t.Errorf("Error Want:%v\tHave:%v", test.wantErr, err)
+			}
+		})
+	}
+
+	states, err := store.GetPlaybackStates(email, start)
+	if err != nil || len(states) != 2 {
+		t.Fatalf("Unexpected playback states:%+v %v", states, err)
+	}
+	for _, state := range states {
+		switch state.PodcastItemID {
+		case items[0].ID:
+			if state.Position != 300 || state.Played || state.Device != "laptop" {
+				t.Errorf("Unexpected playback state:%+v", state)
+			}
+		case items[1].ID:
+			if state.Position != 1800 || !state.Played {
+				t.Errorf("Unexpected playback state:%+v", state)
+			}
+		}
+	}
+	if states, err = store.GetPlaybackStates(email, time.Now().Add(time.Second)); err != nil || len(states) != 0 {
+		t.Errorf("Unexpected playback states after now:%+v %v", states, err)
+	}
+	item, err := store.GetPodcastItemBySubscription(email, items[1].ID)
+	if err != nil || !item.Played {
+		t.Errorf("Episode was not marked played:%+v %v", item, err)
+	}
+}
@@ -0,0 +1,108 @@
+package podcastmg
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RSS is a podcast feed of a playlist's episodes
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+// RSSChannel is the channel of an RSS feed
+type RSSChannel struct {
+	Title       string    `xml:"title"`
+	Description string    `xml:"description"`
+	Items       []RSSItem `xml:"item"`
+}
+
+// RSSItem is an episode of an RSS feed
+type RSSItem struct {
+	Title       string        `xml:"title"`
+	Description string        `xml:"description,omitempty"`
+	GUID        RSSGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   *RSSEnclosure `xml:"enclosure,omitempty"`
+	Author      string        `xml:"itunes:author,omitempty"`
+	Duration    string        `xml:"itunes:duration,omitempty"`
+	Image       *ITunesImage  `xml:"itunes:image,omitempty"`
+}
+
+// RSSGUID identifies an RSS item
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSSEnclosure is the media of an RSS item
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// ITunesImage is the artwork of an RSS item
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// RSS returns the playlist as a podcast feed. The guid of each episode is the url of its podcast followed by
+// the episode id, so that it stays the same while the episode is in the playlist
+func (playlist Playlist) RSS() RSS {
+	rss := RSS{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: RSSChannel{Title: playlist.Name, Description: "Playlist " + playlist.Name},
+	}
+	for _, item := range playlist.Items {
+		rssItem := RSSItem{
+			Title:       item.PodcastTitle + ": " + item.Title,
+			Description: item.Description,
+			GUID:        RSSGUID{Value: item.PodcastURL + "#" + strconv.FormatUint(uint64(item.ID), 10)},
+			Author:      item.Author,
+		}
+		if item.Published != nil {
+			rssItem.PubDate = item.Published.UTC().Format(time.RFC1123Z)
+		}
+		if item.MediaURL != "" {
+			rssItem.Enclosure = &RSSEnclosure{URL: item.MediaURL, Length: item.MediaSize, Type: item.MediaType}
+		}
+		if item.Duration > 0 {
+			rssItem.Duration = strconv.FormatInt(item.Duration, 10)
+		}
+		if item.ImageURL != "" {
+			rssItem.Image = &ITunesImage{Href: item.ImageURL}
+		}
+		rss.Channel.Items = append(rss.Channel.Items, rssItem)
+	}
+	return rss
+}
+
+// WriteM3U writes the playlist as an extended M3U playlist, episodes without media are left out. Lines are buffered
+// and the errors of writing them are dropped, the first one is returned by the final Flush since a failed buffered
+// writer keeps failing
+func (playlist Playlist) WriteM3U(w io.Writer) error {
+	oneLine := strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#EXTM3U\n#PLAYLIST:%s\n", oneLine.Replace(playlist.Name))
+	for _, item := range playlist.Items {
+		if item.MediaURL == "" {
+			continue
+		}
+		duration := item.Duration
+		if duration == 0 {
+			duration = -1
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s - %s\n%s\n", duration, oneLine.Replace(item.PodcastTitle), oneLine.Replace(item.Title), item.MediaURL)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,333 @@
+package podcastmg
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	// PlaylistManual is the kind of playlists whose episodes are picked by the user
+	PlaylistManual = "manual"
+
+	// PlaylistSmart is the kind of playlists whose episodes are selected by PlaylistRules
+	PlaylistSmart = "smart"
+
+	// SortShortest lists episodes shortest first
+	SortShortest = "shortest"
+
+	// SortLongest lists episodes longest first
+	SortLongest = "longest"
+
+	// MaxPlaylistItems is the largest number of episodes in a playlist
+	MaxPlaylistItems = 500
+)
+
+var (
+	// ErrInvalidPlaylist indicates a playlist without a name or an item change of a smart playlist
+	ErrInvalidPlaylist = errors.New("Invalid playlist")
+
+	// ErrInvalidRules indicates smart playlist rules with an unknown order or values out of range
+	ErrInvalidRules = errors.New("Invalid playlist rules")
+
+	// ErrPlaylistNotFound indicates a playlist which does not exist or belongs to another user
+	ErrPlaylistNotFound = errors.New("Playlist not found")
+)
+
+// Playlist is a named list of episodes from the user's subscriptions. A playlist with Rules is a smart
+// playlist, its episodes are selected from the store each time it is read. FeedSecret identifies the playlist
+// in the urls of its feeds, which podcast apps fetch without the user's credentials
+type Playlist struct {
+	ID         uint           `gorm:"primary_key" json:"id"`
+	CreatedAt  time.Time      `json:"-"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	UserID     uint           `gorm:"not null;index" json:"-"`
+	Name       string         `gorm:"not null" json:"name"`
+	Kind       string         `gorm:"not null" json:"kind"`
+	Rules      *PlaylistRules `gorm:"type:text" json:"rules,omitempty"`
+	FeedSecret string         `gorm:"index" json:"feed_secret"`
+	Items      []PlaylistItem `gorm:"-" json:"items,omitempty"`
+}
+
+// PlaylistEntry places an episode in a manual playlist
+type PlaylistEntry struct {
+	PlaylistID    uint `gorm:"primary_key;auto_increment:false"`
+	PodcastItemID uint `gorm:"primary_key;auto_increment:false"`
+	Position      int  `gorm:"not null"`
+}
+
+// PlaylistItem is an episode of a playlist along with the podcast it belongs to
+type PlaylistItem struct {
+	PodcastItem
+	PodcastTitle string `json:"podcast_title"`
+	PodcastURL   string `json:"podcast_url"`
+}
+
+// PlaylistRules select the episodes of a smart playlist. Zero values do not restrict the selection,
+// episodes with any of the tags are selected and durations are in seconds
+type PlaylistRules struct {
+	Unplayed    bool     `json:"unplayed,omitempty"`
+	TagIDs      []uint   `json:"tag_ids,omitempty"`
+	FolderID    uint     `json:"folder_id,omitempty"`
+	PodcastURLs []string `json:"podcast_urls,omitempty"`
+	MinDuration int64    `json:"min_duration,omitempty"`
+	MaxDuration int64    `json:"max_duration,omitempty"`
+	MaxAgeDays  int      `json:"max_age_days,omitempty"`
+	Order       string   `json:"order,omitempty"`
+	Limit       int      `json:"limit,omitempty"`
+}
+
+// Value implements driver.Valuer
+func (rules PlaylistRules) Value() (driver.Value, error) {
+	return jsonValue(rules)
+}
+
+// Scan implements sql.Scanner
+func (rules *PlaylistRules) Scan(src interface{}) error {
+	return jsonScan(src, rules)
+}
+
+// Validate checks that the rules are within their allowed ranges
+func (rules PlaylistRules) Validate() error {
+	switch rules.Order {
+	case "", SortNewest, SortOldest, SortShortest, SortLongest:
+	default:
+		return ErrInvalidRules
+	}
+	if rules.MinDuration < 0 || rules.MaxDuration < 0 || rules.MaxAgeDays < 0 {
+		return ErrInvalidRules
+	}
+	if rules.MaxDuration > 0 && rules.MinDuration > rules.MaxDuration {
+		return ErrInvalidRules
+	}
+	if rules.Limit < 0 || rules.Limit > MaxPlaylistItems {
+		return ErrInvalidRules
+	}
+	return nil
+}
+
+// subscribedItems returns a query over the episodes of the user's subscriptions selecting PlaylistItems
+func (dbStore *DBStore) subscribedItems(userID uint) *gorm.DB {
+	return dbStore.Database.Table("podcast_items").
+		Select("podcast_items.*, podcasts.title AS podcast_title, podcasts.url AS podcast_url").
+		Joins("JOIN podcasts ON podcasts.id = podcast_items.podcast_id AND podcasts.deleted_at IS NULL").
+		Joins("JOIN subscriptions ON subscriptions.podcast_id = podcasts.id").
+		Where("subscriptions.user_id = ?", userID)
+}
+
+// evaluateRules returns the episodes of the user's subscriptions matching the rules
+func (dbStore *DBStore) evaluateRules(userID uint, rules PlaylistRules) ([]PlaylistItem, error) {
+	query := dbStore.subscribedItems(userID)
+	if rules.Unplayed {
+		query = query.Where("NOT podcast_items.played")
+	}
+	if len(rules.TagIDs) > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM subscription_tags WHERE subscription_tags.user_id = subscriptions.user_id"+
+			" AND subscription_tags.podcast_id = subscriptions.podcast_id AND subscription_tags.label_id IN (?))", rules.TagIDs)
+	}
+	if rules.FolderID != 0 {
+		query = query.Where("subscriptions.folder_id = ?", rules.FolderID)
+	}
+	if len(rules.PodcastURLs) > 0 {
+		query = query.Where("podcasts.url IN (?)", rules.PodcastURLs)
+	}
+	if rules.MinDuration > 0 {
+		query = query.Where("podcast_items.duration >= ?", rules.MinDuration)
+	}
+	if rules.MaxDuration > 0 {
+		// Episodes of unknown duration are not taken to be short
+		query = query.Where("podcast_items.duration > 0 AND podcast_items.duration <= ?", rules.MaxDuration)
+	}
+	if rules.MaxAgeDays > 0 {
+		query = query.Where("podcast_items.published >= ?", time.Now().AddDate(0, 0, -rules.MaxAgeDays))
+	}
+	switch rules.Order {
+	case SortOldest:
+		query = query.Order("podcast_items.published, podcast_items.id")
+	case SortShortest:
+		query = query.Order("podcast_items.duration, podcast_items.id")
+	case SortLongest:
+		query = query.Order("podcast_items.duration DESC, podcast_items.id DESC")
+	default:
+		query = query.Order("podcast_items.published DESC, podcast_items.id DESC")
+	}
+	limit := rules.Limit
+	if limit == 0 {
+		limit = MaxPlaylistItems
+	}
+	items := []PlaylistItem{}
+	err := query.Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// checkPlaylist validates the name and rules of the playlist, the tags and folder of the rules must be the user's
+func (dbStore *DBStore) checkPlaylist(userEmail string, playlist *Playlist) error {
+	playlist.Name = strings.TrimSpace(playlist.Name)
+	if playlist.Name == "" {
+		return ErrInvalidPlaylist
+	}
+	if playlist.Rules == nil {
+		return nil
+	}
+	if err := playlist.Rules.Validate(); err != nil {
+		return err
+	}
+	for _, id := range playlist.Rules.TagIDs {
+		if label, err := dbStore.GetLabel(userEmail, id); err != nil || label.Kind != LabelTag {
+			return ErrInvalidRules
+		}
+	}
+	if id := playlist.Rules.FolderID; id != 0 {
+		if label, err := dbStore.GetLabel(userEmail, id); err != nil || label.Kind != LabelFolder {
+			return ErrInvalidRules
+		}
+	}
+	return nil
+}
+
+// CreatePlaylist creates a playlist for the user, it is a smart playlist if it has Rules
+func (dbStore *DBStore) CreatePlaylist(userEmail string, playlist *Playlist) error {
+	if err := dbStore.checkPlaylist(userEmail, playlist); err != nil {
+		return err
+	}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	playlist.ID, playlist.UserID, playlist.Kind, playlist.Items = 0, userID, PlaylistManual, nil
+	if playlist.Rules != nil {
+		playlist.Kind = PlaylistSmart
+	}
+	if playlist.FeedSecret, err = newSecret(); err != nil {
+		return err
+	}
+	return dbStore.Database.Create(playlist).Error
+}
+
+// GetPlaylists returns the user's playlists without their episodes
+func (dbStore *DBStore) GetPlaylists(userEmail string) ([]Playlist, error) {
+	playlists := []Playlist{}
+	err := dbStore.Database.Select("playlists.*").Joins("JOIN users ON users.id = playlists.user_id").
+		Where("users.user_email = ?", userEmail).Order("playlists.name, playlists.id").Find(&playlists).Error
+	return playlists, err
+}
+
+// getPlaylist returns one of the user's playlists without its episodes
+func (dbStore *DBStore) getPlaylist(userEmail string, playlistID uint) (Playlist, error) {
+	var playlist Playlist
+	err := dbStore.Database.Select("playlists.*").Joins("JOIN users ON users.id = playlists.user_id").
+		Where("users.user_email = ? AND playlists.id = ?", userEmail, playlistID).First(&playlist).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return playlist, ErrPlaylistNotFound
+	}
+	return playlist, err
+}
+
+// GetPlaylist returns one of the user's playlists along with its episodes. Episodes of podcasts the
+// user has since unsubscribed from are left out
+func (dbStore *DBStore) GetPlaylist(userEmail string, playlistID uint) (Playlist, error) {
+	playlist, err := dbStore.getPlaylist(userEmail, playlistID)
+	if err != nil {
+		return playlist, err
+	}
+	return playlist, dbStore.playlistItems(&playlist)
+}
+
+// GetPlaylistFeed returns the playlist identified by the feed secret along with its episodes
+func (dbStore *DBStore) GetPlaylistFeed(secret string) (Playlist, error) {
+	var playlist Playlist
+	if secret == "" {
+		return playlist, ErrPlaylistNotFound
+	}
+	err := dbStore.Database.Select("playlists.*").Joins("JOIN users ON users.id = playlists.user_id").
+		Where("users.deleted_at IS NULL AND playlists.feed_secret = ?", secret).First(&playlist).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return playlist, ErrPlaylistNotFound
+	}
+	if err != nil {
+		return playlist, err
+	}
+	return playlist, dbStore.playlistItems(&playlist)
+}
+
+// playlistItems sets the episodes of the playlist. Episodes of podcasts the user has since unsubscribed from
+// are left out
+func (dbStore *DBStore) playlistItems(playlist *Playlist) (err error) {
+	if playlist.Rules != nil {
+		playlist.Items, err = dbStore.evaluateRules(playlist.UserID, *playlist.Rules)
+		return err
+	}
+	playlist.Items = []PlaylistItem{}
+	return dbStore.subscribedItems(playlist.UserID).
+		Joins("JOIN playlist_entries ON playlist_entries.podcast_item_id = podcast_items.id").
+		Where("playlist_entries.playlist_id = ?", playlist.ID).
+		Order("playlist_entries.position").Find(&playlist.Items).Error
+}
+
+// UpdatePlaylist saves the name and rules of one of the user's playlists, a playlist keeps its kind
+func (dbStore *DBStore) UpdatePlaylist(userEmail string, playlist *Playlist) error {
+	stored, err := dbStore.getPlaylist(userEmail, playlist.ID)
+	if err != nil {
+		return err
+	}
+	if (stored.Rules == nil) != (playlist.Rules == nil) {
+		return ErrInvalidPlaylist
+	}
+	if err = dbStore.checkPlaylist(userEmail, playlist); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"name": playlist.Name, "rules": playlist.Rules}
+	if playlist.Rules == nil {
+		updates["rules"] = gorm.Expr("NULL")
+	}
+	return dbStore.Database.Model(&stored).Updates(updates).Error
+}
+
+// DeletePlaylist removes one of the user's playlists
+func (dbStore *DBStore) DeletePlaylist(userEmail string, playlistID uint) error {
+	playlist, err := dbStore.getPlaylist(userEmail, playlistID)
+	if err != nil {
+		return err
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_id = ?", playlist.ID).Delete(&PlaylistEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&playlist).Error
+	})
+}
+
+// SetPlaylistItems replaces the episodes of one of the user's manual playlists with itemIDs in order.
+// The episodes must belong to the user's subscriptions
+func (dbStore *DBStore) SetPlaylistItems(userEmail string, playlistID uint, itemIDs []uint) error {
+	playlist, err := dbStore.getPlaylist(userEmail, playlistID)
+	if err != nil {
+		return err
+	}
+	if playlist.Rules != nil || len(itemIDs) > MaxPlaylistItems {
+		return ErrInvalidPlaylist
+	}
+	seen := map[uint]bool{}
+	for _, id := range itemIDs {
+		if seen[id] {
+			return ErrInvalidPlaylist
+		}
+		seen[id] = true
+		if _, err = dbStore.GetPodcastItemBySubscription(userEmail, id); err != nil {
+			return err
+		}
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_id = ?", playlist.ID).Delete(&PlaylistEntry{}).Error; err != nil {
+			return err
+		}
+		for position, id := range itemIDs {
+			if err := tx.Create(&PlaylistEntry{PlaylistID: playlist.ID, PodcastItemID: id, Position: position}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&playlist).UpdateColumn("updated_at", time.Now()).Error
+	})
+}
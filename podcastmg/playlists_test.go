@@ -0,0 +1,197 @@
+package podcastmg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func playlistTitles(playlist Playlist) []string {
+	titles := []string{}
+	for _, item := range playlist.Items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+func feedError(_ Playlist, err error) error {
+	return err
+}
+
+func TestPlaylists(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	published := func(days int) *time.Time {
+		at := time.Now().AddDate(0, 0, -days)
+		return &at
+	}
+	email := "playlists@test.com"
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "News Cast", URL: "newscast.test/xml", PodcastItems: []PodcastItem{
+			{Title: "Short Old", Duration: 600, Published: published(20), MediaURL: "https://media.test/n1.mp3"},
+			{Title: "Short New", Duration: 900, Published: published(1), MediaURL: "https://media.test/n2.mp3"},
+			{Title: "Long", Duration: 3600, Published: published(2), MediaURL: "https://media.test/n3.mp3"},
+			{Title: "Short Played", Duration: 300, Published: published(3), Played: true},
+			{Title: "Unknown Length", Published: published(4)},
+		}},
+		{Title: "Other Cast", URL: "othercast.test/xml", PodcastItems: []PodcastItem{
+			{Title: "Other Short", Duration: 60, Published: published(1)},
+		}},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+	news := Label{Kind: LabelTag, Name: "News"}
+	if err := store.CreateLabel(email, &news); err != nil {
+		t.Fatalf("Failed to create tag:%v", err)
+	}
+	if err := store.SetSubscriptionTags(email, "newscast.test/xml", []uint{news.ID}); err != nil {
+		t.Fatalf("Failed to tag subscription:%v", err)
+	}
+
+	smart := Playlist{Name: " Quick News ", Rules: &PlaylistRules{Unplayed: true, TagIDs: []uint{news.ID}, MaxDuration: 1800, Order: SortNewest, Limit: 20}}
+	if err := store.CreatePlaylist(email, &smart); err != nil {
+		t.Fatalf("Failed to create playlist:%v", err)
+	}
+	if smart.Kind != PlaylistSmart || smart.Name != "Quick News" {
+		t.Errorf("Unexpected playlist:%+v", smart)
+	}
+
+	type rulesTestCase struct {
+		name  string
+		rules PlaylistRules
+		want  []string
+	}
+	testCases := []rulesTestCase{
+		{"Unplayed News Under 30 Minutes", *smart.Rules, []string{"Short New", "Short Old"}},
+		{"Shortest", PlaylistRules{Order: SortShortest, Limit: 3}, []string{"Unknown Length", "Other Short", "Short Played"}},
+		{"Longest From Podcast", PlaylistRules{PodcastURLs: []string{"newscast.test/xml"}, Order: SortLongest, Limit: 1}, []string{"Long"}},
+		{"Recent And Long", PlaylistRules{MaxAgeDays: 7, MinDuration: 900, Order: SortOldest}, []string{"Long", "Short New"}},
+	}
+	for _, testCase := range testCases {
+		playlist := Playlist{Name: testCase.name, Rules: &testCase.rules}
+		if err := store.CreatePlaylist(email, &playlist); err != nil {
+			t.Fatalf("%s\tFailed to create playlist:%v", testCase.name, err)
+		}
+		stored, err := store.GetPlaylist(email, playlist.ID)
+		if err != nil {
+			t.Fatalf("%s\tFailed to get playlist:%v", testCase.name, err)
+		}
+		if titles := playlistTitles(stored); !reflect.DeepEqual(titles, testCase.want) {
+			t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.want, titles)
+		}
+	}
+
+	manual := Playlist{Name: "Picks"}
+	if err := store.CreatePlaylist(email, &manual); err != nil || manual.Kind != PlaylistManual {
+		t.Fatalf("Failed to create manual playlist:%+v %v", manual, err)
+	}
+	items := user.Podcasts[0].PodcastItems
+	if err := store.SetPlaylistItems(email, manual.ID, []uint{items[2].ID, items[0].ID}); err != nil {
+		t.Fatalf("Failed to set playlist items:%v", err)
+	}
+	picks, err := store.GetPlaylist(email, manual.ID)
+	if want := []string{"Long", "Short Old"}; err != nil || !reflect.DeepEqual(playlistTitles(picks), want) {
+		t.Errorf("Want:%v\tHave:%v %v", want, playlistTitles(picks), err)
+	}
+	if picks.Items[0].PodcastTitle != "News Cast" {
+		t.Errorf("Podcast Want:News Cast\tHave:%s", picks.Items[0].PodcastTitle)
+	}
+	feed, err := store.GetPlaylistFeed(picks.FeedSecret)
+	if want := []string{"Long", "Short Old"}; err != nil || feed.ID != manual.ID || !reflect.DeepEqual(playlistTitles(feed), want) {
+		t.Errorf("Feed Want:%v\tHave:%v %v", want, playlistTitles(feed), err)
+	}
+	if picks.FeedSecret == smart.FeedSecret {
+		t.Errorf("Playlists share the feed secret %s", picks.FeedSecret)
+	}
+
+	type playlistErrorTestCase struct {
+		name string
+		err  error
+		want error
+	}
+	errorCases := []playlistErrorTestCase{
+		{"Empty Name", store.CreatePlaylist(email, &Playlist{Name: " "}), ErrInvalidPlaylist},
+		{"Unknown Order", store.CreatePlaylist(email, &Playlist{Name: "x", Rules: &PlaylistRules{Order: "random"}}), ErrInvalidRules},
+		{"Unknown Tag", store.CreatePlaylist(email, &Playlist{Name: "x", Rules: &PlaylistRules{TagIDs: []uint{news.ID + 100}}}), ErrInvalidRules},
+		{"Limit", store.CreatePlaylist(email, &Playlist{Name: "x", Rules: &PlaylistRules{Limit: MaxPlaylistItems + 1}}), ErrInvalidRules},
+		{"Items Of Smart Playlist", store.SetPlaylistItems(email, smart.ID, []uint{items[0].ID}), ErrInvalidPlaylist},
+		{"Repeated Item", store.SetPlaylistItems(email, manual.ID, []uint{items[0].ID, items[0].ID}), ErrInvalidPlaylist},
+		{"Smart To Manual", store.UpdatePlaylist(email, &Playlist{ID: smart.ID, Name: "x"}), ErrInvalidPlaylist},
+		{"Other User", store.DeletePlaylist("nobody@test.com", manual.ID), ErrPlaylistNotFound},
+		{"Empty Feed Secret", feedError(store.GetPlaylistFeed("")), ErrPlaylistNotFound},
+		{"Unknown Feed Secret", feedError(store.GetPlaylistFeed("unknown")), ErrPlaylistNotFound},
+	}
+	for _, testCase := range errorCases {
+		if testCase.err != testCase.want {
+			t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.want, testCase.err)
+		}
+	}
+
+	smart.Name, smart.Rules.Limit = "Quickest News", 1
+	if err = store.UpdatePlaylist(email, &smart); err != nil {
+		t.Fatalf("Failed to update playlist:%v", err)
+	}
+	if stored, _ := store.GetPlaylist(email, smart.ID); stored.Name != "Quickest News" || len(stored.Items) != 1 {
+		t.Errorf("Unexpected updated playlist:%+v", stored)
+	}
+
+	// The feed of a manual playlist follows its updates
+	if err = store.UpdatePlaylist(email, &Playlist{ID: manual.ID, Name: "Best Picks"}); err != nil {
+		t.Fatalf("Failed to update manual playlist:%v", err)
+	}
+	if err = store.SetPlaylistItems(email, manual.ID, []uint{items[1].ID}); err != nil {
+		t.Fatalf("Failed to set playlist items:%v", err)
+	}
+	feed, err = store.GetPlaylistFeed(picks.FeedSecret)
+	if want := []string{"Short New"}; err != nil || feed.Name != "Best Picks" || !reflect.DeepEqual(playlistTitles(feed), want) {
+		t.Errorf("Updated Feed Want:Best Picks %v\tHave:%s %v %v", want, feed.Name, playlistTitles(feed), err)
+	}
+	if err = store.DeletePlaylist(email, manual.ID); err != nil {
+		t.Fatalf("Failed to delete playlist:%v", err)
+	}
+	if _, err = store.GetPlaylist(email, manual.ID); err != ErrPlaylistNotFound {
+		t.Errorf("Want:%v\tHave:%v", ErrPlaylistNotFound, err)
+	}
+	if playlists, _ := store.GetPlaylists(email); len(playlists) != len(testCases)+1 {
+		t.Errorf("Playlists Want:%d\tHave:%d", len(testCases)+1, len(playlists))
+	}
+}
+
+func TestPlaylistExport(t *testing.T) {
+	published := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	playlist := Playlist{Name: "Picks", Items: []PlaylistItem{
+		{PodcastItem{ID: 1, Title: "First", MediaURL: "https://media.test/1.mp3", MediaSize: 100, MediaType: "audio/mpeg", Duration: 60, Published: &published}, "Cast", "cast.test/xml"},
+		{PodcastItem{ID: 2, Title: "No\nMedia"}, "Cast", "cast.test/xml"},
+	}}
+
+	data, err := xml.Marshal(playlist.RSS())
+	if err != nil {
+		t.Fatalf("Failed to marshal rss:%v", err)
+	}
+	for _, want := range []string{
+		`<title>Cast: First</title>`,
+		`<guid isPermaLink="false">cast.test/xml#1</guid>`,
+		`<pubDate>Mon, 01 Jan 2018 10:00:00 +0000</pubDate>`,
+		`<enclosure url="https://media.test/1.mp3" length="100" type="audio/mpeg"></enclosure>`,
+		`<itunes:duration>60</itunes:duration>`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("RSS is missing %s", want)
+		}
+	}
+
+	var m3u bytes.Buffer
+	if err = playlist.WriteM3U(&m3u); err != nil {
+		t.Fatalf("Failed to write m3u:%v", err)
+	}
+	want := "#EXTM3U\n#PLAYLIST:Picks\n#EXTINF:60,Cast - First\nhttps://media.test/1.mp3\n"
+	if m3u.String() != want {
+		t.Errorf("M3U Want:%q\tHave:%q", want, m3u.String())
+	}
+}
@@ -2,33 +2,63 @@ package podcastmg
 
 import (
 	"github.com/mmcdole/gofeed"
+	"io"
 	"sort"
+	"strconv"
+	"strings"
 )
 
-func parseFeed(xmlURL string) (*gofeed.Feed, error) {
+// newFeedParser returns a feed parser which keeps the hub links of Atom feeds
+func newFeedParser() *gofeed.Parser {
 	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(xmlURL)
+	fp.AtomTranslator = hubAtomTranslator{}
+	return fp
+}
+
+func parseFeed(xmlURL string) (*gofeed.Feed, error) {
+	feed, err := newFeedParser().ParseURL(xmlURL)
 	if err != nil {
 		return nil, err
 	}
 	return feed, nil
 }
 
+// parseFeedContent parses a feed document, such as the content pushed by a WebSub hub
+func parseFeedContent(content io.Reader) (*gofeed.Feed, error) {
+	return newFeedParser().Parse(content)
+}
+
+// buildItemsFromFeedItems returns the items oldest first, items without a publication date are taken as the newest
+// and keep their order in the feed
 func buildItemsFromFeedItems(feedItems []*gofeed.Item) []PodcastItem {
 	var podcastItems []PodcastItem
-	sort.Slice(feedItems, func(i, j int) bool {
+	sort.SliceStable(feedItems, func(i, j int) bool {
+		if feedItems[i].PublishedParsed == nil || feedItems[j].PublishedParsed == nil {
+			return feedItems[j].PublishedParsed == nil && feedItems[i].PublishedParsed != nil
+		}
 		return feedItems[i].PublishedParsed.Before(*feedItems[j].PublishedParsed)
 	})
 	for _, item := range feedItems {
-		var mediaURL, mediaLength string
-		if len(item.Enclosures) < 1 {
-			mediaURL = ""
-			mediaLength = "0"
-		} else {
-			mediaURL = item.Enclosures[0].URL
-			mediaLength = item.Enclosures[0].Length
+		var enclosures []Enclosure
+		for _, enclosure := range item.Enclosures {
+			size, err := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+			if err != nil || size < 0 {
+				size = 0
+			}
+			enclosures = append(enclosures, Enclosure{URL: enclosure.URL, Size: size, Type: enclosure.Type})
+		}
+		var imageURL string
+		if item.Image != nil {
+			imageURL = item.Image.URL
+		}
+		podcastItem := NewPodcastItem(item.Title, item.Description, item.Content, "", imageURL, 0, item.PublishedParsed)
+		if len(enclosures) > 0 {
+			podcastItem.MediaURL = enclosures[0].URL
+			podcastItem.MediaSize = enclosures[0].Size
+			podcastItem.MediaType = enclosures[0].Type
+			podcastItem.Enclosures = enclosures
 		}
-		podcastItem := NewPodcastItem(item.Title, item.Description, item.Content, mediaURL, item.Image.URL, mediaLength, item.PublishedParsed)
+		applyItemMetadata(&podcastItem, item)
 		podcastItems = append(podcastItems, podcastItem)
 	}
 	return podcastItems
@@ -42,7 +72,13 @@ func BuildPodcastFromURL(feedURL string) (Podcast, error) {
 		return pc, err
 	}
 	podcastItems := buildItemsFromFeedItems(feed.Items)
-	pc = NewPodcast(feed.Title, feed.Description, feed.Image.URL, feedURL, podcastItems)
+	var imageURL string
+	if feed.Image != nil {
+		imageURL = feed.Image.URL
+	}
+	pc = NewPodcast(feed.Title, feed.Description, imageURL, feedURL, podcastItems)
+	applyFeedMetadata(&pc, feed)
+	pc.Hub, pc.Topic = feedHub(feed, feedURL)
 	return pc, nil
 }
 
@@ -52,6 +88,11 @@ func GetNewItems(feedURL string, old []PodcastItem) (update []PodcastItem, err e
 	if err != nil {
 		return
 	}
+	return newFeedItems(feed, old), nil
+}
+
+// newFeedItems returns the items of the feed which are newer than the newest of the old items, newest first
+func newFeedItems(feed *gofeed.Feed, old []PodcastItem) (update []PodcastItem) {
 	new := buildItemsFromFeedItems(feed.Items)
 
 	for i := len(new) - 1; i >= 0; i-- {
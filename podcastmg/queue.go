@@ -0,0 +1,240 @@
+package podcastmg
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	// QueueAdd appends an episode to the end of the queue, an episode already queued keeps its place
+	QueueAdd = "add"
+
+	// QueuePlayNext moves an episode to the front of the queue, adding it if needed
+	QueuePlayNext = "play_next"
+
+	// QueueRemove takes an episode off the queue
+	QueueRemove = "remove"
+
+	// QueueMove moves a queued episode to the given position
+	QueueMove = "move"
+
+	// QueueClear empties the queue
+	QueueClear = "clear"
+)
+
+var (
+	// ErrQueueConflict indicates a change based on an outdated version of the queue
+	ErrQueueConflict = errors.New("Queue was changed since the given version")
+
+	// ErrInvalidQueueAction indicates a queue change with an unknown action
+	ErrInvalidQueueAction = errors.New("Invalid queue action")
+
+	// ErrQueuePosition indicates a move to a position outside of the queue
+	ErrQueuePosition = errors.New("Position is outside of the queue")
+
+	// ErrNotQueued indicates an episode which is not in the queue
+	ErrNotQueued = errors.New("Episode is not queued")
+)
+
+// Queue is the user's ordered up-next list of episodes. Version is increased by every change, changes
+// must name the version they are based on so that edits from several devices do not overwrite each other
+type Queue struct {
+	UserID    uint         `gorm:"primary_key;auto_increment:false" json:"-"`
+	Version   int64        `gorm:"not null;default:0" json:"version"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	Entries   []QueueEntry `gorm:"-" json:"entries"`
+}
+
+// QueueEntry places an episode in the user's queue
+type QueueEntry struct {
+	UserID        uint         `gorm:"primary_key;auto_increment:false" json:"-"`
+	PodcastItemID uint         `gorm:"primary_key;auto_increment:false" json:"item_id"`
+	Position      int          `gorm:"not null" json:"position"`
+	Item          *PodcastItem `gorm:"-" json:"item,omitempty"`
+}
+
+// QueueOp is a single change to the queue. ItemID is unused by QueueClear, Position is only used by QueueMove
+type QueueOp struct {
+	Action   string `json:"action"`
+	ItemID   uint   `json:"item_id,omitempty"`
+	Position int    `json:"position,omitempty"`
+}
+
+// apply returns the queued item ids after the change
+func (op QueueOp) apply(itemIDs []uint) ([]uint, error) {
+	index := -1
+	for i, id := range itemIDs {
+		if id == op.ItemID {
+			index = i
+			break
+		}
+	}
+	without := func() []uint {
+		return append(append([]uint{}, itemIDs[:index]...), itemIDs[index+1:]...)
+	}
+	switch op.Action {
+	case QueueAdd:
+		if index >= 0 {
+			return itemIDs, nil
+		}
+		return append(itemIDs, op.ItemID), nil
+	case QueuePlayNext:
+		if index >= 0 {
+			itemIDs = without()
+		}
+		return append([]uint{op.ItemID}, itemIDs...), nil
+	case QueueRemove:
+		if index < 0 {
+			return nil, ErrNotQueued
+		}
+		return without(), nil
+	case QueueMove:
+		if index < 0 {
+			return nil, ErrNotQueued
+		}
+		if op.Position < 0 || op.Position >= len(itemIDs) {
+			return nil, ErrQueuePosition
+		}
+		rest := without()
+		return append(append(append([]uint{}, rest[:op.Position]...), op.ItemID), rest[op.Position:]...), nil
+	case QueueClear:
+		return []uint{}, nil
+	}
+	return nil, ErrInvalidQueueAction
+}
+
+// queuedItemIDs returns the user's queued episodes in order, skipping those no longer in a subscription
+func queuedItemIDs(db *gorm.DB, userID uint) ([]uint, error) {
+	var itemIDs []uint
+	err := db.Table("queue_entries").
+		Joins("JOIN podcast_items ON podcast_items.id = queue_entries.podcast_item_id AND podcast_items.deleted_at IS NULL").
+		Joins("JOIN subscriptions ON subscriptions.podcast_id = podcast_items.podcast_id AND subscriptions.user_id = queue_entries.user_id").
+		Where("queue_entries.user_id = ?", userID).
+		Order("queue_entries.position").Pluck("queue_entries.podcast_item_id", &itemIDs).Error
+	return itemIDs, err
+}
+
+// loadQueue returns the user's queue with its episodes, a user without a queue has an empty one at version 0
+func loadQueue(db *gorm.DB, userID uint) (Queue, error) {
+	queue := Queue{UserID: userID, Entries: []QueueEntry{}}
+	if err := db.Where("user_id = ?", userID).First(&queue).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return queue, err
+	}
+	itemIDs, err := queuedItemIDs(db, userID)
+	if err != nil || len(itemIDs) == 0 {
+		return queue, err
+	}
+	var items []PodcastItem
+	if err = db.Where("id IN (?)", itemIDs).Find(&items).Error; err != nil {
+		return queue, err
+	}
+	index := map[uint]int{}
+	for i, item := range items {
+		index[item.ID] = i
+	}
+	for position, id := range itemIDs {
+		entry := QueueEntry{UserID: userID, PodcastItemID: id, Position: position}
+		if i, ok := index[id]; ok {
+			entry.Item = &items[i]
+		}
+		queue.Entries = append(queue.Entries, entry)
+	}
+	return queue, nil
+}
+
+// bumpQueueVersion increases the version of the user's queue, creating the queue if needed. A version
+// of -1 bumps unconditionally, any other version must match the stored one
+func bumpQueueVersion(tx *gorm.DB, userID uint, version int64) error {
+	queue := Queue{UserID: userID}
+	if err := tx.Where(Queue{UserID: userID}).FirstOrCreate(&queue).Error; err != nil {
+		return err
+	}
+	update := tx.Model(&Queue{}).Where("user_id = ?", userID)
+	if version >= 0 {
+		update = update.Where("version = ?", version)
+	}
+	update = update.Updates(map[string]interface{}{"version": gorm.Expr("version + 1"), "updated_at": time.Now()})
+	if update.Error != nil {
+		return update.Error
+	}
+	if update.RowsAffected == 0 {
+		return ErrQueueConflict
+	}
+	return nil
+}
+
+// writeQueue replaces the user's queued episodes with itemIDs in order
+func writeQueue(tx *gorm.DB, userID uint, itemIDs []uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&QueueEntry{}).Error; err != nil {
+		return err
+	}
+	for position, id := range itemIDs {
+		if err := tx.Create(&QueueEntry{UserID: userID, PodcastItemID: id, Position: position}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetQueue returns the user's queue along with its episodes
+func (dbStore *DBStore) GetQueue(userEmail string) (Queue, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return Queue{}, err
+	}
+	return loadQueue(dbStore.Database, userID)
+}
+
+// UpdateQueue applies the change to the user's queue if it is still at the given version and returns the new queue.
+// Episodes added to the queue must belong to one of the user's subscriptions
+func (dbStore *DBStore) UpdateQueue(userEmail string, version int64, op QueueOp) (Queue, error) {
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return Queue{}, err
+	}
+	if op.Action == QueueAdd || op.Action == QueuePlayNext {
+		if _, err = dbStore.GetPodcastItemBySubscription(userEmail, op.ItemID); err != nil {
+			return Queue{}, err
+		}
+	}
+	if version < 0 {
+		return Queue{}, ErrQueueConflict
+	}
+	var queue Queue
+	err = dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := bumpQueueVersion(tx, userID, version); err != nil {
+			return err
+		}
+		itemIDs, err := queuedItemIDs(tx, userID)
+		if err != nil {
+			return err
+		}
+		if itemIDs, err = op.apply(itemIDs); err != nil {
+			return err
+		}
+		if err = writeQueue(tx, userID, itemIDs); err != nil {
+			return err
+		}
+		queue, err = loadQueue(tx, userID)
+		return err
+	})
+	return queue, err
+}
+
+// appendToQueue adds new episodes to the end of the user's queue regardless of its version
+func appendToQueue(tx *gorm.DB, userID uint, newItemIDs []uint) error {
+	if err := bumpQueueVersion(tx, userID, -1); err != nil {
+		return err
+	}
+	itemIDs, err := queuedItemIDs(tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range newItemIDs {
+		if itemIDs, err = (QueueOp{Action: QueueAdd, ItemID: id}).apply(itemIDs); err != nil {
+			return err
+		}
+	}
+	return writeQueue(tx, userID, itemIDs)
+}
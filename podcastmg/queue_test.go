@@ -0,0 +1,144 @@
+package podcastmg
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func queuedTitles(queue Queue) []string {
+	titles := []string{}
+	for _, entry := range queue.Entries {
+		titles = append(titles, entry.Item.Title)
+	}
+	return titles
+}
+
+func TestQueue(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "queue@test.com"
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{
+		{Title: "Queue Cast", URL: "queuecast.test/xml", PodcastItems: []PodcastItem{
+			{Title: "One"}, {Title: "Two"}, {Title: "Three"},
+		}},
+	}}
+	other := User{UserEmail: "notqueue@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Other Cast", URL: "otherqueuecast.test/xml", PodcastItems: []PodcastItem{{Title: "Other"}}},
+	}}
+	for _, u := range []*User{&user, &other} {
+		if err := store.CreateUser(u); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+	}
+	items := user.Podcasts[0].PodcastItems
+
+	queue, err := store.GetQueue(email)
+	if err != nil || queue.Version != 0 || len(queue.Entries) != 0 {
+		t.Fatalf("Unexpected empty queue:%+v %v", queue, err)
+	}
+
+	type queueTestCase struct {
+		name    string
+		op      QueueOp
+		want    []string
+		wantErr error
+	}
+	testCases := []queueTestCase{
+		{"Add", QueueOp{Action: QueueAdd, ItemID: items[0].ID}, []string{"One"}, nil},
+		{"Add Second", QueueOp{Action: QueueAdd, ItemID: items[1].ID}, []string{"One", "Two"}, nil},
+		{"Add Queued", QueueOp{Action: QueueAdd, ItemID: items[0].ID}, []string{"One", "Two"}, nil},
+		{"Play Next", QueueOp{Action: QueuePlayNext, ItemID: items[2].ID}, []string{"Three", "One", "Two"}, nil},
+		{"Play Next Queued", QueueOp{Action: QueuePlayNext, ItemID: items[1].ID}, []string{"Two", "Three", "One"}, nil},
+		{"Move", QueueOp{Action: QueueMove, ItemID: items[1].ID, Position: 2}, []string{"Three", "One", "Two"}, nil},
+		{"Move Outside", QueueOp{Action: QueueMove, ItemID: items[1].ID, Position: 3}, nil, ErrQueuePosition},
+		{"Remove", QueueOp{Action: QueueRemove, ItemID: items[0].ID}, []string{"Three", "Two"}, nil},
+		{"Remove Missing", QueueOp{Action: QueueRemove, ItemID: items[0].ID}, nil, ErrNotQueued},
+		{"Unknown Action", QueueOp{Action: "shuffle"}, nil, ErrInvalidQueueAction},
+		{"Other User's Episode", QueueOp{Action: QueueAdd, ItemID: other.Podcasts[0].PodcastItems[0].ID}, nil, gorm.ErrRecordNotFound},
+		{"Clear", QueueOp{Action: QueueClear}, []string{}, nil},
+	}
+	for _, testCase := range testCases {
+		updated, err := store.UpdateQueue(email, queue.Version, testCase.op)
+		if testCase.wantErr != nil {
+			if err != testCase.wantErr {
+				t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s\tFailed to update queue:%v", testCase.name, err)
+		}
+		if updated.Version != queue.Version+1 {
+			t.Errorf("%s\tVersion Want:%d\tHave:%d", testCase.name, queue.Version+1, updated.Version)
+		}
+		if titles := queuedTitles(updated); !reflect.DeepEqual(titles, testCase.want) {
+			t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.want, titles)
+		}
+		queue = updated
+	}
+
+	// A device editing an older version of the queue is rejected
+	if _, err = store.UpdateQueue(email, queue.Version-1, QueueOp{Action: QueueAdd, ItemID: items[0].ID}); err != ErrQueueConflict {
+		t.Errorf("Want:%v\tHave:%v", ErrQueueConflict, err)
+	}
+	if stored, _ := store.GetQueue(email); stored.Version != queue.Version || len(stored.Entries) != 0 {
+		t.Errorf("Rejected change was applied:%+v", stored)
+	}
+}
+
+func TestQueueAutoAppend(t *testing.T) {
+	episodes := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Auto Cast</title>`)
+		for i := episodes; i > 0; i-- {
+			fmt.Fprintf(w, `<item><title>Episode %d</title><pubDate>Mon, 0%d Jan 2018 10:00:00 GMT</pubDate><enclosure url="https://media.test/%d.mp3"/></item>`, i, i, i)
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	}))
+	defer server.Close()
+
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	email := "autoqueue@test.com"
+	podcast, err := BuildPodcastFromURL(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to build podcast:%v", err)
+	}
+	user := User{UserEmail: email, Password: "x", Podcasts: []Podcast{podcast}}
+	if err = store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	episodes = 2
+	if err = store.UpdatePodcastBySubscription(email, server.URL); err != nil {
+		t.Fatalf("Failed to update podcast:%v", err)
+	}
+	if queue, _ := store.GetQueue(email); len(queue.Entries) != 0 {
+		t.Errorf("Episodes were queued without AutoQueue:%v", queuedTitles(queue))
+	}
+
+	subscription, _ := store.GetSubscription(email, server.URL)
+	subscription.AutoQueue = true
+	if err = store.UpdateSubscription(&subscription); err != nil {
+		t.Fatalf("Failed to update subscription:%v", err)
+	}
+	episodes = 4
+	if err = store.UpdatePodcastBySubscription(email, server.URL); err != nil {
+		t.Fatalf("Failed to update podcast:%v", err)
+	}
+	queue, err := store.GetQueue(email)
+	if want := []string{"Episode 3", "Episode 4"}; err != nil || !reflect.DeepEqual(queuedTitles(queue), want) {
+		t.Errorf("Want:%v\tHave:%v %v", want, queuedTitles(queue), err)
+	}
+	if queue.Version != 1 {
+		t.Errorf("Version Want:1\tHave:%d", queue.Version)
+	}
+}
@@ -0,0 +1,338 @@
+package podcastmg
+
+import (
+	"errors"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// SearchScopeSubscriptions limits a search to the podcasts the user is subscribed to
+	SearchScopeSubscriptions = "subscriptions"
+
+	// SearchScopeCatalog searches all podcasts known to the store
+	SearchScopeCatalog = "catalog"
+
+	// SearchKindPodcast marks a search result matching a podcast
+	SearchKindPodcast = "podcast"
+
+	// SearchKindEpisode marks a search result matching a podcast item
+	SearchKindEpisode = "episode"
+)
+
+// ErrEmptySearch indicates a search query without any terms
+var ErrEmptySearch = errors.New("Search query has no terms")
+
+// searchHighlightStart and searchHighlightStop wrap matched terms in highlights, as ts_headline does by default
+const (
+	searchHighlightStart = "<b>"
+	searchHighlightStop  = "</b>"
+	searchSnippetLength  = 160
+)
+
+// headlineStart and headlineStop are the control characters ts_headline wraps matched terms in, so that its
+// output can be escaped before the markers are swapped for the highlight markup
+const (
+	headlineStart   = "\x02"
+	headlineStop    = "\x03"
+	headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop
+)
+
+// SearchQuery describes a search over podcasts and their items
+type SearchQuery struct {
+	Terms     string
+	Scope     string
+	UserEmail string
+	Limit     int
+	Offset    int
+}
+
+// SearchResult is a single podcast or episode matching a search
+type SearchResult struct {
+	Kind       string  `json:"kind"`
+	PodcastID  uint    `json:"podcast_id"`
+	ItemID     uint    `json:"item_id,omitempty"`
+	Title      string  `json:"title"`
+	PodcastURL string  `json:"podcast_url"`
+	Rank       float64 `json:"rank"`
+	Highlight  string  `json:"highlight"`
+}
+
+// SearchResults is a page of search results along with the total number of matches
+type SearchResults struct {
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+}
+
+// searchTerms splits the query into lower cased terms
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Search finds podcasts and episodes matching the query terms, ordered by rank.
+// Postgres stores use its full-text search, other dialects rank candidate rows in process
+func (dbStore *DBStore) Search(query SearchQuery) (SearchResults, error) {
+	if len(searchTerms(query.Terms)) == 0 {
+		return SearchResults{}, ErrEmptySearch
+	}
+	if dbStore.dialect == "postgres" {
+		return dbStore.searchFullText(query)
+	}
+	return dbStore.searchPortable(query)
+}
+
+// migrateSearch creates the full-text indexes used by Search where the dialect supports them
+func (dbStore *DBStore) migrateSearch() error {
+	if dbStore.dialect != "postgres" {
+		return nil
+	}
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS podcasts_search_idx ON podcasts USING GIN (" + podcastDocument + ")",
+		"CREATE INDEX IF NOT EXISTS podcast_items_search_idx ON podcast_items USING GIN (" + itemDocument + ")",
+	}
+	for _, index := range indexes {
+		if err := dbStore.Database.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Full-text documents and weighted vectors, the documents must match the GIN index expressions
+const (
+	podcastDocument = "to_tsvector('english', coalesce(podcasts.title, '') || ' ' || coalesce(podcasts.description, ''))"
+	itemDocument    = "to_tsvector('english', coalesce(podcast_items.title, '') || ' ' || coalesce(podcast_items.description, '') || ' ' || coalesce(podcast_items.content, ''))"
+	podcastVector   = "setweight(to_tsvector('english', coalesce(podcasts.title, '')), 'A') || setweight(to_tsvector('english', coalesce(podcasts.description, '')), 'B')"
+	itemVector      = "setweight(to_tsvector('english', coalesce(podcast_items.title, '')), 'A') || setweight(to_tsvector('english', coalesce(podcast_items.description, '') || ' ' || coalesce(podcast_items.content, '')), 'B')"
+	subscribedSQL   = "podcasts.id IN (SELECT subscriptions.podcast_id FROM subscriptions JOIN users ON users.id = subscriptions.user_id WHERE users.user_email = ?)"
+	searchScopeSQL  = " AND " + subscribedSQL
+)
+
+func (dbStore *DBStore) searchFullText(query SearchQuery) (SearchResults, error) {
+	var results SearchResults
+	podcastScope, itemScope := "", ""
+	args := []interface{}{headlineOptions, query.Terms}
+	if query.Scope != SearchScopeCatalog {
+		podcastScope = searchScopeSQL
+		args = append(args, query.UserEmail)
+	}
+	args = append(args, headlineOptions, query.Terms)
+	if query.Scope != SearchScopeCatalog {
+		itemScope = searchScopeSQL
+		args = append(args, query.UserEmail)
+	}
+	// Podcasts are stored once per subscriber, so matches are de-duplicated by feed url
+	matches := "(SELECT DISTINCT ON (podcasts.url) 'podcast' AS kind, podcasts.id AS podcast_id, 0 AS item_id, podcasts.title AS title, podcasts.url AS podcast_url, " +
+		"ts_rank(" + podcastVector + ", q) AS rank, " +
+		"ts_headline('english', coalesce(podcasts.title, '') || ' ' || coalesce(podcasts.description, ''), q, ?) AS highlight " +
+		"FROM podcasts, plainto_tsquery('english', ?) q " +
+		"WHERE podcasts.deleted_at IS NULL AND " + podcastDocument + " @@ q" + podcastScope +
+		" ORDER BY podcasts.url, podcasts.id)" +
+		" UNION ALL " +
+		"(SELECT DISTINCT ON (podcasts.url, podcast_items.title, podcast_items.media_url) 'episode', podcast_items.podcast_id, podcast_items.id, podcast_items.title, podcasts.url, " +
+		"ts_rank(" + itemVector + ", q), " +
+		"ts_headline('english', coalesce(podcast_items.description, '') || ' ' || coalesce(podcast_items.content, ''), q, ?) " +
+		"FROM podcast_items JOIN podcasts ON podcasts.id = podcast_items.podcast_id, plainto_tsquery('english', ?) q " +
+		"WHERE podcast_items.deleted_at IS NULL AND podcasts.deleted_at IS NULL AND " + itemDocument + " @@ q" + itemScope +
+		" ORDER BY podcasts.url, podcast_items.title, podcast_items.media_url, podcast_items.id)"
+
+	if err := dbStore.Database.Raw("SELECT count(*) FROM ("+matches+") matches", args...).Row().Scan(&results.Total); err != nil {
+		return results, err
+	}
+	rows, err := dbStore.Database.Raw("SELECT * FROM ("+matches+") matches ORDER BY rank DESC, podcast_id, item_id LIMIT ? OFFSET ?",
+		append(args, query.Limit, query.Offset)...).Rows()
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result SearchResult
+		if err = rows.Scan(&result.Kind, &result.PodcastID, &result.ItemID, &result.Title, &result.PodcastURL, &result.Rank, &result.Highlight); err != nil {
+			return results, err
+		}
+		result.Highlight = escapeHeadline(result.Highlight)
+		results.Results = append(results.Results, result)
+	}
+	return results, rows.Err()
+}
+
+// escapeHeadline escapes the output of ts_headline, the text is often HTML, and turns its markers into highlights
+func escapeHeadline(headline string) string {
+	escaped := html.EscapeString(headline)
+	return strings.NewReplacer(headlineStart, searchHighlightStart, headlineStop, searchHighlightStop).Replace(escaped)
+}
+
+// searchPortable selects candidates matching all terms with LIKE and ranks them in process
+func (dbStore *DBStore) searchPortable(query SearchQuery) (SearchResults, error) {
+	var results SearchResults
+	terms := searchTerms(query.Terms)
+
+	podcasts := dbStore.Database.Model(&Podcast{})
+	items := dbStore.Database.Model(&PodcastItem{}).Joins("JOIN podcasts ON podcasts.id = podcast_items.podcast_id").
+		Where("podcasts.deleted_at IS NULL")
+	if query.Scope != SearchScopeCatalog {
+		podcasts = podcasts.Where(subscribedSQL, query.UserEmail)
+		items = items.Where(subscribedSQL, query.UserEmail)
+	}
+	var podcastConditions, itemConditions []string
+	var podcastArgs, itemArgs []interface{}
+	for _, term := range terms {
+		pattern := "%" + term + "%"
+		podcastConditions = append(podcastConditions, "(lower(podcasts.title) LIKE ? OR lower(podcasts.description) LIKE ?)")
+		podcastArgs = append(podcastArgs, pattern, pattern)
+		itemConditions = append(itemConditions, "(lower(podcast_items.title) LIKE ? OR lower(podcast_items.description) LIKE ? OR lower(podcast_items.content) LIKE ?)")
+		itemArgs = append(itemArgs, pattern, pattern, pattern)
+	}
+
+	var matchedPodcasts []Podcast
+	if err := podcasts.Where(strings.Join(podcastConditions, " AND "), podcastArgs...).Order("podcasts.id").Find(&matchedPodcasts).Error; err != nil {
+		return results, err
+	}
+	var matchedItems []struct {
+		PodcastItem
+		PodcastURL string
+	}
+	if err := items.Select("podcast_items.*, podcasts.url AS podcast_url").
+		Where(strings.Join(itemConditions, " AND "), itemArgs...).Order("podcast_items.id").Scan(&matchedItems).Error; err != nil {
+		return results, err
+	}
+
+	// Podcasts are stored once per subscriber, so matches are de-duplicated by feed url
+	seen := map[string]bool{}
+	var matches []SearchResult
+	for _, podcast := range matchedPodcasts {
+		if seen[podcast.URL] {
+			continue
+		}
+		seen[podcast.URL] = true
+		rank := 2*termFrequency(podcast.Title, terms) + termFrequency(podcast.Description, terms)
+		matches = append(matches, SearchResult{
+			Kind:       SearchKindPodcast,
+			PodcastID:  podcast.ID,
+			Title:      podcast.Title,
+			PodcastURL: podcast.URL,
+			Rank:       rank,
+			Highlight:  highlight(podcast.Title+" "+podcast.Description, terms),
+		})
+	}
+	for _, item := range matchedItems {
+		key := item.PodcastURL + "\x00" + item.Title + "\x00" + item.MediaURL
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		body := item.Description + " " + item.Content
+		matches = append(matches, SearchResult{
+			Kind:       SearchKindEpisode,
+			PodcastID:  item.PodcastID,
+			ItemID:     item.ID,
+			Title:      item.Title,
+			PodcastURL: item.PodcastURL,
+			Rank:       2*termFrequency(item.Title, terms) + termFrequency(body, terms),
+			Highlight:  highlight(body, terms),
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Rank > matches[j].Rank
+	})
+
+	results.Total = len(matches)
+	if query.Offset < len(matches) {
+		matches = matches[query.Offset:]
+		if query.Limit > 0 && query.Limit < len(matches) {
+			matches = matches[:query.Limit]
+		}
+		results.Results = matches
+	}
+	return results, nil
+}
+
+// termFrequency counts the occurrences of the terms in the text
+func termFrequency(text string, terms []string) float64 {
+	var count int
+	for _, word := range searchTerms(text) {
+		for _, term := range terms {
+			if strings.HasPrefix(word, term) {
+				count++
+			}
+		}
+	}
+	return float64(count)
+}
+
+// highlight returns a snippet of the text around the first matched term with matches wrapped in highlights
+func highlight(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// Lower casing changed the byte offsets, matches cannot be located reliably
+		lower = text
+	}
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	start, end := 0, len(text)
+	if first > searchSnippetLength/2 {
+		start = first - searchSnippetLength/2
+	}
+	if end-start > searchSnippetLength {
+		end = start + searchSnippetLength
+	}
+	// Keep the snippet on word boundaries where the window has them, text without spaces is cut at the window
+	if cut := start; cut > 0 {
+		for cut < end && text[cut-1] != ' ' {
+			cut++
+		}
+		if cut < end {
+			start = cut
+		}
+	}
+	if cut := end; cut < len(text) {
+		for cut > start && text[cut] != ' ' {
+			cut--
+		}
+		if cut > start {
+			end = cut
+		}
+	}
+	for start < end && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	for end < len(text) && end > start && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	snippet := strings.TrimSpace(text[start:end])
+
+	// The text is escaped as it is often HTML, only the highlights are markup
+	lowerSnippet := strings.ToLower(snippet)
+	if len(lowerSnippet) != len(snippet) {
+		return html.EscapeString(snippet)
+	}
+	var out strings.Builder
+	plain := 0
+	for i := 0; i < len(snippet); {
+		matched := 0
+		for _, term := range terms {
+			if strings.HasPrefix(lowerSnippet[i:], term) && len(term) > matched {
+				matched = len(term)
+			}
+		}
+		if matched > 0 {
+			out.WriteString(html.EscapeString(snippet[plain:i]))
+			out.WriteString(searchHighlightStart + html.EscapeString(snippet[i:i+matched]) + searchHighlightStop)
+			i += matched
+			plain = i
+			continue
+		}
+		i++
+	}
+	out.WriteString(html.EscapeString(snippet[plain:]))
+	return out.String()
+}
@@ -0,0 +1,115 @@
+package podcastmg
+
+import (
+	"strings"
+	"testing"
+)
+
+func searchTestPodcasts() (goTime, rustRadio Podcast) {
+	goTime = Podcast{
+		Title:       "Go Time",
+		Description: "A weekly panel about programming",
+		URL:         "gotime.test/xml",
+		PodcastItems: []PodcastItem{
+			{Title: "Generics deep dive", Description: "We talk about generics in depth", MediaURL: "gotime.test/1.mp3"},
+			{Title: "Kubernetes operators", Description: "Writing controllers", MediaURL: "gotime.test/2.mp3"},
+		},
+	}
+	rustRadio = Podcast{
+		Title:       "Rust Radio",
+		Description: "Systems programming with a crab",
+		URL:         "rustradio.test/xml",
+		PodcastItems: []PodcastItem{
+			{Title: "Ownership", Content: "The borrow checker meets generics", MediaURL: "rustradio.test/1.mp3"},
+		},
+	}
+	return
+}
+
+func TestSearch(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	goTime, rustRadio := searchTestPodcasts()
+	// Every subscriber holds its own copy of a podcast
+	goTimeCopy, _ := searchTestPodcasts()
+	users := []User{
+		{UserEmail: "search1@test.com", Password: "x", Podcasts: []Podcast{goTime}},
+		{UserEmail: "search2@test.com", Password: "x", Podcasts: []Podcast{rustRadio, goTimeCopy}},
+	}
+	for i := range users {
+		if err := store.CreateUser(&users[i]); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+	}
+
+	type searchTestCase struct {
+		name       string
+		query      SearchQuery
+		wantTotal  int
+		wantTitles []string
+	}
+	testCases := []searchTestCase{
+		{"Subscriptions", SearchQuery{Terms: "generics", UserEmail: "search1@test.com"}, 1, []string{"Generics deep dive"}},
+		{"Catalog Ranked", SearchQuery{Terms: "Generics", Scope: SearchScopeCatalog}, 2, []string{"Generics deep dive", "Ownership"}},
+		{"Catalog Deduplicated", SearchQuery{Terms: "programming", Scope: SearchScopeCatalog}, 2, []string{"Go Time", "Rust Radio"}},
+		{"All Terms", SearchQuery{Terms: "borrow generics", Scope: SearchScopeCatalog}, 1, []string{"Ownership"}},
+		{"Paginated", SearchQuery{Terms: "generics", Scope: SearchScopeCatalog, Limit: 1, Offset: 1}, 2, []string{"Ownership"}},
+		{"Past Last Page", SearchQuery{Terms: "generics", Scope: SearchScopeCatalog, Limit: 1, Offset: 5}, 2, nil},
+		{"Other User", SearchQuery{Terms: "borrow", UserEmail: "search1@test.com"}, 0, nil},
+	}
+	for _, testCase := range testCases {
+		results, err := store.Search(testCase.query)
+		if err != nil {
+			t.Errorf("%s\tFailed to search:%v", testCase.name, err)
+			continue
+		}
+		var haveTitles []string
+		for _, result := range results.Results {
+			haveTitles = append(haveTitles, result.Title)
+		}
+		if results.Total != testCase.wantTotal || strings.Join(haveTitles, ",") != strings.Join(testCase.wantTitles, ",") {
+			t.Errorf("%s\tWant:%d %v\tHave:%d %v", testCase.name, testCase.wantTotal, testCase.wantTitles, results.Total, haveTitles)
+		}
+	}
+
+	t.Run("Highlight", func(t *testing.T) {
+		results, _ := store.Search(SearchQuery{Terms: "borrow", Scope: SearchScopeCatalog})
+		if len(results.Results) != 1 || results.Results[0].Highlight != "The <b>borrow</b> checker meets generics" {
+			t.Errorf("Unexpected highlight:%v", results.Results)
+		}
+		if results.Results[0].Kind != SearchKindEpisode || results.Results[0].PodcastURL != "rustradio.test/xml" {
+			t.Errorf("Unexpected result:%v", results.Results[0])
+		}
+	})
+
+	t.Run("Highlight Without Spaces", func(t *testing.T) {
+		text := strings.Repeat("x", 400) + "golang" + strings.Repeat("y", 400)
+		if snippet := highlight(text, []string{"golang"}); !strings.Contains(snippet, "<b>golang</b>") {
+			t.Errorf("Unexpected highlight:%s", snippet)
+		}
+	})
+
+	t.Run("Highlight Escaping", func(t *testing.T) {
+		text := `<script>alert("go")</script> learning go & more`
+		want := `&lt;script&gt;alert(&#34;<b>go</b>&#34;)&lt;/script&gt; learning <b>go</b> &amp; more`
+		if snippet := highlight(text, []string{"go"}); snippet != want {
+			t.Errorf("Want:%s\tHave:%s", want, snippet)
+		}
+	})
+
+	t.Run("Headline Escaping", func(t *testing.T) {
+		headline := `<img src=x onerror="go()"> ` + headlineStart + "go" + headlineStop + " & <b>more</b>"
+		want := `&lt;img src=x onerror=&#34;go()&#34;&gt; <b>go</b> &amp; &lt;b&gt;more&lt;/b&gt;`
+		if escaped := escapeHeadline(headline); escaped != want {
+			t.Errorf("Want:%s\tHave:%s", want, escaped)
+		}
+	})
+
+	t.Run("Empty Query", func(t *testing.T) {
+		if _, err := store.Search(SearchQuery{Terms: " ,. "}); err != ErrEmptySearch {
+			t.Errorf("Want:%v\tHave:%v", ErrEmptySearch, err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package podcastmg
+
+import (
+	"errors"
+)
+
+const (
+	// SortNewest lists a subscription's episodes newest first
+	SortNewest = "newest"
+
+	// SortOldest lists a subscription's episodes oldest first
+	SortOldest = "oldest"
+)
+
+// ErrInvalidSettings indicates subscription settings outside of their allowed ranges
+var ErrInvalidSettings = errors.New("Invalid subscription settings")
+
+// Subscription is the join between a User and a Podcast along with the user's settings for the podcast
+type Subscription struct {
+	UserID    uint  `gorm:"primary_key;auto_increment:false" json:"-"`
+	PodcastID uint  `gorm:"primary_key;auto_increment:false" json:"podcast_id"`
+	FolderID  *uint `gorm:"index" json:"folder_id,omitempty"`
+	SubscriptionSettings
+}
+
+// TableName keeps Subscription on the join table of the User.Podcasts many2many
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
+
+// SubscriptionSettings are the per user settings of a subscribed podcast. The column defaults apply
+// to rows inserted by the many2many association, they must match DefaultSubscriptionSettings.
+// Notifications opts the subscription in to new episode webhooks, live events and digests
+type SubscriptionSettings struct {
+	CustomTitle   string  `gorm:"not null;default:''" json:"custom_title"`
+	PlaybackSpeed float64 `gorm:"not null;default:1" json:"playback_speed"`
+	SkipIntro     int     `gorm:"not null;default:0" json:"skip_intro"`
+	SkipOutro     int     `gorm:"not null;default:0" json:"skip_outro"`
+	Notifications bool    `gorm:"not null;default:false" json:"notifications"`
+	SortOrder     string  `gorm:"not null;default:'newest'" json:"sort_order"`
+	AutoQueue     bool    `gorm:"not null;default:false" json:"auto_queue"`
+}
+
+// DefaultSubscriptionSettings returns the settings of a new subscription
+func DefaultSubscriptionSettings() SubscriptionSettings {
+	return SubscriptionSettings{
+		PlaybackSpeed: 1,
+		SortOrder:     SortNewest,
+	}
+}
+
+// Validate checks that the settings are within their allowed ranges
+func (settings SubscriptionSettings) Validate() error {
+	if settings.PlaybackSpeed < 0.25 || settings.PlaybackSpeed > 4 {
+		return ErrInvalidSettings
+	}
+	if settings.SkipIntro < 0 || settings.SkipOutro < 0 {
+		return ErrInvalidSettings
+	}
+	if settings.SortOrder != SortNewest && settings.SortOrder != SortOldest {
+		return ErrInvalidSettings
+	}
+	return nil
+}
+
+// GetSubscription returns the user's subscription to the podcast with the given url
+func (dbStore *DBStore) GetSubscription(userEmail string, podcastURL string) (Subscription, error) {
+	var subscription Subscription
+	err := dbStore.Database.Select("subscriptions.*").
+		Joins("JOIN users ON users.id = subscriptions.user_id").
+		Joins("JOIN podcasts ON podcasts.id = subscriptions.podcast_id AND podcasts.deleted_at IS NULL").
+		Where("users.user_email = ? AND podcasts.url = ?", userEmail, podcastURL).
+		First(&subscription).Error
+	return subscription, err
+}
+
+// GetSubscriptions returns all subscriptions of the user
+func (dbStore *DBStore) GetSubscriptions(userEmail string) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := dbStore.Database.Select("subscriptions.*").
+		Joins("JOIN users ON users.id = subscriptions.user_id").
+		Where("users.user_email = ?", userEmail).
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// UpdateSubscription saves the settings of an existing subscription
+func (dbStore *DBStore) UpdateSubscription(subscription *Subscription) error {
+	return dbStore.Database.Model(subscription).
+		Where("user_id = ? AND podcast_id = ?", subscription.UserID, subscription.PodcastID).
+		Updates(map[string]interface{}{
+			"custom_title":   subscription.CustomTitle,
+			"playback_speed": subscription.PlaybackSpeed,
+			"skip_intro":     subscription.SkipIntro,
+			"skip_outro":     subscription.SkipOutro,
+			"notifications":  subscription.Notifications,
+			"sort_order":     subscription.SortOrder,
+			"auto_queue":     subscription.AutoQueue,
+		}).Error
+}
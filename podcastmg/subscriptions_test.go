@@ -0,0 +1,107 @@
+package podcastmg
+
+import (
+	"testing"
+)
+
+func TestSubscriptionSettings(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	user := User{UserEmail: "settings@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Settings Cast", URL: "settingscast.test/xml"},
+		{Title: "Other Cast", URL: "othercast.test/xml"},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	subscriptions, err := store.GetSubscriptions("settings@test.com")
+	if err != nil || len(subscriptions) != 2 {
+		t.Fatalf("Failed to get subscriptions:%v %v", subscriptions, err)
+	}
+	for _, subscription := range subscriptions {
+		if subscription.SubscriptionSettings != DefaultSubscriptionSettings() {
+			t.Errorf("Settings Want:%+v\tHave:%+v", DefaultSubscriptionSettings(), subscription.SubscriptionSettings)
+		}
+	}
+
+	subscription, err := store.GetSubscription("settings@test.com", "settingscast.test/xml")
+	if err != nil {
+		t.Fatalf("Failed to get subscription:%v", err)
+	}
+	want := SubscriptionSettings{
+		CustomTitle:   "My Cast",
+		PlaybackSpeed: 1.5,
+		SkipIntro:     30,
+		SkipOutro:     10,
+		Notifications: true,
+		SortOrder:     SortOldest,
+		AutoQueue:     true,
+	}
+	subscription.SubscriptionSettings = want
+	if err = store.UpdateSubscription(&subscription); err != nil {
+		t.Fatalf("Failed to update subscription:%v", err)
+	}
+	if subscription, _ = store.GetSubscription("settings@test.com", "settingscast.test/xml"); subscription.SubscriptionSettings != want {
+		t.Errorf("Settings Want:%+v\tHave:%+v", want, subscription.SubscriptionSettings)
+	}
+	if other, _ := store.GetSubscription("settings@test.com", "othercast.test/xml"); other.SubscriptionSettings != DefaultSubscriptionSettings() {
+		t.Errorf("Update changed another subscription:%+v", other.SubscriptionSettings)
+	}
+
+	// Zero values must be saved as well
+	subscription.SubscriptionSettings = DefaultSubscriptionSettings()
+	store.UpdateSubscription(&subscription)
+	if subscription, _ = store.GetSubscription("settings@test.com", "settingscast.test/xml"); subscription.SubscriptionSettings != DefaultSubscriptionSettings() {
+		t.Errorf("Settings Want:%+v\tHave:%+v", DefaultSubscriptionSettings(), subscription.SubscriptionSettings)
+	}
+
+	if _, err = store.GetSubscription("settings@test.com", "unknown.test/xml"); err == nil {
+		t.Errorf("Should have errored on an unknown subscription, but did not")
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	valid := DefaultSubscriptionSettings()
+	type validateTestCase struct {
+		name   string
+		modify func(*SubscriptionSettings)
+		want   error
+	}
+	testCases := []validateTestCase{
+		{"Defaults", func(s *SubscriptionSettings) {}, nil},
+		{"Slow", func(s *SubscriptionSettings) { s.PlaybackSpeed = 0.1 }, ErrInvalidSettings},
+		{"Fast", func(s *SubscriptionSettings) { s.PlaybackSpeed = 5 }, ErrInvalidSettings},
+		{"Negative Skip", func(s *SubscriptionSettings) { s.SkipIntro = -1 }, ErrInvalidSettings},
+		{"Sort Order", func(s *SubscriptionSettings) { s.SortOrder = "random" }, ErrInvalidSettings},
+	}
+	for _, testCase := range testCases {
+		settings := valid
+		testCase.modify(&settings)
+		if err := settings.Validate(); err != testCase.want {
+			t.Errorf("%s\tWant:%v\tHave:%v", testCase.name, testCase.want, err)
+		}
+	}
+}
+
+func TestSubscriptionMigration(t *testing.T) {
+	store.Connect()
+	defer store.Close()
+
+	// Older databases hold the bare join table created by the many2many association
+	store.Database.DropTableIfExists("subscriptions")
+	store.Database.Exec("CREATE TABLE subscriptions (user_id integer, podcast_id integer, PRIMARY KEY (user_id, podcast_id))")
+	store.Database.Exec("INSERT INTO subscriptions (user_id, podcast_id) VALUES (1, 1)")
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Failed to migrate DB:%v", err)
+	}
+	var subscription Subscription
+	if err := store.Database.Where("user_id = 1 AND podcast_id = 1").First(&subscription).Error; err != nil {
+		t.Fatalf("Failed to get migrated subscription:%v", err)
+	}
+	if subscription.SubscriptionSettings != DefaultSubscriptionSettings() {
+		t.Errorf("Settings Want:%+v\tHave:%+v", DefaultSubscriptionSettings(), subscription.SubscriptionSettings)
+	}
+}
@@ -0,0 +1,34 @@
+package podcastmg
+
+// SubscriptionTotals summarises the episodes of a subscribed podcast, durations are in seconds.
+// Sizes count the first enclosure of each item since further enclosures are alternate formats of the same episode
+type SubscriptionTotals struct {
+	PodcastID        uint   `json:"podcast_id"`
+	Title            string `json:"title"`
+	URL              string `json:"url"`
+	Episodes         int    `json:"episodes"`
+	Unplayed         int    `json:"unplayed"`
+	Duration         int64  `json:"duration"`
+	UnplayedDuration int64  `json:"unplayed_duration"`
+	UnplayedSize     int64  `json:"unplayed_size"`
+}
+
+const totalsSelect = "podcasts.id AS podcast_id, podcasts.title AS title, podcasts.url AS url, " +
+	"count(podcast_items.id) AS episodes, " +
+	"coalesce(sum(CASE WHEN NOT podcast_items.played THEN 1 ELSE 0 END), 0) AS unplayed, " +
+	"coalesce(sum(podcast_items.duration), 0) AS duration, " +
+	"coalesce(sum(CASE WHEN NOT podcast_items.played THEN podcast_items.duration ELSE 0 END), 0) AS unplayed_duration, " +
+	"coalesce(sum(CASE WHEN NOT podcast_items.played THEN podcast_items.media_size ELSE 0 END), 0) AS unplayed_size"
+
+// GetSubscriptionTotals returns the episode totals of each of the user's subscriptions
+func (dbStore *DBStore) GetSubscriptionTotals(userEmail string) ([]SubscriptionTotals, error) {
+	totals := []SubscriptionTotals{}
+	err := dbStore.Database.Table("podcasts").Select(totalsSelect).
+		Joins("LEFT JOIN podcast_items ON podcast_items.podcast_id = podcasts.id AND podcast_items.deleted_at IS NULL").
+		Where("podcasts.deleted_at IS NULL").Where(subscribedSQL, userEmail).
+		Group("podcasts.id, podcasts.title, podcasts.url").Order("podcasts.id").Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
@@ -0,0 +1,45 @@
+package podcastmg
+
+import (
+	"testing"
+)
+
+func TestSubscriptionTotals(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	user := User{UserEmail: "totals@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Long Cast", URL: "longcast.test/xml", PodcastItems: []PodcastItem{
+			{Title: "One", Duration: 3600, MediaSize: 1000, Played: true},
+			{Title: "Two", Duration: 1800, MediaSize: 500},
+			{Title: "Three", Duration: 600, MediaSize: 200},
+		}},
+		{Title: "Empty Cast", URL: "emptycast.test/xml"},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	totals, err := store.GetSubscriptionTotals("totals@test.com")
+	if err != nil {
+		t.Fatalf("Failed to get totals:%v", err)
+	}
+	want := []SubscriptionTotals{
+		{Title: "Long Cast", URL: "longcast.test/xml", Episodes: 3, Unplayed: 2, Duration: 6000, UnplayedDuration: 2400, UnplayedSize: 700},
+		{Title: "Empty Cast", URL: "emptycast.test/xml"},
+	}
+	if len(totals) != len(want) {
+		t.Fatalf("Totals Want:%d\tHave:%d", len(want), len(totals))
+	}
+	for i := range want {
+		want[i].PodcastID = totals[i].PodcastID
+		if totals[i] != want[i] {
+			t.Errorf("Want:%+v\tHave:%+v", want[i], totals[i])
+		}
+	}
+
+	if totals, err = store.GetSubscriptionTotals("nobody@test.com"); err != nil || len(totals) != 0 {
+		t.Errorf("Unexpected totals for unknown user:%v %v", totals, err)
+	}
+}
@@ -0,0 +1,305 @@
+package podcastmg
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"net"
+	"net/url"
+	"time"
+)
+
+const (
+	// EventNewEpisodes is the webhook event sent when new episodes of a subscription are found
+	EventNewEpisodes = "episodes.new"
+
+	// DeliveryPending marks a webhook delivery which is waiting for its next attempt
+	DeliveryPending = "pending"
+
+	// DeliveryDelivered marks a webhook delivery which was accepted by the receiver
+	DeliveryDelivered = "delivered"
+
+	// DeliveryDead marks a webhook delivery which failed all its attempts
+	DeliveryDead = "dead"
+
+	// MaxWebhooks is the largest number of webhooks a user may register
+	MaxWebhooks = 10
+)
+
+var (
+	// ErrInvalidWebhook indicates a webhook url which is not an absolute http or https url
+	ErrInvalidWebhook = errors.New("Webhook url must be an absolute http or https url")
+
+	// ErrWebhookAddress indicates a webhook url whose host does not resolve or resolves to an address which is not
+	// public, such as a loopback, private, link-local or cloud metadata address
+	ErrWebhookAddress = errors.New("Webhook url must resolve to public addresses only")
+
+	// ErrTooManyWebhooks indicates that the user already has MaxWebhooks webhooks
+	ErrTooManyWebhooks = errors.New("Too many webhooks")
+
+	// ErrWebhookNotFound indicates a webhook or delivery which does not exist or belongs to another user
+	ErrWebhookNotFound = errors.New("Webhook not found")
+)
+
+// Webhook is a url which receives the events of the user's subscriptions. Payloads are signed with the secret
+type Webhook struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	URL       string    `gorm:"not null" json:"url"`
+	Secret    string    `gorm:"not null" json:"secret,omitempty"`
+}
+
+// WebhookDelivery is an event in the webhook outbox. It is kept after the last attempt as the delivery log
+type WebhookDelivery struct {
+	ID          uint       `gorm:"primary_key" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"-"`
+	WebhookID   uint       `gorm:"not null;index" json:"webhook_id"`
+	Event       string     `gorm:"not null" json:"event"`
+	Payload     string     `gorm:"type:text;not null" json:"payload"`
+	Status      string     `gorm:"not null;index" json:"status"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttempt time.Time  `gorm:"index" json:"next_attempt"`
+	StatusCode  int        `json:"status_code,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// DueDelivery is a claimed webhook delivery along with the webhook it is sent to
+type DueDelivery struct {
+	WebhookDelivery
+	WebhookURL    string
+	WebhookSecret string
+}
+
+// NewEpisodesPayload is the payload of the EventNewEpisodes webhook event
+type NewEpisodesPayload struct {
+	Event    string           `json:"event"`
+	Podcast  WebhookPodcast   `json:"podcast"`
+	Episodes []WebhookEpisode `json:"episodes"`
+}
+
+// WebhookPodcast is the podcast of a webhook payload
+type WebhookPodcast struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// WebhookEpisode is an episode of a webhook payload
+type WebhookEpisode struct {
+	ID        uint       `json:"id"`
+	Title     string     `json:"title"`
+	MediaURL  string     `json:"media_url"`
+	Duration  int64      `json:"duration,omitempty"`
+	Published *time.Time `json:"published,omitempty"`
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not routed on the internet
+var sharedAddressSpace = net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// PublicAddress reports whether webhook deliveries may be sent to the address. Loopback, private, link-local
+// (which holds the cloud metadata endpoints), shared, multicast and unspecified addresses are refused
+func PublicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// checkWebhookHost returns ErrWebhookAddress unless all the addresses of the host are public
+func checkWebhookHost(host string) error {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil || len(ips) == 0 {
+			return ErrWebhookAddress
+		}
+	}
+	for _, ip := range ips {
+		if !PublicAddress(ip) {
+			return ErrWebhookAddress
+		}
+	}
+	return nil
+}
+
+// CreateWebhook registers a webhook for the user, a secret is generated if none is set. The host of the url has to
+// resolve to public addresses, the dispatcher checks the address again on every delivery
+func (dbStore *DBStore) CreateWebhook(userEmail string, webhook *Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhook
+	}
+	if err = checkWebhookHost(u.Hostname()); err != nil {
+		return err
+	}
+	userID, err := dbStore.userID(userEmail)
+	if err != nil {
+		return err
+	}
+	var count int
+	if err = dbStore.Database.Model(&Webhook{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= MaxWebhooks {
+		return ErrTooManyWebhooks
+	}
+	if webhook.Secret == "" {
+		if webhook.Secret, err = newSecret(); err != nil {
+			return err
+		}
+	}
+	webhook.ID, webhook.UserID = 0, userID
+	return dbStore.Database.Create(webhook).Error
+}
+
+// GetWebhooks returns the user's webhooks
+func (dbStore *DBStore) GetWebhooks(userEmail string) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := dbStore.Database.Select("webhooks.*").Joins("JOIN users ON users.id = webhooks.user_id").
+		Where("users.user_email = ?", userEmail).Order("webhooks.id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// getWebhook returns one of the user's webhooks
+func (dbStore *DBStore) getWebhook(userEmail string, webhookID uint) (Webhook, error) {
+	var webhook Webhook
+	err := dbStore.Database.Select("webhooks.*").Joins("JOIN users ON users.id = webhooks.user_id").
+		Where("users.user_email = ? AND webhooks.id = ?", userEmail, webhookID).First(&webhook).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return webhook, ErrWebhookNotFound
+	}
+	return webhook, err
+}
+
+// DeleteWebhook removes one of the user's webhooks along with its deliveries
+func (dbStore *DBStore) DeleteWebhook(userEmail string, webhookID uint) error {
+	webhook, err := dbStore.getWebhook(userEmail, webhookID)
+	if err != nil {
+		return err
+	}
+	return dbStore.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&webhook).Error
+	})
+}
+
+// GetWebhookDeliveries returns the latest deliveries of one of the user's webhooks, newest first
+func (dbStore *DBStore) GetWebhookDeliveries(userEmail string, webhookID uint, limit int) ([]WebhookDelivery, error) {
+	webhook, err := dbStore.getWebhook(userEmail, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []WebhookDelivery{}
+	err = dbStore.Database.Where("webhook_id = ?", webhook.ID).Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// RetryWebhookDelivery schedules a delivery of one of the user's webhooks for another round of attempts
+func (dbStore *DBStore) RetryWebhookDelivery(userEmail string, deliveryID uint) error {
+	var delivery WebhookDelivery
+	err := dbStore.Database.Select("webhook_deliveries.*").
+		Joins("JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id").
+		Joins("JOIN users ON users.id = webhooks.user_id").
+		Where("users.user_email = ? AND webhook_deliveries.id = ?", userEmail, deliveryID).First(&delivery).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return dbStore.Database.Model(&delivery).Updates(map[string]interface{}{
+		"status":       DeliveryPending,
+		"attempts":     0,
+		"next_attempt": time.Now(),
+	}).Error
+}
+
+// enqueueWebhookEvent adds a delivery of the event to the outbox of each of the user's webhooks
+func enqueueWebhookEvent(tx *gorm.DB, userID uint, event string, payload interface{}) error {
+	var webhooks []Webhook
+	if err := tx.Where("user_id = ?", userID).Find(&webhooks).Error; err != nil || len(webhooks) == 0 {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		delivery := WebhookDelivery{
+			WebhookID:   webhook.ID,
+			Event:       event,
+			Payload:     string(data),
+			Status:      DeliveryPending,
+			NextAttempt: time.Now(),
+		}
+		if err := tx.Create(&delivery).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueNewEpisodes adds an EventNewEpisodes delivery for the new items of the podcast to the user's webhooks
+func enqueueNewEpisodes(tx *gorm.DB, userID uint, podcast Podcast, newItems []PodcastItem) error {
+	return enqueueWebhookEvent(tx, userID, EventNewEpisodes, newEpisodesPayload(podcast, newItems))
+}
+
+// newEpisodesPayload returns the EventNewEpisodes payload for the new items of the podcast
+func newEpisodesPayload(podcast Podcast, newItems []PodcastItem) NewEpisodesPayload {
+	payload := NewEpisodesPayload{
+		Event:   EventNewEpisodes,
+		Podcast: WebhookPodcast{Title: podcast.Title, URL: podcast.URL},
+	}
+	for _, item := range newItems {
+		payload.Episodes = append(payload.Episodes, WebhookEpisode{
+			ID:        item.ID,
+			Title:     item.Title,
+			MediaURL:  item.MediaURL,
+			Duration:  item.Duration,
+			Published: item.Published,
+		})
+	}
+	return payload
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries which are due and pushes their next attempt back
+// by lease, so that other dispatchers do not pick them up while they are being sent
+func (dbStore *DBStore) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]DueDelivery, error) {
+	var due []DueDelivery
+	err := dbStore.Database.Table("webhook_deliveries").
+		Select("webhook_deliveries.*, webhooks.url AS webhook_url, webhooks.secret AS webhook_secret").
+		Joins("JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id").
+		Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt <= ?", DeliveryPending, now).
+		Order("webhook_deliveries.next_attempt, webhook_deliveries.id").Limit(limit).Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+	claimed := []DueDelivery{}
+	for _, delivery := range due {
+		claim := dbStore.Database.Model(&WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt <= ?", delivery.ID, DeliveryPending, now).
+			UpdateColumn("next_attempt", now.Add(lease))
+		if claim.Error != nil {
+			return claimed, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			claimed = append(claimed, delivery)
+		}
+	}
+	return claimed, nil
+}
+
+// SaveWebhookDelivery records the outcome of an attempt of the delivery
+func (dbStore *DBStore) SaveWebhookDelivery(delivery *WebhookDelivery) error {
+	return dbStore.Database.Model(delivery).Updates(map[string]interface{}{
+		"status":       delivery.Status,
+		"attempts":     delivery.Attempts,
+		"next_attempt": delivery.NextAttempt,
+		"status_code":  delivery.StatusCode,
+		"last_error":   delivery.LastError,
+		"delivered_at": delivery.DeliveredAt,
+	}).Error
+}
@@ -0,0 +1,303 @@
+package podcastmg
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// HubPending marks a hub subscription which was requested and waits for the hub to verify it
+	HubPending = "pending"
+
+	// HubVerified marks a hub subscription which the hub verified, it pushes updates until the lease expires
+	HubVerified = "verified"
+
+	// HubDenied marks a hub subscription which the hub refused
+	HubDenied = "denied"
+
+	// HubUnsubscribing marks a hub subscription of a topic without subscribers, which is being cancelled
+	HubUnsubscribing = "unsubscribing"
+
+	// HubModeSubscribe is the hub.mode of subscribe requests and their verification
+	HubModeSubscribe = "subscribe"
+
+	// HubModeUnsubscribe is the hub.mode of unsubscribe requests and their verification
+	HubModeUnsubscribe = "unsubscribe"
+
+	// HubModeDenied is the hub.mode of the notification that the hub refused a subscription
+	HubModeDenied = "denied"
+)
+
+var (
+	// ErrHubSubscriptionNotFound indicates a hub callback for a subscription or topic which is not wanted
+	ErrHubSubscriptionNotFound = errors.New("Hub subscription not found")
+
+	// ErrInvalidHubIntent indicates a hub callback with an unknown hub.mode
+	ErrInvalidHubIntent = errors.New("Invalid hub.mode")
+
+	// ErrInvalidHubContent indicates pushed content which is not a feed
+	ErrInvalidHubContent = errors.New("Pushed content is not a feed")
+)
+
+// HubSubscription is the WebSub subscription to a hub for a feed topic, shared by all subscribers of the feed.
+// Secret signs the content pushed by the hub
+type HubSubscription struct {
+	ID           uint       `gorm:"primary_key" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"-"`
+	Topic        string     `gorm:"not null;unique_index" json:"topic"`
+	Hub          string     `gorm:"not null" json:"hub"`
+	Secret       string     `gorm:"not null" json:"-"`
+	State        string     `gorm:"not null" json:"state"`
+	LeaseExpires *time.Time `json:"lease_expires,omitempty"`
+	NextRenewal  time.Time  `gorm:"index" json:"next_renewal"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// DueHubSubscription is a hub subscription which is due for a request to the hub, along with the number of
+// subscribed podcasts of its topic. A topic without podcasts is unsubscribed from the hub
+type DueHubSubscription struct {
+	HubSubscription
+	Podcasts int
+}
+
+// HubIntent is the verification of a subscribe or unsubscribe request, or the notice of a denied subscription,
+// sent by a hub to the callback
+type HubIntent struct {
+	Mode         string
+	Topic        string
+	LeaseSeconds int
+	Reason       string
+}
+
+// hubAtomTranslator keeps the hub links of Atom feeds as atom link extensions, the way RSS feeds carry them
+type hubAtomTranslator struct{}
+
+func (hubAtomTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := (&gofeed.DefaultAtomTranslator{}).Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+	atomFeed, ok := feed.(*atom.Feed)
+	if !ok {
+		return result, nil
+	}
+	for _, link := range atomFeed.Links {
+		if !hasRel(link.Rel, "hub") {
+			continue
+		}
+		if result.Extensions == nil {
+			result.Extensions = ext.Extensions{}
+		}
+		if result.Extensions["atom"] == nil {
+			result.Extensions["atom"] = map[string][]ext.Extension{}
+		}
+		result.Extensions["atom"]["link"] = append(result.Extensions["atom"]["link"], ext.Extension{
+			Name:  "link",
+			Attrs: map[string]string{"rel": "hub", "href": link.Href},
+		})
+	}
+	return result, nil
+}
+
+func hasRel(rels, rel string) bool {
+	for _, r := range strings.Fields(rels) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// feedHub returns the first hub advertised by the feed's rel="hub" links and the topic the hub publishes the feed
+// under, which is the feed's rel="self" link or else its url. Both are empty if the feed advertises no hub
+func feedHub(feed *gofeed.Feed, feedURL string) (hub, topic string) {
+	for _, key := range []string{"atom", "atom10", "atom03"} {
+		for _, link := range feed.Extensions[key]["link"] {
+			href := strings.TrimSpace(link.Attrs["href"])
+			if hub == "" && hasRel(link.Attrs["rel"], "hub") {
+				hub = href
+			}
+			if topic == "" && hasRel(link.Attrs["rel"], "self") {
+				topic = href
+			}
+		}
+	}
+	if hub == "" {
+		return "", ""
+	}
+	if topic == "" {
+		topic = feed.FeedLink
+	}
+	if topic == "" {
+		topic = feedURL
+	}
+	return hub, topic
+}
+
+// syncHubSubscriptions adds a pending hub subscription for every subscribed topic which has none
+func (dbStore *DBStore) syncHubSubscriptions(now time.Time) error {
+	var topics []struct {
+		Hub   string
+		Topic string
+	}
+	err := dbStore.Database.Table("podcasts").Select("DISTINCT podcasts.hub, podcasts.topic").
+		Joins("JOIN subscriptions ON subscriptions.podcast_id = podcasts.id").
+		Where("podcasts.deleted_at IS NULL AND podcasts.hub <> '' AND podcasts.topic <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM hub_subscriptions WHERE hub_subscriptions.topic = podcasts.topic)").
+		Scan(&topics).Error
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, topic := range topics {
+		if seen[topic.Topic] {
+			continue
+		}
+		seen[topic.Topic] = true
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+		subscription := HubSubscription{Topic: topic.Topic, Hub: topic.Hub, Secret: secret, State: HubPending, NextRenewal: now}
+		if err = dbStore.Database.Create(&subscription).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimHubRenewals returns up to limit hub subscriptions which are due for a subscribe or unsubscribe request,
+// new topics of subscribed podcasts included. Each is pushed back by retry, so that it is requested again
+// if the hub never verifies the request
+func (dbStore *DBStore) ClaimHubRenewals(now time.Time, retry time.Duration, limit int) ([]DueHubSubscription, error) {
+	if err := dbStore.syncHubSubscriptions(now); err != nil {
+		return nil, err
+	}
+	var due []DueHubSubscription
+	err := dbStore.Database.Table("hub_subscriptions").
+		Select("hub_subscriptions.*, (SELECT COUNT(*) FROM podcasts JOIN subscriptions ON subscriptions.podcast_id = podcasts.id"+
+			" WHERE podcasts.topic = hub_subscriptions.topic AND podcasts.hub <> '' AND podcasts.deleted_at IS NULL) AS podcasts").
+		Where("hub_subscriptions.next_renewal <= ?", now).
+		Order("hub_subscriptions.next_renewal, hub_subscriptions.id").Limit(limit).Find(&due).Error
+	if err != nil {
+		return nil, err
+	}
+	claimed := []DueHubSubscription{}
+	for _, subscription := range due {
+		claim := dbStore.Database.Model(&HubSubscription{}).
+			Where("id = ? AND next_renewal <= ?", subscription.ID, now).
+			UpdateColumn("next_renewal", now.Add(retry))
+		if claim.Error != nil {
+			return claimed, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			subscription.NextRenewal = now.Add(retry)
+			claimed = append(claimed, subscription)
+		}
+	}
+	return claimed, nil
+}
+
+// SaveHubSubscription records the state and outcome of the latest request to the hub
+func (dbStore *DBStore) SaveHubSubscription(subscription *HubSubscription) error {
+	return dbStore.Database.Model(subscription).Updates(map[string]interface{}{
+		"state":        subscription.State,
+		"next_renewal": subscription.NextRenewal,
+		"last_error":   subscription.LastError,
+	}).Error
+}
+
+// GetHubSubscription returns the hub subscription with the given id
+func (dbStore *DBStore) GetHubSubscription(subscriptionID uint) (HubSubscription, error) {
+	var subscription HubSubscription
+	err := dbStore.Database.Where("id = ?", subscriptionID).First(&subscription).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return subscription, ErrHubSubscriptionNotFound
+	}
+	return subscription, err
+}
+
+// VerifyHubIntent confirms a subscribe or unsubscribe request of the hub subscription if it matches the
+// subscription's topic and state, or records that the hub denied the subscription. A verified subscription
+// is renewed when 90% of its lease has passed, a denied one is requested again after a day
+func (dbStore *DBStore) VerifyHubIntent(subscriptionID uint, intent HubIntent, now time.Time) error {
+	subscription, err := dbStore.GetHubSubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+	if intent.Topic != subscription.Topic {
+		return ErrHubSubscriptionNotFound
+	}
+	switch intent.Mode {
+	case HubModeSubscribe:
+		if subscription.State != HubPending && subscription.State != HubVerified {
+			return ErrHubSubscriptionNotFound
+		}
+		updates := map[string]interface{}{"state": HubVerified, "last_error": "", "lease_expires": gorm.Expr("NULL")}
+		updates["next_renewal"] = now.Add(24 * time.Hour)
+		if intent.LeaseSeconds > 0 {
+			lease := time.Duration(intent.LeaseSeconds) * time.Second
+			updates["lease_expires"] = now.Add(lease)
+			updates["next_renewal"] = now.Add(lease * 9 / 10)
+		}
+		return dbStore.Database.Model(&subscription).Updates(updates).Error
+	case HubModeUnsubscribe:
+		if subscription.State != HubUnsubscribing {
+			return ErrHubSubscriptionNotFound
+		}
+		return dbStore.Database.Delete(&subscription).Error
+	case HubModeDenied:
+		return dbStore.Database.Model(&subscription).Updates(map[string]interface{}{
+			"state":         HubDenied,
+			"last_error":    intent.Reason,
+			"lease_expires": gorm.Expr("NULL"),
+			"next_renewal":  now.Add(24 * time.Hour),
+		}).Error
+	}
+	return ErrInvalidHubIntent
+}
+
+// IngestHubContent adds the new items of the feed content pushed for a verified hub subscription to every
+// subscribed podcast of its topic, and returns the number of items added. New items are handled like those
+// found by UpdatePodcastBySubscription
+func (dbStore *DBStore) IngestHubContent(subscriptionID uint, content io.Reader) (int, error) {
+	subscription, err := dbStore.GetHubSubscription(subscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	if subscription.State != HubVerified {
+		return 0, ErrHubSubscriptionNotFound
+	}
+	feed, err := parseFeedContent(content)
+	if err != nil {
+		return 0, ErrInvalidHubContent
+	}
+	var subscribed []Subscription
+	err = dbStore.Database.Model(&Podcast{}).Select("subscriptions.user_id, subscriptions.podcast_id").
+		Joins("JOIN subscriptions ON subscriptions.podcast_id = podcasts.id").
+		Where("podcasts.topic = ? AND podcasts.hub <> ''", subscription.Topic).Scan(&subscribed).Error
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, s := range subscribed {
+		podcast, err := dbStore.GetPodcastByID(s.PodcastID)
+		if err != nil {
+			return added, err
+		}
+		known := len(podcast.PodcastItems)
+		podcast.PodcastItems = append(podcast.PodcastItems, newFeedItems(feed, podcast.PodcastItems)...)
+		if err = dbStore.savePodcastUpdate(s.UserID, &podcast, known); err != nil {
+			return added, err
+		}
+		added += len(podcast.PodcastItems) - known
+	}
+	return added, nil
+}
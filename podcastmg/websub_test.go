@@ -0,0 +1,156 @@
+package podcastmg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const hubRSS = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+	<title>Hub Cast</title>
+	<atom:link rel="self" href="https://hubcast.test/feed"/>
+	<atom:link rel="hub" href="https://hub.test/"/>
+	%s
+</channel>
+</rss>`
+
+const hubItem = `<item><title>%s</title><pubDate>%s</pubDate><enclosure url="https://hubcast.test/%s.mp3"/></item>`
+
+func TestFeedHub(t *testing.T) {
+	type hubTestCase struct {
+		name      string
+		feed      string
+		wantHub   string
+		wantTopic string
+	}
+	testCases := []hubTestCase{
+		{"RSS", fmt.Sprintf(hubRSS, ""), "https://hub.test/", "https://hubcast.test/feed"},
+		{"Atom", `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Atom Cast</title>` +
+			`<link rel="hub" href="https://atomhub.test/"/><link rel="self" href="https://atomcast.test/atom"/></feed>`,
+			"https://atomhub.test/", "https://atomcast.test/atom"},
+		{"RSS Without Self", `<?xml version="1.0"?><rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>` +
+			`<title>Cast</title><atom:link rel="hub" href="https://hub.test/"/></channel></rss>`, "https://hub.test/", "https://cast.test/rss"},
+		{"No Hub", `<?xml version="1.0"?><rss version="2.0"><channel><title>Cast</title></channel></rss>`, "", ""},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			feed, err := parseFeedContent(strings.NewReader(test.feed))
+			if err != nil {
+				t.Fatalf("Failed to parse feed:%v", err)
+			}
+			if hub, topic := feedHub(feed, "https://cast.test/rss"); hub != test.wantHub || topic != test.wantTopic {
+				t.Errorf("Want:%s %s\tHave:%s %s", test.wantHub, test.wantTopic, hub, topic)
+			}
+		})
+	}
+}
+
+func TestHubSubscription(t *testing.T) {
+	store.Connect()
+	store.Migrate()
+	defer store.Close()
+
+	topic := "https://hubcast.test/feed"
+	published := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	user := User{UserEmail: "websub@test.com", Password: "x", Podcasts: []Podcast{
+		{Title: "Hub Cast", URL: topic, Hub: "https://hub.test/", Topic: topic, PodcastItems: []PodcastItem{
+			{Title: "One", MediaURL: "https://hubcast.test/one.mp3", Published: &published},
+		}},
+	}}
+	if err := store.CreateUser(&user); err != nil {
+		t.Fatalf("Failed to create user:%v", err)
+	}
+
+	now := time.Now()
+	due, err := store.ClaimHubRenewals(now, time.Hour, 10)
+	if err != nil || len(due) != 1 || due[0].Topic != topic || due[0].State != HubPending || due[0].Podcasts != 1 || due[0].Secret == "" {
+		t.Fatalf("Unexpected due hub subscriptions:%+v %v", due, err)
+	}
+	if again, err := store.ClaimHubRenewals(now, time.Hour, 10); err != nil || len(again) != 0 {
+		t.Errorf("Hub subscription was claimed twice:%+v %v", again, err)
+	}
+	id := due[0].ID
+
+	// Content is only accepted once the hub verified the subscription
+	content := fmt.Sprintf(hubRSS, fmt.Sprintf(hubItem, "One", "Mon, 01 Jan 2018 10:00:00 GMT", "one")+
+		fmt.Sprintf(hubItem, "Two", "Mon, 08 Jan 2018 10:00:00 GMT", "two"))
+	if _, err = store.IngestHubContent(id, strings.NewReader(content)); err != ErrHubSubscriptionNotFound {
+		t.Errorf("Error Want:%v\tHave:%v", ErrHubSubscriptionNotFound, err)
+	}
+	type intentTestCase struct {
+		name    string
+		intent  HubIntent
+		wantErr error
+	}
+	testCases := []intentTestCase{
+		{"Other Topic", HubIntent{Mode: HubModeSubscribe, Topic: "https://other.test/feed", LeaseSeconds: 3600}, ErrHubSubscriptionNotFound},
+		{"Unrequested Unsubscribe", HubIntent{Mode: HubModeUnsubscribe, Topic: topic}, ErrHubSubscriptionNotFound},
+		{"Unknown Mode", HubIntent{Mode: "publish", Topic: topic}, ErrInvalidHubIntent},
+		{"Subscribe", HubIntent{Mode: HubModeSubscribe, Topic: topic, LeaseSeconds: 3600}, nil},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := store.VerifyHubIntent(id, test.intent, now); err != test.wantErr {
+				t.Errorf("Error Want:%v\tHave:%v", test.wantErr, err)
+			}
+		})
+	}
+	subscription, err := store.GetHubSubscription(id)
+	if err != nil || subscription.State != HubVerified || !subscription.LeaseExpires.Equal(now.Add(time.Hour)) ||
+		!subscription.NextRenewal.Equal(now.Add(54*time.Minute)) {
+		t.Fatalf("Unexpected verified subscription:%+v %v", subscription, err)
+	}
+
+	if _, err = store.IngestHubContent(id, strings.NewReader("not a feed")); err != ErrInvalidHubContent {
+		t.Errorf("Error Want:%v\tHave:%v", ErrInvalidHubContent, err)
+	}
+	added, err := store.IngestHubContent(id, strings.NewReader(content))
+	if err != nil || added != 1 {
+		t.Fatalf("Added Want:1\tHave:%d %v", added, err)
+	}
+	podcast, err := store.GetPodcastByID(user.Podcasts[0].ID)
+	if err != nil || len(podcast.PodcastItems) != 2 || podcast.PodcastItems[1].Title != "Two" {
+		t.Errorf("Unexpected podcast after push:%+v %v", podcast, err)
+	}
+	var changes int
+	store.Database.Model(&Change{}).Where("user_id = ? AND kind = ?", user.ID, ChangeNewEpisode).Count(&changes)
+	if changes != 1 {
+		t.Errorf("New episode changes Want:1\tHave:%d", changes)
+	}
+	if added, err = store.IngestHubContent(id, strings.NewReader(content)); err != nil || added != 0 {
+		t.Errorf("Added Want:0\tHave:%d %v", added, err)
+	}
+
+	// Items without a publication date are taken as the newest
+	undated := fmt.Sprintf(hubRSS, `<item><title>Three</title><enclosure url="https://hubcast.test/three.mp3"/></item>`+
+		fmt.Sprintf(hubItem, "One", "Mon, 01 Jan 2018 10:00:00 GMT", "one")+fmt.Sprintf(hubItem, "Two", "Mon, 08 Jan 2018 10:00:00 GMT", "two"))
+	if added, err = store.IngestHubContent(id, strings.NewReader(undated)); err != nil || added != 1 {
+		t.Fatalf("Added Want:1\tHave:%d %v", added, err)
+	}
+	podcast, err = store.GetPodcastByID(podcast.ID)
+	if err != nil || len(podcast.PodcastItems) != 3 || podcast.PodcastItems[2].Title != "Three" || podcast.PodcastItems[2].Published != nil {
+		t.Errorf("Unexpected podcast after undated push:%+v %v", podcast, err)
+	}
+
+	// A topic without subscribers is unsubscribed and forgotten once the hub verifies it
+	if err = store.Database.Where("podcast_id = ?", podcast.ID).Delete(&Subscription{}).Error; err != nil {
+		t.Fatalf("Failed to remove subscription:%v", err)
+	}
+	due, err = store.ClaimHubRenewals(subscription.NextRenewal, time.Hour, 10)
+	if err != nil || len(due) != 1 || due[0].Podcasts != 0 {
+		t.Fatalf("Unexpected due hub subscriptions:%+v %v", due, err)
+	}
+	due[0].State = HubUnsubscribing
+	if err = store.SaveHubSubscription(&due[0].HubSubscription); err != nil {
+		t.Fatalf("Failed to save hub subscription:%v", err)
+	}
+	if err = store.VerifyHubIntent(id, HubIntent{Mode: HubModeUnsubscribe, Topic: topic}, now); err != nil {
+		t.Fatalf("Failed to verify unsubscribe:%v", err)
+	}
+	if _, err = store.GetHubSubscription(id); err != ErrHubSubscriptionNotFound {
+		t.Errorf("Error Want:%v\tHave:%v", ErrHubSubscriptionNotFound, err)
+	}
+}
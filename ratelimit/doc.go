@@ -0,0 +1,2 @@
+// Package ratelimit throttles attempts by key and locks keys out after repeated failures, keeping its state in a pluggable store.
+package ratelimit
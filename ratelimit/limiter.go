@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// State is what a Store keeps for a key: the attempts within the current window and the failures since the last
+// success, along with the lockout they caused
+type State struct {
+	WindowStart time.Time `json:"window_start"`
+	Attempts    int       `json:"attempts"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Store keeps the State of keys. A store backed by a shared database lets several replicas of the service limit
+// attempts together
+type Store interface {
+	// Update applies fn to the state of the key and saves the result in one step, so that concurrent updates of the
+	// key are not lost. Keys without a state are given the zero State. States which are not updated for ttl may be
+	// dropped
+	Update(key string, ttl time.Duration, fn func(state *State)) (State, error)
+}
+
+// memoryEntry is a state kept by a MemoryStore
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// MemoryStore is a Store for the limiters of a single process
+type MemoryStore struct {
+	mtx       sync.Mutex
+	states    map[string]memoryEntry
+	lastSweep time.Time
+}
+
+// sweepInterval is how often a MemoryStore drops expired states
+const sweepInterval = time.Minute
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[string]memoryEntry{}}
+}
+
+// Update applies fn to the state of the key, expired states are dropped along the way
+func (s *MemoryStore) Update(key string, ttl time.Duration, fn func(state *State)) (State, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, entry := range s.states {
+			if now.After(entry.expires) {
+				delete(s.states, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	entry, ok := s.states[key]
+	if !ok || now.After(entry.expires) {
+		entry = memoryEntry{}
+	}
+	fn(&entry.state)
+	entry.expires = now.Add(ttl)
+	s.states[key] = entry
+	return entry.state, nil
+}
+
+// Limiter allows a number of attempts per key within a window and locks a key out after repeated failures. The
+// lockout doubles with every further failure until an attempt succeeds
+type Limiter struct {
+	store      Store
+	attempts   int
+	window     time.Duration
+	threshold  int
+	lockout    time.Duration
+	maxLockout time.Duration
+	now        func() time.Time
+}
+
+// Option configures a Limiter
+type Option func(*Limiter)
+
+// Rate sets the number of attempts allowed for a key within the window
+func Rate(attempts int, window time.Duration) Option {
+	return func(l *Limiter) {
+		l.attempts = attempts
+		l.window = window
+	}
+}
+
+// Lockout sets the number of failures after which a key is locked out and how long, the lockout doubles with
+// every further failure up to max
+func Lockout(threshold int, initial, max time.Duration) Option {
+	return func(l *Limiter) {
+		l.threshold = threshold
+		l.lockout = initial
+		l.maxLockout = max
+	}
+}
+
+// NewLimiter returns a Limiter keeping its state in the store
+func NewLimiter(store Store, options ...Option) *Limiter {
+	l := Limiter{
+		store:      store,
+		attempts:   10,
+		window:     time.Minute,
+		threshold:  5,
+		lockout:    time.Minute,
+		maxLockout: time.Hour,
+		now:        time.Now,
+	}
+	for _, option := range options {
+		option(&l)
+	}
+	return &l
+}
+
+// ttl is how long a state is needed after its last update
+func (l *Limiter) ttl() time.Duration {
+	return l.window + l.maxLockout
+}
+
+// Allow counts an attempt for each of the keys. It returns how long to wait before trying again if any of them is
+// locked out or out of attempts, zero if the attempt may go ahead
+func (l *Limiter) Allow(keys ...string) (time.Duration, error) {
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		var keyWait time.Duration
+		_, err := l.store.Update(key, l.ttl(), func(state *State) {
+			if now.Before(state.LockedUntil) {
+				keyWait = state.LockedUntil.Sub(now)
+				return
+			}
+			if !now.Before(state.WindowStart.Add(l.window)) {
+				state.WindowStart, state.Attempts = now, 0
+			}
+			state.Attempts++
+			if state.Attempts > l.attempts {
+				keyWait = state.WindowStart.Add(l.window).Sub(now)
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+		if keyWait > wait {
+			wait = keyWait
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt for each of the keys, locking out those which reached the threshold
+func (l *Limiter) Fail(keys ...string) error {
+	now := l.now()
+	for _, key := range keys {
+		_, err := l.store.Update(key, l.ttl(), func(state *State) {
+			state.Failures++
+			if state.Failures >= l.threshold {
+				state.LockedUntil = now.Add(l.delay(state.Failures - l.threshold + 1))
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Succeed clears the failures of each of the keys, the attempts within the window still count
+func (l *Limiter) Succeed(keys ...string) error {
+	for _, key := range keys {
+		_, err := l.store.Update(key, l.ttl(), func(state *State) {
+			state.Failures = 0
+			state.LockedUntil = time.Time{}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delay returns the lockout after the given number of failures past the threshold
+func (l *Limiter) delay(failures int) time.Duration {
+	delay := l.lockout
+	for i := 1; i < failures && delay < l.maxLockout; i++ {
+		delay *= 2
+	}
+	if delay > l.maxLockout {
+		delay = l.maxLockout
+	}
+	return delay
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// testLimiter returns a limiter whose clock is moved by the returned function
+func testLimiter(options ...Option) (*Limiter, func(time.Duration)) {
+	l := NewLimiter(NewMemoryStore(), options...)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLimiterRate(t *testing.T) {
+	l, advance := testLimiter(Rate(3, time.Minute))
+	for i := 0; i < 3; i++ {
+		if wait, err := l.Allow("ip:1"); err != nil || wait != 0 {
+			t.Fatalf("Attempt %d should be allowed:%v %v", i+1, wait, err)
+		}
+	}
+	advance(20 * time.Second)
+	if wait, _ := l.Allow("ip:1"); wait != 40*time.Second {
+		t.Errorf("Wait Want:%v\tHave:%v", 40*time.Second, wait)
+	}
+	if wait, _ := l.Allow("ip:2"); wait != 0 {
+		t.Errorf("Other keys should not be limited:%v", wait)
+	}
+	advance(40 * time.Second)
+	if wait, _ := l.Allow("ip:1"); wait != 0 {
+		t.Errorf("A new window should allow attempts:%v", wait)
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	l, advance := testLimiter(Rate(100, time.Minute), Lockout(3, time.Minute, 3*time.Minute))
+
+	type lockoutTestCase struct {
+		failures int
+		wantWait time.Duration
+	}
+	testCases := []lockoutTestCase{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 3 * time.Minute},
+		{6, 3 * time.Minute},
+	}
+	for _, test := range testCases {
+		if err := l.Fail("account:a", "ip:1"); err != nil {
+			t.Fatalf("Failed to record failure:%v", err)
+		}
+		if wait, _ := l.Allow("account:a"); wait != test.wantWait {
+			t.Errorf("Wait after %d failures Want:%v\tHave:%v", test.failures, test.wantWait, wait)
+		}
+	}
+
+	// The longest wait of the keys is returned
+	if wait, _ := l.Allow("account:b", "ip:1"); wait != 3*time.Minute {
+		t.Errorf("Wait Want:%v\tHave:%v", 3*time.Minute, wait)
+	}
+	advance(3 * time.Minute)
+	if wait, _ := l.Allow("account:a"); wait != 0 {
+		t.Errorf("Lockout should be over:%v", wait)
+	}
+	if err := l.Succeed("account:a"); err != nil {
+		t.Fatalf("Failed to record success:%v", err)
+	}
+	l.Fail("account:a")
+	if wait, _ := l.Allow("account:a"); wait != 0 {
+		t.Errorf("A success should clear the failures:%v", wait)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	increment := func(state *State) { state.Attempts++ }
+	s.Update("key", time.Hour, increment)
+	if state, _ := s.Update("key", time.Hour, increment); state.Attempts != 2 {
+		t.Errorf("Attempts Want:2\tHave:%d", state.Attempts)
+	}
+	s.Update("short", time.Millisecond, increment)
+	time.Sleep(5 * time.Millisecond)
+	if state, _ := s.Update("short", time.Millisecond, increment); state.Attempts != 1 {
+		t.Errorf("Expired state should be dropped, Attempts Want:1\tHave:%d", state.Attempts)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"time"
+)
+
+// accessTokenError passes on the errors of invalid access token requests and wraps all others in a service error
+func (svc *podcastManageService) accessTokenError(err error) error {
+	switch err {
+	case podcastmg.ErrInvalidAccessTokenName, podcastmg.ErrInvalidScope, podcastmg.ErrInvalidExpiry,
+		podcastmg.ErrTooManyAccessTokens:
+		return err
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrAccessTokenNotFound.Wrap(err)
+	}
+	return ErrAccessTokenUpdate.Wrap(err)
+}
+
+// CreateAccessToken creates a personal access token for scripts of the user with the given name, scopes and
+// optional expiry. The returned token carries the token itself, it is not returned again
+func (svc *podcastManageService) CreateAccessToken(ctx context.Context, emailID string, token podcastmg.AccessToken) (podcastmg.AccessToken, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.AccessToken{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.AccessToken{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.CreateAccessToken(emailID, &token, time.Now()); err != nil {
+		return podcastmg.AccessToken{}, svc.accessTokenError(err)
+	}
+	return token, nil
+}
+
+// GetAccessTokens returns the user's access tokens without the tokens themselves
+func (svc *podcastManageService) GetAccessTokens(ctx context.Context, emailID string) ([]podcastmg.AccessToken, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	tokens, err := svc.store.GetAccessTokens(emailID)
+	if err != nil {
+		return nil, ErrUserFetch.Wrap(err)
+	}
+	return tokens, nil
+}
+
+// RevokeAccessToken deletes one of the user's access tokens, it is refused from then on
+func (svc *podcastManageService) RevokeAccessToken(ctx context.Context, emailID string, tokenID uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.DeleteAccessToken(emailID, tokenID); err != nil {
+		return svc.accessTokenError(err)
+	}
+	return nil
+}
+
+// ExchangeAccessToken returns a short-lived JWT limited to the scopes of the access token. It expires after
+// accessTokenLifetime or with the access token, whichever comes first
+func (svc *podcastManageService) ExchangeAccessToken(ctx context.Context, token string) (string, error) {
+	err := svc.store.Connect()
+	if err != nil {
+		return "", ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	now := time.Now()
+	accessToken, emailID, err := svc.store.AuthenticateAccessToken(token, now)
+	if err == podcastmg.ErrInvalidAccessToken {
+		return "", err
+	}
+	if err != nil {
+		return "", ErrUserFetch.Wrap(err)
+	}
+	expiresAt := now.Add(accessTokenLifetime)
+	if accessToken.ExpiresAt != nil && accessToken.ExpiresAt.Before(expiresAt) {
+		expiresAt = *accessToken.ExpiresAt
+	}
+	return svc.signToken(accessToken.UserID, emailID, accessToken.Scopes, expiresAt)
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/mail"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// VerifyEmailPath is the path of the links in verification emails, the token is passed in the token query parameter
+	VerifyEmailPath = "/verify"
+
+	// ResetPasswordPath is the path of the links in password reset emails, the token is passed in the token query parameter
+	ResetPasswordPath = "/password/reset"
+
+	// ChangeEmailPath is the path of the links confirming a change of email, the token is passed in the token query parameter
+	ChangeEmailPath = "/email/confirm"
+)
+
+// accountMail is the email sent with a token of its purpose
+type accountMail struct {
+	path    string
+	ttl     time.Duration
+	subject string
+	text    string
+}
+
+var accountMails = map[string]accountMail{
+	podcastmg.TokenVerifyEmail: {VerifyEmailPath, verifyEmailTTL, "Verify your email address", `Please confirm that this is your email address by opening the link below:
+
+%s
+
+The link expires in %s. If you did not register, you can ignore this email.
+`},
+	podcastmg.TokenResetPassword: {ResetPasswordPath, resetPasswordTTL, "Reset your password", `Someone asked to reset the password of your account. Open the link below to choose a new password:
+
+%s
+
+The link expires in %s. If you did not ask for it, you can ignore this email and your password stays the same.
+`},
+	podcastmg.TokenChangeEmail: {ChangeEmailPath, changeEmailTTL, "Confirm your new email address", `Someone asked to change the email of their account to this address. Open the link below to confirm the change:
+
+%s
+
+The link expires in %s. If you did not ask for it, you can ignore this email.
+`},
+}
+
+// sendAccountToken issues a token of the purpose for the user and mails the link using it. The store must be connected
+func (svc *podcastManageService) sendAccountToken(ctx context.Context, emailID, purpose string) error {
+	accountMail := accountMails[purpose]
+	token, err := svc.store.CreateAccountToken(emailID, purpose, accountMail.ttl, time.Now())
+	if err != nil {
+		return err
+	}
+	return svc.mailAccountToken(ctx, emailID, purpose, token)
+}
+
+// mailAccountToken mails the link using a token of the purpose to the address
+func (svc *podcastManageService) mailAccountToken(ctx context.Context, to, purpose, token string) error {
+	accountMail := accountMails[purpose]
+	link := strings.TrimRight(svc.baseURL, "/") + accountMail.path + "?token=" + url.QueryEscape(token)
+	return svc.mailer.Send(ctx, mail.Message{
+		To:      to,
+		Subject: accountMail.subject,
+		Text:    fmt.Sprintf(accountMail.text, link, accountMail.ttl),
+	})
+}
+
+// RequestEmailVerification mails the user a new verification link, earlier links stop working
+func (svc *podcastManageService) RequestEmailVerification(ctx context.Context, emailID string) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	if svc.mailer == nil {
+		return ErrMailDisabled
+	}
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, err := svc.store.GetUserByEmail(emailID)
+	if err != nil {
+		return ErrUserFetch.Wrap(err)
+	}
+	if user.EmailVerified {
+		return ErrEmailVerified
+	}
+	if err = svc.sendAccountToken(ctx, emailID, podcastmg.TokenVerifyEmail); err != nil {
+		return ErrMailSend.Wrap(err)
+	}
+	return nil
+}
+
+// VerifyEmail marks the email of a verification link as verified, the token stands in for the user's credentials
+func (svc *podcastManageService) VerifyEmail(ctx context.Context, token string) error {
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	err = svc.store.VerifyEmail(token, time.Now())
+	if err == podcastmg.ErrInvalidAccountToken {
+		return err
+	}
+	if err != nil {
+		return ErrAccountUpdate.Wrap(err)
+	}
+	return nil
+}
+
+// RequestPasswordReset mails a password reset link to the user. It succeeds for emails without a user as well,
+// so that it cannot be used to find out who has an account
+func (svc *podcastManageService) RequestPasswordReset(ctx context.Context, emailID string) error {
+	if svc.mailer == nil {
+		return ErrMailDisabled
+	}
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	err = svc.sendAccountToken(ctx, emailID, podcastmg.TokenResetPassword)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		svc.logger.Log("err", err)
+	}
+	return nil
+}
+
+// ResetPassword sets the password of the user a password reset link was sent to, the token stands in for the
+// user's credentials. The user's access tokens and issued tokens are revoked like on ChangePassword
+func (svc *podcastManageService) ResetPassword(ctx context.Context, token, password string) error {
+	passwordHash, err := podcastmg.HashPassword(svc.hasher, password)
+	if err == podcastmg.ErrEmptyPassword {
+		return err
+	}
+	if err != nil {
+		return ErrAccountUpdate.Wrap(err)
+	}
+
+	err = svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	err = svc.store.ResetPassword(token, passwordHash, time.Now())
+	if err == podcastmg.ErrInvalidAccountToken {
+		return err
+	}
+	if err != nil {
+		return ErrAccountUpdate.Wrap(err)
+	}
+	return nil
+}
+
+// ChangePassword sets a new password for the user once the old one matches. Outstanding verification and password
+// reset links stop working, access tokens are deleted and tokens issued before are revoked, see CheckToken
+func (svc *podcastManageService) ChangePassword(ctx context.Context, emailID, oldPassword, newPassword string) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, err := svc.store.GetUserByEmail(emailID)
+	if err != nil {
+		return ErrUserFetch.Wrap(err)
+	}
+	if err = user.ComparePassword(oldPassword); err != nil {
+		return ErrInvalidPassword.Wrap(err)
+	}
+	passwordHash, err := podcastmg.HashPassword(svc.hasher, newPassword)
+	if err == podcastmg.ErrEmptyPassword {
+		return err
+	}
+	if err == nil {
+		err = svc.store.ChangePassword(emailID, passwordHash, time.Now())
+	}
+	if err != nil {
+		return ErrAccountUpdate.Wrap(err)
+	}
+	return nil
+}
+
+// RequestEmailChange mails a link to the new email which changes the user's email to it once opened, the user's
+// password is asked for as the change hands over the account
+func (svc *podcastManageService) RequestEmailChange(ctx context.Context, emailID, password, newEmail string) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	if svc.mailer == nil {
+		return ErrMailDisabled
+	}
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, err := svc.store.GetUserByEmail(emailID)
+	if err != nil {
+		return ErrUserFetch.Wrap(err)
+	}
+	if err = user.ComparePassword(password); err != nil {
+		return ErrInvalidPassword.Wrap(err)
+	}
+	token, err := svc.store.CreateEmailChangeToken(emailID, newEmail, changeEmailTTL, time.Now())
+	if err == podcastmg.ErrInvalidEmail || err == podcastmg.ErrEmailTaken {
+		return err
+	}
+	if err != nil {
+		return ErrAccountUpdate.Wrap(err)
+	}
+	if err = svc.mailAccountToken(ctx, newEmail, podcastmg.TokenChangeEmail, token); err != nil {
+		return ErrMailSend.Wrap(err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange changes the user's email to the one an email change link was sent to, the token stands in
+// for the user's credentials. Tokens issued for the previous email no longer match the user, so they have to log
+// in again
+func (svc *podcastManageService) ConfirmEmailChange(ctx context.Context, token string) error {
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	previous, email, err := svc.store.ChangeEmail(token, time.Now())
+	if err == podcastmg.ErrInvalidAccountToken || err == podcastmg.ErrEmailTaken {
+		return err
+	}
+	if err != nil {
+		return ErrAccountUpdate.Wrap(err)
+	}
+	if svc.archiver != nil {
+		if err = svc.archiver.Move(previous, email); err != nil {
+			svc.logger.Log("err", err)
+		}
+	}
+	return nil
+}
+
+// ExportAccount returns all data kept for the user
+func (svc *podcastManageService) ExportAccount(ctx context.Context, emailID string) (podcastmg.UserExport, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.UserExport{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.UserExport{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	export, err := svc.store.ExportUser(emailID, time.Now())
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return export, ErrUserFetch.Wrap(err)
+		}
+		return export, ErrAccountExport.Wrap(err)
+	}
+	return export, nil
+}
+
+// DeleteAccount deletes the user along with all data kept for them and their archived media once the password
+// matches
+func (svc *podcastManageService) DeleteAccount(ctx context.Context, emailID, password string) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, err := svc.store.GetUserByEmail(emailID)
+	if err != nil {
+		return ErrUserFetch.Wrap(err)
+	}
+	if err = user.ComparePassword(password); err != nil {
+		return ErrInvalidPassword.Wrap(err)
+	}
+	if err = svc.store.DeleteUserByEmail(emailID); err != nil {
+		return ErrAccountDelete.Wrap(err)
+	}
+	if svc.archiver != nil {
+		if err = svc.archiver.RemoveAll(emailID); err != nil {
+			svc.logger.Log("err", err)
+		}
+	}
+	return nil
+}
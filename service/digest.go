@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"time"
+)
+
+// GetDigestSchedule returns the user's email digest preferences along with the next scheduled digest
+func (svc *podcastManageService) GetDigestSchedule(ctx context.Context, emailID string) (podcastmg.DigestSchedule, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.DigestSchedule{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.DigestSchedule{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	schedule, err := svc.store.GetDigestSchedule(emailID)
+	if err != nil {
+		return podcastmg.DigestSchedule{}, ErrUserFetch.Wrap(err)
+	}
+	return schedule, nil
+}
+
+// UpdateDigestSettings sets how often the user receives the email digest of new episodes
+func (svc *podcastManageService) UpdateDigestSettings(ctx context.Context, emailID string, settings podcastmg.DigestSettings) (podcastmg.DigestSchedule, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.DigestSchedule{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.DigestSchedule{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	schedule, err := svc.store.SetDigestSettings(emailID, settings, time.Now())
+	if err == podcastmg.ErrInvalidDigestSettings {
+		return podcastmg.DigestSchedule{}, err
+	}
+	if err != nil {
+		return podcastmg.DigestSchedule{}, ErrDigestUpdate.Wrap(err)
+	}
+	return schedule, nil
+}
+
+// UnsubscribeDigest turns off the digest of an unsubscribe link, the token stands in for the user's credentials
+func (svc *podcastManageService) UnsubscribeDigest(ctx context.Context, token string) error {
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	err = svc.store.UnsubscribeDigest(token)
+	if err == podcastmg.ErrDigestNotFound {
+		return err
+	}
+	if err != nil {
+		return ErrDigestUpdate.Wrap(err)
+	}
+	return nil
+}
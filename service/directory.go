@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"sync"
+	"time"
+)
+
+const (
+	// DirectoryPopular lists the podcasts with the most subscribers
+	DirectoryPopular = "popular"
+
+	// DirectoryTrending lists the podcasts which gained the most subscribers within the trending window
+	DirectoryTrending = "trending"
+
+	// DirectoryRecent lists the podcasts most recently added to the catalog
+	DirectoryRecent = "recent"
+
+	// DirectoryRelated lists the podcasts most often subscribed to along with a given podcast
+	DirectoryRelated = "related"
+)
+
+const (
+	// defaultDirectoryLimit is the number of entries returned when a request does not ask for one
+	defaultDirectoryLimit = 20
+
+	// maxDirectoryLimit is the number of entries computed and cached for each list
+	maxDirectoryLimit = 100
+)
+
+// Directory computes the discovery lists of the shared catalog in the background and swaps them in as a
+// snapshot, so that requests never wait for a computation. Related lists depend on the podcast asked about, they
+// are computed on request and kept in the snapshot until the next one replaces it. Only the related lists of
+// podcasts listed in the snapshot are kept, which bounds them by the size of the lists
+type Directory struct {
+	store          podcastmg.Store
+	logger         log.Logger
+	refresh        time.Duration
+	trendingWindow time.Duration
+
+	mtx      sync.RWMutex
+	snapshot *directorySnapshot
+}
+
+// directorySnapshot holds the lists computed at one time. lists and listed are not changed once the snapshot is
+// swapped in, related is filled as related lists of listed podcasts are asked for
+type directorySnapshot struct {
+	lists   map[string][]podcastmg.DirectoryEntry
+	listed  map[string]bool
+	mtx     sync.Mutex
+	related map[string][]podcastmg.DirectoryEntry
+}
+
+// NewDirectory returns a Directory which computes the lists every refresh, subscriptions made within the trending
+// window count towards trending. The store is connected for every computation, it should not be shared with the
+// service
+func NewDirectory(store podcastmg.Store, logger log.Logger, refresh, trendingWindow time.Duration) *Directory {
+	return &Directory{
+		store:          store,
+		logger:         logger,
+		refresh:        refresh,
+		trendingWindow: trendingWindow,
+	}
+}
+
+// WithDirectory enables the discovery lists, they are served from the Directory which has to be run as well
+func WithDirectory(directory *Directory) Option {
+	return func(svc *podcastManageService) {
+		svc.directory = directory
+	}
+}
+
+// Run computes the lists right away and again every refresh until the context is done
+func (d *Directory) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.refresh)
+	defer ticker.Stop()
+	for {
+		if err := d.Refresh(); err != nil {
+			d.logger.Log("err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh computes the lists and swaps them in, requests are served from the previous lists meanwhile
+func (d *Directory) Refresh() error {
+	if err := d.store.Connect(); err != nil {
+		return err
+	}
+	defer d.store.Close()
+	popular, err := d.store.PopularPodcasts(maxDirectoryLimit)
+	if err != nil {
+		return err
+	}
+	trending, err := d.store.TrendingPodcasts(time.Now().Add(-d.trendingWindow), maxDirectoryLimit)
+	if err != nil {
+		return err
+	}
+	recent, err := d.store.RecentPodcasts(maxDirectoryLimit)
+	if err != nil {
+		return err
+	}
+	snapshot := &directorySnapshot{
+		lists: map[string][]podcastmg.DirectoryEntry{
+			DirectoryPopular:  popular,
+			DirectoryTrending: trending,
+			DirectoryRecent:   recent,
+		},
+		listed:  map[string]bool{},
+		related: map[string][]podcastmg.DirectoryEntry{},
+	}
+	for _, entries := range snapshot.lists {
+		for _, entry := range entries {
+			snapshot.listed[entry.URL] = true
+		}
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.snapshot = snapshot
+	return nil
+}
+
+// entries returns the list from the latest snapshot, related lists missing from it are computed with the store.
+// Related lists of podcasts which are not listed in the snapshot are computed on every request
+func (d *Directory) entries(store podcastmg.Store, list, podcastURL string) ([]podcastmg.DirectoryEntry, error) {
+	d.mtx.RLock()
+	snapshot := d.snapshot
+	d.mtx.RUnlock()
+	if snapshot == nil {
+		return nil, ErrDirectoryNotReady
+	}
+	if list != DirectoryRelated {
+		return snapshot.lists[list], nil
+	}
+
+	snapshot.mtx.Lock()
+	entries, ok := snapshot.related[podcastURL]
+	snapshot.mtx.Unlock()
+	if ok {
+		return entries, nil
+	}
+	err := store.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if entries, err = store.RelatedPodcasts(podcastURL, maxDirectoryLimit); err != nil {
+		return nil, err
+	}
+	if !snapshot.listed[podcastURL] {
+		return entries, nil
+	}
+	snapshot.mtx.Lock()
+	defer snapshot.mtx.Unlock()
+	snapshot.related[podcastURL] = entries
+	return entries, nil
+}
@@ -3,7 +3,10 @@ package service
 import (
 	"context"
 	"github.com/go-kit/kit/endpoint"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
 	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"time"
 )
 
 // Endpoints is a struct which contains a full list of endpoints for the PodcastManageService
@@ -17,6 +20,69 @@ type Endpoints struct {
 	GetUserSubscriptionsEndpoint   endpoint.Endpoint
 	GetSubscriptionDetailsEndpoint endpoint.Endpoint
 	GetTokenEndpoint               endpoint.Endpoint
+	ArchiveEpisodeEndpoint         endpoint.Endpoint
+	GetEpisodeMediaEndpoint        endpoint.Endpoint
+	SearchEndpoint                 endpoint.Endpoint
+	DiscoverEndpoint               endpoint.Endpoint
+	GetSubscriptionTotalsEndpoint  endpoint.Endpoint
+	GetSettingsEndpoint            endpoint.Endpoint
+	UpdateSettingsEndpoint         endpoint.Endpoint
+	ResetSettingsEndpoint          endpoint.Endpoint
+	CreateLabelEndpoint            endpoint.Endpoint
+	GetLabelsEndpoint              endpoint.Endpoint
+	RenameLabelEndpoint            endpoint.Endpoint
+	ReorderLabelsEndpoint          endpoint.Endpoint
+	DeleteLabelEndpoint            endpoint.Endpoint
+	SetFolderEndpoint              endpoint.Endpoint
+	SetTagsEndpoint                endpoint.Endpoint
+	FilterSubscriptionsEndpoint    endpoint.Endpoint
+	ExportOPMLEndpoint             endpoint.Endpoint
+	GetQueueEndpoint               endpoint.Endpoint
+	UpdateQueueEndpoint            endpoint.Endpoint
+	CreatePlaylistEndpoint         endpoint.Endpoint
+	GetPlaylistsEndpoint           endpoint.Endpoint
+	GetPlaylistEndpoint            endpoint.Endpoint
+	GetPlaylistFeedEndpoint        endpoint.Endpoint
+	UpdatePlaylistEndpoint         endpoint.Endpoint
+	DeletePlaylistEndpoint         endpoint.Endpoint
+	SetPlaylistItemsEndpoint       endpoint.Endpoint
+	CreateWebhookEndpoint          endpoint.Endpoint
+	GetWebhooksEndpoint            endpoint.Endpoint
+	DeleteWebhookEndpoint          endpoint.Endpoint
+	GetWebhookDeliveriesEndpoint   endpoint.Endpoint
+	RetryWebhookDeliveryEndpoint   endpoint.Endpoint
+	GetDigestScheduleEndpoint      endpoint.Endpoint
+	UpdateDigestSettingsEndpoint   endpoint.Endpoint
+	UnsubscribeDigestEndpoint      endpoint.Endpoint
+	VerifyHubIntentEndpoint        endpoint.Endpoint
+	ReceiveHubContentEndpoint      endpoint.Endpoint
+	StreamEventsEndpoint           endpoint.Endpoint
+	GetPlaybackStatesEndpoint      endpoint.Endpoint
+	UpdatePlaybackStateEndpoint    endpoint.Endpoint
+	GetDevicesEndpoint             endpoint.Endpoint
+	UpdateDeviceEndpoint           endpoint.Endpoint
+	GetSubscriptionChangesEndpoint endpoint.Endpoint
+	UploadSubscriptionsEndpoint    endpoint.Endpoint
+	GetEpisodeActionsEndpoint      endpoint.Endpoint
+	UploadEpisodeActionsEndpoint   endpoint.Endpoint
+	SyncEndpoint                   endpoint.Endpoint
+	UploadChangesEndpoint          endpoint.Endpoint
+	RequestVerificationEndpoint    endpoint.Endpoint
+	VerifyEmailEndpoint            endpoint.Endpoint
+	RequestPasswordResetEndpoint   endpoint.Endpoint
+	ResetPasswordEndpoint          endpoint.Endpoint
+	ChangePasswordEndpoint         endpoint.Endpoint
+	RequestEmailChangeEndpoint     endpoint.Endpoint
+	ConfirmEmailChangeEndpoint     endpoint.Endpoint
+	ExportAccountEndpoint          endpoint.Endpoint
+	DeleteAccountEndpoint          endpoint.Endpoint
+	CreateAccessTokenEndpoint      endpoint.Endpoint
+	GetAccessTokensEndpoint        endpoint.Endpoint
+	RevokeAccessTokenEndpoint      endpoint.Endpoint
+	ExchangeAccessTokenEndpoint    endpoint.Endpoint
+	CheckTokenEndpoint             endpoint.Endpoint
+	BeginOIDCLoginEndpoint         endpoint.Endpoint
+	CompleteOIDCLoginEndpoint      endpoint.Endpoint
 }
 
 // MakeServerEndpoints returns a struct containing all the endpoints for a PodcastManageService
@@ -31,6 +97,69 @@ func MakeServerEndpoints(svc PodcastManageService) Endpoints {
 		GetUserSubscriptionsEndpoint:   MakeGetUserSubscriptionsEndpoint(svc),
 		GetSubscriptionDetailsEndpoint: MakeGetSubscriptionDetailsEndpoint(svc),
 		GetTokenEndpoint:               MakeGetTokenEndpoint(svc),
+		ArchiveEpisodeEndpoint:         MakeArchiveEpisodeEndpoint(svc),
+		GetEpisodeMediaEndpoint:        MakeGetEpisodeMediaEndpoint(svc),
+		SearchEndpoint:                 MakeSearchEndpoint(svc),
+		DiscoverEndpoint:               MakeDiscoverEndpoint(svc),
+		GetSubscriptionTotalsEndpoint:  MakeGetSubscriptionTotalsEndpoint(svc),
+		GetSettingsEndpoint:            MakeGetSettingsEndpoint(svc),
+		UpdateSettingsEndpoint:         MakeUpdateSettingsEndpoint(svc),
+		ResetSettingsEndpoint:          MakeResetSettingsEndpoint(svc),
+		CreateLabelEndpoint:            MakeCreateLabelEndpoint(svc),
+		GetLabelsEndpoint:              MakeGetLabelsEndpoint(svc),
+		RenameLabelEndpoint:            MakeRenameLabelEndpoint(svc),
+		ReorderLabelsEndpoint:          MakeReorderLabelsEndpoint(svc),
+		DeleteLabelEndpoint:            MakeDeleteLabelEndpoint(svc),
+		SetFolderEndpoint:              MakeSetFolderEndpoint(svc),
+		SetTagsEndpoint:                MakeSetTagsEndpoint(svc),
+		FilterSubscriptionsEndpoint:    MakeFilterSubscriptionsEndpoint(svc),
+		ExportOPMLEndpoint:             MakeExportOPMLEndpoint(svc),
+		GetQueueEndpoint:               MakeGetQueueEndpoint(svc),
+		UpdateQueueEndpoint:            MakeUpdateQueueEndpoint(svc),
+		CreatePlaylistEndpoint:         MakeCreatePlaylistEndpoint(svc),
+		GetPlaylistsEndpoint:           MakeGetPlaylistsEndpoint(svc),
+		GetPlaylistEndpoint:            MakeGetPlaylistEndpoint(svc),
+		GetPlaylistFeedEndpoint:        MakeGetPlaylistFeedEndpoint(svc),
+		UpdatePlaylistEndpoint:         MakeUpdatePlaylistEndpoint(svc),
+		DeletePlaylistEndpoint:         MakeDeletePlaylistEndpoint(svc),
+		SetPlaylistItemsEndpoint:       MakeSetPlaylistItemsEndpoint(svc),
+		CreateWebhookEndpoint:          MakeCreateWebhookEndpoint(svc),
+		GetWebhooksEndpoint:            MakeGetWebhooksEndpoint(svc),
+		DeleteWebhookEndpoint:          MakeDeleteWebhookEndpoint(svc),
+		GetWebhookDeliveriesEndpoint:   MakeGetWebhookDeliveriesEndpoint(svc),
+		RetryWebhookDeliveryEndpoint:   MakeRetryWebhookDeliveryEndpoint(svc),
+		GetDigestScheduleEndpoint:      MakeGetDigestScheduleEndpoint(svc),
+		UpdateDigestSettingsEndpoint:   MakeUpdateDigestSettingsEndpoint(svc),
+		UnsubscribeDigestEndpoint:      MakeUnsubscribeDigestEndpoint(svc),
+		VerifyHubIntentEndpoint:        MakeVerifyHubIntentEndpoint(svc),
+		ReceiveHubContentEndpoint:      MakeReceiveHubContentEndpoint(svc),
+		StreamEventsEndpoint:           MakeStreamEventsEndpoint(svc),
+		GetPlaybackStatesEndpoint:      MakeGetPlaybackStatesEndpoint(svc),
+		UpdatePlaybackStateEndpoint:    MakeUpdatePlaybackStateEndpoint(svc),
+		GetDevicesEndpoint:             MakeGetDevicesEndpoint(svc),
+		UpdateDeviceEndpoint:           MakeUpdateDeviceEndpoint(svc),
+		GetSubscriptionChangesEndpoint: MakeGetSubscriptionChangesEndpoint(svc),
+		UploadSubscriptionsEndpoint:    MakeUploadSubscriptionsEndpoint(svc),
+		GetEpisodeActionsEndpoint:      MakeGetEpisodeActionsEndpoint(svc),
+		UploadEpisodeActionsEndpoint:   MakeUploadEpisodeActionsEndpoint(svc),
+		SyncEndpoint:                   MakeSyncEndpoint(svc),
+		UploadChangesEndpoint:          MakeUploadChangesEndpoint(svc),
+		RequestVerificationEndpoint:    MakeRequestVerificationEndpoint(svc),
+		VerifyEmailEndpoint:            MakeVerifyEmailEndpoint(svc),
+		RequestPasswordResetEndpoint:   MakeRequestPasswordResetEndpoint(svc),
+		ResetPasswordEndpoint:          MakeResetPasswordEndpoint(svc),
+		ChangePasswordEndpoint:         MakeChangePasswordEndpoint(svc),
+		RequestEmailChangeEndpoint:     MakeRequestEmailChangeEndpoint(svc),
+		ConfirmEmailChangeEndpoint:     MakeConfirmEmailChangeEndpoint(svc),
+		ExportAccountEndpoint:          MakeExportAccountEndpoint(svc),
+		DeleteAccountEndpoint:          MakeDeleteAccountEndpoint(svc),
+		CreateAccessTokenEndpoint:      MakeCreateAccessTokenEndpoint(svc),
+		GetAccessTokensEndpoint:        MakeGetAccessTokensEndpoint(svc),
+		RevokeAccessTokenEndpoint:      MakeRevokeAccessTokenEndpoint(svc),
+		ExchangeAccessTokenEndpoint:    MakeExchangeAccessTokenEndpoint(svc),
+		CheckTokenEndpoint:             MakeCheckTokenEndpoint(svc),
+		BeginOIDCLoginEndpoint:         MakeBeginOIDCLoginEndpoint(svc),
+		CompleteOIDCLoginEndpoint:      MakeCompleteOIDCLoginEndpoint(svc),
 	}
 }
 
@@ -100,7 +229,7 @@ func MakeGetPodcastDetailsEndpoint(svc PodcastManageService) endpoint.Endpoint {
 		req := request.(getPodcastDetailsRequest)
 		podcast, e := svc.GetPodcastDetails(ctx, req.URL)
 		if e != nil {
-			return getPodcastDetailsResponse{Podcast: podcast, Err: err.Error()}, e
+			return getPodcastDetailsResponse{Podcast: podcast, Err: e.Error()}, e
 		}
 		return getPodcastDetailsResponse{Podcast: podcast, Err: ""}, nil
 	}
@@ -142,6 +271,1114 @@ func MakeUpdatePodcastEndpoint(svc PodcastManageService) endpoint.Endpoint {
 	}
 }
 
+// MakeArchiveEpisodeEndpoint returns an ArchiveEpisodeEndpoint via the passed service
+func MakeArchiveEpisodeEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(archiveEpisodeRequest)
+		e := svc.ArchiveEpisode(ctx, req.EmailID, req.ItemID)
+		if e != nil {
+			return archiveEpisodeResponse{Status: false, Err: e.Error()}, e
+		}
+		return archiveEpisodeResponse{Status: true, Err: ""}, nil
+	}
+}
+
+// MakeGetEpisodeMediaEndpoint returns a GetEpisodeMediaEndpoint via the passed service
+func MakeGetEpisodeMediaEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getEpisodeMediaRequest)
+		media, e := svc.GetEpisodeMedia(ctx, req.EmailID, req.ItemID)
+		if e != nil {
+			return getEpisodeMediaResponse{Err: e.Error()}, e
+		}
+		return getEpisodeMediaResponse{Media: media, Err: ""}, nil
+	}
+}
+
+// MakeSearchEndpoint returns a SearchEndpoint via the passed service
+func MakeSearchEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(searchRequest)
+		query := podcastmg.SearchQuery{
+			Terms:  req.Query,
+			Scope:  req.Scope,
+			Limit:  req.Limit,
+			Offset: req.Offset,
+		}
+		results, e := svc.Search(ctx, req.EmailID, query)
+		if e != nil {
+			return searchResponse{Err: e.Error()}, e
+		}
+		return searchResponse{results, ""}, nil
+	}
+}
+
+type searchRequest struct {
+	EmailID string `json:"email_id"`
+	Query   string `json:"query"`
+	Scope   string `json:"scope"`
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+}
+
+type searchResponse struct {
+	Results podcastmg.SearchResults `json:"results"`
+	Err     string                  `json:"err,omitempty"`
+}
+
+// MakeDiscoverEndpoint returns a DiscoverEndpoint via the passed service
+func MakeDiscoverEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(discoverRequest)
+		podcasts, e := svc.Discover(ctx, req.List, req.URL, req.Limit)
+		if e != nil {
+			return discoverResponse{Err: e.Error()}, e
+		}
+		return discoverResponse{podcasts, ""}, nil
+	}
+}
+
+type discoverRequest struct {
+	List  string `json:"list"`
+	URL   string `json:"url"`
+	Limit int    `json:"limit"`
+}
+
+type discoverResponse struct {
+	Podcasts []podcastmg.DirectoryEntry `json:"podcasts"`
+	Err      string                     `json:"err,omitempty"`
+}
+
+// MakeGetSubscriptionTotalsEndpoint returns a GetSubscriptionTotalsEndpoint via the passed service
+func MakeGetSubscriptionTotalsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserSubscriptionsRequest)
+		totals, e := svc.GetSubscriptionTotals(ctx, req.EmailID)
+		if e != nil {
+			return getSubscriptionTotalsResponse{Err: e.Error()}, e
+		}
+		return getSubscriptionTotalsResponse{totals, ""}, nil
+	}
+}
+
+type getSubscriptionTotalsResponse struct {
+	Totals []podcastmg.SubscriptionTotals `json:"totals"`
+	Err    string                         `json:"err,omitempty"`
+}
+
+// MakeGetSettingsEndpoint returns a GetSettingsEndpoint via the passed service
+func MakeGetSettingsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSubscriptionDetailsRequest)
+		settings, e := svc.GetSubscriptionSettings(ctx, req.EmailID, req.URL)
+		if e != nil {
+			return settingsResponse{Err: e.Error()}, e
+		}
+		return settingsResponse{settings, ""}, nil
+	}
+}
+
+// MakeUpdateSettingsEndpoint returns an UpdateSettingsEndpoint via the passed service
+func MakeUpdateSettingsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateSettingsRequest)
+		e := svc.UpdateSubscriptionSettings(ctx, req.EmailID, req.URL, req.Settings)
+		if e != nil {
+			return updateSettingsResponse{false, e.Error()}, e
+		}
+		return updateSettingsResponse{true, ""}, nil
+	}
+}
+
+// MakeResetSettingsEndpoint returns a ResetSettingsEndpoint via the passed service
+func MakeResetSettingsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSubscriptionDetailsRequest)
+		e := svc.ResetSubscriptionSettings(ctx, req.EmailID, req.URL)
+		if e != nil {
+			return updateSettingsResponse{false, e.Error()}, e
+		}
+		return updateSettingsResponse{true, ""}, nil
+	}
+}
+
+type settingsResponse struct {
+	Settings podcastmg.SubscriptionSettings `json:"settings"`
+	Err      string                         `json:"err,omitempty"`
+}
+
+type updateSettingsRequest struct {
+	EmailID  string                         `json:"email_id"`
+	URL      string                         `json:"url"`
+	Settings podcastmg.SubscriptionSettings `json:"settings"`
+}
+
+type updateSettingsResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+// MakeCreateLabelEndpoint returns a CreateLabelEndpoint via the passed service
+func MakeCreateLabelEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(labelRequest)
+		label, e := svc.CreateLabel(ctx, req.EmailID, req.Kind, req.Name)
+		if e != nil {
+			return labelResponse{Err: e.Error()}, e
+		}
+		return labelResponse{label, ""}, nil
+	}
+}
+
+// MakeGetLabelsEndpoint returns a GetLabelsEndpoint via the passed service
+func MakeGetLabelsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(labelRequest)
+		labels, e := svc.GetLabels(ctx, req.EmailID, req.Kind)
+		if e != nil {
+			return getLabelsResponse{Err: e.Error()}, e
+		}
+		return getLabelsResponse{labels, ""}, nil
+	}
+}
+
+// MakeRenameLabelEndpoint returns a RenameLabelEndpoint via the passed service
+func MakeRenameLabelEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(labelRequest)
+		e := svc.RenameLabel(ctx, req.EmailID, req.ID, req.Name)
+		if e != nil {
+			return labelStatusResponse{false, e.Error()}, e
+		}
+		return labelStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeReorderLabelsEndpoint returns a ReorderLabelsEndpoint via the passed service
+func MakeReorderLabelsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(labelRequest)
+		e := svc.ReorderLabels(ctx, req.EmailID, req.Kind, req.IDs)
+		if e != nil {
+			return labelStatusResponse{false, e.Error()}, e
+		}
+		return labelStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeDeleteLabelEndpoint returns a DeleteLabelEndpoint via the passed service
+func MakeDeleteLabelEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(labelRequest)
+		e := svc.DeleteLabel(ctx, req.EmailID, req.ID)
+		if e != nil {
+			return labelStatusResponse{false, e.Error()}, e
+		}
+		return labelStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeSetFolderEndpoint returns a SetFolderEndpoint via the passed service
+func MakeSetFolderEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(assignLabelsRequest)
+		e := svc.SetSubscriptionFolder(ctx, req.EmailID, req.URL, req.FolderID)
+		if e != nil {
+			return labelStatusResponse{false, e.Error()}, e
+		}
+		return labelStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeSetTagsEndpoint returns a SetTagsEndpoint via the passed service
+func MakeSetTagsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(assignLabelsRequest)
+		e := svc.SetSubscriptionTags(ctx, req.EmailID, req.URL, req.TagIDs)
+		if e != nil {
+			return labelStatusResponse{false, e.Error()}, e
+		}
+		return labelStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeFilterSubscriptionsEndpoint returns a FilterSubscriptionsEndpoint via the passed service
+func MakeFilterSubscriptionsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(filterSubscriptionsRequest)
+		subscriptions, e := svc.FilterSubscriptions(ctx, req.EmailID, req.FolderID, req.TagID)
+		if e != nil {
+			return getUserSubscriptionsResponse{subscriptions, e.Error()}, e
+		}
+		return getUserSubscriptionsResponse{subscriptions, ""}, nil
+	}
+}
+
+// MakeExportOPMLEndpoint returns an ExportOPMLEndpoint via the passed service
+func MakeExportOPMLEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserSubscriptionsRequest)
+		opml, e := svc.ExportOPML(ctx, req.EmailID)
+		if e != nil {
+			return nil, e
+		}
+		return opml, nil
+	}
+}
+
+// MakeGetQueueEndpoint returns a GetQueueEndpoint via the passed service
+func MakeGetQueueEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserSubscriptionsRequest)
+		queue, e := svc.GetQueue(ctx, req.EmailID)
+		if e != nil {
+			return queueResponse{Err: e.Error()}, e
+		}
+		return queueResponse{queue, ""}, nil
+	}
+}
+
+// MakeUpdateQueueEndpoint returns an UpdateQueueEndpoint via the passed service
+func MakeUpdateQueueEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateQueueRequest)
+		queue, e := svc.UpdateQueue(ctx, req.EmailID, req.Version, req.QueueOp)
+		if e != nil {
+			return queueResponse{Err: e.Error()}, e
+		}
+		return queueResponse{queue, ""}, nil
+	}
+}
+
+// MakeCreatePlaylistEndpoint returns a CreatePlaylistEndpoint via the passed service
+func MakeCreatePlaylistEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playlistRequest)
+		playlist, e := svc.CreatePlaylist(ctx, req.EmailID, req.Playlist)
+		if e != nil {
+			return playlistResponse{Err: e.Error()}, e
+		}
+		return playlistResponse{playlist, ""}, nil
+	}
+}
+
+// MakeGetPlaylistsEndpoint returns a GetPlaylistsEndpoint via the passed service
+func MakeGetPlaylistsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserSubscriptionsRequest)
+		playlists, e := svc.GetPlaylists(ctx, req.EmailID)
+		if e != nil {
+			return getPlaylistsResponse{Err: e.Error()}, e
+		}
+		return getPlaylistsResponse{playlists, ""}, nil
+	}
+}
+
+// MakeGetPlaylistEndpoint returns a GetPlaylistEndpoint via the passed service
+func MakeGetPlaylistEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playlistItemsRequest)
+		playlist, e := svc.GetPlaylist(ctx, req.EmailID, req.ID)
+		if e != nil {
+			return playlistResponse{Err: e.Error()}, e
+		}
+		return playlistResponse{playlist, ""}, nil
+	}
+}
+
+// MakeGetPlaylistFeedEndpoint returns a GetPlaylistFeedEndpoint via the passed service
+func MakeGetPlaylistFeedEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playlistFeedRequest)
+		playlist, e := svc.GetPlaylistFeed(ctx, req.Secret)
+		if e != nil {
+			return playlistResponse{Err: e.Error()}, e
+		}
+		return playlistResponse{playlist, ""}, nil
+	}
+}
+
+// MakeUpdatePlaylistEndpoint returns an UpdatePlaylistEndpoint via the passed service
+func MakeUpdatePlaylistEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playlistRequest)
+		e := svc.UpdatePlaylist(ctx, req.EmailID, req.Playlist)
+		if e != nil {
+			return playlistStatusResponse{false, e.Error()}, e
+		}
+		return playlistStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeDeletePlaylistEndpoint returns a DeletePlaylistEndpoint via the passed service
+func MakeDeletePlaylistEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playlistItemsRequest)
+		e := svc.DeletePlaylist(ctx, req.EmailID, req.ID)
+		if e != nil {
+			return playlistStatusResponse{false, e.Error()}, e
+		}
+		return playlistStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeSetPlaylistItemsEndpoint returns a SetPlaylistItemsEndpoint via the passed service
+func MakeSetPlaylistItemsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playlistItemsRequest)
+		e := svc.SetPlaylistItems(ctx, req.EmailID, req.ID, req.ItemIDs)
+		if e != nil {
+			return playlistStatusResponse{false, e.Error()}, e
+		}
+		return playlistStatusResponse{true, ""}, nil
+	}
+}
+
+type playlistRequest struct {
+	EmailID  string             `json:"email_id"`
+	Playlist podcastmg.Playlist `json:"playlist"`
+}
+
+type playlistItemsRequest struct {
+	EmailID string `json:"email_id"`
+	ID      uint   `json:"id"`
+	ItemIDs []uint `json:"item_ids"`
+}
+
+type playlistFeedRequest struct {
+	Secret string `json:"secret"`
+}
+
+type playlistResponse struct {
+	Playlist podcastmg.Playlist `json:"playlist"`
+	Err      string             `json:"err,omitempty"`
+}
+
+type getPlaylistsResponse struct {
+	Playlists []podcastmg.Playlist `json:"playlists"`
+	Err       string               `json:"err,omitempty"`
+}
+
+type playlistStatusResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+// MakeCreateWebhookEndpoint returns a CreateWebhookEndpoint via the passed service
+func MakeCreateWebhookEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(webhookRequest)
+		webhook, e := svc.CreateWebhook(ctx, req.EmailID, req.URL)
+		if e != nil {
+			return webhookResponse{Err: e.Error()}, e
+		}
+		return webhookResponse{webhook, ""}, nil
+	}
+}
+
+// MakeGetWebhooksEndpoint returns a GetWebhooksEndpoint via the passed service
+func MakeGetWebhooksEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(webhookRequest)
+		webhooks, e := svc.GetWebhooks(ctx, req.EmailID)
+		if e != nil {
+			return getWebhooksResponse{Err: e.Error()}, e
+		}
+		return getWebhooksResponse{webhooks, ""}, nil
+	}
+}
+
+// MakeDeleteWebhookEndpoint returns a DeleteWebhookEndpoint via the passed service
+func MakeDeleteWebhookEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(webhookRequest)
+		e := svc.DeleteWebhook(ctx, req.EmailID, req.ID)
+		if e != nil {
+			return webhookStatusResponse{false, e.Error()}, e
+		}
+		return webhookStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeGetWebhookDeliveriesEndpoint returns a GetWebhookDeliveriesEndpoint via the passed service
+func MakeGetWebhookDeliveriesEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(webhookRequest)
+		deliveries, e := svc.GetWebhookDeliveries(ctx, req.EmailID, req.ID)
+		if e != nil {
+			return webhookDeliveriesResponse{Err: e.Error()}, e
+		}
+		return webhookDeliveriesResponse{deliveries, ""}, nil
+	}
+}
+
+// MakeRetryWebhookDeliveryEndpoint returns a RetryWebhookDeliveryEndpoint via the passed service
+func MakeRetryWebhookDeliveryEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(webhookRequest)
+		e := svc.RetryWebhookDelivery(ctx, req.EmailID, req.ID)
+		if e != nil {
+			return webhookStatusResponse{false, e.Error()}, e
+		}
+		return webhookStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeGetDigestScheduleEndpoint returns a GetDigestScheduleEndpoint via the passed service
+func MakeGetDigestScheduleEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(digestRequest)
+		schedule, e := svc.GetDigestSchedule(ctx, req.EmailID)
+		if e != nil {
+			return digestResponse{Err: e.Error()}, e
+		}
+		return digestResponse{schedule, ""}, nil
+	}
+}
+
+// MakeUpdateDigestSettingsEndpoint returns an UpdateDigestSettingsEndpoint via the passed service
+func MakeUpdateDigestSettingsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(digestRequest)
+		schedule, e := svc.UpdateDigestSettings(ctx, req.EmailID, req.DigestSettings)
+		if e != nil {
+			return digestResponse{Err: e.Error()}, e
+		}
+		return digestResponse{schedule, ""}, nil
+	}
+}
+
+// MakeUnsubscribeDigestEndpoint returns an UnsubscribeDigestEndpoint via the passed service
+func MakeUnsubscribeDigestEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(unsubscribeDigestRequest)
+		e := svc.UnsubscribeDigest(ctx, req.Token)
+		if e != nil {
+			return digestStatusResponse{false, e.Error()}, e
+		}
+		return digestStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeVerifyHubIntentEndpoint returns a VerifyHubIntentEndpoint via the passed service
+func MakeVerifyHubIntentEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(hubIntentRequest)
+		challenge, e := svc.VerifyHubIntent(ctx, req.ID, req.HubIntent, req.Challenge)
+		if e != nil {
+			return hubIntentResponse{Err: e.Error()}, e
+		}
+		return hubIntentResponse{challenge, ""}, nil
+	}
+}
+
+// MakeReceiveHubContentEndpoint returns a ReceiveHubContentEndpoint via the passed service
+func MakeReceiveHubContentEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(hubContentRequest)
+		e := svc.ReceiveHubContent(ctx, req.ID, req.Signature, req.Content)
+		if e != nil {
+			return hubStatusResponse{false, e.Error()}, e
+		}
+		return hubStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeStreamEventsEndpoint returns a StreamEventsEndpoint via the passed service
+func MakeStreamEventsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserSubscriptionsRequest)
+		stream, e := svc.StreamEvents(ctx, req.EmailID)
+		if e != nil {
+			return eventStreamResponse{Err: e.Error()}, e
+		}
+		return eventStreamResponse{stream, ""}, nil
+	}
+}
+
+// MakeGetPlaybackStatesEndpoint returns a GetPlaybackStatesEndpoint via the passed service
+func MakeGetPlaybackStatesEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(playbackStatesRequest)
+		states, e := svc.GetPlaybackStates(ctx, req.EmailID, req.Since)
+		if e != nil {
+			return playbackStatesResponse{Err: e.Error()}, e
+		}
+		return playbackStatesResponse{states, ""}, nil
+	}
+}
+
+// MakeUpdatePlaybackStateEndpoint returns an UpdatePlaybackStateEndpoint via the passed service
+func MakeUpdatePlaybackStateEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updatePlaybackRequest)
+		state, e := svc.UpdatePlaybackState(ctx, req.EmailID, req.PlaybackState)
+		if e != nil {
+			return playbackResponse{Err: e.Error()}, e
+		}
+		return playbackResponse{state, ""}, nil
+	}
+}
+
+type eventStreamResponse struct {
+	Events <-chan events.Event `json:"-"`
+	Err    string              `json:"err,omitempty"`
+}
+
+type playbackStatesRequest struct {
+	EmailID string    `json:"email_id"`
+	Since   time.Time `json:"since"`
+}
+
+type playbackStatesResponse struct {
+	States []podcastmg.PlaybackState `json:"states"`
+	Err    string                    `json:"err,omitempty"`
+}
+
+type updatePlaybackRequest struct {
+	EmailID string `json:"email_id"`
+	podcastmg.PlaybackState
+}
+
+type playbackResponse struct {
+	State podcastmg.PlaybackState `json:"state"`
+	Err   string                  `json:"err,omitempty"`
+}
+
+// MakeGetDevicesEndpoint returns a GetDevicesEndpoint via the passed service
+func MakeGetDevicesEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserSubscriptionsRequest)
+		devices, e := svc.GetDevices(ctx, req.EmailID)
+		if e != nil {
+			return gpodderResponse{Err: e.Error()}, e
+		}
+		return gpodderResponse{devices, ""}, nil
+	}
+}
+
+// MakeUpdateDeviceEndpoint returns an UpdateDeviceEndpoint via the passed service
+func MakeUpdateDeviceEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(updateDeviceRequest)
+		e := svc.UpdateDevice(ctx, req.EmailID, req.Device)
+		if e != nil {
+			return gpodderResponse{Err: e.Error()}, e
+		}
+		return gpodderResponse{struct{}{}, ""}, nil
+	}
+}
+
+// MakeGetSubscriptionChangesEndpoint returns a GetSubscriptionChangesEndpoint via the passed service
+func MakeGetSubscriptionChangesEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(subscriptionChangesRequest)
+		changes, e := svc.GetSubscriptionChanges(ctx, req.EmailID, req.DeviceID, req.Since)
+		if e != nil {
+			return gpodderResponse{Err: e.Error()}, e
+		}
+		return gpodderResponse{changes, ""}, nil
+	}
+}
+
+// MakeUploadSubscriptionsEndpoint returns an UploadSubscriptionsEndpoint via the passed service
+func MakeUploadSubscriptionsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(uploadSubscriptionsRequest)
+		result, e := svc.UploadSubscriptionChanges(ctx, req.EmailID, req.DeviceID, req.Changes)
+		if e != nil {
+			return gpodderResponse{Err: e.Error()}, e
+		}
+		return gpodderResponse{result, ""}, nil
+	}
+}
+
+// MakeGetEpisodeActionsEndpoint returns a GetEpisodeActionsEndpoint via the passed service
+func MakeGetEpisodeActionsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(episodeActionsRequest)
+		actions, e := svc.GetEpisodeActions(ctx, req.EmailID, req.Query)
+		if e != nil {
+			return gpodderResponse{Err: e.Error()}, e
+		}
+		return gpodderResponse{actions, ""}, nil
+	}
+}
+
+// MakeUploadEpisodeActionsEndpoint returns an UploadEpisodeActionsEndpoint via the passed service
+func MakeUploadEpisodeActionsEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(uploadEpisodeActionsRequest)
+		result, e := svc.UploadEpisodeActions(ctx, req.EmailID, req.Actions)
+		if e != nil {
+			return gpodderResponse{Err: e.Error()}, e
+		}
+		return gpodderResponse{result, ""}, nil
+	}
+}
+
+// MakeSyncEndpoint returns a SyncEndpoint via the passed service
+func MakeSyncEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(syncRequest)
+		delta, e := svc.Sync(ctx, req.EmailID, req.Token, req.Limit)
+		if e != nil {
+			return syncResponse{Err: e.Error()}, e
+		}
+		return syncResponse{delta, ""}, nil
+	}
+}
+
+// MakeUploadChangesEndpoint returns an UploadChangesEndpoint via the passed service
+func MakeUploadChangesEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(uploadChangesRequest)
+		applied, e := svc.UploadChanges(ctx, req.EmailID, req.Device, req.Changes)
+		if e != nil {
+			return uploadChangesResponse{Err: e.Error()}, e
+		}
+		return uploadChangesResponse{applied, ""}, nil
+	}
+}
+
+type syncRequest struct {
+	EmailID string
+	Token   string
+	Limit   int
+}
+
+type syncResponse struct {
+	podcastmg.SyncDelta
+	Err string `json:"err,omitempty"`
+}
+
+type uploadChangesRequest struct {
+	EmailID string             `json:"-"`
+	Device  string             `json:"device"`
+	Changes []podcastmg.Change `json:"changes"`
+}
+
+type uploadChangesResponse struct {
+	Applied []podcastmg.Change `json:"applied"`
+	Err     string             `json:"err,omitempty"`
+}
+
+// MakeRequestVerificationEndpoint returns a RequestVerificationEndpoint via the passed service
+func MakeRequestVerificationEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserRequest)
+		e := svc.RequestEmailVerification(ctx, req.EmailID)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeVerifyEmailEndpoint returns a VerifyEmailEndpoint via the passed service
+func MakeVerifyEmailEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(verifyEmailRequest)
+		e := svc.VerifyEmail(ctx, req.Token)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeRequestPasswordResetEndpoint returns a RequestPasswordResetEndpoint via the passed service
+func MakeRequestPasswordResetEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserRequest)
+		e := svc.RequestPasswordReset(ctx, req.EmailID)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeResetPasswordEndpoint returns a ResetPasswordEndpoint via the passed service
+func MakeResetPasswordEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(resetPasswordRequest)
+		e := svc.ResetPassword(ctx, req.Token, req.Password)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeChangePasswordEndpoint returns a ChangePasswordEndpoint via the passed service
+func MakeChangePasswordEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(changePasswordRequest)
+		e := svc.ChangePassword(ctx, req.EmailID, req.OldPassword, req.NewPassword)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeRequestEmailChangeEndpoint returns a RequestEmailChangeEndpoint via the passed service
+func MakeRequestEmailChangeEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(changeEmailRequest)
+		e := svc.RequestEmailChange(ctx, req.EmailID, req.Password, req.NewEmail)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeConfirmEmailChangeEndpoint returns a ConfirmEmailChangeEndpoint via the passed service
+func MakeConfirmEmailChangeEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(verifyEmailRequest)
+		e := svc.ConfirmEmailChange(ctx, req.Token)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeExportAccountEndpoint returns an ExportAccountEndpoint via the passed service
+func MakeExportAccountEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUserRequest)
+		export, e := svc.ExportAccount(ctx, req.EmailID)
+		if e != nil {
+			return nil, e
+		}
+		return export, nil
+	}
+}
+
+// MakeDeleteAccountEndpoint returns a DeleteAccountEndpoint via the passed service
+func MakeDeleteAccountEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getTokenRequest)
+		e := svc.DeleteAccount(ctx, req.EmailID, req.Password)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeCreateAccessTokenEndpoint returns a CreateAccessTokenEndpoint via the passed service
+func MakeCreateAccessTokenEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(accessTokenRequest)
+		token, e := svc.CreateAccessToken(ctx, req.EmailID, podcastmg.AccessToken{Name: req.Name, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt})
+		if e != nil {
+			return accessTokenResponse{Err: e.Error()}, e
+		}
+		return accessTokenResponse{token, ""}, nil
+	}
+}
+
+// MakeGetAccessTokensEndpoint returns a GetAccessTokensEndpoint via the passed service
+func MakeGetAccessTokensEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(accessTokenRequest)
+		tokens, e := svc.GetAccessTokens(ctx, req.EmailID)
+		if e != nil {
+			return getAccessTokensResponse{Err: e.Error()}, e
+		}
+		return getAccessTokensResponse{tokens, ""}, nil
+	}
+}
+
+// MakeRevokeAccessTokenEndpoint returns a RevokeAccessTokenEndpoint via the passed service
+func MakeRevokeAccessTokenEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(accessTokenRequest)
+		e := svc.RevokeAccessToken(ctx, req.EmailID, req.ID)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeExchangeAccessTokenEndpoint returns an ExchangeAccessTokenEndpoint via the passed service
+func MakeExchangeAccessTokenEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(exchangeAccessTokenRequest)
+		tokenString, e := svc.ExchangeAccessToken(ctx, req.Token)
+		if e != nil {
+			return getTokenResponse{tokenString, e.Error()}, e
+		}
+		return getTokenResponse{tokenString, ""}, nil
+	}
+}
+
+// MakeCheckTokenEndpoint returns a CheckTokenEndpoint via the passed service
+func MakeCheckTokenEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		e := svc.CheckToken(ctx)
+		if e != nil {
+			return accountStatusResponse{false, e.Error()}, e
+		}
+		return accountStatusResponse{true, ""}, nil
+	}
+}
+
+// MakeBeginOIDCLoginEndpoint returns a BeginOIDCLoginEndpoint via the passed service
+func MakeBeginOIDCLoginEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		login, e := svc.BeginOIDCLogin(ctx)
+		if e != nil {
+			return oidcLoginResponse{Err: e.Error()}, e
+		}
+		return oidcLoginResponse{login, ""}, nil
+	}
+}
+
+// MakeCompleteOIDCLoginEndpoint returns a CompleteOIDCLoginEndpoint via the passed service
+func MakeCompleteOIDCLoginEndpoint(svc PodcastManageService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(completeOIDCLoginRequest)
+		tokenString, e := svc.CompleteOIDCLogin(ctx, req.Session, req.State, req.Code)
+		if e != nil {
+			return getTokenResponse{tokenString, e.Error()}, e
+		}
+		return getTokenResponse{tokenString, ""}, nil
+	}
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	EmailID     string `json:"email_id"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type changeEmailRequest struct {
+	EmailID  string `json:"email_id"`
+	Password string `json:"password"`
+	NewEmail string `json:"new_email"`
+}
+
+type accessTokenRequest struct {
+	EmailID   string     `json:"email_id"`
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type accessTokenResponse struct {
+	AccessToken podcastmg.AccessToken `json:"access_token"`
+	Err         string                `json:"err,omitempty"`
+}
+
+type getAccessTokensResponse struct {
+	AccessTokens []podcastmg.AccessToken `json:"access_tokens"`
+	Err          string                  `json:"err,omitempty"`
+}
+
+type exchangeAccessTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type oidcLoginResponse struct {
+	OIDCLogin
+	Err string `json:"err,omitempty"`
+}
+
+type completeOIDCLoginRequest struct {
+	Session string `json:"session"`
+	State   string `json:"state"`
+	Code    string `json:"code"`
+}
+
+type accountStatusResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+// gpodderResponse is the response of the gpodder.net API, whose clients expect the bare body
+type gpodderResponse struct {
+	Body interface{}
+	Err  string
+}
+
+type updateDeviceRequest struct {
+	EmailID string
+	Device  podcastmg.Device
+}
+
+type subscriptionChangesRequest struct {
+	EmailID  string
+	DeviceID string
+	Since    int64
+}
+
+type uploadSubscriptionsRequest struct {
+	EmailID  string
+	DeviceID string
+	Changes  podcastmg.SubscriptionChanges
+}
+
+type episodeActionsRequest struct {
+	EmailID string
+	Query   podcastmg.EpisodeActionQuery
+}
+
+type uploadEpisodeActionsRequest struct {
+	EmailID string
+	Actions []podcastmg.EpisodeAction
+}
+
+type hubIntentRequest struct {
+	ID uint
+	podcastmg.HubIntent
+	Challenge string
+}
+
+type hubIntentResponse struct {
+	Challenge string `json:"challenge"`
+	Err       string `json:"err,omitempty"`
+}
+
+type hubContentRequest struct {
+	ID        uint
+	Signature string
+	Content   []byte
+}
+
+type hubStatusResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+type digestRequest struct {
+	EmailID string `json:"email_id"`
+	podcastmg.DigestSettings
+}
+
+type digestResponse struct {
+	Digest podcastmg.DigestSchedule `json:"digest"`
+	Err    string                   `json:"err,omitempty"`
+}
+
+type unsubscribeDigestRequest struct {
+	Token string `json:"token"`
+}
+
+type digestStatusResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+type webhookRequest struct {
+	EmailID string `json:"email_id"`
+	URL     string `json:"url"`
+	ID      uint   `json:"id"`
+}
+
+type webhookResponse struct {
+	Webhook podcastmg.Webhook `json:"webhook"`
+	Err     string            `json:"err,omitempty"`
+}
+
+type getWebhooksResponse struct {
+	Webhooks []podcastmg.Webhook `json:"webhooks"`
+	Err      string              `json:"err,omitempty"`
+}
+
+type webhookDeliveriesResponse struct {
+	Deliveries []podcastmg.WebhookDelivery `json:"deliveries"`
+	Err        string                      `json:"err,omitempty"`
+}
+
+type webhookStatusResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+type updateQueueRequest struct {
+	EmailID string `json:"email_id"`
+	Version int64  `json:"version"`
+	podcastmg.QueueOp
+}
+
+type queueResponse struct {
+	Queue podcastmg.Queue `json:"queue"`
+	Err   string          `json:"err,omitempty"`
+}
+
+type labelRequest struct {
+	EmailID string `json:"email_id"`
+	Kind    string `json:"kind"`
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	IDs     []uint `json:"ids"`
+}
+
+type labelResponse struct {
+	Label podcastmg.Label `json:"label"`
+	Err   string          `json:"err,omitempty"`
+}
+
+type getLabelsResponse struct {
+	Labels []podcastmg.Label `json:"labels"`
+	Err    string            `json:"err,omitempty"`
+}
+
+type labelStatusResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+type assignLabelsRequest struct {
+	EmailID  string `json:"email_id"`
+	URL      string `json:"url"`
+	FolderID uint   `json:"folder_id"`
+	TagIDs   []uint `json:"tag_ids"`
+}
+
+type filterSubscriptionsRequest struct {
+	EmailID  string `json:"email_id"`
+	FolderID uint   `json:"folder_id"`
+	TagID    uint   `json:"tag_id"`
+}
+
+type archiveEpisodeRequest struct {
+	EmailID string `json:"email_id"`
+	ItemID  uint   `json:"item_id"`
+}
+
+type archiveEpisodeResponse struct {
+	Status bool   `json:"status"`
+	Err    string `json:"err,omitempty"`
+}
+
+type getEpisodeMediaRequest struct {
+	EmailID string
+	ItemID  uint
+}
+
+type getEpisodeMediaResponse struct {
+	Media archive.Blob
+	Err   string
+}
+
 type getTokenRequest struct {
 	EmailID  string `json:"email_id"`
 	Password string `json:"password"`
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"net/http"
+)
+
+// Error is an error the service returns to its clients. Code tells errors apart for programs, Status is the HTTP
+// status it is sent with and Message is safe to show to users. Cause is the underlying error, it is logged along
+// with the message but never sent to clients
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+	Cause   error
+}
+
+// newError returns an error without cause, to be declared once and wrapped around the causes it is returned for
+func newError(code string, status int, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+// Error returns the message followed by the cause if there is one
+func (e *Error) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Cause.Error()
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports whether the target is an Error of the same code, so that errors.Is matches an error with its cause
+// against the declared error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns the error with the cause
+func (e *Error) Wrap(cause error) error {
+	return &Error{Code: e.Code, Status: e.Status, Message: e.Message, Cause: cause}
+}
+
+var (
+	// ErrInternal is sent in place of errors which are not meant for clients
+	ErrInternal = newError("internal", http.StatusInternalServerError, "Internal server error")
+
+	// ErrRouteNotFound indicates a request to a path the service does not serve
+	ErrRouteNotFound = newError("route_not_found", http.StatusNotFound, "No such route")
+
+	// ErrMethodNotAllowed indicates a request with a method the path is not served for
+	ErrMethodNotAllowed = newError("method_not_allowed", http.StatusMethodNotAllowed, "Method not allowed")
+)
+
+// foreignErrors are the errors of other packages which are passed on to clients, they are sent with their own
+// message under the code and status given here
+var foreignErrors = map[error]*Error{
+	kitjwt.ErrTokenContextMissing:          {Code: "token_missing", Status: http.StatusUnauthorized},
+	kitjwt.ErrTokenInvalid:                 {Code: "token_invalid", Status: http.StatusUnauthorized},
+	kitjwt.ErrTokenExpired:                 {Code: "token_expired", Status: http.StatusUnauthorized},
+	kitjwt.ErrTokenMalformed:               {Code: "token_malformed", Status: http.StatusBadRequest},
+	kitjwt.ErrTokenNotActive:               {Code: "token_not_active", Status: http.StatusUnauthorized},
+	kitjwt.ErrUnexpectedSigningMethod:      {Code: "token_signing_method", Status: http.StatusUnauthorized},
+	archive.ErrQuotaExceeded:               {Code: "archive_quota_exceeded", Status: http.StatusForbidden},
+	archive.ErrNoMedia:                     {Code: "no_media", Status: http.StatusBadRequest},
+	podcastmg.ErrEmptySearch:               {Code: "empty_search", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidSettings:           {Code: "invalid_settings", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidLabel:              {Code: "invalid_label", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidOrder:              {Code: "invalid_order", Status: http.StatusBadRequest},
+	podcastmg.ErrLabelNotFound:             {Code: "label_not_found", Status: http.StatusNotFound},
+	podcastmg.ErrLabelExists:               {Code: "label_exists", Status: http.StatusConflict},
+	podcastmg.ErrQueueConflict:             {Code: "queue_conflict", Status: http.StatusConflict},
+	podcastmg.ErrInvalidQueueAction:        {Code: "invalid_queue_action", Status: http.StatusBadRequest},
+	podcastmg.ErrQueuePosition:             {Code: "invalid_queue_position", Status: http.StatusBadRequest},
+	podcastmg.ErrNotQueued:                 {Code: "not_queued", Status: http.StatusNotFound},
+	podcastmg.ErrInvalidPlaylist:           {Code: "invalid_playlist", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidRules:              {Code: "invalid_playlist_rules", Status: http.StatusBadRequest},
+	podcastmg.ErrPlaylistNotFound:          {Code: "playlist_not_found", Status: http.StatusNotFound},
+	podcastmg.ErrInvalidWebhook:            {Code: "invalid_webhook", Status: http.StatusBadRequest},
+	podcastmg.ErrWebhookAddress:            {Code: "webhook_address", Status: http.StatusBadRequest},
+	podcastmg.ErrTooManyWebhooks:           {Code: "too_many_webhooks", Status: http.StatusForbidden},
+	podcastmg.ErrWebhookNotFound:           {Code: "webhook_not_found", Status: http.StatusNotFound},
+	podcastmg.ErrInvalidDigestSettings:     {Code: "invalid_digest_settings", Status: http.StatusBadRequest},
+	podcastmg.ErrDigestNotFound:            {Code: "digest_not_found", Status: http.StatusNotFound},
+	podcastmg.ErrHubSubscriptionNotFound:   {Code: "hub_subscription_not_found", Status: http.StatusNotFound},
+	podcastmg.ErrInvalidHubIntent:          {Code: "invalid_hub_intent", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidHubContent:         {Code: "invalid_hub_content", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidPlayback:           {Code: "invalid_playback", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidDevice:             {Code: "invalid_device", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidSubscriptionChange: {Code: "invalid_subscription_change", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidEpisodeAction:      {Code: "invalid_episode_action", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidSyncToken:          {Code: "invalid_sync_token", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidChange:             {Code: "invalid_change", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidEmail:              {Code: "invalid_email", Status: http.StatusBadRequest},
+	podcastmg.ErrEmptyPassword:             {Code: "empty_password", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidAccountToken:       {Code: "invalid_account_token", Status: http.StatusBadRequest},
+	podcastmg.ErrEmailTaken:                {Code: "email_taken", Status: http.StatusConflict},
+	podcastmg.ErrInvalidAccessToken:        {Code: "invalid_access_token", Status: http.StatusUnauthorized},
+	podcastmg.ErrInvalidAccessTokenName:    {Code: "invalid_access_token_name", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidScope:              {Code: "invalid_scope", Status: http.StatusBadRequest},
+	podcastmg.ErrInvalidExpiry:             {Code: "invalid_expiry", Status: http.StatusBadRequest},
+	podcastmg.ErrTooManyAccessTokens:       {Code: "too_many_access_tokens", Status: http.StatusForbidden},
+	podcastmg.ErrUnverifiedAccount:         {Code: "unverified_account", Status: http.StatusConflict},
+}
+
+// errorFrom returns the Error to send to the client for the error. Errors of other packages which are not known to
+// be safe to send are replaced by ErrInternal, with the error as its cause
+func errorFrom(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	for cause := err; cause != nil; cause = errors.Unwrap(cause) {
+		if known, ok := foreignErrors[cause]; ok {
+			return &Error{Code: known.Code, Status: known.Status, Message: cause.Error(), Cause: err}
+		}
+	}
+	return &Error{Code: ErrInternal.Code, Status: ErrInternal.Status, Message: ErrInternal.Message, Cause: err}
+}
+
+// ErrorCode returns the code the error is sent to clients with
+func ErrorCode(err error) string {
+	return errorFrom(err).Code
+}
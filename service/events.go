@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"time"
+)
+
+// publish sends an event to the user's live streams. Streams are best effort, failures are only logged
+func (svc *podcastManageService) publish(emailID, eventType string, data interface{}) {
+	if svc.broker == nil {
+		return
+	}
+	event, err := events.New(eventType, data)
+	if err == nil {
+		err = svc.broker.Publish(emailID, event)
+	}
+	if err != nil {
+		svc.logger.Log("event", eventType, "err", err)
+	}
+}
+
+func (svc *podcastManageService) publishSubscriptionChange(emailID, action, podcastURL string) {
+	svc.publish(emailID, events.TypeSubscriptions, events.SubscriptionChange{Action: action, URL: podcastURL})
+}
+
+func (svc *podcastManageService) publishNewEpisodes(emailID string, payload podcastmg.NewEpisodesPayload) {
+	svc.publish(emailID, events.TypeNewEpisodes, payload)
+}
+
+// StreamEvents returns the live events of the user's account until the context is done
+func (svc *podcastManageService) StreamEvents(ctx context.Context, emailID string) (<-chan events.Event, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	if svc.broker == nil {
+		return nil, ErrEventsDisabled
+	}
+	stream, err := svc.broker.Subscribe(ctx, emailID)
+	if err != nil {
+		return nil, ErrEventStream.Wrap(err)
+	}
+	return stream, nil
+}
+
+// GetPlaybackStates returns the playback states of the user's episodes which changed after since, so that
+// a device can catch up on the progress made on others
+func (svc *podcastManageService) GetPlaybackStates(ctx context.Context, emailID string, since time.Time) ([]podcastmg.PlaybackState, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	states, err := svc.store.GetPlaybackStates(emailID, since)
+	if err != nil {
+		return nil, ErrPlaybackFetch.Wrap(err)
+	}
+	return states, nil
+}
+
+// UpdatePlaybackState saves the playback state of one of the user's episodes and passes it on to the user's
+// other devices
+func (svc *podcastManageService) UpdatePlaybackState(ctx context.Context, emailID string, state podcastmg.PlaybackState) (podcastmg.PlaybackState, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return state, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return state, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	err = svc.store.SavePlaybackState(emailID, &state)
+	switch {
+	case err == nil:
+		svc.publish(emailID, events.TypePlayback, state)
+		return state, nil
+	case err == podcastmg.ErrInvalidPlayback:
+		return state, err
+	case gorm.IsRecordNotFoundError(err):
+		return state, ErrEpisodeFetch.Wrap(err)
+	}
+	return state, ErrPlaybackUpdate.Wrap(err)
+}
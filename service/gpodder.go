@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// syncError passes on the errors of invalid sync requests and wraps all others in a service error
+func (svc *podcastManageService) syncError(err error, fallback *Error) error {
+	switch err {
+	case podcastmg.ErrInvalidDevice, podcastmg.ErrInvalidSubscriptionChange, podcastmg.ErrInvalidEpisodeAction,
+		podcastmg.ErrInvalidChange:
+		return err
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrUserFetch.Wrap(err)
+	}
+	return fallback.Wrap(err)
+}
+
+// syncTime turns a gpodder.net timestamp into a time, zero means from the beginning
+func syncTime(since int64) time.Time {
+	if since <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(since, 0)
+}
+
+// cleanFeedURL trims the podcast url and returns an empty string for urls which are not http(s)
+func cleanFeedURL(podcastURL string) string {
+	podcastURL = strings.TrimSpace(podcastURL)
+	parsed, err := url.Parse(podcastURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ""
+	}
+	return podcastURL
+}
+
+// GetDevices returns the user's devices
+func (svc *podcastManageService) GetDevices(ctx context.Context, emailID string) ([]podcastmg.Device, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	devices, err := svc.store.GetDevices(emailID)
+	if err != nil {
+		return nil, svc.syncError(err, ErrUserFetch)
+	}
+	return devices, nil
+}
+
+// UpdateDevice registers one of the user's devices or changes its caption and type
+func (svc *podcastManageService) UpdateDevice(ctx context.Context, emailID string, device podcastmg.Device) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.UpdateDevice(emailID, &device); err != nil {
+		return svc.syncError(err, ErrDeviceUpdate)
+	}
+	return nil
+}
+
+// GetSubscriptionChanges returns the podcasts the user subscribed to or unsubscribed from since the given
+// timestamp, in seconds since the epoch, along with the timestamp to ask from next time
+func (svc *podcastManageService) GetSubscriptionChanges(ctx context.Context, emailID, deviceID string, since int64) (podcastmg.SubscriptionChanges, error) {
+	var changes podcastmg.SubscriptionChanges
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return changes, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return changes, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	timestamp := time.Now().Unix()
+	changes, err = svc.store.GetSubscriptionChanges(emailID, deviceID, syncTime(since))
+	if err != nil {
+		return changes, svc.syncError(err, ErrSyncFetch)
+	}
+	changes.Timestamp = timestamp
+	return changes, nil
+}
+
+// UploadSubscriptionChanges applies the subscriptions and unsubscriptions a device made. Podcasts whose feed cannot
+// be fetched are still subscribed to so that the device's list is kept, they fill in on their next update
+func (svc *podcastManageService) UploadSubscriptionChanges(ctx context.Context, emailID, deviceID string, changes podcastmg.SubscriptionChanges) (podcastmg.SyncResult, error) {
+	result := podcastmg.SyncResult{UpdateURLs: [][2]string{}}
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return result, ErrInvalidClaim
+	}
+	if err := changes.Validate(); err != nil {
+		return result, err
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return result, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, err := svc.store.GetUserByEmail(emailID)
+	if err != nil {
+		return result, ErrUserFetch.Wrap(err)
+	}
+	result.Timestamp = time.Now().Unix()
+
+	var add []podcastmg.Podcast
+	for _, rawURL := range changes.Add {
+		podcastURL := cleanFeedURL(rawURL)
+		if podcastURL != rawURL {
+			result.UpdateURLs = append(result.UpdateURLs, [2]string{rawURL, podcastURL})
+		}
+		if podcastURL == "" || user.CheckSubscription(podcastmg.Podcast{URL: podcastURL}) {
+			continue
+		}
+		podcast, err := podcastmg.BuildPodcastFromURL(podcastURL)
+		if err != nil {
+			svc.logger.Log("url", podcastURL, "err", err)
+			podcast = podcastmg.Podcast{Title: podcastURL, URL: podcastURL}
+		}
+		add = append(add, podcast)
+		user.AddSubscription(podcast)
+	}
+	var remove []string
+	for _, rawURL := range changes.Remove {
+		podcastURL := cleanFeedURL(rawURL)
+		if podcastURL != rawURL {
+			result.UpdateURLs = append(result.UpdateURLs, [2]string{rawURL, podcastURL})
+		}
+		if podcastURL != "" {
+			remove = append(remove, podcastURL)
+		}
+	}
+
+	if err = svc.store.ApplySubscriptionChanges(emailID, deviceID, add, remove); err != nil {
+		return result, svc.syncError(err, ErrSyncUpdate)
+	}
+	for _, podcast := range add {
+		svc.publishSubscriptionChange(emailID, events.SubscriptionAdded, podcast.URL)
+	}
+	for _, podcastURL := range remove {
+		svc.publishSubscriptionChange(emailID, events.SubscriptionRemoved, podcastURL)
+	}
+	return result, nil
+}
+
+// GetEpisodeActions returns the episode actions the user's devices uploaded since the query's time along with the
+// timestamp to ask from next time
+func (svc *podcastManageService) GetEpisodeActions(ctx context.Context, emailID string, query podcastmg.EpisodeActionQuery) (podcastmg.EpisodeActions, error) {
+	var actions podcastmg.EpisodeActions
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return actions, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return actions, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	actions.Timestamp = time.Now().Unix()
+	actions.Actions, err = svc.store.GetEpisodeActions(emailID, query)
+	if err != nil {
+		return actions, svc.syncError(err, ErrSyncFetch)
+	}
+	return actions, nil
+}
+
+// UploadEpisodeActions records the episode actions of a device and passes the playback states they moved on to
+// the user's other devices
+func (svc *podcastManageService) UploadEpisodeActions(ctx context.Context, emailID string, actions []podcastmg.EpisodeAction) (podcastmg.SyncResult, error) {
+	result := podcastmg.SyncResult{UpdateURLs: [][2]string{}}
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return result, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return result, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	now := time.Now()
+	result.Timestamp = now.Unix()
+	states, err := svc.store.AddEpisodeActions(emailID, actions, now)
+	if err != nil {
+		return result, svc.syncError(err, ErrSyncUpdate)
+	}
+	for _, state := range states {
+		svc.publish(emailID, events.TypePlayback, state)
+	}
+	return result, nil
+}
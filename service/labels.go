@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+)
+
+// labelError passes on the errors of invalid label requests and wraps all others in a service error
+func (svc *podcastManageService) labelError(err error) error {
+	switch err {
+	case podcastmg.ErrInvalidLabel, podcastmg.ErrLabelExists, podcastmg.ErrLabelNotFound, podcastmg.ErrInvalidOrder:
+		return err
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrSubscriptionFetch.Wrap(err)
+	}
+	return ErrLabelUpdate.Wrap(err)
+}
+
+// CreateLabel creates a folder or tag for the user
+func (svc *podcastManageService) CreateLabel(ctx context.Context, emailID, kind, name string) (podcastmg.Label, error) {
+	label := podcastmg.Label{Kind: kind, Name: name}
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return label, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return label, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.CreateLabel(emailID, &label); err != nil {
+		return label, svc.labelError(err)
+	}
+	return label, nil
+}
+
+// GetLabels returns the user's folders or tags in their order
+func (svc *podcastManageService) GetLabels(ctx context.Context, emailID, kind string) ([]podcastmg.Label, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+	if kind != podcastmg.LabelFolder && kind != podcastmg.LabelTag {
+		return nil, podcastmg.ErrInvalidLabel
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	labels, err := svc.store.GetLabels(emailID, kind)
+	if err != nil {
+		return nil, ErrUserFetch.Wrap(err)
+	}
+	return labels, nil
+}
+
+// RenameLabel renames one of the user's folders or tags
+func (svc *podcastManageService) RenameLabel(ctx context.Context, emailID string, labelID uint, name string) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.RenameLabel(emailID, labelID, name); err != nil {
+		return svc.labelError(err)
+	}
+	return nil
+}
+
+// ReorderLabels sets the order of the user's folders or tags
+func (svc *podcastManageService) ReorderLabels(ctx context.Context, emailID, kind string, labelIDs []uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+	if kind != podcastmg.LabelFolder && kind != podcastmg.LabelTag {
+		return podcastmg.ErrInvalidLabel
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.ReorderLabels(emailID, kind, labelIDs); err != nil {
+		return svc.labelError(err)
+	}
+	return nil
+}
+
+// DeleteLabel removes one of the user's folders or tags, subscriptions in it are kept
+func (svc *podcastManageService) DeleteLabel(ctx context.Context, emailID string, labelID uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.DeleteLabel(emailID, labelID); err != nil {
+		return svc.labelError(err)
+	}
+	return nil
+}
+
+// SetSubscriptionFolder moves a subscription into one of the user's folders, a folderID of 0 removes it from its folder
+func (svc *podcastManageService) SetSubscriptionFolder(ctx context.Context, emailID, podcastURL string, folderID uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.SetSubscriptionFolder(emailID, podcastURL, folderID); err != nil {
+		return svc.labelError(err)
+	}
+	svc.publishSubscriptionChange(emailID, events.SubscriptionFolder, podcastURL)
+	return nil
+}
+
+// SetSubscriptionTags replaces the tags of a subscription
+func (svc *podcastManageService) SetSubscriptionTags(ctx context.Context, emailID, podcastURL string, tagIDs []uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.SetSubscriptionTags(emailID, podcastURL, tagIDs); err != nil {
+		return svc.labelError(err)
+	}
+	svc.publishSubscriptionChange(emailID, events.SubscriptionTags, podcastURL)
+	return nil
+}
+
+// FilterSubscriptions returns the user's subscriptions in the folder and with the tag, a zero id matches any
+func (svc *podcastManageService) FilterSubscriptions(ctx context.Context, emailID string, folderID, tagID uint) ([]podcastmg.Podcast, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	subscriptions, err := svc.listSubscriptions(emailID)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []podcastmg.Podcast{}
+	for _, podcast := range subscriptions {
+		if folderID != 0 && (podcast.Folder == nil || podcast.Folder.ID != folderID) {
+			continue
+		}
+		if tagID != 0 && !hasLabel(podcast.Tags, tagID) {
+			continue
+		}
+		filtered = append(filtered, podcast)
+	}
+	return filtered, nil
+}
+
+func hasLabel(labels []podcastmg.Label, labelID uint) bool {
+	for _, label := range labels {
+		if label.ID == labelID {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportOPML returns the user's subscriptions as an OPML document with an outline per folder
+func (svc *podcastManageService) ExportOPML(ctx context.Context, emailID string) (podcastmg.OPML, error) {
+	var opml podcastmg.OPML
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return opml, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return opml, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	subscriptions, err := svc.listSubscriptions(emailID)
+	if err != nil {
+		return opml, err
+	}
+	folders, err := svc.store.GetLabels(emailID, podcastmg.LabelFolder)
+	if err != nil {
+		return opml, ErrPodcastFetch.Wrap(err)
+	}
+	return podcastmg.NewOPML("Podcast subscriptions of "+emailID, subscriptions, folders), nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/tchaudhry91/podcast-manage-svc/ratelimit"
+	"net"
+	"strings"
+	"time"
+)
+
+// limitedError is returned in place of an attempt which was not made because of too many earlier ones, it reads
+// as ErrTooManyAttempts and carries how long to wait before trying again
+type limitedError struct {
+	retryAfter time.Duration
+}
+
+func (e limitedError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+// Unwrap returns ErrTooManyAttempts, which is sent to the client
+func (e limitedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// seconds returns the wait rounded up to whole seconds, as sent in the Retry-After header
+func (e limitedError) seconds() int {
+	return int((e.retryAfter + time.Second - 1) / time.Second)
+}
+
+// loginLimitMiddleware throttles the methods which check the user's password, all others are passed through
+type loginLimitMiddleware struct {
+	PodcastManageService
+	logger       log.Logger
+	limiter      *ratelimit.Limiter
+	forwardedFor bool
+}
+
+// MakeLoginLimitMiddleware limits the password checks of the service per account and per client address with the
+// limiter, an account or address is locked out after repeated wrong passwords. The client address is taken from
+// the last X-Forwarded-For entry if forwardedFor is set, which must only be done behind a proxy setting it
+func MakeLoginLimitMiddleware(logger log.Logger, limiter *ratelimit.Limiter, forwardedFor bool, next PodcastManageService) PodcastManageService {
+	return loginLimitMiddleware{
+		next,
+		logger,
+		limiter,
+		forwardedFor,
+	}
+}
+
+// clientAddress returns the address of the client making the request, empty if the request did not come over HTTP
+func (mw loginLimitMiddleware) clientAddress(ctx context.Context) string {
+	if mw.forwardedFor {
+		forwarded, _ := ctx.Value(kithttp.ContextKeyRequestXForwardedFor).(string)
+		if i := strings.LastIndex(forwarded, ","); i >= 0 {
+			forwarded = forwarded[i+1:]
+		}
+		if forwarded = strings.TrimSpace(forwarded); forwarded != "" {
+			return forwarded
+		}
+	}
+	remoteAddr, _ := ctx.Value(kithttp.ContextKeyRequestRemoteAddr).(string)
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// limit makes the attempt unless the account or client is limited, a wrong password counts as a failure. Attempts
+// are let through if the limiter's store fails
+func (mw loginLimitMiddleware) limit(ctx context.Context, emailID string, attempt func() error) error {
+	keys := []string{"account:" + strings.ToLower(emailID)}
+	if address := mw.clientAddress(ctx); address != "" {
+		keys = append(keys, "ip:"+address)
+	}
+	wait, err := mw.limiter.Allow(keys...)
+	if err != nil {
+		mw.logger.Log("err", err)
+	} else if wait > 0 {
+		return limitedError{wait}
+	}
+
+	err = attempt()
+	var e error
+	switch {
+	case err == nil:
+		e = mw.limiter.Succeed(keys...)
+	case errors.Is(err, ErrInvalidPassword):
+		e = mw.limiter.Fail(keys...)
+	}
+	if e != nil {
+		mw.logger.Log("err", e)
+	}
+	return err
+}
+
+func (mw loginLimitMiddleware) GetToken(ctx context.Context, emailID, password string) (token string, err error) {
+	err = mw.limit(ctx, emailID, func() error {
+		token, err = mw.PodcastManageService.GetToken(ctx, emailID, password)
+		return err
+	})
+	return token, err
+}
+
+func (mw loginLimitMiddleware) ChangePassword(ctx context.Context, emailID, oldPassword, newPassword string) error {
+	return mw.limit(ctx, emailID, func() error {
+		return mw.PodcastManageService.ChangePassword(ctx, emailID, oldPassword, newPassword)
+	})
+}
+
+func (mw loginLimitMiddleware) RequestEmailChange(ctx context.Context, emailID, password, newEmail string) error {
+	return mw.limit(ctx, emailID, func() error {
+		return mw.PodcastManageService.RequestEmailChange(ctx, emailID, password, newEmail)
+	})
+}
+
+func (mw loginLimitMiddleware) DeleteAccount(ctx context.Context, emailID, password string) error {
+	return mw.limit(ctx, emailID, func() error {
+		return mw.PodcastManageService.DeleteAccount(ctx, emailID, password)
+	})
+}
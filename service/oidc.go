@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"time"
+)
+
+const (
+	// OIDCLoginPath starts a login with the OpenID Connect provider, OIDCCallbackPath is where the provider sends
+	// the user back to
+	OIDCLoginPath    = "/login/oidc"
+	OIDCCallbackPath = "/login/oidc/callback"
+
+	// oidcSessionTTL is how long a user may take to sign in with the provider
+	oidcSessionTTL = 10 * time.Minute
+)
+
+// OIDCLogin is a login started with the OpenID Connect provider. The user is sent to AuthURL, Session has to be
+// handed back along with the provider's response to complete the login
+type OIDCLogin struct {
+	AuthURL string `json:"auth_url"`
+	Session string `json:"session"`
+}
+
+// oidcSessionClaims keep the secrets of a login while the user signs in with the provider
+type oidcSessionClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+// WithOIDC enables logins with the OpenID Connect provider, users are linked by the email the provider verified
+func WithOIDC(provider *oidc.Provider) Option {
+	return func(svc *podcastManageService) {
+		svc.oidc = provider
+	}
+}
+
+// oidcSessionKey signs login sessions, it is derived from the signing string so that sessions are never taken
+// for tokens. Without a signing string the sessions are signed with a random key of this process
+func (svc *podcastManageService) oidcSessionKey() []byte {
+	secret := []byte(svc.tokenSigningString)
+	if len(secret) == 0 {
+		secret = svc.processKey
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("oidc-session"))
+	return mac.Sum(nil)
+}
+
+// BeginOIDCLogin starts a login with the OpenID Connect provider
+func (svc *podcastManageService) BeginOIDCLogin(ctx context.Context) (OIDCLogin, error) {
+	if svc.oidc == nil {
+		return OIDCLogin{}, ErrOIDCDisabled
+	}
+	var claims oidcSessionClaims
+	for _, secret := range []*string{&claims.State, &claims.Nonce, &claims.Verifier} {
+		var err error
+		if *secret, err = oidc.NewSecret(); err != nil {
+			return OIDCLogin{}, ErrOIDCLogin.Wrap(err)
+		}
+	}
+	claims.ExpiresAt = time.Now().Add(oidcSessionTTL).Unix()
+	session, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(svc.oidcSessionKey())
+	if err != nil {
+		return OIDCLogin{}, ErrOIDCLogin.Wrap(err)
+	}
+	return OIDCLogin{svc.oidc.AuthCodeURL(claims.State, claims.Nonce, claims.Verifier), session}, nil
+}
+
+// CompleteOIDCLogin exchanges the authorization code the provider returned to the login's session for the user's
+// identity and returns a token of the user linked to it. Users are created on their first login, an identity is
+// only linked to a user by an email the provider verified
+func (svc *podcastManageService) CompleteOIDCLogin(ctx context.Context, session, state, code string) (string, error) {
+	if svc.oidc == nil {
+		return "", ErrOIDCDisabled
+	}
+	var claims oidcSessionClaims
+	_, err := new(jwt.Parser).ParseWithClaims(session, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrOIDCLogin
+		}
+		return svc.oidcSessionKey(), nil
+	})
+	if err != nil || subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 || code == "" {
+		return "", ErrOIDCLogin
+	}
+	identity, err := svc.oidc.Exchange(ctx, code, claims.Verifier, claims.Nonce)
+	if err != nil {
+		return "", ErrOIDCLogin.Wrap(err)
+	}
+	if !identity.EmailVerified {
+		return "", ErrEmailNotVerified
+	}
+
+	err = svc.store.Connect()
+	if err != nil {
+		return "", ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, _, err := svc.store.LinkIdentity(identity.Issuer, identity.Subject, identity.Email, time.Now())
+	if err == podcastmg.ErrInvalidEmail || err == podcastmg.ErrUnverifiedAccount {
+		return "", err
+	}
+	if err != nil {
+		return "", ErrUserCreate.Wrap(err)
+	}
+	return svc.signToken(user.ID, user.UserEmail, nil, time.Now().Add(tokenLifetime))
+}
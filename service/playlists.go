@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+)
+
+// playlistError passes on the errors of invalid playlist requests and wraps all others in a service error
+func (svc *podcastManageService) playlistError(err error) error {
+	switch err {
+	case podcastmg.ErrInvalidPlaylist, podcastmg.ErrInvalidRules, podcastmg.ErrPlaylistNotFound:
+		return err
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrEpisodeFetch.Wrap(err)
+	}
+	return ErrPlaylistUpdate.Wrap(err)
+}
+
+// CreatePlaylist creates a playlist for the user, the playlist is a smart playlist if it has rules
+func (svc *podcastManageService) CreatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) (podcastmg.Playlist, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.Playlist{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.Playlist{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.CreatePlaylist(emailID, &playlist); err != nil {
+		return podcastmg.Playlist{}, svc.playlistError(err)
+	}
+	return playlist, nil
+}
+
+// GetPlaylists returns the user's playlists without their episodes
+func (svc *podcastManageService) GetPlaylists(ctx context.Context, emailID string) ([]podcastmg.Playlist, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	playlists, err := svc.store.GetPlaylists(emailID)
+	if err != nil {
+		return nil, ErrUserFetch.Wrap(err)
+	}
+	return playlists, nil
+}
+
+// GetPlaylist returns one of the user's playlists along with its episodes, smart playlists are evaluated on each call
+func (svc *podcastManageService) GetPlaylist(ctx context.Context, emailID string, playlistID uint) (podcastmg.Playlist, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.Playlist{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.Playlist{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	playlist, err := svc.store.GetPlaylist(emailID, playlistID)
+	if err == podcastmg.ErrPlaylistNotFound {
+		return podcastmg.Playlist{}, err
+	}
+	if err != nil {
+		return podcastmg.Playlist{}, ErrEpisodeFetch.Wrap(err)
+	}
+	return playlist, nil
+}
+
+// GetPlaylistFeed returns the playlist of a feed url along with its episodes, the feed secret stands in for the
+// user's credentials
+func (svc *podcastManageService) GetPlaylistFeed(ctx context.Context, secret string) (podcastmg.Playlist, error) {
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.Playlist{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	playlist, err := svc.store.GetPlaylistFeed(secret)
+	if err == podcastmg.ErrPlaylistNotFound {
+		return podcastmg.Playlist{}, err
+	}
+	if err != nil {
+		return podcastmg.Playlist{}, ErrEpisodeFetch.Wrap(err)
+	}
+	return playlist, nil
+}
+
+// UpdatePlaylist saves the name and rules of one of the user's playlists
+func (svc *podcastManageService) UpdatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.UpdatePlaylist(emailID, &playlist); err != nil {
+		return svc.playlistError(err)
+	}
+	return nil
+}
+
+// DeletePlaylist removes one of the user's playlists, its episodes are kept
+func (svc *podcastManageService) DeletePlaylist(ctx context.Context, emailID string, playlistID uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.DeletePlaylist(emailID, playlistID); err != nil {
+		return svc.playlistError(err)
+	}
+	return nil
+}
+
+// SetPlaylistItems replaces the episodes of one of the user's manual playlists
+func (svc *podcastManageService) SetPlaylistItems(ctx context.Context, emailID string, playlistID uint, itemIDs []uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.SetPlaylistItems(emailID, playlistID, itemIDs); err != nil {
+		return svc.playlistError(err)
+	}
+	return nil
+}
@@ -2,46 +2,212 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	jwt "github.com/dgrijalva/jwt-go"
 	kitjwt "github.com/go-kit/kit/auth/jwt"
 	"github.com/go-kit/kit/log"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/mail"
+	"github.com/tchaudhry91/podcast-manage-svc/oidc"
 	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/signing"
+	"net/http"
 	"time"
 )
 
 var (
 	// ErrDBConn indicates a failure to connect to the database
-	ErrDBConn = errors.New("DB Connection Failed")
+	ErrDBConn = newError("db_unavailable", http.StatusServiceUnavailable, "DB Connection Failed")
 
 	// ErrUserCreate indicate a failure to create a user
-	ErrUserCreate = errors.New("Failed to create User")
+	ErrUserCreate = newError("user_create_failed", http.StatusInternalServerError, "Failed to create User")
 
 	// ErrUserFetch indicates a failure to fetch the user from the Datastore
-	ErrUserFetch = errors.New("Failed to get user")
+	ErrUserFetch = newError("user_fetch_failed", http.StatusBadRequest, "Failed to get user")
 
 	//ErrPodcastBuild indicates a failure to build the podcast for the given URL
-	ErrPodcastBuild = errors.New("Failed to build podcast from given URL")
+	ErrPodcastBuild = newError("podcast_build_failed", http.StatusInternalServerError, "Failed to build podcast from given URL")
 
 	//ErrPodcastUpdate indicates a failure to update the podcast for the given URL
-	ErrPodcastUpdate = errors.New("Failed to update the podcast in the database")
+	ErrPodcastUpdate = newError("podcast_update_failed", http.StatusInternalServerError, "Failed to update the podcast in the database")
 
 	// ErrUserUpdate indicates a failure to save an updated user to the Datastore
-	ErrUserUpdate = errors.New("Failed to save user update to Database")
+	ErrUserUpdate = newError("user_update_failed", http.StatusInternalServerError, "Failed to save user update to Database")
 
 	// ErrPodcastFetch indicates a failure to fetch user subscriptions from the Datastore
-	ErrPodcastFetch = errors.New("Failed to fetch subscriptions")
+	ErrPodcastFetch = newError("podcast_fetch_failed", http.StatusInternalServerError, "Failed to fetch subscriptions")
 
 	// ErrInvalidPassword indicates a failure to match password
-	ErrInvalidPassword = errors.New("Invalid password provided")
+	ErrInvalidPassword = newError("invalid_password", http.StatusUnauthorized, "Invalid password provided")
 
 	// ErrInvalidCLaim indicates a mismatch in request and the claim provided by the token
-	ErrInvalidClaim = errors.New("User/Token mismatch")
+	ErrInvalidClaim = newError("invalid_claim", http.StatusUnauthorized, "User/Token mismatch")
+
+	// ErrEpisodeFetch indicates a failure to fetch an episode of the user's subscriptions from the Datastore
+	ErrEpisodeFetch = newError("episode_not_found", http.StatusNotFound, "Failed to get episode")
+
+	// ErrArchiveDisabled indicates that the service runs without a media archiver
+	ErrArchiveDisabled = newError("archive_disabled", http.StatusNotImplemented, "Media archiving is not enabled")
+
+	// ErrArchive indicates a failure to download an episode's media into the archive
+	ErrArchive = newError("archive_failed", http.StatusInternalServerError, "Failed to archive episode media")
+
+	// ErrMediaNotArchived indicates that the episode's media has not been archived
+	ErrMediaNotArchived = newError("media_not_archived", http.StatusNotFound, "Episode media is not archived")
+
+	// ErrSearch indicates a failure to search the Datastore
+	ErrSearch = newError("search_failed", http.StatusInternalServerError, "Failed to search podcasts")
+
+	// ErrInvalidSearchScope indicates a search scope other than subscriptions or catalog
+	ErrInvalidSearchScope = newError("invalid_search_scope", http.StatusBadRequest, "Invalid search scope")
+
+	// ErrUnknownDirectory indicates a discovery list other than popular, trending, recent or related
+	ErrUnknownDirectory = newError("unknown_directory", http.StatusBadRequest, "Unknown directory list")
+
+	// ErrDirectoryURL indicates a related podcasts request without the podcast url to relate to
+	ErrDirectoryURL = newError("directory_url_required", http.StatusBadRequest, "Related podcasts need a podcast url")
+
+	// ErrDirectoryDisabled indicates that the service runs without a Directory
+	ErrDirectoryDisabled = newError("directory_disabled", http.StatusNotImplemented, "Podcast directory is not enabled")
+
+	// ErrDirectoryNotReady indicates that the directory lists were not computed yet after the start of the service
+	ErrDirectoryNotReady = newError("directory_not_ready", http.StatusServiceUnavailable, "Podcast directory is not computed yet")
+
+	// ErrDirectory indicates a failure to compute a directory list from the Datastore
+	ErrDirectory = newError("directory_failed", http.StatusInternalServerError, "Failed to compute podcast directory")
+
+	// ErrSubscriptionFetch indicates a failure to fetch one of the user's subscriptions from the Datastore
+	ErrSubscriptionFetch = newError("subscription_not_found", http.StatusNotFound, "Failed to get subscription")
+
+	// ErrSubscriptionUpdate indicates a failure to save the settings of a subscription to the Datastore
+	ErrSubscriptionUpdate = newError("subscription_update_failed", http.StatusInternalServerError, "Failed to save subscription settings")
+
+	// ErrLabelUpdate indicates a failure to save a folder or tag to the Datastore
+	ErrLabelUpdate = newError("label_update_failed", http.StatusInternalServerError, "Failed to save folder or tag")
+
+	// ErrQueueFetch indicates a failure to get the user's queue from the Datastore
+	ErrQueueFetch = newError("queue_fetch_failed", http.StatusInternalServerError, "Failed to get queue")
+
+	// ErrQueueUpdate indicates a failure to save a change of the user's queue to the Datastore
+	ErrQueueUpdate = newError("queue_update_failed", http.StatusInternalServerError, "Failed to update queue")
+
+	// ErrPlaylistUpdate indicates a failure to save a playlist to the Datastore
+	ErrPlaylistUpdate = newError("playlist_update_failed", http.StatusInternalServerError, "Failed to save playlist")
+
+	// ErrWebhookUpdate indicates a failure to save a webhook to the Datastore
+	ErrWebhookUpdate = newError("webhook_update_failed", http.StatusInternalServerError, "Failed to save webhook")
+
+	// ErrDigestUpdate indicates a failure to save the user's digest preferences to the Datastore
+	ErrDigestUpdate = newError("digest_update_failed", http.StatusInternalServerError, "Failed to save digest settings")
+
+	// ErrHubCallback indicates a failure to record a hub's verification or pushed content in the Datastore
+	ErrHubCallback = newError("hub_callback_failed", http.StatusInternalServerError, "Failed to handle hub callback")
+
+	// ErrEventsDisabled indicates that the service runs without an event broker
+	ErrEventsDisabled = newError("events_disabled", http.StatusNotImplemented, "Live events are not enabled")
+
+	// ErrEventStream indicates a failure to subscribe to the user's events
+	ErrEventStream = newError("event_stream_failed", http.StatusInternalServerError, "Failed to open event stream")
+
+	// ErrPlaybackFetch indicates a failure to get the user's playback states from the Datastore
+	ErrPlaybackFetch = newError("playback_fetch_failed", http.StatusInternalServerError, "Failed to get playback states")
+
+	// ErrPlaybackUpdate indicates a failure to save an episode's playback state to the Datastore
+	ErrPlaybackUpdate = newError("playback_update_failed", http.StatusInternalServerError, "Failed to save playback state")
+
+	// ErrDeviceUpdate indicates a failure to save one of the user's devices to the Datastore
+	ErrDeviceUpdate = newError("device_update_failed", http.StatusInternalServerError, "Failed to save device")
+
+	// ErrSyncFetch indicates a failure to get the subscription changes or episode actions of the user's devices
+	ErrSyncFetch = newError("sync_fetch_failed", http.StatusInternalServerError, "Failed to get sync changes")
+
+	// ErrSyncUpdate indicates a failure to save the subscription changes or episode actions a device uploaded
+	ErrSyncUpdate = newError("sync_update_failed", http.StatusInternalServerError, "Failed to save sync changes")
+
+	// ErrMailDisabled indicates that the service runs without a mailer
+	ErrMailDisabled = newError("mail_disabled", http.StatusNotImplemented, "Email is not enabled")
+
+	// ErrMailSend indicates a failure to send an email to the user
+	ErrMailSend = newError("mail_send_failed", http.StatusInternalServerError, "Failed to send email")
+
+	// ErrEmailVerified indicates a verification request for an email which is verified already
+	ErrEmailVerified = newError("email_already_verified", http.StatusConflict, "Email is already verified")
+
+	// ErrAccountUpdate indicates a failure to save the user's verified email or new password to the Datastore
+	ErrAccountUpdate = newError("account_update_failed", http.StatusInternalServerError, "Failed to update account")
+
+	// ErrAccountExport indicates a failure to read the data kept for the user from the Datastore
+	ErrAccountExport = newError("account_export_failed", http.StatusInternalServerError, "Failed to export account")
+
+	// ErrAccountDelete indicates a failure to delete the user and their data from the Datastore
+	ErrAccountDelete = newError("account_delete_failed", http.StatusInternalServerError, "Failed to delete account")
+
+	// ErrTooManyAttempts indicates a password check refused because of too many recent attempts for the account or
+	// from the client
+	ErrTooManyAttempts = newError("too_many_attempts", http.StatusTooManyRequests, "Too many attempts, try again later")
+
+	// ErrTokenRevoked indicates a token issued before the user last changed their password, or for a user who no
+	// longer exists
+	ErrTokenRevoked = newError("token_revoked", http.StatusUnauthorized, "Token was revoked, log in again")
+
+	// ErrInsufficientScope indicates a request made with an access token whose scopes do not cover it
+	ErrInsufficientScope = newError("insufficient_scope", http.StatusForbidden, "Access token scope does not allow this request")
+
+	// ErrAccessTokenNotFound indicates an access token which does not exist or belongs to another user
+	ErrAccessTokenNotFound = newError("access_token_not_found", http.StatusNotFound, "Access token not found")
+
+	// ErrAccessTokenUpdate indicates a failure to save an access token to the Datastore
+	ErrAccessTokenUpdate = newError("access_token_update_failed", http.StatusInternalServerError, "Failed to save access token")
+
+	// ErrOIDCDisabled indicates a login with an OpenID Connect provider on a service without one
+	ErrOIDCDisabled = newError("oidc_disabled", http.StatusNotImplemented, "OpenID Connect login is not enabled")
+
+	// ErrOIDCLogin indicates a login with the OpenID Connect provider which expired, was tampered with or was not
+	// completed by the provider
+	ErrOIDCLogin = newError("oidc_login_failed", http.StatusUnauthorized, "OpenID Connect login failed")
+
+	// ErrEmailNotVerified indicates a login with an OpenID Connect provider which did not verify the user's email
+	ErrEmailNotVerified = newError("email_not_verified", http.StatusForbidden, "Email is not verified by the identity provider")
 )
 
-// TokenClaims is a custom claims struct to issue JWT tokens
+const (
+	// defaultSearchLimit is the page size of searches which do not ask for one
+	defaultSearchLimit = 20
+
+	// maxSearchLimit is the largest page size a search may ask for
+	maxSearchLimit = 100
+
+	// defaultSyncLimit is the number of changes returned by syncs which do not ask for a number
+	defaultSyncLimit = 200
+
+	// maxSyncLimit is the largest number of changes a sync may ask for
+	maxSyncLimit = 1000
+
+	// verifyEmailTTL is how long the link of a verification email can be used
+	verifyEmailTTL = 48 * time.Hour
+
+	// resetPasswordTTL is how long the link of a password reset email can be used
+	resetPasswordTTL = time.Hour
+
+	// changeEmailTTL is how long the link confirming a change of email can be used
+	changeEmailTTL = 24 * time.Hour
+
+	// tokenLifetime is how long a token issued on login is valid
+	tokenLifetime = 24 * time.Hour
+
+	// accessTokenLifetime is the longest a token issued in exchange for an access token is valid
+	accessTokenLifetime = 15 * time.Minute
+)
+
+// TokenClaims is a custom claims struct to issue JWT tokens. Tokens issued for an access token carry its scopes,
+// tokens without scopes grant full access. Emails change hands, so the token names the user by ID as well
 type TokenClaims struct {
-	EmailID string `json:"email_id"`
+	UserID  uint     `json:"user_id"`
+	EmailID string   `json:"email_id"`
+	Scopes  []string `json:"scopes,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -56,22 +222,135 @@ type PodcastManageService interface {
 	GetUserSubscriptions(ctx context.Context, emailID string) ([]podcastmg.Podcast, error)
 	GetSubscriptionDetails(ctx context.Context, emailID, podcastURL string) (podcastmg.Podcast, error)
 	GetToken(ctx context.Context, emailID, password string) (string, error)
+	CheckToken(ctx context.Context) error
+	ArchiveEpisode(ctx context.Context, emailID string, itemID uint) error
+	GetEpisodeMedia(ctx context.Context, emailID string, itemID uint) (archive.Blob, error)
+	Search(ctx context.Context, emailID string, query podcastmg.SearchQuery) (podcastmg.SearchResults, error)
+	Discover(ctx context.Context, list, podcastURL string, limit int) ([]podcastmg.DirectoryEntry, error)
+	GetSubscriptionTotals(ctx context.Context, emailID string) ([]podcastmg.SubscriptionTotals, error)
+	GetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) (podcastmg.SubscriptionSettings, error)
+	UpdateSubscriptionSettings(ctx context.Context, emailID, podcastURL string, settings podcastmg.SubscriptionSettings) error
+	ResetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) error
+	CreateLabel(ctx context.Context, emailID, kind, name string) (podcastmg.Label, error)
+	GetLabels(ctx context.Context, emailID, kind string) ([]podcastmg.Label, error)
+	RenameLabel(ctx context.Context, emailID string, labelID uint, name string) error
+	ReorderLabels(ctx context.Context, emailID, kind string, labelIDs []uint) error
+	DeleteLabel(ctx context.Context, emailID string, labelID uint) error
+	SetSubscriptionFolder(ctx context.Context, emailID, podcastURL string, folderID uint) error
+	SetSubscriptionTags(ctx context.Context, emailID, podcastURL string, tagIDs []uint) error
+	FilterSubscriptions(ctx context.Context, emailID string, folderID, tagID uint) ([]podcastmg.Podcast, error)
+	ExportOPML(ctx context.Context, emailID string) (podcastmg.OPML, error)
+	GetQueue(ctx context.Context, emailID string) (podcastmg.Queue, error)
+	UpdateQueue(ctx context.Context, emailID string, version int64, op podcastmg.QueueOp) (podcastmg.Queue, error)
+	CreatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) (podcastmg.Playlist, error)
+	GetPlaylists(ctx context.Context, emailID string) ([]podcastmg.Playlist, error)
+	GetPlaylist(ctx context.Context, emailID string, playlistID uint) (podcastmg.Playlist, error)
+	GetPlaylistFeed(ctx context.Context, secret string) (podcastmg.Playlist, error)
+	UpdatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) error
+	DeletePlaylist(ctx context.Context, emailID string, playlistID uint) error
+	SetPlaylistItems(ctx context.Context, emailID string, playlistID uint, itemIDs []uint) error
+	CreateWebhook(ctx context.Context, emailID, webhookURL string) (podcastmg.Webhook, error)
+	GetWebhooks(ctx context.Context, emailID string) ([]podcastmg.Webhook, error)
+	DeleteWebhook(ctx context.Context, emailID string, webhookID uint) error
+	GetWebhookDeliveries(ctx context.Context, emailID string, webhookID uint) ([]podcastmg.WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, emailID string, deliveryID uint) error
+	GetDigestSchedule(ctx context.Context, emailID string) (podcastmg.DigestSchedule, error)
+	UpdateDigestSettings(ctx context.Context, emailID string, settings podcastmg.DigestSettings) (podcastmg.DigestSchedule, error)
+	UnsubscribeDigest(ctx context.Context, token string) error
+	VerifyHubIntent(ctx context.Context, subscriptionID uint, intent podcastmg.HubIntent, challenge string) (string, error)
+	ReceiveHubContent(ctx context.Context, subscriptionID uint, signature string, content []byte) error
+	StreamEvents(ctx context.Context, emailID string) (<-chan events.Event, error)
+	GetPlaybackStates(ctx context.Context, emailID string, since time.Time) ([]podcastmg.PlaybackState, error)
+	UpdatePlaybackState(ctx context.Context, emailID string, state podcastmg.PlaybackState) (podcastmg.PlaybackState, error)
+	GetDevices(ctx context.Context, emailID string) ([]podcastmg.Device, error)
+	UpdateDevice(ctx context.Context, emailID string, device podcastmg.Device) error
+	GetSubscriptionChanges(ctx context.Context, emailID, deviceID string, since int64) (podcastmg.SubscriptionChanges, error)
+	UploadSubscriptionChanges(ctx context.Context, emailID, deviceID string, changes podcastmg.SubscriptionChanges) (podcastmg.SyncResult, error)
+	GetEpisodeActions(ctx context.Context, emailID string, query podcastmg.EpisodeActionQuery) (podcastmg.EpisodeActions, error)
+	UploadEpisodeActions(ctx context.Context, emailID string, actions []podcastmg.EpisodeAction) (podcastmg.SyncResult, error)
+	Sync(ctx context.Context, emailID, token string, limit int) (podcastmg.SyncDelta, error)
+	UploadChanges(ctx context.Context, emailID, device string, changes []podcastmg.Change) ([]podcastmg.Change, error)
+	RequestEmailVerification(ctx context.Context, emailID string) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, emailID string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	ChangePassword(ctx context.Context, emailID, oldPassword, newPassword string) error
+	RequestEmailChange(ctx context.Context, emailID, password, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	ExportAccount(ctx context.Context, emailID string) (podcastmg.UserExport, error)
+	DeleteAccount(ctx context.Context, emailID, password string) error
+	CreateAccessToken(ctx context.Context, emailID string, token podcastmg.AccessToken) (podcastmg.AccessToken, error)
+	GetAccessTokens(ctx context.Context, emailID string) ([]podcastmg.AccessToken, error)
+	RevokeAccessToken(ctx context.Context, emailID string, tokenID uint) error
+	ExchangeAccessToken(ctx context.Context, token string) (string, error)
+	BeginOIDCLogin(ctx context.Context) (OIDCLogin, error)
+	CompleteOIDCLogin(ctx context.Context, session, state, code string) (string, error)
 }
 
 type podcastManageService struct {
 	store              podcastmg.Store
 	logger             log.Logger
 	tokenSigningString string
+	archiver           *archive.Archiver
+	directory          *Directory
+	broker             events.Broker
+	mailer             mail.Mailer
+	baseURL            string
+	hasher             podcastmg.PasswordHasher
+	oidc               *oidc.Provider
+	keys               *signing.KeySet
+	processKey         []byte
+}
+
+// Option configures optional components of the service
+type Option func(*podcastManageService)
+
+// WithArchiver enables media archiving of episodes with the given Archiver
+func WithArchiver(archiver *archive.Archiver) Option {
+	return func(svc *podcastManageService) {
+		svc.archiver = archiver
+	}
+}
+
+// WithBroker enables live event streams, the events of every user are passed through the given Broker
+func WithBroker(broker events.Broker) Option {
+	return func(svc *podcastManageService) {
+		svc.broker = broker
+	}
+}
+
+// WithMailer enables email verification and password resets, the links in the emails point to the service at baseURL
+func WithMailer(mailer mail.Mailer, baseURL string) Option {
+	return func(svc *podcastManageService) {
+		svc.mailer = mailer
+		svc.baseURL = baseURL
+	}
+}
+
+// WithPasswordHasher sets the hasher of new passwords, podcastmg.DefaultPasswordHasher is used otherwise. Hashes
+// made by other hashers still verify and are replaced by one of this hasher when their user logs in
+func WithPasswordHasher(hasher podcastmg.PasswordHasher) Option {
+	return func(svc *podcastManageService) {
+		svc.hasher = hasher
+	}
+}
+
+// WithSigningKeys signs tokens with the active key of the set and names it by the kid of the tokens, an HS256 key
+// of the signing string is used otherwise
+func WithSigningKeys(keys *signing.KeySet) Option {
+	return func(svc *podcastManageService) {
+		svc.keys = keys
+	}
 }
 
 // NewSQLStorePodcastManageService returns a pmg-svc backed by a SQL based DB Store
-func NewSQLStorePodcastManageService(dialect, connectionString, tokenSigningString string, logger log.Logger) (PodcastManageService, error) {
+func NewSQLStorePodcastManageService(dialect, connectionString, tokenSigningString string, logger log.Logger, options ...Option) (PodcastManageService, error) {
 	var svc podcastManageService
 	store := podcastmg.NewDBStore(dialect, connectionString)
 	err := store.Connect()
 	if err != nil {
 		logger.Log("err", err)
-		return &svc, ErrDBConn
+		return &svc, ErrDBConn.Wrap(err)
 	}
 	defer store.Close()
 	err = store.Migrate()
@@ -84,27 +363,50 @@ func NewSQLStorePodcastManageService(dialect, connectionString, tokenSigningStri
 		store:              store,
 		tokenSigningString: tokenSigningString,
 		logger:             logger,
+		hasher:             podcastmg.DefaultPasswordHasher,
+	}
+	for _, option := range options {
+		option(&svc)
+	}
+	if svc.keys == nil {
+		svc.keys, _ = signing.NewKeySet(signing.NewHMACKey("", []byte(tokenSigningString)))
+	}
+	svc.processKey = make([]byte, 32)
+	if _, err = rand.Read(svc.processKey); err != nil {
+		return &svc, err
+	}
+	if svc.broker != nil {
+		store.OnNewEpisodes(svc.publishNewEpisodes)
 	}
 	return &svc, nil
 }
 
-// CreateUser registers a new user in the store
+// CreateUser registers a new user in the store and mails a verification link if the service has a mailer. The
+// user can sign in before verifying, a link which could not be sent can be asked for again
 func (svc *podcastManageService) CreateUser(ctx context.Context, emailID string, password string) error {
-	user, err := podcastmg.NewUser(emailID, password)
+	user, err := podcastmg.NewUserWithHasher(emailID, password, svc.hasher)
+	if err == podcastmg.ErrInvalidEmail {
+		return err
+	}
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrUserCreate
+		return ErrUserCreate.Wrap(err)
 	}
 	err = svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrDBConn
+		return ErrDBConn.Wrap(err)
 	}
 	defer svc.store.Close()
 	err = svc.store.CreateUser(&user)
+	if err == podcastmg.ErrEmailTaken {
+		return err
+	}
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrUserCreate
+		return ErrUserCreate.Wrap(err)
+	}
+	if svc.mailer != nil {
+		if err = svc.sendAccountToken(ctx, emailID, podcastmg.TokenVerifyEmail); err != nil {
+			svc.logger.Log("err", err)
+		}
 	}
 	return nil
 }
@@ -121,14 +423,12 @@ func (svc *podcastManageService) GetUser(ctx context.Context, emailID string) (p
 
 	err := svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return user, ErrDBConn
+		return user, ErrDBConn.Wrap(err)
 	}
 	defer svc.store.Close()
 	user, err = svc.store.GetUserByEmail(emailID)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return user, ErrUserFetch
+		return user, ErrUserFetch.Wrap(err)
 	}
 	return user, nil
 }
@@ -137,13 +437,13 @@ func (svc *podcastManageService) GetUser(ctx context.Context, emailID string) (p
 func (svc *podcastManageService) GetPodcastDetails(ctx context.Context, url string) (podcastmg.Podcast, error) {
 	podcast, err := podcastmg.BuildPodcastFromURL(url)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return podcast, ErrPodcastBuild
+		return podcast, ErrPodcastBuild.Wrap(err)
 	}
 	return podcast, nil
 }
 
-// Subscribe adds a podcast subscription to a user and saves it in the database
+// Subscribe adds a podcast subscription to a user and saves it in the database along with the change, the event
+// is published once both are saved
 func (svc *podcastManageService) Subscribe(ctx context.Context, emailID, podcastURL string) error {
 
 	// Match Token Claim emailID to requested ID
@@ -154,30 +454,30 @@ func (svc *podcastManageService) Subscribe(ctx context.Context, emailID, podcast
 
 	err := svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrDBConn
+		return ErrDBConn.Wrap(err)
 	}
 	defer svc.store.Close()
 	user, err := svc.store.GetUserByEmail(emailID)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrUserFetch
+		return ErrUserFetch.Wrap(err)
+	}
+	if user.CheckSubscription(podcastmg.Podcast{URL: podcastURL}) {
+		return nil
 	}
 	podcast, err := podcastmg.BuildPodcastFromURL(podcastURL)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrPodcastBuild
+		return ErrPodcastBuild.Wrap(err)
 	}
-	user.AddSubscription(podcast)
-	err = svc.store.UpdateUser(&user)
+	err = svc.store.ApplySubscriptionChanges(emailID, "", []podcastmg.Podcast{podcast}, nil)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrUserUpdate
+		return ErrUserUpdate.Wrap(err)
 	}
+	svc.publishSubscriptionChange(emailID, events.SubscriptionAdded, podcastURL)
 	return nil
 }
 
-// Unsubscribe removes a podcast for a user's list of subscriptions
+// Unsubscribe removes a podcast for a user's list of subscriptions and saves the change along with it, the event
+// is published once both are saved
 func (svc *podcastManageService) Unsubscribe(ctx context.Context, emailID, podcastURL string) error {
 
 	// Match Token Claim emailID to requested ID
@@ -188,26 +488,21 @@ func (svc *podcastManageService) Unsubscribe(ctx context.Context, emailID, podca
 
 	err := svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrDBConn
+		return ErrDBConn.Wrap(err)
 	}
 	defer svc.store.Close()
 	user, err := svc.store.GetUserByEmail(emailID)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrUserFetch
+		return ErrUserFetch.Wrap(err)
 	}
-	podcast, err := podcastmg.BuildPodcastFromURL(podcastURL)
-	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrPodcastBuild
+	if !user.CheckSubscription(podcastmg.Podcast{URL: podcastURL}) {
+		return nil
 	}
-	user.RemoveSubscription(podcast)
-	err = svc.store.UpdateUser(&user)
+	err = svc.store.ApplySubscriptionChanges(emailID, "", nil, []string{podcastURL})
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrUserUpdate
+		return ErrUserUpdate.Wrap(err)
 	}
+	svc.publishSubscriptionChange(emailID, events.SubscriptionRemoved, podcastURL)
 	return nil
 }
 
@@ -222,15 +517,13 @@ func (svc *podcastManageService) UpdatePodcast(ctx context.Context, emailID, pod
 
 	err := svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrDBConn
+		return ErrDBConn.Wrap(err)
 	}
 	defer svc.store.Close()
 
 	err = svc.store.UpdatePodcastBySubscription(emailID, podcastURL)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return ErrPodcastUpdate
+		return ErrPodcastUpdate.Wrap(err)
 	}
 	return nil
 }
@@ -247,16 +540,62 @@ func (svc *podcastManageService) GetUserSubscriptions(ctx context.Context, email
 
 	err := svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return subscriptions, ErrDBConn
+		return subscriptions, ErrDBConn.Wrap(err)
 	}
 	defer svc.store.Close()
+	return svc.listSubscriptions(emailID)
+}
+
+// listSubscriptions returns the user's subscriptions along with their settings, folder and tags. The store must be connected
+func (svc *podcastManageService) listSubscriptions(emailID string) ([]podcastmg.Podcast, error) {
 	user, err := svc.store.GetUserByEmail(emailID)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return subscriptions, ErrUserFetch
+		return nil, ErrUserFetch.Wrap(err)
+	}
+	settings, err := svc.store.GetSubscriptions(emailID)
+	if err != nil {
+		return nil, ErrPodcastFetch.Wrap(err)
+	}
+	folders, err := svc.store.GetLabels(emailID, podcastmg.LabelFolder)
+	if err != nil {
+		return nil, ErrPodcastFetch.Wrap(err)
 	}
-	return user.GetSubscriptions(), nil
+	tags, err := svc.store.GetLabels(emailID, podcastmg.LabelTag)
+	if err != nil {
+		return nil, ErrPodcastFetch.Wrap(err)
+	}
+	assignments, err := svc.store.GetSubscriptionTags(emailID)
+	if err != nil {
+		return nil, ErrPodcastFetch.Wrap(err)
+	}
+
+	labels := map[uint]podcastmg.Label{}
+	for _, label := range append(folders, tags...) {
+		labels[label.ID] = label
+	}
+	byPodcast := map[uint]podcastmg.Subscription{}
+	for _, subscription := range settings {
+		byPodcast[subscription.PodcastID] = subscription
+	}
+	tagsByPodcast := map[uint][]podcastmg.Label{}
+	for _, assignment := range assignments {
+		tagsByPodcast[assignment.PodcastID] = append(tagsByPodcast[assignment.PodcastID], labels[assignment.LabelID])
+	}
+	subscriptions := user.GetSubscriptions()
+	for i := range subscriptions {
+		podcast := &subscriptions[i]
+		if subscription, ok := byPodcast[podcast.ID]; ok {
+			podcastSettings := subscription.SubscriptionSettings
+			podcast.Settings = &podcastSettings
+			if subscription.FolderID != nil {
+				if folder, ok := labels[*subscription.FolderID]; ok {
+					podcast.Folder = &folder
+				}
+			}
+		}
+		podcast.Tags = tagsByPodcast[podcast.ID]
+	}
+	return subscriptions, nil
 }
 
 // GetSubscriptionDetails returns a populated podcast with items based on the user subscription
@@ -271,14 +610,12 @@ func (svc *podcastManageService) GetSubscriptionDetails(ctx context.Context, ema
 
 	err := svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return podcast, ErrDBConn
+		return podcast, ErrDBConn.Wrap(err)
 	}
 	defer svc.store.Close()
 	podcast, err = svc.store.GetPodcastBySubscription(emailID, podcastURL)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return podcast, ErrPodcastFetch
+		return podcast, ErrPodcastFetch.Wrap(err)
 	}
 	return podcast, nil
 }
@@ -287,31 +624,301 @@ func (svc *podcastManageService) GetSubscriptionDetails(ctx context.Context, ema
 func (svc *podcastManageService) GetToken(ctx context.Context, emailID string, password string) (tokenString string, err error) {
 	err = svc.store.Connect()
 	if err != nil {
-		svc.logger.Log("err", err)
-		return tokenString, ErrDBConn
+		return tokenString, ErrDBConn.Wrap(err)
 	}
 	user, err := svc.store.GetUserByEmail(emailID)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return tokenString, ErrUserFetch
+		return tokenString, ErrUserFetch.Wrap(err)
 	}
 	err = user.ComparePassword(password)
 	if err != nil {
-		svc.logger.Log("err", err)
-		return tokenString, ErrInvalidPassword
+		return tokenString, ErrInvalidPassword.Wrap(err)
+	}
+	svc.rehashPassword(user, password)
+	return svc.signToken(user.ID, emailID, nil, time.Now().Add(tokenLifetime))
+}
+
+// CheckToken returns ErrTokenRevoked unless the user of the request's token still exists under the token's email
+// and has not changed their password since the token was issued. Signatures only show that the service issued a
+// token, this catches tokens which were valid when they were issued: those of deleted users, of users who changed
+// their email, whose previous email may have been registered again since, and of users who changed their password
+func (svc *podcastManageService) CheckToken(ctx context.Context) error {
+	claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if !ok {
+		return kitjwt.ErrTokenContextMissing
 	}
 
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, err := svc.store.GetUserByEmail(claims.EmailID)
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrTokenRevoked.Wrap(err)
+	}
+	if err != nil {
+		return ErrUserFetch.Wrap(err)
+	}
+	if user.ID != claims.UserID {
+		return ErrTokenRevoked
+	}
+
+	// Tokens carry the second they were issued at, the ones issued in the second of the change are let through
+	if user.TokensValidAfter != nil && claims.IssuedAt < user.TokensValidAfter.Unix() {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// signToken issues a token for the user which expires at expiresAt, limited to the scopes unless they are empty
+func (svc *podcastManageService) signToken(userID uint, emailID string, scopes []string, expiresAt time.Time) (string, error) {
 	claims := TokenClaims{
+		userID,
 		emailID,
+		scopes,
 		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err = token.SignedString([]byte(svc.tokenSigningString))
+	return svc.keys.Sign(claims)
+}
+
+// rehashPassword replaces the user's password hash by one of the service's hasher if it is outdated, the password
+// has been checked against it. Failures are only logged as the old hash keeps working
+func (svc *podcastManageService) rehashPassword(user podcastmg.User, password string) {
+	if !svc.hasher.Outdated(user.Password) {
+		return
+	}
+	passwordHash, err := podcastmg.HashPassword(svc.hasher, password)
+	if err == nil {
+		err = svc.store.RehashPassword(user.UserEmail, user.Password, passwordHash)
+	}
+	if err != nil {
+		svc.logger.Log("err", err)
+	}
+}
+
+// ArchiveEpisode downloads the media of an episode of the user's subscriptions into the archive
+func (svc *podcastManageService) ArchiveEpisode(ctx context.Context, emailID string, itemID uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	if svc.archiver == nil {
+		return ErrArchiveDisabled
+	}
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	item, err := svc.store.GetPodcastItemBySubscription(emailID, itemID)
+	svc.store.Close()
+	if err != nil {
+		return ErrEpisodeFetch.Wrap(err)
+	}
+	err = svc.archiver.Archive(ctx, emailID, item)
+	switch err {
+	case nil:
+		return nil
+	case archive.ErrQuotaExceeded, archive.ErrNoMedia:
+		return err
+	default:
+		return ErrArchive.Wrap(err)
+	}
+}
+
+// GetEpisodeMedia returns the archived media of an episode of the user's subscriptions
+func (svc *podcastManageService) GetEpisodeMedia(ctx context.Context, emailID string, itemID uint) (archive.Blob, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	if svc.archiver == nil {
+		return nil, ErrArchiveDisabled
+	}
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if _, err = svc.store.GetPodcastItemBySubscription(emailID, itemID); err != nil {
+		return nil, ErrEpisodeFetch.Wrap(err)
+	}
+	media, err := svc.archiver.Open(emailID, itemID)
 	if err != nil {
-		return tokenString, err
+		return nil, ErrMediaNotArchived.Wrap(err)
+	}
+	return media, nil
+}
+
+// Search finds podcasts and episodes in the user's subscriptions or the whole catalog
+func (svc *podcastManageService) Search(ctx context.Context, emailID string, query podcastmg.SearchQuery) (podcastmg.SearchResults, error) {
+	var results podcastmg.SearchResults
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return results, ErrInvalidClaim
+	}
+
+	switch query.Scope {
+	case "":
+		query.Scope = podcastmg.SearchScopeSubscriptions
+	case podcastmg.SearchScopeSubscriptions, podcastmg.SearchScopeCatalog:
+	default:
+		return results, ErrInvalidSearchScope
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultSearchLimit
+	}
+	if query.Limit > maxSearchLimit {
+		query.Limit = maxSearchLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+	query.UserEmail = emailID
+
+	err := svc.store.Connect()
+	if err != nil {
+		return results, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	results, err = svc.store.Search(query)
+	if err == podcastmg.ErrEmptySearch {
+		return results, err
+	}
+	if err != nil {
+		return results, ErrSearch.Wrap(err)
+	}
+	return results, nil
+}
+
+// Discover returns a directory list computed from the subscriptions of all users, as of the Directory's last
+// refresh
+func (svc *podcastManageService) Discover(ctx context.Context, list, podcastURL string, limit int) ([]podcastmg.DirectoryEntry, error) {
+	switch list {
+	case DirectoryPopular, DirectoryTrending, DirectoryRecent:
+		podcastURL = ""
+	case DirectoryRelated:
+		if podcastURL == "" {
+			return nil, ErrDirectoryURL
+		}
+	default:
+		return nil, ErrUnknownDirectory
+	}
+	if limit <= 0 {
+		limit = defaultDirectoryLimit
 	}
-	return tokenString, err
+	if svc.directory == nil {
+		return nil, ErrDirectoryDisabled
+	}
+
+	entries, err := svc.directory.entries(svc.store, list, podcastURL)
+	if err == ErrDirectoryNotReady {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrDirectory.Wrap(err)
+	}
+	if limit < len(entries) {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// GetSubscriptionTotals returns the episode counts, durations and sizes of each of the user's subscriptions
+func (svc *podcastManageService) GetSubscriptionTotals(ctx context.Context, emailID string) ([]podcastmg.SubscriptionTotals, error) {
+	var totals []podcastmg.SubscriptionTotals
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return totals, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return totals, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	totals, err = svc.store.GetSubscriptionTotals(emailID)
+	if err != nil {
+		return totals, ErrPodcastFetch.Wrap(err)
+	}
+	return totals, nil
+}
+
+// GetSubscriptionSettings returns the user's settings for a subscribed podcast
+func (svc *podcastManageService) GetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) (podcastmg.SubscriptionSettings, error) {
+	var settings podcastmg.SubscriptionSettings
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return settings, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return settings, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	subscription, err := svc.store.GetSubscription(emailID, podcastURL)
+	if err != nil {
+		return settings, ErrSubscriptionFetch.Wrap(err)
+	}
+	return subscription.SubscriptionSettings, nil
+}
+
+// UpdateSubscriptionSettings replaces the user's settings for a subscribed podcast
+func (svc *podcastManageService) UpdateSubscriptionSettings(ctx context.Context, emailID, podcastURL string, settings podcastmg.SubscriptionSettings) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	return svc.saveSubscriptionSettings(emailID, podcastURL, settings)
+}
+
+// ResetSubscriptionSettings restores the default settings for a subscribed podcast
+func (svc *podcastManageService) ResetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+	return svc.saveSubscriptionSettings(emailID, podcastURL, podcastmg.DefaultSubscriptionSettings())
+}
+
+func (svc *podcastManageService) saveSubscriptionSettings(emailID, podcastURL string, settings podcastmg.SubscriptionSettings) error {
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	subscription, err := svc.store.GetSubscription(emailID, podcastURL)
+	if err != nil {
+		return ErrSubscriptionFetch.Wrap(err)
+	}
+	subscription.SubscriptionSettings = settings
+	if err = svc.store.UpdateSubscription(&subscription); err != nil {
+		return ErrSubscriptionUpdate.Wrap(err)
+	}
+	svc.publishSubscriptionChange(emailID, events.SubscriptionSettings, podcastURL)
+	return nil
 }
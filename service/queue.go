@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+)
+
+// GetQueue returns the user's up-next queue of episodes
+func (svc *podcastManageService) GetQueue(ctx context.Context, emailID string) (podcastmg.Queue, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.Queue{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.Queue{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	queue, err := svc.store.GetQueue(emailID)
+	if err != nil {
+		return podcastmg.Queue{}, ErrQueueFetch.Wrap(err)
+	}
+	return queue, nil
+}
+
+// UpdateQueue applies a change to the user's queue. The change is rejected with podcastmg.ErrQueueConflict
+// if the queue is no longer at the given version, the caller should fetch the queue again and retry
+func (svc *podcastManageService) UpdateQueue(ctx context.Context, emailID string, version int64, op podcastmg.QueueOp) (podcastmg.Queue, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.Queue{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.Queue{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	queue, err := svc.store.UpdateQueue(emailID, version, op)
+	switch {
+	case err == nil:
+		return queue, nil
+	case err == podcastmg.ErrQueueConflict, err == podcastmg.ErrInvalidQueueAction, err == podcastmg.ErrQueuePosition, err == podcastmg.ErrNotQueued:
+		return podcastmg.Queue{}, err
+	case gorm.IsRecordNotFoundError(err):
+		return podcastmg.Queue{}, ErrEpisodeFetch.Wrap(err)
+	}
+	return podcastmg.Queue{}, ErrQueueUpdate.Wrap(err)
+}
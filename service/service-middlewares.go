@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"github.com/go-kit/kit/log"
+	"github.com/tchaudhry91/podcast-manage-svc/archive"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
 	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
 	"time"
 )
@@ -139,3 +141,882 @@ func (mw loggingMiddleware) GetToken(ctx context.Context, emailID, password stri
 	token, err = mw.next.GetToken(ctx, emailID, password)
 	return
 }
+
+func (mw loggingMiddleware) ArchiveEpisode(ctx context.Context, emailID string, itemID uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ArchiveEpisode",
+			"user", emailID,
+			"item", itemID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.ArchiveEpisode(ctx, emailID, itemID)
+	return
+}
+
+func (mw loggingMiddleware) GetEpisodeMedia(ctx context.Context, emailID string, itemID uint) (media archive.Blob, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetEpisodeMedia",
+			"user", emailID,
+			"item", itemID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	media, err = mw.next.GetEpisodeMedia(ctx, emailID, itemID)
+	return
+}
+
+func (mw loggingMiddleware) Search(ctx context.Context, emailID string, query podcastmg.SearchQuery) (results podcastmg.SearchResults, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "Search",
+			"user", emailID,
+			"query", query.Terms,
+			"scope", query.Scope,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	results, err = mw.next.Search(ctx, emailID, query)
+	return
+}
+
+func (mw loggingMiddleware) Discover(ctx context.Context, list, podcastURL string, limit int) (podcasts []podcastmg.DirectoryEntry, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "Discover",
+			"list", list,
+			"url", podcastURL,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	podcasts, err = mw.next.Discover(ctx, list, podcastURL, limit)
+	return
+}
+
+func (mw loggingMiddleware) GetSubscriptionTotals(ctx context.Context, emailID string) (totals []podcastmg.SubscriptionTotals, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetSubscriptionTotals",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	totals, err = mw.next.GetSubscriptionTotals(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) GetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) (settings podcastmg.SubscriptionSettings, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetSubscriptionSettings",
+			"user", emailID,
+			"url", podcastURL,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	settings, err = mw.next.GetSubscriptionSettings(ctx, emailID, podcastURL)
+	return
+}
+
+func (mw loggingMiddleware) UpdateSubscriptionSettings(ctx context.Context, emailID, podcastURL string, settings podcastmg.SubscriptionSettings) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UpdateSubscriptionSettings",
+			"user", emailID,
+			"url", podcastURL,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.UpdateSubscriptionSettings(ctx, emailID, podcastURL, settings)
+	return
+}
+
+func (mw loggingMiddleware) ResetSubscriptionSettings(ctx context.Context, emailID, podcastURL string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ResetSubscriptionSettings",
+			"user", emailID,
+			"url", podcastURL,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.ResetSubscriptionSettings(ctx, emailID, podcastURL)
+	return
+}
+
+func (mw loggingMiddleware) CreateLabel(ctx context.Context, emailID, kind, name string) (label podcastmg.Label, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CreateLabel",
+			"user", emailID,
+			"kind", kind,
+			"name", name,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	label, err = mw.next.CreateLabel(ctx, emailID, kind, name)
+	return
+}
+
+func (mw loggingMiddleware) GetLabels(ctx context.Context, emailID, kind string) (labels []podcastmg.Label, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetLabels",
+			"user", emailID,
+			"kind", kind,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	labels, err = mw.next.GetLabels(ctx, emailID, kind)
+	return
+}
+
+func (mw loggingMiddleware) RenameLabel(ctx context.Context, emailID string, labelID uint, name string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RenameLabel",
+			"user", emailID,
+			"label", labelID,
+			"name", name,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.RenameLabel(ctx, emailID, labelID, name)
+	return
+}
+
+func (mw loggingMiddleware) ReorderLabels(ctx context.Context, emailID, kind string, labelIDs []uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ReorderLabels",
+			"user", emailID,
+			"kind", kind,
+			"labels", len(labelIDs),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.ReorderLabels(ctx, emailID, kind, labelIDs)
+	return
+}
+
+func (mw loggingMiddleware) DeleteLabel(ctx context.Context, emailID string, labelID uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DeleteLabel",
+			"user", emailID,
+			"label", labelID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.DeleteLabel(ctx, emailID, labelID)
+	return
+}
+
+func (mw loggingMiddleware) SetSubscriptionFolder(ctx context.Context, emailID, podcastURL string, folderID uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "SetSubscriptionFolder",
+			"user", emailID,
+			"url", podcastURL,
+			"folder", folderID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.SetSubscriptionFolder(ctx, emailID, podcastURL, folderID)
+	return
+}
+
+func (mw loggingMiddleware) SetSubscriptionTags(ctx context.Context, emailID, podcastURL string, tagIDs []uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "SetSubscriptionTags",
+			"user", emailID,
+			"url", podcastURL,
+			"tags", len(tagIDs),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.SetSubscriptionTags(ctx, emailID, podcastURL, tagIDs)
+	return
+}
+
+func (mw loggingMiddleware) FilterSubscriptions(ctx context.Context, emailID string, folderID, tagID uint) (subscriptions []podcastmg.Podcast, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "FilterSubscriptions",
+			"user", emailID,
+			"folder", folderID,
+			"tag", tagID,
+			"results", len(subscriptions),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	subscriptions, err = mw.next.FilterSubscriptions(ctx, emailID, folderID, tagID)
+	return
+}
+
+func (mw loggingMiddleware) ExportOPML(ctx context.Context, emailID string) (opml podcastmg.OPML, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ExportOPML",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	opml, err = mw.next.ExportOPML(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) GetQueue(ctx context.Context, emailID string) (queue podcastmg.Queue, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetQueue",
+			"user", emailID,
+			"version", queue.Version,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	queue, err = mw.next.GetQueue(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) UpdateQueue(ctx context.Context, emailID string, version int64, op podcastmg.QueueOp) (queue podcastmg.Queue, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UpdateQueue",
+			"user", emailID,
+			"version", version,
+			"action", op.Action,
+			"item", op.ItemID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	queue, err = mw.next.UpdateQueue(ctx, emailID, version, op)
+	return
+}
+
+func (mw loggingMiddleware) CreatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) (created podcastmg.Playlist, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CreatePlaylist",
+			"user", emailID,
+			"name", playlist.Name,
+			"smart", playlist.Rules != nil,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	created, err = mw.next.CreatePlaylist(ctx, emailID, playlist)
+	return
+}
+
+func (mw loggingMiddleware) GetPlaylists(ctx context.Context, emailID string) (playlists []podcastmg.Playlist, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetPlaylists",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	playlists, err = mw.next.GetPlaylists(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) GetPlaylist(ctx context.Context, emailID string, playlistID uint) (playlist podcastmg.Playlist, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetPlaylist",
+			"user", emailID,
+			"playlist", playlistID,
+			"items", len(playlist.Items),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	playlist, err = mw.next.GetPlaylist(ctx, emailID, playlistID)
+	return
+}
+
+func (mw loggingMiddleware) GetPlaylistFeed(ctx context.Context, secret string) (playlist podcastmg.Playlist, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetPlaylistFeed",
+			"playlist", playlist.ID,
+			"items", len(playlist.Items),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	playlist, err = mw.next.GetPlaylistFeed(ctx, secret)
+	return
+}
+
+func (mw loggingMiddleware) UpdatePlaylist(ctx context.Context, emailID string, playlist podcastmg.Playlist) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UpdatePlaylist",
+			"user", emailID,
+			"playlist", playlist.ID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.UpdatePlaylist(ctx, emailID, playlist)
+	return
+}
+
+func (mw loggingMiddleware) DeletePlaylist(ctx context.Context, emailID string, playlistID uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DeletePlaylist",
+			"user", emailID,
+			"playlist", playlistID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.DeletePlaylist(ctx, emailID, playlistID)
+	return
+}
+
+func (mw loggingMiddleware) SetPlaylistItems(ctx context.Context, emailID string, playlistID uint, itemIDs []uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "SetPlaylistItems",
+			"user", emailID,
+			"playlist", playlistID,
+			"items", len(itemIDs),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.SetPlaylistItems(ctx, emailID, playlistID, itemIDs)
+	return
+}
+
+func (mw loggingMiddleware) CreateWebhook(ctx context.Context, emailID, webhookURL string) (webhook podcastmg.Webhook, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CreateWebhook",
+			"user", emailID,
+			"url", webhookURL,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	webhook, err = mw.next.CreateWebhook(ctx, emailID, webhookURL)
+	return
+}
+
+func (mw loggingMiddleware) GetWebhooks(ctx context.Context, emailID string) (webhooks []podcastmg.Webhook, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetWebhooks",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	webhooks, err = mw.next.GetWebhooks(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) DeleteWebhook(ctx context.Context, emailID string, webhookID uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DeleteWebhook",
+			"user", emailID,
+			"webhook", webhookID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.DeleteWebhook(ctx, emailID, webhookID)
+	return
+}
+
+func (mw loggingMiddleware) GetWebhookDeliveries(ctx context.Context, emailID string, webhookID uint) (deliveries []podcastmg.WebhookDelivery, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetWebhookDeliveries",
+			"user", emailID,
+			"webhook", webhookID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	deliveries, err = mw.next.GetWebhookDeliveries(ctx, emailID, webhookID)
+	return
+}
+
+func (mw loggingMiddleware) RetryWebhookDelivery(ctx context.Context, emailID string, deliveryID uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RetryWebhookDelivery",
+			"user", emailID,
+			"delivery", deliveryID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.RetryWebhookDelivery(ctx, emailID, deliveryID)
+	return
+}
+
+func (mw loggingMiddleware) GetDigestSchedule(ctx context.Context, emailID string) (schedule podcastmg.DigestSchedule, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetDigestSchedule",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	schedule, err = mw.next.GetDigestSchedule(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) UpdateDigestSettings(ctx context.Context, emailID string, settings podcastmg.DigestSettings) (schedule podcastmg.DigestSchedule, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UpdateDigestSettings",
+			"user", emailID,
+			"frequency", settings.Frequency,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	schedule, err = mw.next.UpdateDigestSettings(ctx, emailID, settings)
+	return
+}
+
+func (mw loggingMiddleware) UnsubscribeDigest(ctx context.Context, token string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UnsubscribeDigest",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.UnsubscribeDigest(ctx, token)
+	return
+}
+
+func (mw loggingMiddleware) VerifyHubIntent(ctx context.Context, subscriptionID uint, intent podcastmg.HubIntent, challenge string) (response string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "VerifyHubIntent",
+			"subscription", subscriptionID,
+			"mode", intent.Mode,
+			"topic", intent.Topic,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	response, err = mw.next.VerifyHubIntent(ctx, subscriptionID, intent, challenge)
+	return
+}
+
+func (mw loggingMiddleware) ReceiveHubContent(ctx context.Context, subscriptionID uint, signature string, content []byte) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ReceiveHubContent",
+			"subscription", subscriptionID,
+			"bytes", len(content),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.ReceiveHubContent(ctx, subscriptionID, signature, content)
+	return
+}
+
+func (mw loggingMiddleware) StreamEvents(ctx context.Context, emailID string) (stream <-chan events.Event, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "StreamEvents",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	stream, err = mw.next.StreamEvents(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) GetPlaybackStates(ctx context.Context, emailID string, since time.Time) (states []podcastmg.PlaybackState, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetPlaybackStates",
+			"user", emailID,
+			"since", since,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	states, err = mw.next.GetPlaybackStates(ctx, emailID, since)
+	return
+}
+
+func (mw loggingMiddleware) UpdatePlaybackState(ctx context.Context, emailID string, state podcastmg.PlaybackState) (updated podcastmg.PlaybackState, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UpdatePlaybackState",
+			"user", emailID,
+			"item", state.PodcastItemID,
+			"device", state.Device,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	updated, err = mw.next.UpdatePlaybackState(ctx, emailID, state)
+	return
+}
+
+func (mw loggingMiddleware) GetDevices(ctx context.Context, emailID string) (devices []podcastmg.Device, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetDevices",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	devices, err = mw.next.GetDevices(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) UpdateDevice(ctx context.Context, emailID string, device podcastmg.Device) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UpdateDevice",
+			"user", emailID,
+			"device", device.DeviceID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.UpdateDevice(ctx, emailID, device)
+	return
+}
+
+func (mw loggingMiddleware) GetSubscriptionChanges(ctx context.Context, emailID, deviceID string, since int64) (changes podcastmg.SubscriptionChanges, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetSubscriptionChanges",
+			"user", emailID,
+			"device", deviceID,
+			"since", since,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	changes, err = mw.next.GetSubscriptionChanges(ctx, emailID, deviceID, since)
+	return
+}
+
+func (mw loggingMiddleware) UploadSubscriptionChanges(ctx context.Context, emailID, deviceID string, changes podcastmg.SubscriptionChanges) (result podcastmg.SyncResult, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UploadSubscriptionChanges",
+			"user", emailID,
+			"device", deviceID,
+			"add", len(changes.Add),
+			"remove", len(changes.Remove),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	result, err = mw.next.UploadSubscriptionChanges(ctx, emailID, deviceID, changes)
+	return
+}
+
+func (mw loggingMiddleware) GetEpisodeActions(ctx context.Context, emailID string, query podcastmg.EpisodeActionQuery) (actions podcastmg.EpisodeActions, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetEpisodeActions",
+			"user", emailID,
+			"since", query.Since,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	actions, err = mw.next.GetEpisodeActions(ctx, emailID, query)
+	return
+}
+
+func (mw loggingMiddleware) UploadEpisodeActions(ctx context.Context, emailID string, actions []podcastmg.EpisodeAction) (result podcastmg.SyncResult, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UploadEpisodeActions",
+			"user", emailID,
+			"actions", len(actions),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	result, err = mw.next.UploadEpisodeActions(ctx, emailID, actions)
+	return
+}
+
+func (mw loggingMiddleware) Sync(ctx context.Context, emailID, token string, limit int) (delta podcastmg.SyncDelta, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "Sync",
+			"user", emailID,
+			"since", token,
+			"token", delta.Token,
+			"changes", len(delta.Changes),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	delta, err = mw.next.Sync(ctx, emailID, token, limit)
+	return
+}
+
+func (mw loggingMiddleware) UploadChanges(ctx context.Context, emailID, device string, changes []podcastmg.Change) (applied []podcastmg.Change, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UploadChanges",
+			"user", emailID,
+			"device", device,
+			"changes", len(changes),
+			"applied", len(applied),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	applied, err = mw.next.UploadChanges(ctx, emailID, device, changes)
+	return
+}
+
+func (mw loggingMiddleware) RequestEmailVerification(ctx context.Context, emailID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RequestEmailVerification",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.RequestEmailVerification(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) VerifyEmail(ctx context.Context, token string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "VerifyEmail",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.VerifyEmail(ctx, token)
+	return
+}
+
+func (mw loggingMiddleware) RequestPasswordReset(ctx context.Context, emailID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RequestPasswordReset",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.RequestPasswordReset(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) ResetPassword(ctx context.Context, token, password string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ResetPassword",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.ResetPassword(ctx, token, password)
+	return
+}
+
+func (mw loggingMiddleware) ChangePassword(ctx context.Context, emailID, oldPassword, newPassword string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ChangePassword",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.ChangePassword(ctx, emailID, oldPassword, newPassword)
+	return
+}
+
+func (mw loggingMiddleware) RequestEmailChange(ctx context.Context, emailID, password, newEmail string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RequestEmailChange",
+			"user", emailID,
+			"new_email", newEmail,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.RequestEmailChange(ctx, emailID, password, newEmail)
+	return
+}
+
+func (mw loggingMiddleware) ConfirmEmailChange(ctx context.Context, token string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ConfirmEmailChange",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.ConfirmEmailChange(ctx, token)
+	return
+}
+
+func (mw loggingMiddleware) ExportAccount(ctx context.Context, emailID string) (export podcastmg.UserExport, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ExportAccount",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	export, err = mw.next.ExportAccount(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) DeleteAccount(ctx context.Context, emailID, password string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DeleteAccount",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.DeleteAccount(ctx, emailID, password)
+	return
+}
+
+func (mw loggingMiddleware) CreateAccessToken(ctx context.Context, emailID string, token podcastmg.AccessToken) (created podcastmg.AccessToken, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CreateAccessToken",
+			"user", emailID,
+			"name", token.Name,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	created, err = mw.next.CreateAccessToken(ctx, emailID, token)
+	return
+}
+
+func (mw loggingMiddleware) GetAccessTokens(ctx context.Context, emailID string) (tokens []podcastmg.AccessToken, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetAccessTokens",
+			"user", emailID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	tokens, err = mw.next.GetAccessTokens(ctx, emailID)
+	return
+}
+
+func (mw loggingMiddleware) RevokeAccessToken(ctx context.Context, emailID string, tokenID uint) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RevokeAccessToken",
+			"user", emailID,
+			"token_id", tokenID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.RevokeAccessToken(ctx, emailID, tokenID)
+	return
+}
+
+func (mw loggingMiddleware) ExchangeAccessToken(ctx context.Context, token string) (jwtToken string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ExchangeAccessToken",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	jwtToken, err = mw.next.ExchangeAccessToken(ctx, token)
+	return
+}
+
+// CheckToken runs on every authenticated request, it is only logged when the token is refused
+func (mw loggingMiddleware) CheckToken(ctx context.Context) (err error) {
+	defer func(begin time.Time) {
+		if err == nil {
+			return
+		}
+		mw.logger.Log(
+			"method", "CheckToken",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	err = mw.next.CheckToken(ctx)
+	return
+}
+
+func (mw loggingMiddleware) BeginOIDCLogin(ctx context.Context) (login OIDCLogin, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "BeginOIDCLogin",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	login, err = mw.next.BeginOIDCLogin(ctx)
+	return
+}
+
+func (mw loggingMiddleware) CompleteOIDCLogin(ctx context.Context, session, state, code string) (token string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CompleteOIDCLogin",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	token, err = mw.next.CompleteOIDCLogin(ctx, session, state, code)
+	return
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/jinzhu/gorm"
+	"github.com/tchaudhry91/podcast-manage-svc/events"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+)
+
+// Sync returns the changes of the user's account after the token along with the token to ask from next time.
+// An empty token returns the token of the latest change, devices ask for it before downloading all subscriptions
+func (svc *podcastManageService) Sync(ctx context.Context, emailID, token string, limit int) (podcastmg.SyncDelta, error) {
+	var delta podcastmg.SyncDelta
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return delta, ErrInvalidClaim
+	}
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return delta, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	delta, err = svc.store.GetChanges(emailID, token, limit)
+	switch {
+	case err == nil:
+		return delta, nil
+	case err == podcastmg.ErrInvalidSyncToken:
+		return delta, err
+	case gorm.IsRecordNotFoundError(err):
+		return delta, ErrUserFetch.Wrap(err)
+	}
+	return delta, ErrSyncFetch.Wrap(err)
+}
+
+// UploadChanges applies the changes a device made while it was offline, a change loses against a later change of
+// the same podcast or episode. The applied changes are returned, they are also part of the next sync
+func (svc *podcastManageService) UploadChanges(ctx context.Context, emailID, device string, changes []podcastmg.Change) ([]podcastmg.Change, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+	for i, change := range changes {
+		if err := change.Validate(); err != nil {
+			return nil, err
+		}
+		if change.Kind != podcastmg.ChangeEpisodeState {
+			if changes[i].PodcastURL = cleanFeedURL(change.PodcastURL); changes[i].PodcastURL == "" {
+				return nil, podcastmg.ErrInvalidChange
+			}
+		}
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	user, err := svc.store.GetUserByEmail(emailID)
+	if err != nil {
+		return nil, ErrUserFetch.Wrap(err)
+	}
+
+	// Feeds are fetched before the changes are applied, a podcast whose feed cannot be fetched fills in on its
+	// next update. Podcasts which are unsubscribed from before they are subscribed to again are fetched as well
+	removed := map[string]bool{}
+	for _, change := range changes {
+		if change.Kind == podcastmg.ChangeUnsubscribed {
+			removed[change.PodcastURL] = true
+		}
+	}
+	podcasts := map[string]podcastmg.Podcast{}
+	for _, change := range changes {
+		_, built := podcasts[change.PodcastURL]
+		subscribed := user.CheckSubscription(podcastmg.Podcast{URL: change.PodcastURL}) && !removed[change.PodcastURL]
+		if change.Kind != podcastmg.ChangeSubscribed || built || subscribed {
+			continue
+		}
+		podcast, err := podcastmg.BuildPodcastFromURL(change.PodcastURL)
+		if err != nil {
+			svc.logger.Log("url", change.PodcastURL, "err", err)
+			podcast = podcastmg.Podcast{Title: change.PodcastURL, URL: change.PodcastURL}
+		}
+		podcasts[change.PodcastURL] = podcast
+	}
+
+	applied, err := svc.store.UploadChanges(emailID, device, changes, podcasts)
+	if err != nil {
+		return nil, svc.syncError(err, ErrSyncUpdate)
+	}
+	for _, change := range applied {
+		switch change.Kind {
+		case podcastmg.ChangeSubscribed:
+			svc.publishSubscriptionChange(emailID, events.SubscriptionAdded, change.PodcastURL)
+		case podcastmg.ChangeUnsubscribed:
+			svc.publishSubscriptionChange(emailID, events.SubscriptionRemoved, change.PodcastURL)
+		case podcastmg.ChangeEpisodeState:
+			svc.publish(emailID, events.TypePlayback, podcastmg.PlaybackState{PodcastItemID: *change.PodcastItemID,
+				Position: *change.Position, Played: *change.Played, Device: change.Device, UpdatedAt: change.ChangedAt})
+		}
+	}
+	return applied, nil
+}
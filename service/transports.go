@@ -3,37 +3,99 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
 	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+	"github.com/tchaudhry91/podcast-manage-svc/digest"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/signing"
+	"github.com/tchaudhry91/podcast-manage-svc/websub"
+	"html/template"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 var (
 	// ErrJSONUnmarshall is an error when the JSON parsing fails on the request
-	ErrJSONUnmarshall = errors.New("Failed to parse incoming JSON")
+	ErrJSONUnmarshall = newError("invalid_json", http.StatusBadRequest, "Failed to parse incoming JSON")
+
+	// ErrBadRouting indicates a path parameter that does not match the expected format
+	ErrBadRouting = newError("bad_routing", http.StatusBadRequest, "Inconsistent mapping between route and handler")
+
+	// ErrStreamingUnsupported indicates a connection which cannot flush the events of a stream as they happen
+	ErrStreamingUnsupported = newError("streaming_unsupported", http.StatusNotImplemented, "Streaming is not supported")
+
+	// ErrBadQuery indicates a query parameter that does not match the expected format
+	ErrBadQuery = newError("invalid_query", http.StatusBadRequest, "Invalid query parameter")
+)
+
+const (
+	// maxHubContent is the largest feed content accepted from a hub, longer content is cut off
+	maxHubContent = 10 << 20
+
+	// eventKeepAlive is the interval of the comments sent on idle event streams to keep proxies from closing them
+	eventKeepAlive = 30 * time.Second
+
+	// sessionCookie is the cookie of gpodder.net API sessions, it holds the session's token
+	sessionCookie = "sessionid"
+
+	// sessionLifetime is how long the session cookie is kept, as long as the token it holds is valid
+	sessionLifetime = 24 * time.Hour
+
+	// oidcSessionCookie holds the session of a login with the OpenID Connect provider while the user signs in
+	oidcSessionCookie = "oidc_session"
+)
+
+type contextKey int
+
+const (
+	// contextKeyConditionalHeaders holds the range and conditional headers of a request serving media
+	contextKeyConditionalHeaders contextKey = iota
+
+	// contextKeyBasicAuth holds the basic auth credentials of a gpodder.net API request
+	contextKeyBasicAuth
+
+	// contextKeySecure holds whether the request came over TLS, cookies set in response are then only sent over TLS
+	contextKeySecure
 )
 
+// conditionalHeaders are the request headers which http.ServeContent evaluates
+var conditionalHeaders = []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
 // MakeHTTPHandler returns a router for the podcast-manager-service
-func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.Logger) http.Handler {
+func MakeHTTPHandler(svc PodcastManageService, keys *signing.KeySet, logger log.Logger) http.Handler {
 	router := mux.NewRouter()
+	router.NotFoundHandler = errorHandler(ErrRouteNotFound)
+	router.MethodNotAllowedHandler = errorHandler(ErrMethodNotAllowed)
 	endpoints := MakeServerEndpoints(svc)
 	serverOptions := []kithttp.ServerOption{
-		kithttp.ServerBefore(kitjwt.HTTPToContext()),
+		kithttp.ServerBefore(kitjwt.HTTPToContext(), kithttp.PopulateRequestContext),
 		kithttp.ServerErrorEncoder(encodeError),
 		kithttp.ServerErrorLogger(logger),
 	}
 
-	kf := func(token *jwt.Token) (interface{}, error) {
-		return []byte(signingString), nil
-	}
 	claimsFetcher := func() jwt.Claims {
 		return &TokenClaims{}
 	}
-	authMiddleware := kitjwt.NewParser(kf, jwt.SigningMethodHS256, claimsFetcher)
+	jwtParser := keySetParser(keys, claimsFetcher)
+
+	// scopedAuth accepts tokens issued on login and access tokens with the scope, access tokens are refused where
+	// the scope is empty. Tokens revoked since they were issued are refused everywhere
+	scopedAuth := func(scope string) endpoint.Middleware {
+		return endpoint.Chain(accessTokenMiddleware(svc), jwtParser, revocationMiddleware(svc), scopeMiddleware(scope))
+	}
+	authMiddleware := scopedAuth("")
+	readAuth := scopedAuth(podcastmg.ScopeRead)
+	subscriptionsAuth := scopedAuth(podcastmg.ScopeSubscriptionsWrite)
 
 	router.Methods("POST").Path("/register").Handler(kithttp.NewServer(
 		endpoints.CreateUserEndpoint,
@@ -43,7 +105,7 @@ func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.
 	))
 
 	getUserEndpoint := endpoints.GetUserEndpoint
-	getUserEndpoint = authMiddleware(getUserEndpoint)
+	getUserEndpoint = readAuth(getUserEndpoint)
 	router.Methods("POST").Path("/user").Handler(kithttp.NewServer(
 		getUserEndpoint,
 		decodeGetUserRequest,
@@ -65,7 +127,7 @@ func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.
 	))
 
 	subscribeEndpoint := endpoints.SubscribeEndpoint
-	subscribeEndpoint = authMiddleware(subscribeEndpoint)
+	subscribeEndpoint = subscriptionsAuth(subscribeEndpoint)
 	router.Methods("POST").Path("/subscribe").Handler(kithttp.NewServer(
 		subscribeEndpoint,
 		decodeSubscribeRequest,
@@ -74,7 +136,7 @@ func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.
 	))
 
 	unsubscribeEndpoint := endpoints.UnsubscribeEndpoint
-	unsubscribeEndpoint = authMiddleware(unsubscribeEndpoint)
+	unsubscribeEndpoint = subscriptionsAuth(unsubscribeEndpoint)
 	router.Methods("POST").Path("/unsubscribe").Handler(kithttp.NewServer(
 		unsubscribeEndpoint,
 		decodeUnsubscribeRequest,
@@ -83,7 +145,7 @@ func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.
 	))
 
 	updatePodcastEndpoint := endpoints.UpdatePodcastEndpoint
-	updatePodcastEndpoint = authMiddleware(updatePodcastEndpoint)
+	updatePodcastEndpoint = subscriptionsAuth(updatePodcastEndpoint)
 	router.Methods("POST").Path("/update").Handler(kithttp.NewServer(
 		updatePodcastEndpoint,
 		decodeUpdatePodcastRequest,
@@ -92,7 +154,7 @@ func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.
 	))
 
 	subscriptionsEndpoint := endpoints.GetUserSubscriptionsEndpoint
-	subscriptionsEndpoint = authMiddleware(subscriptionsEndpoint)
+	subscriptionsEndpoint = readAuth(subscriptionsEndpoint)
 	router.Methods("POST").Path("/subscriptions").Handler(kithttp.NewServer(
 		subscriptionsEndpoint,
 		decodeGetUserSubscriptionsRequest,
@@ -101,7 +163,7 @@ func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.
 	))
 
 	subscriptionEndpoint := endpoints.GetSubscriptionDetailsEndpoint
-	subscriptionEndpoint = authMiddleware(subscriptionEndpoint)
+	subscriptionEndpoint = readAuth(subscriptionEndpoint)
 	router.Methods("POST").Path("/subscription").Handler(kithttp.NewServer(
 		subscriptionEndpoint,
 		decodeGetSubscriptionDetailsRequest,
@@ -115,26 +177,1323 @@ func MakeHTTPHandler(svc PodcastManageService, signingString string, logger log.
 		encodeGenericResponse,
 		serverOptions...,
 	))
+
+	archiveEpisodeEndpoint := endpoints.ArchiveEpisodeEndpoint
+	archiveEpisodeEndpoint = authMiddleware(archiveEpisodeEndpoint)
+	router.Methods("POST").Path("/archive").Handler(kithttp.NewServer(
+		archiveEpisodeEndpoint,
+		decodeArchiveEpisodeRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	episodeMediaEndpoint := endpoints.GetEpisodeMediaEndpoint
+	episodeMediaEndpoint = readAuth(episodeMediaEndpoint)
+	router.Methods("GET").Path("/media/{user}/{item}").Handler(kithttp.NewServer(
+		episodeMediaEndpoint,
+		decodeGetEpisodeMediaRequest,
+		encodeEpisodeMediaResponse,
+		append(serverOptions, kithttp.ServerBefore(conditionalHeadersToContext))...,
+	))
+
+	searchEndpoint := endpoints.SearchEndpoint
+	searchEndpoint = readAuth(searchEndpoint)
+	router.Methods("POST").Path("/search").Handler(kithttp.NewServer(
+		searchEndpoint,
+		decodeSearchRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	totalsEndpoint := endpoints.GetSubscriptionTotalsEndpoint
+	totalsEndpoint = readAuth(totalsEndpoint)
+	router.Methods("POST").Path("/subscriptions/totals").Handler(kithttp.NewServer(
+		totalsEndpoint,
+		decodeGetUserSubscriptionsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getSettingsEndpoint := endpoints.GetSettingsEndpoint
+	getSettingsEndpoint = readAuth(getSettingsEndpoint)
+	router.Methods("POST").Path("/subscription/settings").Handler(kithttp.NewServer(
+		getSettingsEndpoint,
+		decodeGetSubscriptionDetailsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	updateSettingsEndpoint := endpoints.UpdateSettingsEndpoint
+	updateSettingsEndpoint = subscriptionsAuth(updateSettingsEndpoint)
+	router.Methods("POST").Path("/subscription/settings/update").Handler(kithttp.NewServer(
+		updateSettingsEndpoint,
+		decodeUpdateSettingsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	resetSettingsEndpoint := endpoints.ResetSettingsEndpoint
+	resetSettingsEndpoint = subscriptionsAuth(resetSettingsEndpoint)
+	router.Methods("POST").Path("/subscription/settings/reset").Handler(kithttp.NewServer(
+		resetSettingsEndpoint,
+		decodeGetSubscriptionDetailsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	createLabelEndpoint := endpoints.CreateLabelEndpoint
+	createLabelEndpoint = authMiddleware(createLabelEndpoint)
+	router.Methods("POST").Path("/labels/create").Handler(kithttp.NewServer(
+		createLabelEndpoint,
+		decodeLabelRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getLabelsEndpoint := endpoints.GetLabelsEndpoint
+	getLabelsEndpoint = readAuth(getLabelsEndpoint)
+	router.Methods("POST").Path("/labels").Handler(kithttp.NewServer(
+		getLabelsEndpoint,
+		decodeLabelRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	renameLabelEndpoint := endpoints.RenameLabelEndpoint
+	renameLabelEndpoint = authMiddleware(renameLabelEndpoint)
+	router.Methods("POST").Path("/labels/rename").Handler(kithttp.NewServer(
+		renameLabelEndpoint,
+		decodeLabelRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	reorderLabelsEndpoint := endpoints.ReorderLabelsEndpoint
+	reorderLabelsEndpoint = authMiddleware(reorderLabelsEndpoint)
+	router.Methods("POST").Path("/labels/reorder").Handler(kithttp.NewServer(
+		reorderLabelsEndpoint,
+		decodeLabelRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	deleteLabelEndpoint := endpoints.DeleteLabelEndpoint
+	deleteLabelEndpoint = authMiddleware(deleteLabelEndpoint)
+	router.Methods("POST").Path("/labels/delete").Handler(kithttp.NewServer(
+		deleteLabelEndpoint,
+		decodeLabelRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	setFolderEndpoint := endpoints.SetFolderEndpoint
+	setFolderEndpoint = subscriptionsAuth(setFolderEndpoint)
+	router.Methods("POST").Path("/subscription/folder").Handler(kithttp.NewServer(
+		setFolderEndpoint,
+		decodeAssignLabelsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	setTagsEndpoint := endpoints.SetTagsEndpoint
+	setTagsEndpoint = subscriptionsAuth(setTagsEndpoint)
+	router.Methods("POST").Path("/subscription/tags").Handler(kithttp.NewServer(
+		setTagsEndpoint,
+		decodeAssignLabelsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	filterSubscriptionsEndpoint := endpoints.FilterSubscriptionsEndpoint
+	filterSubscriptionsEndpoint = readAuth(filterSubscriptionsEndpoint)
+	router.Methods("POST").Path("/subscriptions/filter").Handler(kithttp.NewServer(
+		filterSubscriptionsEndpoint,
+		decodeFilterSubscriptionsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getQueueEndpoint := endpoints.GetQueueEndpoint
+	getQueueEndpoint = readAuth(getQueueEndpoint)
+	router.Methods("POST").Path("/queue").Handler(kithttp.NewServer(
+		getQueueEndpoint,
+		decodeGetUserSubscriptionsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	updateQueueEndpoint := endpoints.UpdateQueueEndpoint
+	updateQueueEndpoint = authMiddleware(updateQueueEndpoint)
+	router.Methods("POST").Path("/queue/update").Handler(kithttp.NewServer(
+		updateQueueEndpoint,
+		decodeUpdateQueueRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	createPlaylistEndpoint := endpoints.CreatePlaylistEndpoint
+	createPlaylistEndpoint = authMiddleware(createPlaylistEndpoint)
+	router.Methods("POST").Path("/playlists/create").Handler(kithttp.NewServer(
+		createPlaylistEndpoint,
+		decodePlaylistRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getPlaylistsEndpoint := endpoints.GetPlaylistsEndpoint
+	getPlaylistsEndpoint = readAuth(getPlaylistsEndpoint)
+	router.Methods("POST").Path("/playlists").Handler(kithttp.NewServer(
+		getPlaylistsEndpoint,
+		decodeGetUserSubscriptionsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getPlaylistEndpoint := endpoints.GetPlaylistEndpoint
+	getPlaylistEndpoint = readAuth(getPlaylistEndpoint)
+	router.Methods("POST").Path("/playlist").Handler(kithttp.NewServer(
+		getPlaylistEndpoint,
+		decodePlaylistItemsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	updatePlaylistEndpoint := endpoints.UpdatePlaylistEndpoint
+	updatePlaylistEndpoint = authMiddleware(updatePlaylistEndpoint)
+	router.Methods("POST").Path("/playlist/update").Handler(kithttp.NewServer(
+		updatePlaylistEndpoint,
+		decodePlaylistRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	deletePlaylistEndpoint := endpoints.DeletePlaylistEndpoint
+	deletePlaylistEndpoint = authMiddleware(deletePlaylistEndpoint)
+	router.Methods("POST").Path("/playlist/delete").Handler(kithttp.NewServer(
+		deletePlaylistEndpoint,
+		decodePlaylistItemsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	setPlaylistItemsEndpoint := endpoints.SetPlaylistItemsEndpoint
+	setPlaylistItemsEndpoint = authMiddleware(setPlaylistItemsEndpoint)
+	router.Methods("POST").Path("/playlist/items").Handler(kithttp.NewServer(
+		setPlaylistItemsEndpoint,
+		decodePlaylistItemsRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	// Podcast apps fetch the feeds of a playlist without credentials, the feed secret in the url identifies it
+	router.Methods("POST").Path("/playlist/feed").Handler(kithttp.NewServer(
+		endpoints.GetPlaylistFeedEndpoint,
+		decodePlaylistFeedRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	router.Methods("GET").Path("/playlist/feed/{secret}/rss").Handler(kithttp.NewServer(
+		endpoints.GetPlaylistFeedEndpoint,
+		decodePlaylistFeedURLRequest,
+		encodePlaylistRSSResponse,
+		serverOptions...,
+	))
+
+	router.Methods("GET").Path("/playlist/feed/{secret}/m3u").Handler(kithttp.NewServer(
+		endpoints.GetPlaylistFeedEndpoint,
+		decodePlaylistFeedURLRequest,
+		encodePlaylistM3UResponse,
+		serverOptions...,
+	))
+
+	createWebhookEndpoint := endpoints.CreateWebhookEndpoint
+	createWebhookEndpoint = authMiddleware(createWebhookEndpoint)
+	router.Methods("POST").Path("/webhooks/create").Handler(kithttp.NewServer(
+		createWebhookEndpoint,
+		decodeWebhookRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getWebhooksEndpoint := endpoints.GetWebhooksEndpoint
+	getWebhooksEndpoint = authMiddleware(getWebhooksEndpoint)
+	router.Methods("POST").Path("/webhooks").Handler(kithttp.NewServer(
+		getWebhooksEndpoint,
+		decodeWebhookRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	deleteWebhookEndpoint := endpoints.DeleteWebhookEndpoint
+	deleteWebhookEndpoint = authMiddleware(deleteWebhookEndpoint)
+	router.Methods("POST").Path("/webhooks/delete").Handler(kithttp.NewServer(
+		deleteWebhookEndpoint,
+		decodeWebhookRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getWebhookDeliveriesEndpoint := endpoints.GetWebhookDeliveriesEndpoint
+	getWebhookDeliveriesEndpoint = authMiddleware(getWebhookDeliveriesEndpoint)
+	router.Methods("POST").Path("/webhooks/deliveries").Handler(kithttp.NewServer(
+		getWebhookDeliveriesEndpoint,
+		decodeWebhookRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	retryWebhookDeliveryEndpoint := endpoints.RetryWebhookDeliveryEndpoint
+	retryWebhookDeliveryEndpoint = authMiddleware(retryWebhookDeliveryEndpoint)
+	router.Methods("POST").Path("/webhooks/deliveries/retry").Handler(kithttp.NewServer(
+		retryWebhookDeliveryEndpoint,
+		decodeWebhookRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getDigestScheduleEndpoint := endpoints.GetDigestScheduleEndpoint
+	getDigestScheduleEndpoint = readAuth(getDigestScheduleEndpoint)
+	router.Methods("POST").Path("/digest").Handler(kithttp.NewServer(
+		getDigestScheduleEndpoint,
+		decodeDigestRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	updateDigestSettingsEndpoint := endpoints.UpdateDigestSettingsEndpoint
+	updateDigestSettingsEndpoint = authMiddleware(updateDigestSettingsEndpoint)
+	router.Methods("POST").Path("/digest/update").Handler(kithttp.NewServer(
+		updateDigestSettingsEndpoint,
+		decodeDigestRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	// Unsubscribe links are opened from the digest email, the token in the link authorizes the request.
+	// POST serves one-click unsubscribes of mail clients
+	router.Methods("GET", "POST").Path(digest.UnsubscribePath).Handler(kithttp.NewServer(
+		endpoints.UnsubscribeDigestEndpoint,
+		decodeUnsubscribeDigestRequest,
+		encodeUnsubscribeDigestResponse,
+		serverOptions...,
+	))
+
+	// Hub callbacks are called by WebSub hubs, the topic and the signature of the subscription secret authorize them
+	router.Methods("GET").Path(websub.CallbackPath + "/{id}").Handler(kithttp.NewServer(
+		endpoints.VerifyHubIntentEndpoint,
+		decodeHubIntentRequest,
+		encodeHubIntentResponse,
+		serverOptions...,
+	))
+
+	router.Methods("POST").Path(websub.CallbackPath + "/{id}").Handler(kithttp.NewServer(
+		endpoints.ReceiveHubContentEndpoint,
+		decodeHubContentRequest,
+		encodeHubContentResponse,
+		serverOptions...,
+	))
+
+	streamEventsEndpoint := endpoints.StreamEventsEndpoint
+	streamEventsEndpoint = readAuth(streamEventsEndpoint)
+	router.Methods("GET").Path("/events/{user}").Handler(kithttp.NewServer(
+		streamEventsEndpoint,
+		decodeStreamEventsRequest,
+		encodeEventStreamResponse,
+		serverOptions...,
+	))
+
+	playbackStatesEndpoint := endpoints.GetPlaybackStatesEndpoint
+	playbackStatesEndpoint = readAuth(playbackStatesEndpoint)
+	router.Methods("POST").Path("/playback").Handler(kithttp.NewServer(
+		playbackStatesEndpoint,
+		decodePlaybackStatesRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	updatePlaybackEndpoint := endpoints.UpdatePlaybackStateEndpoint
+	updatePlaybackEndpoint = authMiddleware(updatePlaybackEndpoint)
+	router.Methods("POST").Path("/playback/update").Handler(kithttp.NewServer(
+		updatePlaybackEndpoint,
+		decodeUpdatePlaybackRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	syncEndpoint := endpoints.SyncEndpoint
+	syncEndpoint = readAuth(syncEndpoint)
+	router.Methods("GET").Path("/sync/{user}").Handler(kithttp.NewServer(
+		syncEndpoint,
+		decodeSyncRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	uploadChangesEndpoint := endpoints.UploadChangesEndpoint
+	uploadChangesEndpoint = authMiddleware(uploadChangesEndpoint)
+	router.Methods("POST").Path("/sync/{user}").Handler(kithttp.NewServer(
+		uploadChangesEndpoint,
+		decodeUploadChangesRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	requestVerificationEndpoint := endpoints.RequestVerificationEndpoint
+	requestVerificationEndpoint = authMiddleware(requestVerificationEndpoint)
+	router.Methods("POST").Path(VerifyEmailPath + "/request").Handler(kithttp.NewServer(
+		requestVerificationEndpoint,
+		decodeGetUserRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	// Verification and password reset links are opened from their emails, the token in the link authorizes them
+	router.Methods("GET").Path(VerifyEmailPath).Handler(kithttp.NewServer(
+		endpoints.VerifyEmailEndpoint,
+		decodeVerifyEmailRequest,
+		encodeVerifyEmailResponse,
+		serverOptions...,
+	))
+
+	router.Methods("POST").Path("/password/forgot").Handler(kithttp.NewServer(
+		endpoints.RequestPasswordResetEndpoint,
+		decodeGetUserRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	router.Methods("GET").Path(ResetPasswordPath).HandlerFunc(resetPasswordForm)
+	router.Methods("POST").Path(ResetPasswordPath).Handler(kithttp.NewServer(
+		endpoints.ResetPasswordEndpoint,
+		decodeResetPasswordRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	changePasswordEndpoint := endpoints.ChangePasswordEndpoint
+	changePasswordEndpoint = authMiddleware(changePasswordEndpoint)
+	router.Methods("POST").Path("/password/change").Handler(kithttp.NewServer(
+		changePasswordEndpoint,
+		decodeChangePasswordRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	requestEmailChangeEndpoint := endpoints.RequestEmailChangeEndpoint
+	requestEmailChangeEndpoint = authMiddleware(requestEmailChangeEndpoint)
+	router.Methods("POST").Path("/email/change").Handler(kithttp.NewServer(
+		requestEmailChangeEndpoint,
+		decodeChangeEmailRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	router.Methods("GET").Path(ChangeEmailPath).Handler(kithttp.NewServer(
+		endpoints.ConfirmEmailChangeEndpoint,
+		decodeVerifyEmailRequest,
+		encodeConfirmEmailChangeResponse,
+		serverOptions...,
+	))
+
+	exportAccountEndpoint := endpoints.ExportAccountEndpoint
+	exportAccountEndpoint = authMiddleware(exportAccountEndpoint)
+	router.Methods("GET").Path("/account/{user}/export").Handler(kithttp.NewServer(
+		exportAccountEndpoint,
+		decodeGetUserRequestAlternate,
+		encodeAccountExportResponse,
+		serverOptions...,
+	))
+
+	deleteAccountEndpoint := endpoints.DeleteAccountEndpoint
+	deleteAccountEndpoint = authMiddleware(deleteAccountEndpoint)
+	router.Methods("POST").Path("/account/delete").Handler(kithttp.NewServer(
+		deleteAccountEndpoint,
+		decodeGetTokenRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	createAccessTokenEndpoint := endpoints.CreateAccessTokenEndpoint
+	createAccessTokenEndpoint = authMiddleware(createAccessTokenEndpoint)
+	router.Methods("POST").Path("/tokens/create").Handler(kithttp.NewServer(
+		createAccessTokenEndpoint,
+		decodeAccessTokenRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	getAccessTokensEndpoint := endpoints.GetAccessTokensEndpoint
+	getAccessTokensEndpoint = authMiddleware(getAccessTokensEndpoint)
+	router.Methods("POST").Path("/tokens").Handler(kithttp.NewServer(
+		getAccessTokensEndpoint,
+		decodeAccessTokenRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	revokeAccessTokenEndpoint := endpoints.RevokeAccessTokenEndpoint
+	revokeAccessTokenEndpoint = authMiddleware(revokeAccessTokenEndpoint)
+	router.Methods("POST").Path("/tokens/revoke").Handler(kithttp.NewServer(
+		revokeAccessTokenEndpoint,
+		decodeAccessTokenRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	checkTokenEndpoint := endpoints.CheckTokenEndpoint
+	checkTokenEndpoint = authMiddleware(checkTokenEndpoint)
+	router.Methods("POST").Path("/token/check").Handler(kithttp.NewServer(
+		checkTokenEndpoint,
+		decodeCheckTokenRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	// Access tokens are exchanged for a short-lived token limited to their scopes, which spares scripts holding
+	// one from sending it with every request
+	router.Methods("POST").Path("/tokens/exchange").Handler(kithttp.NewServer(
+		endpoints.ExchangeAccessTokenEndpoint,
+		decodeExchangeAccessTokenRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	// Browsers are sent to the OpenID Connect provider and come back to the callback, the login's session is kept
+	// in a cookie meanwhile. API clients are handed the session and send it back along with the provider's response
+	router.Methods("GET").Path(OIDCLoginPath).Handler(kithttp.NewServer(
+		endpoints.BeginOIDCLoginEndpoint,
+		decodeBeginOIDCLoginRequest,
+		encodeOIDCRedirectResponse,
+		serverOptions...,
+	))
+	router.Methods("POST").Path(OIDCLoginPath).Handler(kithttp.NewServer(
+		endpoints.BeginOIDCLoginEndpoint,
+		decodeBeginOIDCLoginRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+	router.Methods("GET").Path(OIDCCallbackPath).Handler(kithttp.NewServer(
+		endpoints.CompleteOIDCLoginEndpoint,
+		decodeOIDCCallbackRequest,
+		encodeOIDCCallbackResponse,
+		serverOptions...,
+	))
+	router.Methods("POST").Path(OIDCCallbackPath).Handler(kithttp.NewServer(
+		endpoints.CompleteOIDCLoginEndpoint,
+		decodeCompleteOIDCLoginRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
+
+	// Verifiers holding no shared secret check tokens against the published public keys
+	router.Methods("GET").Path("/.well-known/jwks.json").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "max-age=300")
+		json.NewEncoder(w).Encode(keys.JWKS())
+	})
+
+	// The gpodder.net API authenticates with basic auth or the cookie of a session, besides the usual token
+	gpodderOptions := append(serverOptions, kithttp.ServerBefore(gpodderAuthToContext, secureToContext))
+	gpodderAuth := func(scope string, e endpoint.Endpoint) endpoint.Endpoint {
+		return basicAuthMiddleware(svc)(scopedAuth(scope)(e))
+	}
+	router.Methods("POST").Path("/api/2/auth/{user}/login.json").Handler(kithttp.NewServer(
+		endpoints.GetTokenEndpoint,
+		decodeGpodderLoginRequest,
+		encodeGpodderLoginResponse,
+		gpodderOptions...,
+	))
+	router.Methods("POST").Path("/api/2/auth/{user}/logout.json").HandlerFunc(gpodderLogout)
+
+	router.Methods("GET").Path("/api/2/devices/{user}.json").Handler(kithttp.NewServer(
+		gpodderAuth(podcastmg.ScopeRead, endpoints.GetDevicesEndpoint),
+		decodeGetDevicesRequest,
+		encodeGpodderResponse,
+		gpodderOptions...,
+	))
+	router.Methods("POST").Path("/api/2/devices/{user}/{device}.json").Handler(kithttp.NewServer(
+		gpodderAuth("", endpoints.UpdateDeviceEndpoint),
+		decodeUpdateDeviceRequest,
+		encodeGpodderResponse,
+		gpodderOptions...,
+	))
+
+	router.Methods("GET").Path("/api/2/subscriptions/{user}/{device}.json").Handler(kithttp.NewServer(
+		gpodderAuth(podcastmg.ScopeRead, endpoints.GetSubscriptionChangesEndpoint),
+		decodeSubscriptionChangesRequest,
+		encodeGpodderResponse,
+		gpodderOptions...,
+	))
+	router.Methods("POST").Path("/api/2/subscriptions/{user}/{device}.json").Handler(kithttp.NewServer(
+		gpodderAuth(podcastmg.ScopeSubscriptionsWrite, endpoints.UploadSubscriptionsEndpoint),
+		decodeUploadSubscriptionsRequest,
+		encodeGpodderResponse,
+		gpodderOptions...,
+	))
+
+	router.Methods("GET").Path("/api/2/episodes/{user}.json").Handler(kithttp.NewServer(
+		gpodderAuth(podcastmg.ScopeRead, endpoints.GetEpisodeActionsEndpoint),
+		decodeEpisodeActionsRequest,
+		encodeGpodderResponse,
+		gpodderOptions...,
+	))
+	router.Methods("POST").Path("/api/2/episodes/{user}.json").Handler(kithttp.NewServer(
+		gpodderAuth("", endpoints.UploadEpisodeActionsEndpoint),
+		decodeUploadEpisodeActionsRequest,
+		encodeGpodderResponse,
+		gpodderOptions...,
+	))
+
+	exportOPMLEndpoint := endpoints.ExportOPMLEndpoint
+	exportOPMLEndpoint = readAuth(exportOPMLEndpoint)
+	router.Methods("GET").Path("/opml/{user}").Handler(kithttp.NewServer(
+		exportOPMLEndpoint,
+		decodeExportOPMLRequest,
+		encodeOPMLResponse,
+		serverOptions...,
+	))
+
+	router.Methods("POST").Path("/discover").Handler(kithttp.NewServer(
+		endpoints.DiscoverEndpoint,
+		decodeDiscoverRequest,
+		encodeGenericResponse,
+		serverOptions...,
+	))
 	return router
 }
 
+// encodeError sends the message and code of the error with its status, causes are not sent
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
 	}
-	w.WriteHeader(codeFrom(err))
+	var limited limitedError
+	if errors.As(err, &limited) {
+		w.Header().Set("Retry-After", strconv.Itoa(limited.seconds()))
+	}
+	svcErr := errorFrom(err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(svcErr.Status)
 	e := json.NewEncoder(w).Encode(map[string]interface{}{
-		"err": err.Error(),
+		"err":  svcErr.Message,
+		"code": svcErr.Code,
 	})
 	if e != nil {
 		panic("Error encoding error")
 	}
 }
 
+// errorHandler answers requests which reach no endpoint with the error, encoded like the errors of endpoints
+func errorHandler(err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		encodeError(req.Context(), err, w)
+	})
+}
+
+// conditionalHeadersToContext keeps the headers needed to answer range requests for the response encoder
+func conditionalHeadersToContext(ctx context.Context, req *http.Request) context.Context {
+	headers := http.Header{}
+	for _, name := range conditionalHeaders {
+		if value := req.Header.Get(name); value != "" {
+			headers.Set(name, value)
+		}
+	}
+	return context.WithValue(ctx, contextKeyConditionalHeaders, headers)
+}
+
+func decodeSearchRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var searchReq searchRequest
+	if err := json.NewDecoder(req.Body).Decode(&searchReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return searchReq, nil
+}
+
+func decodeDiscoverRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var discoverReq discoverRequest
+	if err := json.NewDecoder(req.Body).Decode(&discoverReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return discoverReq, nil
+}
+
+func decodeUpdateSettingsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var settingsReq updateSettingsRequest
+	if err := json.NewDecoder(req.Body).Decode(&settingsReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return settingsReq, nil
+}
+
+func decodeLabelRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var labelReq labelRequest
+	if err := json.NewDecoder(req.Body).Decode(&labelReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return labelReq, nil
+}
+
+func decodeAssignLabelsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var assignReq assignLabelsRequest
+	if err := json.NewDecoder(req.Body).Decode(&assignReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return assignReq, nil
+}
+
+func decodeFilterSubscriptionsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var filterReq filterSubscriptionsRequest
+	if err := json.NewDecoder(req.Body).Decode(&filterReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return filterReq, nil
+}
+
+func decodeUpdateQueueRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var queueReq updateQueueRequest
+	if err := json.NewDecoder(req.Body).Decode(&queueReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return queueReq, nil
+}
+
+func decodePlaylistRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var playlistReq playlistRequest
+	if err := json.NewDecoder(req.Body).Decode(&playlistReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return playlistReq, nil
+}
+
+func decodePlaylistItemsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var itemsReq playlistItemsRequest
+	if err := json.NewDecoder(req.Body).Decode(&itemsReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return itemsReq, nil
+}
+
+func decodePlaylistFeedRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var feedReq playlistFeedRequest
+	if err := json.NewDecoder(req.Body).Decode(&feedReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return feedReq, nil
+}
+
+func decodePlaylistFeedURLRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	return playlistFeedRequest{Secret: mux.Vars(req)["secret"]}, nil
+}
+
+// encodePlaylistRSSResponse writes the playlist as a podcast feed
+func encodePlaylistRSSResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(response.(playlistResponse).Playlist.RSS())
+}
+
+// encodePlaylistM3UResponse writes the playlist as an M3U playlist
+func encodePlaylistM3UResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	return response.(playlistResponse).Playlist.WriteM3U(w)
+}
+
+func decodeWebhookRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var webhookReq webhookRequest
+	if err := json.NewDecoder(req.Body).Decode(&webhookReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return webhookReq, nil
+}
+
+func decodeDigestRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var digestReq digestRequest
+	if err := json.NewDecoder(req.Body).Decode(&digestReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return digestReq, nil
+}
+
+func decodeUnsubscribeDigestRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	return unsubscribeDigestRequest{Token: req.URL.Query().Get("token")}, nil
+}
+
+// encodeUnsubscribeDigestResponse confirms the unsubscribe in plain text for readers following the link
+func encodeUnsubscribeDigestResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := io.WriteString(w, "You have been unsubscribed from the podcast digest.\n")
+	return err
+}
+
+func hubSubscriptionID(req *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(req)["id"], 10, 32)
+	if err != nil {
+		return 0, ErrBadRouting.Wrap(err)
+	}
+	return uint(id), nil
+}
+
+func decodeHubIntentRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	id, err := hubSubscriptionID(req)
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	leaseSeconds, _ := strconv.Atoi(query.Get("hub.lease_seconds"))
+	return hubIntentRequest{
+		ID: id,
+		HubIntent: podcastmg.HubIntent{
+			Mode:         query.Get("hub.mode"),
+			Topic:        query.Get("hub.topic"),
+			LeaseSeconds: leaseSeconds,
+			Reason:       query.Get("hub.reason"),
+		},
+		Challenge: query.Get("hub.challenge"),
+	}, nil
+}
+
+// encodeHubIntentResponse echoes the challenge of a verified intent in the response body
+func encodeHubIntentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := io.WriteString(w, response.(hubIntentResponse).Challenge)
+	return err
+}
+
+func decodeHubContentRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	id, err := hubSubscriptionID(req)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(req.Body, maxHubContent))
+	if err != nil {
+		return nil, err
+	}
+	return hubContentRequest{ID: id, Signature: req.Header.Get(websub.HeaderSignature), Content: content}, nil
+}
+
+// encodeHubContentResponse acknowledges pushed content without a body
+func encodeHubContentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func decodeStreamEventsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(req)
+	return getUserSubscriptionsRequest{EmailID: vars["user"]}, nil
+}
+
+// encodeEventStreamResponse writes the user's events as server-sent events until the stream or the request ends.
+// A comment is sent on idle streams every eventKeepAlive
+func encodeEventStreamResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	stream := response.(eventStreamResponse).Events
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return ErrStreamingUnsupported
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return err
+			}
+		case event, ok := <-stream:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func decodePlaybackStatesRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var playbackReq playbackStatesRequest
+	if err := json.NewDecoder(req.Body).Decode(&playbackReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return playbackReq, nil
+}
+
+func decodeUpdatePlaybackRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var playbackReq updatePlaybackRequest
+	if err := json.NewDecoder(req.Body).Decode(&playbackReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return playbackReq, nil
+}
+
+func decodeSyncRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	query := req.URL.Query()
+	syncReq := syncRequest{EmailID: mux.Vars(req)["user"], Token: query.Get("since")}
+	if limit := query.Get("limit"); limit != "" {
+		if syncReq.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, ErrBadQuery.Wrap(err)
+		}
+	}
+	return syncReq, nil
+}
+
+func decodeUploadChangesRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var uploadReq uploadChangesRequest
+	if err := json.NewDecoder(req.Body).Decode(&uploadReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	uploadReq.EmailID = mux.Vars(req)["user"]
+	return uploadReq, nil
+}
+
+func decodeVerifyEmailRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	return verifyEmailRequest{Token: req.URL.Query().Get("token")}, nil
+}
+
+// encodeVerifyEmailResponse confirms the verification in plain text for readers following the link
+func encodeVerifyEmailResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := io.WriteString(w, "Your email address has been verified.\n")
+	return err
+}
+
+var resetPasswordTemplate = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<h1>Reset your password</h1>
+<form method="POST">
+<input type="hidden" name="token" value="{{.}}">
+<label>New password <input type="password" name="password" autocomplete="new-password" required></label>
+<button type="submit">Reset password</button>
+</form>
+</body>
+</html>
+`))
+
+// resetPasswordForm serves the form of password reset links, it posts the token and the new password back to the link
+func resetPasswordForm(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	resetPasswordTemplate.Execute(w, req.URL.Query().Get("token"))
+}
+
+// decodeResetPasswordRequest accepts JSON as well as the reset form's url encoded post
+func decodeResetPasswordRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var resetReq resetPasswordRequest
+	if req.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		if err := req.ParseForm(); err != nil {
+			return nil, ErrBadQuery.Wrap(err)
+		}
+		return resetPasswordRequest{Token: req.PostForm.Get("token"), Password: req.PostForm.Get("password")}, nil
+	}
+	if err := json.NewDecoder(req.Body).Decode(&resetReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return resetReq, nil
+}
+
+func decodeChangePasswordRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var changeReq changePasswordRequest
+	if err := json.NewDecoder(req.Body).Decode(&changeReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return changeReq, nil
+}
+
+func decodeChangeEmailRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var changeReq changeEmailRequest
+	if err := json.NewDecoder(req.Body).Decode(&changeReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return changeReq, nil
+}
+
+// encodeConfirmEmailChangeResponse confirms the change in plain text for readers following the link
+func encodeConfirmEmailChangeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := io.WriteString(w, "Your email address has been changed, please log in with the new address.\n")
+	return err
+}
+
+// encodeAccountExportResponse writes the export as a JSON file to download
+func encodeAccountExportResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="podcast-manage-export.json"`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(response.(podcastmg.UserExport))
+}
+
+func decodeAccessTokenRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var tokenReq accessTokenRequest
+	if err := json.NewDecoder(req.Body).Decode(&tokenReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return tokenReq, nil
+}
+
+func decodeExchangeAccessTokenRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var exchangeReq exchangeAccessTokenRequest
+	if err := json.NewDecoder(req.Body).Decode(&exchangeReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return exchangeReq, nil
+}
+
+func decodeCheckTokenRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	return nil, nil
+}
+
+func decodeBeginOIDCLoginRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	return nil, nil
+}
+
+// encodeOIDCRedirectResponse keeps the login's session in a cookie and sends the browser to the provider
+func encodeOIDCRedirectResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	login := response.(oidcLoginResponse)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcSessionCookie,
+		Value:    login.Session,
+		Path:     OIDCCallbackPath,
+		MaxAge:   int(oidcSessionTTL / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Location", login.AuthURL)
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+// decodeOIDCCallbackRequest reads the provider's response from the query and the login's session from its cookie.
+// A login the provider refused fails
+func decodeOIDCCallbackRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	query := req.URL.Query()
+	if query.Get("error") != "" {
+		return nil, ErrOIDCLogin
+	}
+	cookie, err := req.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil, ErrOIDCLogin.Wrap(err)
+	}
+	return completeOIDCLoginRequest{cookie.Value, query.Get("state"), query.Get("code")}, nil
+}
+
+// encodeOIDCCallbackResponse drops the login's session, it cannot be used again
+func encodeOIDCCallbackResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	http.SetCookie(w, &http.Cookie{Name: oidcSessionCookie, Path: OIDCCallbackPath, MaxAge: -1, HttpOnly: true})
+	return encodeGenericResponse(ctx, w, response)
+}
+
+func decodeCompleteOIDCLoginRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var completeReq completeOIDCLoginRequest
+	if err := json.NewDecoder(req.Body).Decode(&completeReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return completeReq, nil
+}
+
+// accessTokenMiddleware exchanges an access token sent in place of a JWT for a token limited to its scopes
+func accessTokenMiddleware(svc PodcastManageService) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			if token, ok := ctx.Value(kitjwt.JWTTokenContextKey).(string); ok && podcastmg.IsAccessToken(token) {
+				token, err = svc.ExchangeAccessToken(ctx, token)
+				if err != nil {
+					return nil, err
+				}
+				ctx = context.WithValue(ctx, kitjwt.JWTTokenContextKey, token)
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// keySetParser verifies the token of the request with the key named by its kid. kitjwt.NewParser expects a single
+// signing method, so a parser is made for each method of the set and chosen by the alg of the token. The key then
+// has to be of that method, which keeps a token from being verified with a key of another kind. Tokens of unknown
+// or retired keys are invalid, so that clients log in again
+func keySetParser(keys *signing.KeySet, claimsFetcher func() jwt.Claims) endpoint.Middleware {
+	kf := func(token *jwt.Token) (interface{}, error) {
+		key, err := keys.Keyfunc(token)
+		if err != nil {
+			return nil, kitjwt.ErrTokenInvalid
+		}
+		return key, nil
+	}
+	parsers := map[string]endpoint.Middleware{}
+	for _, method := range signing.Methods {
+		parsers[method.Alg()] = kitjwt.NewParser(kf, method, claimsFetcher)
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		endpoints := map[string]endpoint.Endpoint{}
+		for alg, parser := range parsers {
+			endpoints[alg] = parser(next)
+		}
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			tokenString, _ := ctx.Value(kitjwt.JWTTokenContextKey).(string)
+			alg := jwt.SigningMethodHS256.Alg()
+			if token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{}); err == nil {
+				if _, ok := endpoints[token.Method.Alg()]; ok {
+					alg = token.Method.Alg()
+				}
+			}
+			return endpoints[alg](ctx, request)
+		}
+	}
+}
+
+// revocationMiddleware refuses tokens which were revoked after they were issued, see CheckToken
+func revocationMiddleware(svc PodcastManageService) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			if err = svc.CheckToken(ctx); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// scopeMiddleware refuses requests made with a token limited to scopes other than the scope, tokens without
+// scopes are let through
+func scopeMiddleware(scope string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			claims, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+			if !ok {
+				return nil, kitjwt.ErrTokenContextMissing
+			}
+			if len(claims.Scopes) > 0 && (scope == "" || !podcastmg.Scopes(claims.Scopes).Has(scope)) {
+				return nil, ErrInsufficientScope
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// gpodderAuthToContext keeps the basic auth credentials of the request and takes the token from the session
+// cookie when the request has no bearer token
+func gpodderAuthToContext(ctx context.Context, req *http.Request) context.Context {
+	if user, password, ok := req.BasicAuth(); ok {
+		ctx = context.WithValue(ctx, contextKeyBasicAuth, getTokenRequest{user, password})
+	}
+	if _, ok := ctx.Value(kitjwt.JWTTokenContextKey).(string); ok {
+		return ctx
+	}
+	if cookie, err := req.Cookie(sessionCookie); err == nil && cookie.Value != "" {
+		ctx = context.WithValue(ctx, kitjwt.JWTTokenContextKey, cookie.Value)
+	}
+	return ctx
+}
+
+// basicAuthMiddleware issues a token for requests which carry basic auth credentials instead of one. An access
+// token given as the password is used as the token
+func basicAuthMiddleware(svc PodcastManageService) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			credentials, ok := ctx.Value(contextKeyBasicAuth).(getTokenRequest)
+			if _, hasToken := ctx.Value(kitjwt.JWTTokenContextKey).(string); ok && !hasToken {
+				if podcastmg.IsAccessToken(credentials.Password) {
+					ctx = context.WithValue(ctx, kitjwt.JWTTokenContextKey, credentials.Password)
+					return next(ctx, request)
+				}
+				token, err := svc.GetToken(ctx, credentials.EmailID, credentials.Password)
+				if err != nil {
+					return nil, err
+				}
+				ctx = context.WithValue(ctx, kitjwt.JWTTokenContextKey, token)
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+func decodeGpodderLoginRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	credentials, ok := ctx.Value(contextKeyBasicAuth).(getTokenRequest)
+	if !ok {
+		return nil, kitjwt.ErrTokenContextMissing
+	}
+	if credentials.EmailID != mux.Vars(req)["user"] {
+		return nil, ErrInvalidClaim
+	}
+	return credentials, nil
+}
+
+// secureToContext records whether the request came over TLS
+func secureToContext(ctx context.Context, req *http.Request) context.Context {
+	return context.WithValue(ctx, contextKeySecure, req.TLS != nil)
+}
+
+// encodeGpodderLoginResponse starts a session by setting the session cookie to the issued token. The cookie is not
+// sent along with requests of other sites, and only over TLS if the login came over TLS
+func encodeGpodderLoginResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	secure, _ := ctx.Value(contextKeySecure).(bool)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    response.(getTokenResponse).TokenString,
+		Path:     "/",
+		Expires:  time.Now().Add(sessionLifetime),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return encodeGenericResponse(ctx, w, response)
+}
+
+// gpodderLogout ends the session by clearing the session cookie, the token itself stays valid until it expires
+func gpodderLogout(w http.ResponseWriter, req *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func decodeGetDevicesRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	return getUserSubscriptionsRequest{EmailID: mux.Vars(req)["user"]}, nil
+}
+
+func decodeUpdateDeviceRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(req)
+	deviceReq := updateDeviceRequest{EmailID: vars["user"]}
+	if err := json.NewDecoder(req.Body).Decode(&deviceReq.Device); err != nil && err != io.EOF {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	deviceReq.Device.DeviceID = vars["device"]
+	return deviceReq, nil
+}
+
+func decodeSubscriptionChangesRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(req)
+	changesReq := subscriptionChangesRequest{EmailID: vars["user"], DeviceID: vars["device"]}
+	if since := req.URL.Query().Get("since"); since != "" {
+		if changesReq.Since, err = strconv.ParseInt(since, 10, 64); err != nil {
+			return nil, ErrBadQuery.Wrap(err)
+		}
+	}
+	return changesReq, nil
+}
+
+func decodeUploadSubscriptionsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(req)
+	uploadReq := uploadSubscriptionsRequest{EmailID: vars["user"], DeviceID: vars["device"]}
+	if err := json.NewDecoder(req.Body).Decode(&uploadReq.Changes); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return uploadReq, nil
+}
+
+func decodeEpisodeActionsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	query := req.URL.Query()
+	actionsReq := episodeActionsRequest{EmailID: mux.Vars(req)["user"]}
+	actionsReq.Query.Podcast = query.Get("podcast")
+	actionsReq.Query.Device = query.Get("device")
+	if since := query.Get("since"); since != "" {
+		seconds, err := strconv.ParseInt(since, 10, 64)
+		if err != nil {
+			return nil, ErrBadQuery.Wrap(err)
+		}
+		actionsReq.Query.Since = syncTime(seconds)
+	}
+	if aggregated := query.Get("aggregated"); aggregated != "" {
+		if actionsReq.Query.Aggregated, err = strconv.ParseBool(aggregated); err != nil {
+			return nil, ErrBadQuery.Wrap(err)
+		}
+	}
+	return actionsReq, nil
+}
+
+func decodeUploadEpisodeActionsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	uploadReq := uploadEpisodeActionsRequest{EmailID: mux.Vars(req)["user"]}
+	if err := json.NewDecoder(req.Body).Decode(&uploadReq.Actions); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return uploadReq, nil
+}
+
+// encodeGpodderResponse writes the bare body of a gpodder.net API response
+func encodeGpodderResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	return json.NewEncoder(w).Encode(response.(gpodderResponse).Body)
+}
+
+func decodeExportOPMLRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(req)
+	return getUserSubscriptionsRequest{EmailID: vars["user"]}, nil
+}
+
+// encodeOPMLResponse writes the OPML document as XML
+func encodeOPMLResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(response.(podcastmg.OPML))
+}
+
+func decodeArchiveEpisodeRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	var archiveReq archiveEpisodeRequest
+	if err := json.NewDecoder(req.Body).Decode(&archiveReq); err != nil {
+		return nil, ErrJSONUnmarshall.Wrap(err)
+	}
+	return archiveReq, nil
+}
+
+func decodeGetEpisodeMediaRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(req)
+	itemID, err := strconv.ParseUint(vars["item"], 10, 64)
+	if err != nil {
+		return nil, ErrBadRouting.Wrap(err)
+	}
+	mediaReq := getEpisodeMediaRequest{
+		EmailID: vars["user"],
+		ItemID:  uint(itemID),
+	}
+	return mediaReq, nil
+}
+
+// encodeEpisodeMediaResponse serves the archived media, honouring range and conditional requests
+func encodeEpisodeMediaResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(getEpisodeMediaResponse)
+	defer resp.Media.Close()
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		return err
+	}
+	if headers, ok := ctx.Value(contextKeyConditionalHeaders).(http.Header); ok {
+		req.Header = headers
+	}
+	http.ServeContent(w, req, "", resp.Media.ModTime(), resp.Media)
+	return nil
+}
+
 func decodeGetTokenRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var tokenReq getTokenRequest
 	if err := json.NewDecoder(req.Body).Decode(&tokenReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return tokenReq, nil
 }
@@ -142,7 +1501,7 @@ func decodeGetTokenRequest(ctx context.Context, req *http.Request) (request inte
 func decodeGetSubscriptionDetailsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var subReq getSubscriptionDetailsRequest
 	if err := json.NewDecoder(req.Body).Decode(&subReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return subReq, nil
 }
@@ -150,7 +1509,7 @@ func decodeGetSubscriptionDetailsRequest(ctx context.Context, req *http.Request)
 func decodeGetUserSubscriptionsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var subReq getUserSubscriptionsRequest
 	if err := json.NewDecoder(req.Body).Decode(&subReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return subReq, nil
 }
@@ -158,7 +1517,7 @@ func decodeGetUserSubscriptionsRequest(ctx context.Context, req *http.Request) (
 func decodeSubscribeRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var subReq subscribeRequest
 	if err := json.NewDecoder(req.Body).Decode(&subReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return subReq, nil
 }
@@ -166,7 +1525,7 @@ func decodeSubscribeRequest(ctx context.Context, req *http.Request) (request int
 func decodeUnsubscribeRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var unsubReq unsubscribeRequest
 	if err := json.NewDecoder(req.Body).Decode(&unsubReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return unsubReq, nil
 }
@@ -174,7 +1533,7 @@ func decodeUnsubscribeRequest(ctx context.Context, req *http.Request) (request i
 func decodeUpdatePodcastRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var podReq updatePodcastRequest
 	if err := json.NewDecoder(req.Body).Decode(&podReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return podReq, nil
 }
@@ -182,7 +1541,7 @@ func decodeUpdatePodcastRequest(ctx context.Context, req *http.Request) (request
 func decodeGetPodcastDetailsRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var podReq getPodcastDetailsRequest
 	if err := json.NewDecoder(req.Body).Decode(&podReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return podReq, nil
 }
@@ -190,7 +1549,7 @@ func decodeGetPodcastDetailsRequest(ctx context.Context, req *http.Request) (req
 func decodeGetUserRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var guReq getUserRequest
 	if err := json.NewDecoder(req.Body).Decode(&guReq); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return guReq, nil
 }
@@ -206,7 +1565,7 @@ func decodeGetUserRequestAlternate(ctx context.Context, req *http.Request) (requ
 func decodeCreateUserRequest(ctx context.Context, req *http.Request) (request interface{}, err error) {
 	var userRequest createUserRequest
 	if err := json.NewDecoder(req.Body).Decode(&userRequest); err != nil {
-		return nil, ErrJSONUnmarshall
+		return nil, ErrJSONUnmarshall.Wrap(err)
 	}
 	return userRequest, nil
 }
@@ -214,28 +1573,3 @@ func decodeCreateUserRequest(ctx context.Context, req *http.Request) (request in
 func encodeGenericResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	return json.NewEncoder(w).Encode(response)
 }
-
-func codeFrom(err error) int {
-	switch err {
-	case ErrJSONUnmarshall:
-		return http.StatusBadRequest
-	case ErrUserFetch:
-		return http.StatusBadRequest
-	case ErrInvalidPassword:
-		return http.StatusUnauthorized
-	case kitjwt.ErrTokenContextMissing:
-		return http.StatusUnauthorized
-	case kitjwt.ErrTokenInvalid:
-		return http.StatusUnauthorized
-	case kitjwt.ErrTokenExpired:
-		return http.StatusUnauthorized
-	case kitjwt.ErrTokenMalformed:
-		return http.StatusBadRequest
-	case kitjwt.ErrTokenNotActive:
-		return http.StatusUnauthorized
-	case ErrInvalidClaim:
-		return http.StatusUnauthorized
-	default:
-		return http.StatusInternalServerError
-	}
-}
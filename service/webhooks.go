@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+)
+
+// webhookDeliveryLog is the number of deliveries returned by GetWebhookDeliveries
+const webhookDeliveryLog = 100
+
+// webhookError passes on the errors of invalid webhook requests and wraps all others in a service error
+func (svc *podcastManageService) webhookError(err error) error {
+	switch err {
+	case podcastmg.ErrInvalidWebhook, podcastmg.ErrWebhookAddress, podcastmg.ErrTooManyWebhooks, podcastmg.ErrWebhookNotFound:
+		return err
+	}
+	return ErrWebhookUpdate.Wrap(err)
+}
+
+// CreateWebhook registers a url which receives signed notifications of new episodes of the user's subscriptions.
+// The returned webhook carries the signing secret, it is not returned again
+func (svc *podcastManageService) CreateWebhook(ctx context.Context, emailID, webhookURL string) (podcastmg.Webhook, error) {
+	webhook := podcastmg.Webhook{URL: webhookURL}
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return podcastmg.Webhook{}, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return podcastmg.Webhook{}, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.CreateWebhook(emailID, &webhook); err != nil {
+		return podcastmg.Webhook{}, svc.webhookError(err)
+	}
+	return webhook, nil
+}
+
+// GetWebhooks returns the user's webhooks without their secrets
+func (svc *podcastManageService) GetWebhooks(ctx context.Context, emailID string) ([]podcastmg.Webhook, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	webhooks, err := svc.store.GetWebhooks(emailID)
+	if err != nil {
+		return nil, ErrUserFetch.Wrap(err)
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes one of the user's webhooks, pending deliveries are dropped
+func (svc *podcastManageService) DeleteWebhook(ctx context.Context, emailID string, webhookID uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.DeleteWebhook(emailID, webhookID); err != nil {
+		return svc.webhookError(err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the latest deliveries of one of the user's webhooks along with their outcome
+func (svc *podcastManageService) GetWebhookDeliveries(ctx context.Context, emailID string, webhookID uint) ([]podcastmg.WebhookDelivery, error) {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return nil, ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return nil, ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	deliveries, err := svc.store.GetWebhookDeliveries(emailID, webhookID, webhookDeliveryLog)
+	if err == podcastmg.ErrWebhookNotFound {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrUserFetch.Wrap(err)
+	}
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery schedules a delivery, usually a dead-lettered one, for another round of attempts
+func (svc *podcastManageService) RetryWebhookDelivery(ctx context.Context, emailID string, deliveryID uint) error {
+
+	// Match Token Claim emailID to requested ID
+	claims := ctx.Value(kitjwt.JWTClaimsContextKey).(*TokenClaims)
+	if emailID != claims.EmailID {
+		return ErrInvalidClaim
+	}
+
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.RetryWebhookDelivery(emailID, deliveryID); err != nil {
+		return svc.webhookError(err)
+	}
+	return nil
+}
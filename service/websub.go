@@ -0,0 +1,57 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"github.com/tchaudhry91/podcast-manage-svc/websub"
+	"time"
+)
+
+// hubError passes on the errors of unwanted or invalid hub callbacks and wraps all others in a service error
+func (svc *podcastManageService) hubError(err error) error {
+	switch err {
+	case podcastmg.ErrHubSubscriptionNotFound, podcastmg.ErrInvalidHubIntent, podcastmg.ErrInvalidHubContent:
+		return err
+	}
+	return ErrHubCallback.Wrap(err)
+}
+
+// VerifyHubIntent answers a hub's verification of a subscribe or unsubscribe request with the challenge,
+// intents which were not requested are refused. Denied subscriptions are recorded and answer no challenge
+func (svc *podcastManageService) VerifyHubIntent(ctx context.Context, subscriptionID uint, intent podcastmg.HubIntent, challenge string) (string, error) {
+	err := svc.store.Connect()
+	if err != nil {
+		return "", ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	if err = svc.store.VerifyHubIntent(subscriptionID, intent, time.Now()); err != nil {
+		return "", svc.hubError(err)
+	}
+	if intent.Mode == podcastmg.HubModeDenied {
+		return "", nil
+	}
+	return challenge, nil
+}
+
+// ReceiveHubContent ingests the feed content pushed by a hub. Content with an invalid signature is acknowledged
+// but ignored, as the WebSub spec asks, so that a forger learns nothing about the secret
+func (svc *podcastManageService) ReceiveHubContent(ctx context.Context, subscriptionID uint, signature string, content []byte) error {
+	err := svc.store.Connect()
+	if err != nil {
+		return ErrDBConn.Wrap(err)
+	}
+	defer svc.store.Close()
+	subscription, err := svc.store.GetHubSubscription(subscriptionID)
+	if err != nil {
+		return svc.hubError(err)
+	}
+	if !websub.Verify(subscription.Secret, content, signature) {
+		svc.logger.Log("hub", subscription.Hub, "topic", subscription.Topic, "err", "Invalid hub signature, content ignored")
+		return nil
+	}
+	if _, err = svc.store.IngestHubContent(subscriptionID, bytes.NewReader(content)); err != nil {
+		return svc.hubError(err)
+	}
+	return nil
+}
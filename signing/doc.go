@@ -0,0 +1,2 @@
+// Package signing keeps the keys the service signs its tokens with. Keys are named by the kid header of the tokens they sign, so that keys can be rotated while tokens signed with earlier ones stay valid, and the public keys are published as a JSON Web Key Set.
+package signing
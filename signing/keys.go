@@ -0,0 +1,252 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnknownKey indicates a token whose kid names no key of the set
+	ErrUnknownKey = errors.New("Token signed with an unknown key")
+
+	// ErrKeyMethod indicates a token whose alg is not the signing method of the key named by its kid
+	ErrKeyMethod = errors.New("Token alg does not match its key")
+
+	// ErrNoSigningKey indicates a key set without a key to sign with
+	ErrNoSigningKey = errors.New("No signing key")
+
+	// ErrUnsupportedKey indicates a key which is neither RSA of at least 2048 bits nor Ed25519
+	ErrUnsupportedKey = errors.New("Unsupported key type, keys have to be RSA of at least 2048 bits or Ed25519")
+)
+
+// Methods are the signing methods of the keys supported by the package
+var Methods = []jwt.SigningMethod{jwt.SigningMethodHS256, jwt.SigningMethodRS256, SigningMethodEdDSA}
+
+// minRSABits is the smallest RSA key accepted
+const minRSABits = 2048
+
+// Key is a key tokens are signed or verified with, keys loaded from public keys only verify
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey returns an HS256 key of the shared secret. Every verifier of its tokens has to hold the secret
+func NewHMACKey(id string, secret []byte) Key {
+	return Key{id, jwt.SigningMethodHS256, secret, secret}
+}
+
+// NewKey returns a key signing with the private key, which is an *rsa.PrivateKey signing RS256 or an
+// ed25519.PrivateKey signing EdDSA
+func NewKey(id string, private interface{}) (Key, error) {
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return Key{}, ErrUnsupportedKey
+		}
+		return Key{id, jwt.SigningMethodRS256, k, &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return Key{id, SigningMethodEdDSA, k, k.Public()}, nil
+	}
+	return Key{}, ErrUnsupportedKey
+}
+
+// NewVerifyKey returns a key which only verifies tokens, with an *rsa.PublicKey or an ed25519.PublicKey
+func NewVerifyKey(id string, public interface{}) (Key, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return Key{}, ErrUnsupportedKey
+		}
+		return Key{id, jwt.SigningMethodRS256, nil, k}, nil
+	case ed25519.PublicKey:
+		return Key{id, SigningMethodEdDSA, nil, k}, nil
+	}
+	return Key{}, ErrUnsupportedKey
+}
+
+// ParsePEM returns the key of a PEM block: a PKCS #8 or PKCS #1 private key, or a PKIX public key which only
+// verifies
+func ParsePEM(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("%s: no PEM block", id)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return NewKey(id, private)
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return NewKey(id, private)
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return NewVerifyKey(id, public)
+	}
+	return Key{}, fmt.Errorf("%s: unsupported PEM block %s", id, block.Type)
+}
+
+// CanSign reports whether tokens can be signed with the key
+func (key Key) CanSign() bool {
+	return key.signKey != nil
+}
+
+// KeySet is the keys of the service. Tokens are signed with the active key and verified with the key named by
+// their kid, tokens without kid are verified with the key whose ID is empty
+type KeySet struct {
+	mtx    sync.RWMutex
+	keys   map[string]Key
+	active string
+}
+
+// NewKeySet returns a set signing with the active key, the others only verify
+func NewKeySet(active Key, others ...Key) (*KeySet, error) {
+	if !active.CanSign() {
+		return nil, ErrNoSigningKey
+	}
+	s := &KeySet{keys: map[string]Key{}, active: active.ID}
+	for _, key := range append(others, active) {
+		s.keys[key.ID] = key
+	}
+	return s, nil
+}
+
+// LoadDir returns the keys of the PEM files named <kid>.pem in the directory along with the extra keys. The
+// private key whose kid sorts last is the active key, so that keys are rotated by adding a file with a later name.
+// Files of earlier keys, or their public keys, are kept until the tokens they signed expired
+func LoadDir(dir string, extra ...Key) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	keys := append([]Key{}, extra...)
+	var active *Key
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePEM(strings.TrimSuffix(filepath.Base(file), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		if key.CanSign() {
+			active = &keys[len(keys)-1]
+		}
+	}
+	if active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return NewKeySet(*active, keys...)
+}
+
+// Replace takes over the keys of the other set, tokens signed from then on are signed with its active key
+func (s *KeySet) Replace(other *KeySet) {
+	other.mtx.RLock()
+	keys, active := other.keys, other.active
+	other.mtx.RUnlock()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.keys, s.active = keys, active
+}
+
+// Sign returns the token of the claims signed with the active key, its kid names the key
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	s.mtx.RLock()
+	key := s.keys[s.active]
+	s.mtx.RUnlock()
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.signKey)
+}
+
+// Keyfunc returns the key named by the kid of the token to verify it with, the token's alg has to be the key's
+// signing method
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	s.mtx.RLock()
+	key, ok := s.keys[kid]
+	s.mtx.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method == nil || token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrKeyMethod
+	}
+	return key.verifyKey, nil
+}
+
+// Parse verifies the token with the key set and decodes its claims
+func (s *KeySet) Parse(tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.Keyfunc)
+	return err
+}
+
+// JSONWebKey is a public key as published in a JSON Web Key Set
+type JSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is the document of a JWKS endpoint
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys of the set ordered by kid, shared secrets are not published
+func (s *KeySet) JWKS() JSONWebKeySet {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range s.keys {
+		jwk := JSONWebKey{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
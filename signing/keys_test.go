@@ -0,0 +1,224 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	jwt "github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// testKeys returns an RSA and an Ed25519 key, RSA keys are slow to generate so they are made once
+var testKeys = func() func(t *testing.T) (*rsa.PrivateKey, ed25519.PrivateKey) {
+	var rsaKey *rsa.PrivateKey
+	var edKey ed25519.PrivateKey
+	return func(t *testing.T) (*rsa.PrivateKey, ed25519.PrivateKey) {
+		if rsaKey == nil {
+			var err error
+			if rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+				t.Fatalf("Could not generate RSA key:%v", err)
+			}
+			if _, edKey, err = ed25519.GenerateKey(rand.Reader); err != nil {
+				t.Fatalf("Could not generate Ed25519 key:%v", err)
+			}
+		}
+		return rsaKey, edKey
+	}
+}()
+
+func testClaims() jwt.StandardClaims {
+	return jwt.StandardClaims{Subject: "test@test.com", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+}
+
+func mustKey(t *testing.T, id string, private interface{}) Key {
+	key, err := NewKey(id, private)
+	if err != nil {
+		t.Fatalf("Could not create key %s:%v", id, err)
+	}
+	return key
+}
+
+func TestKeySetSign(t *testing.T) {
+	rsaKey, edKey := testKeys(t)
+	type signTestCase struct {
+		key     Key
+		wantAlg string
+	}
+	testCases := []signTestCase{
+		{NewHMACKey("", []byte("secret")), "HS256"},
+		{mustKey(t, "rsa-1", rsaKey), "RS256"},
+		{mustKey(t, "ed-1", edKey), "EdDSA"},
+	}
+	for _, test := range testCases {
+		keys, err := NewKeySet(test.key)
+		if err != nil {
+			t.Fatalf("Could not create key set:%v", err)
+		}
+		tokenString, err := keys.Sign(testClaims())
+		if err != nil {
+			t.Fatalf("%s: Failed to sign:%v", test.wantAlg, err)
+		}
+		token, _, err := new(jwt.Parser).ParseUnverified(tokenString, &jwt.StandardClaims{})
+		if err != nil {
+			t.Fatalf("%s: Failed to parse:%v", test.wantAlg, err)
+		}
+		if token.Method.Alg() != test.wantAlg {
+			t.Errorf("Alg Want:%s\tHave:%s", test.wantAlg, token.Method.Alg())
+		}
+		if kid, ok := token.Header["kid"]; (test.key.ID == "" && ok) || (test.key.ID != "" && kid != test.key.ID) {
+			t.Errorf("%s: Kid Want:%q\tHave:%v", test.wantAlg, test.key.ID, kid)
+		}
+		var claims jwt.StandardClaims
+		if err = keys.Parse(tokenString, &claims); err != nil || claims.Subject != "test@test.com" {
+			t.Errorf("%s: Failed to verify:%v %v", test.wantAlg, err, claims)
+		}
+		if err = keys.Parse(tokenString[:len(tokenString)-4]+"AAAA", &claims); err == nil {
+			t.Errorf("%s: Token with a wrong signature was accepted", test.wantAlg)
+		}
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	rsaKey, edKey := testKeys(t)
+	legacy := NewHMACKey("", []byte("secret"))
+	keys, _ := NewKeySet(legacy)
+	legacyToken, _ := keys.Sign(testClaims())
+
+	rsaSigning := mustKey(t, "rsa-1", rsaKey)
+	rotated, err := NewKeySet(rsaSigning, legacy)
+	if err != nil {
+		t.Fatalf("Could not create key set:%v", err)
+	}
+	keys.Replace(rotated)
+	rsaToken, _ := keys.Sign(testClaims())
+
+	rsaVerify, err := NewVerifyKey("rsa-1", &rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Could not create verify key:%v", err)
+	}
+	rotated, _ = NewKeySet(mustKey(t, "ed-1", edKey), rsaVerify, legacy)
+	keys.Replace(rotated)
+	edToken, _ := keys.Sign(testClaims())
+
+	for _, token := range []string{legacyToken, rsaToken, edToken} {
+		if err = keys.Parse(token, &jwt.StandardClaims{}); err != nil {
+			t.Errorf("Token of an earlier key should stay valid:%v", err)
+		}
+	}
+
+	// Tokens of keys which are removed are not valid anymore
+	rotated, _ = NewKeySet(mustKey(t, "ed-1", edKey))
+	keys.Replace(rotated)
+	for _, token := range []string{legacyToken, rsaToken} {
+		if err = keys.Parse(token, &jwt.StandardClaims{}); err == nil {
+			t.Errorf("Token of a removed key was accepted")
+		}
+	}
+	if _, err = NewKeySet(rsaVerify); err != ErrNoSigningKey {
+		t.Errorf("Want:%v\tHave:%v", ErrNoSigningKey, err)
+	}
+}
+
+func TestKeySetAlgConfusion(t *testing.T) {
+	rsaKey, _ := testKeys(t)
+	keys, _ := NewKeySet(mustKey(t, "rsa-1", rsaKey), NewHMACKey("", []byte("secret")))
+	public, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+
+	// An HS256 token keyed with the published public key must not pass for a token of the RSA key
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token.Header["kid"] = "rsa-1"
+	forged, _ := token.SignedString(publicPEM)
+	if err := keys.Parse(forged, &jwt.StandardClaims{}); err == nil {
+		t.Errorf("HS256 token of an RSA key was accepted")
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+	token.Header["kid"] = "rsa-1"
+	unsigned, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err := keys.Parse(unsigned, &jwt.StandardClaims{}); err == nil {
+		t.Errorf("Unsigned token was accepted")
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token.Header["kid"] = "unknown"
+	unknown, _ := token.SignedString([]byte("secret"))
+	if err := keys.Parse(unknown, &jwt.StandardClaims{}); err == nil {
+		t.Errorf("Token of an unknown key was accepted")
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	rsaKey, edKey := testKeys(t)
+	keys, _ := NewKeySet(mustKey(t, "rsa-1", rsaKey), mustKey(t, "ed-1", edKey), NewHMACKey("", []byte("secret")))
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Shared secrets must not be published:%v", jwks.Keys)
+	}
+	ed, rs := jwks.Keys[0], jwks.Keys[1]
+	if ed.Kid != "ed-1" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Unexpected Ed25519 key:%v", ed)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(ed.X); string(x) != string(edKey.Public().(ed25519.PublicKey)) {
+		t.Errorf("Ed25519 public key mismatch")
+	}
+	if rs.Kid != "rsa-1" || rs.Kty != "RSA" || rs.Alg != "RS256" || rs.E != "AQAB" {
+		t.Errorf("Unexpected RSA key:%v", rs)
+	}
+	if n, _ := base64.RawURLEncoding.DecodeString(rs.N); string(n) != string(rsaKey.N.Bytes()) {
+		t.Errorf("RSA modulus mismatch")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	rsaKey, edKey := testKeys(t)
+	dir, err := ioutil.TempDir("", "pmg-keys")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	edPKCS8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	rsaPublic, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	files := map[string]*pem.Block{
+		"2020-01.pem": {Type: "PUBLIC KEY", Bytes: rsaPublic},
+		"2020-02.pem": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"2020-03.pem": {Type: "PRIVATE KEY", Bytes: edPKCS8},
+	}
+	for name, block := range files {
+		if err = ioutil.WriteFile(path.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatalf("Could not write key:%v", err)
+		}
+	}
+	keys, err := LoadDir(dir, NewHMACKey("", []byte("secret")))
+	if err != nil {
+		t.Fatalf("Failed to load keys:%v", err)
+	}
+	tokenString, _ := keys.Sign(testClaims())
+	token, _, _ := new(jwt.Parser).ParseUnverified(tokenString, &jwt.StandardClaims{})
+	if token.Header["kid"] != "2020-03" || token.Method != SigningMethodEdDSA {
+		t.Errorf("Key sorting last should sign, Have:%v", token.Header)
+	}
+	if len(keys.JWKS().Keys) != 3 {
+		t.Errorf("Public keys Want:3\tHave:%d", len(keys.JWKS().Keys))
+	}
+
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+	smallPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(small)})
+	if _, err = ParsePEM("small", smallPEM); err != ErrUnsupportedKey {
+		t.Errorf("Want:%v\tHave:%v", ErrUnsupportedKey, err)
+	}
+
+	empty, _ := ioutil.TempDir("", "pmg-keys")
+	defer os.RemoveAll(empty)
+	if _, err = LoadDir(empty); err != ErrNoSigningKey {
+		t.Errorf("Want:%v\tHave:%v", ErrNoSigningKey, err)
+	}
+}
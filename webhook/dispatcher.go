@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// HeaderEvent carries the event of a delivery
+	HeaderEvent = "X-Webhook-Event"
+
+	// HeaderDelivery carries the id of a delivery, it is the same for all attempts of the delivery
+	HeaderDelivery = "X-Webhook-Delivery"
+
+	// HeaderTimestamp carries the unix time at which the delivery was signed
+	HeaderTimestamp = "X-Webhook-Timestamp"
+
+	// HeaderSignature carries the signature of the delivery as returned by Sign
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Dispatcher sends the pending deliveries of the webhook outbox. A delivery succeeds on a 2xx response,
+// failed attempts are retried with exponential backoff and the delivery is dead-lettered after the last attempt
+type Dispatcher struct {
+	store       podcastmg.Store
+	logger      log.Logger
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	interval    time.Duration
+	batch       int
+	now         func() time.Time
+}
+
+// Option configures a Dispatcher
+type Option func(*Dispatcher)
+
+// MaxAttempts sets the number of attempts after which a delivery is dead-lettered
+func MaxAttempts(attempts int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = attempts
+	}
+}
+
+// Backoff sets the delay after the first failed attempt, it doubles with every further attempt up to max
+func Backoff(initial, max time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = initial
+		d.maxBackoff = max
+	}
+}
+
+// PollInterval sets the interval at which Run checks the outbox for due deliveries
+func PollInterval(interval time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.interval = interval
+	}
+}
+
+// HTTPClient sets the http.Client used to send deliveries. It replaces the default client, which only connects to
+// public addresses and does not follow redirects
+func HTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// NewDispatcher returns a Dispatcher for the outbox of the store. The store is connected for every
+// round of deliveries, it should not be shared with the service
+func NewDispatcher(store podcastmg.Store, logger log.Logger, options ...Option) *Dispatcher {
+	d := Dispatcher{
+		store:       store,
+		logger:      logger,
+		client:      newHTTPClient(podcastmg.PublicAddress),
+		maxAttempts: 8,
+		backoff:     30 * time.Second,
+		maxBackoff:  6 * time.Hour,
+		interval:    10 * time.Second,
+		batch:       50,
+		now:         time.Now,
+	}
+	for _, option := range options {
+		option(&d)
+	}
+	return &d
+}
+
+// newHTTPClient returns a client which connects only to the addresses allowed, whatever the host of the webhook
+// resolves to at the time of the delivery, and returns redirects as the response instead of following them
+func newHTTPClient(allowed func(net.IP) bool) *http.Client {
+	dialer := net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("Webhook address %s is not public", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Sign returns the signature of a payload sent at the given unix time: the hex encoded HMAC-SHA256 of
+// "<timestamp>.<payload>" keyed with the webhook secret, prefixed with "sha256="
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature matches the payload sent at the given unix time
+func Verify(secret string, timestamp int64, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
+
+// Run delivers due deliveries every poll interval until the context is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil {
+			d.logger.Log("err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue makes an attempt at every due delivery and returns the number of attempts made
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	if err := d.store.Connect(); err != nil {
+		return 0, err
+	}
+	defer d.store.Close()
+
+	// Claimed deliveries are not picked up again before the client has given up on them
+	lease := 2*d.client.Timeout + time.Minute
+	due, err := d.store.ClaimWebhookDeliveries(d.now(), lease, d.batch)
+	if err != nil {
+		return 0, err
+	}
+	for i := range due {
+		delivery := &due[i]
+		d.attempt(ctx, delivery)
+		if err = d.store.SaveWebhookDelivery(&delivery.WebhookDelivery); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+// attempt sends the delivery once and records the outcome on it
+func (d *Dispatcher) attempt(ctx context.Context, delivery *podcastmg.DueDelivery) {
+	delivery.Attempts++
+	delivery.StatusCode, delivery.LastError = 0, ""
+	err := d.send(ctx, delivery)
+	now := d.now()
+	switch {
+	case err == nil:
+		delivery.Status = podcastmg.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		return
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = podcastmg.DeliveryDead
+	default:
+		delivery.NextAttempt = now.Add(d.delay(delivery.Attempts))
+	}
+	delivery.LastError = err.Error()
+	d.logger.Log("webhook", delivery.WebhookID, "delivery", delivery.ID, "attempt", delivery.Attempts, "status", delivery.Status, "err", err)
+}
+
+// delay returns the backoff after the given number of failed attempts
+func (d *Dispatcher) delay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *podcastmg.DueDelivery) error {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", delivery.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.WebhookSecret, timestamp, payload))
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook responded with %s", resp.Status)
+	}
+	return nil
+}
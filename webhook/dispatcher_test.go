@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint answering with a configurable status and recording valid deliveries
+type receiver struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	status   int
+	payloads []podcastmg.NewEpisodesPayload
+	invalid  int
+}
+
+func newReceiver(secret string) *receiver {
+	r := receiver{status: http.StatusInternalServerError}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		body, _ := ioutil.ReadAll(req.Body)
+		timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+		if !Verify(secret, timestamp, body, req.Header.Get(HeaderSignature)) || req.Header.Get(HeaderEvent) != podcastmg.EventNewEpisodes {
+			r.invalid++
+		} else if r.status == http.StatusOK {
+			var payload podcastmg.NewEpisodesPayload
+			json.Unmarshal(body, &payload)
+			r.payloads = append(r.payloads, payload)
+		}
+		w.WriteHeader(r.status)
+	}))
+	return &r
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.status = status
+}
+
+func TestDispatcher(t *testing.T) {
+	episodes := 1
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Hook Cast</title>`)
+		for i := episodes; i > 0; i-- {
+			fmt.Fprintf(w, `<item><title>Episode %d</title><pubDate>Mon, 0%d Jan 2018 10:00:00 GMT</pubDate><enclosure url="https://media.test/%d.mp3"/></item>`, i, i, i)
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	}))
+	defer feed.Close()
+	secret := "s3cret"
+	hook := newReceiver(secret)
+	defer hook.Close()
+
+	dir, err := ioutil.TempDir("", "pmg-webhook")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	store := podcastmg.NewDBStore("sqlite3", path.Join(dir, "webhook.db"))
+	email := "hooks@test.com"
+	func() {
+		store.Connect()
+		defer store.Close()
+		store.Migrate()
+		podcast, err := podcastmg.BuildPodcastFromURL(feed.URL)
+		if err != nil {
+			t.Fatalf("Failed to build podcast:%v", err)
+		}
+		if err = store.CreateUser(&podcastmg.User{UserEmail: email, Password: "x", Podcasts: []podcastmg.Podcast{podcast}}); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+		// The receiver listens on a loopback address, which CreateWebhook refuses
+		user, _ := store.GetUserByEmail(email)
+		if err = store.Database.Create(&podcastmg.Webhook{UserID: user.ID, URL: hook.URL, Secret: secret}).Error; err != nil {
+			t.Fatalf("Failed to create webhook:%v", err)
+		}
+		if err = store.Database.Model(&podcastmg.Subscription{}).Where("user_id = ?", user.ID).UpdateColumn("notifications", true).Error; err != nil {
+			t.Fatalf("Failed to enable notifications:%v", err)
+		}
+		episodes = 3
+		if err = store.UpdatePodcastBySubscription(email, feed.URL); err != nil {
+			t.Fatalf("Failed to update podcast:%v", err)
+		}
+	}()
+	deliveries := func() []podcastmg.WebhookDelivery {
+		store.Connect()
+		defer store.Close()
+		webhooks, _ := store.GetWebhooks(email)
+		deliveries, err := store.GetWebhookDeliveries(email, webhooks[0].ID, 10)
+		if err != nil || len(deliveries) != 1 {
+			t.Fatalf("Unexpected deliveries:%+v %v", deliveries, err)
+		}
+		return deliveries
+	}
+
+	now := time.Now()
+	client := newHTTPClient(func(net.IP) bool { return true })
+	d := NewDispatcher(store, log.NewNopLogger(), MaxAttempts(2), Backoff(time.Minute, time.Hour), HTTPClient(client))
+	d.now = func() time.Time { return now }
+	deliver := func(want int) {
+		if attempts, err := d.DeliverDue(context.Background()); err != nil || attempts != want {
+			t.Fatalf("Attempts Want:%d\tHave:%d %v", want, attempts, err)
+		}
+	}
+
+	deliver(1)
+	delivery := deliveries()[0]
+	if delivery.Status != podcastmg.DeliveryPending || delivery.Attempts != 1 || delivery.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Unexpected delivery after failed attempt:%+v", delivery)
+	}
+	if !delivery.NextAttempt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Next Attempt Want:%v\tHave:%v", now.Add(time.Minute), delivery.NextAttempt)
+	}
+
+	// The delivery waits for its backoff and is dead-lettered after the last attempt
+	deliver(0)
+	now = now.Add(2 * time.Minute)
+	deliver(1)
+	if delivery = deliveries()[0]; delivery.Status != podcastmg.DeliveryDead || delivery.Attempts != 2 {
+		t.Errorf("Unexpected delivery after last attempt:%+v", delivery)
+	}
+	now = now.Add(time.Hour)
+	deliver(0)
+
+	// A dead delivery can be retried by its owner
+	store.Connect()
+	err = store.RetryWebhookDelivery(email, delivery.ID)
+	store.Close()
+	if err != nil {
+		t.Fatalf("Failed to retry delivery:%v", err)
+	}
+	hook.setStatus(http.StatusOK)
+	deliver(1)
+	if delivery = deliveries()[0]; delivery.Status != podcastmg.DeliveryDelivered || delivery.DeliveredAt == nil {
+		t.Errorf("Unexpected delivery after successful attempt:%+v", delivery)
+	}
+
+	hook.mtx.Lock()
+	defer hook.mtx.Unlock()
+	if hook.invalid != 0 || len(hook.payloads) != 1 {
+		t.Fatalf("Invalid:%d\tPayloads:%+v", hook.invalid, hook.payloads)
+	}
+	payload := hook.payloads[0]
+	if payload.Podcast.URL != feed.URL || len(payload.Episodes) != 2 || payload.Episodes[0].Title != "Episode 2" || payload.Episodes[1].Title != "Episode 3" {
+		t.Errorf("Unexpected payload:%+v", payload)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, log.NewNopLogger(), Backoff(time.Second, 5*time.Second))
+	for attempts, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if have := d.delay(attempts + 1); have != want {
+			t.Errorf("Attempt %d\tWant:%v\tHave:%v", attempts+1, want, have)
+		}
+	}
+	if !Verify("secret", 1, []byte("{}"), Sign("secret", 1, []byte("{}"))) || Verify("secret", 2, []byte("{}"), Sign("secret", 1, []byte("{}"))) {
+		t.Errorf("Signature does not cover the timestamp")
+	}
+}
+
+func TestDispatcherClient(t *testing.T) {
+	redirects := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			redirects++
+		}
+		http.Redirect(w, r, "/internal", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// The default client refuses the loopback address of the server
+	d := NewDispatcher(nil, log.NewNopLogger())
+	delivery := podcastmg.DueDelivery{WebhookURL: server.URL, WebhookSecret: "secret"}
+	delivery.Payload = "{}"
+	if err := d.send(context.Background(), &delivery); err == nil {
+		t.Errorf("Delivery to a loopback address should fail")
+	}
+
+	// Redirects are not followed, they fail the delivery
+	d.client = newHTTPClient(func(net.IP) bool { return true })
+	if err := d.send(context.Background(), &delivery); err == nil || delivery.StatusCode != http.StatusFound || redirects != 0 {
+		t.Errorf("Redirect should not be followed:%d %d %v", delivery.StatusCode, redirects, err)
+	}
+}
@@ -0,0 +1,2 @@
+// Package webhook delivers the webhook outbox of a podcastmg.Store with signed requests, retrying failed deliveries with exponential backoff.
+package webhook
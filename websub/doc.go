@@ -0,0 +1,2 @@
+// Package websub keeps WebSub (PubSubHubbub) subscriptions to the hubs advertised by subscribed feeds, renewing them before their leases expire.
+package websub
@@ -0,0 +1,212 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CallbackPath is the path of the service's hub callbacks, the hub subscription id follows it
+	CallbackPath = "/websub/callback"
+
+	// HeaderSignature carries the signature of pushed content as returned by Sign
+	HeaderSignature = "X-Hub-Signature"
+)
+
+// signatureHashes are the hash functions of X-Hub-Signature methods
+var signatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Sign returns the X-Hub-Signature of pushed content: the hex encoded HMAC-SHA256 of the content keyed with
+// the subscription secret, prefixed with "sha256="
+func Sign(secret string, content []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(content)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the X-Hub-Signature matches the content. Hubs may sign with sha1, sha256, sha384 or sha512
+func Verify(secret string, content []byte, signature string) bool {
+	parts := strings.SplitN(signature, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	newHash, ok := signatureHashes[strings.ToLower(parts[0])]
+	if !ok {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(content)
+	return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(parts[1])))
+}
+
+// CallbackURL returns the callback of the hub subscription with the given id on the service at baseURL
+func CallbackURL(baseURL string, subscriptionID uint) string {
+	return strings.TrimRight(baseURL, "/") + CallbackPath + "/" + strconv.FormatUint(uint64(subscriptionID), 10)
+}
+
+// Subscriber sends the subscribe requests of new and expiring hub subscriptions, and unsubscribes topics which
+// lost all their subscribers. The hub verifies each request through the service's callback
+type Subscriber struct {
+	store    podcastmg.Store
+	baseURL  string
+	logger   log.Logger
+	client   *http.Client
+	lease    time.Duration
+	retry    time.Duration
+	interval time.Duration
+	batch    int
+	now      func() time.Time
+}
+
+// Option configures a Subscriber
+type Option func(*Subscriber)
+
+// Lease sets the lease asked for in subscribe requests, the hub may grant a different one
+func Lease(lease time.Duration) Option {
+	return func(s *Subscriber) {
+		s.lease = lease
+	}
+}
+
+// Retry sets the delay after which a request the hub did not verify is sent again
+func Retry(retry time.Duration) Option {
+	return func(s *Subscriber) {
+		s.retry = retry
+	}
+}
+
+// PollInterval sets the interval at which Run checks for hub subscriptions due for a request
+func PollInterval(interval time.Duration) Option {
+	return func(s *Subscriber) {
+		s.interval = interval
+	}
+}
+
+// HTTPClient sets the http.Client used to send requests to hubs
+func HTTPClient(client *http.Client) Option {
+	return func(s *Subscriber) {
+		s.client = client
+	}
+}
+
+// NewSubscriber returns a Subscriber for the hub subscriptions of the store, with callbacks on the service at baseURL.
+// The store is connected for every round of requests, it should not be shared with the service
+func NewSubscriber(store podcastmg.Store, baseURL string, logger log.Logger, options ...Option) *Subscriber {
+	s := Subscriber{
+		store:    store,
+		baseURL:  baseURL,
+		logger:   logger,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		lease:    10 * 24 * time.Hour,
+		retry:    time.Hour,
+		interval: time.Minute,
+		batch:    50,
+		now:      time.Now,
+	}
+	for _, option := range options {
+		option(&s)
+	}
+	return &s
+}
+
+// Run sends due hub requests every poll interval until the context is done
+func (s *Subscriber) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RenewDue(ctx); err != nil {
+			s.logger.Log("err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RenewDue sends a request for every hub subscription which is due and returns the number of requests made
+func (s *Subscriber) RenewDue(ctx context.Context) (int, error) {
+	if err := s.store.Connect(); err != nil {
+		return 0, err
+	}
+	defer s.store.Close()
+
+	due, err := s.store.ClaimHubRenewals(s.now(), s.retry, s.batch)
+	if err != nil {
+		return 0, err
+	}
+	for i := range due {
+		subscription := &due[i].HubSubscription
+		mode := podcastmg.HubModeSubscribe
+		switch {
+		case due[i].Podcasts == 0:
+			mode, subscription.State = podcastmg.HubModeUnsubscribe, podcastmg.HubUnsubscribing
+		case subscription.State != podcastmg.HubVerified:
+			subscription.State = podcastmg.HubPending
+		}
+
+		// The state is saved first, hubs may verify the request before answering it
+		subscription.LastError = ""
+		if err = s.store.SaveHubSubscription(subscription); err != nil {
+			return i, err
+		}
+		if err = s.request(ctx, subscription, mode); err == nil {
+			continue
+		}
+		s.logger.Log("hub", subscription.Hub, "topic", subscription.Topic, "mode", mode, "err", err)
+		subscription.LastError = err.Error()
+		if err = s.store.SaveHubSubscription(subscription); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+// request sends a subscribe or unsubscribe request for the subscription to its hub
+func (s *Subscriber) request(ctx context.Context, subscription *podcastmg.HubSubscription, mode string) error {
+	form := url.Values{
+		"hub.callback": {CallbackURL(s.baseURL, subscription.ID)},
+		"hub.mode":     {mode},
+		"hub.topic":    {subscription.Topic},
+	}
+	if mode == podcastmg.HubModeSubscribe {
+		form.Set("hub.lease_seconds", strconv.Itoa(int(s.lease/time.Second)))
+		form.Set("hub.secret", subscription.Secret)
+	}
+	req, err := http.NewRequest("POST", subscription.Hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Hub responded with %s", resp.Status)
+	}
+	return nil
+}
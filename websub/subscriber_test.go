@@ -0,0 +1,173 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/go-kit/kit/log"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/tchaudhry91/podcast-manage-svc/podcastmg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hub is a WebSub hub recording subscription requests, it verifies subscribe requests before answering them
+type hub struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	status   int
+	requests []url.Values
+}
+
+func newHub(store *podcastmg.DBStore, now func() time.Time) *hub {
+	h := hub{status: http.StatusAccepted}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.mtx.Lock()
+		defer h.mtx.Unlock()
+		req.ParseForm()
+		h.requests = append(h.requests, req.PostForm)
+		if h.status == http.StatusAccepted && req.PostForm.Get("hub.mode") == podcastmg.HubModeSubscribe {
+			callback := req.PostForm.Get("hub.callback")
+			id, _ := strconv.ParseUint(callback[strings.LastIndex(callback, "/")+1:], 10, 32)
+			lease, _ := strconv.Atoi(req.PostForm.Get("hub.lease_seconds"))
+			intent := podcastmg.HubIntent{Mode: podcastmg.HubModeSubscribe, Topic: req.PostForm.Get("hub.topic"), LeaseSeconds: lease}
+			store.VerifyHubIntent(uint(id), intent, now())
+		}
+		w.WriteHeader(h.status)
+	}))
+	return &h
+}
+
+func (h *hub) lastRequest() (url.Values, int) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.requests[len(h.requests)-1], len(h.requests)
+}
+
+func TestSubscriber(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmg-websub")
+	if err != nil {
+		t.Fatalf("Could not create temp dir:%v", err)
+	}
+	defer os.RemoveAll(dir)
+	store := podcastmg.NewDBStore("sqlite3", path.Join(dir, "websub.db"))
+	now := time.Now()
+	h := newHub(store, func() time.Time { return now })
+	defer h.Close()
+
+	topic := "https://hubcast.test/feed"
+	user := podcastmg.User{UserEmail: "websub@test.com", Password: "x", Podcasts: []podcastmg.Podcast{
+		{Title: "Hub Cast", URL: topic, Hub: h.URL, Topic: topic},
+	}}
+	func() {
+		store.Connect()
+		defer store.Close()
+		store.Migrate()
+		if err = store.CreateUser(&user); err != nil {
+			t.Fatalf("Failed to create user:%v", err)
+		}
+	}()
+	subscription := func() podcastmg.HubSubscription {
+		store.Connect()
+		defer store.Close()
+		var subscription podcastmg.HubSubscription
+		if err := store.Database.Where("topic = ?", topic).First(&subscription).Error; err != nil {
+			t.Fatalf("Failed to get hub subscription:%v", err)
+		}
+		return subscription
+	}
+
+	s := NewSubscriber(store, "https://podcasts.test/", log.NewNopLogger(), Lease(time.Hour), Retry(10*time.Minute))
+	s.now = func() time.Time { return now }
+	renew := func(want int) {
+		if requests, err := s.RenewDue(context.Background()); err != nil || requests != want {
+			t.Fatalf("Requests Want:%d\tHave:%d %v", want, requests, err)
+		}
+	}
+
+	// The hub verifies the subscription while the request is being answered
+	renew(1)
+	sub := subscription()
+	form, _ := h.lastRequest()
+	want := url.Values{
+		"hub.callback":      {"https://podcasts.test/websub/callback/" + strconv.FormatUint(uint64(sub.ID), 10)},
+		"hub.mode":          {podcastmg.HubModeSubscribe},
+		"hub.topic":         {topic},
+		"hub.lease_seconds": {"3600"},
+		"hub.secret":        {sub.Secret},
+	}
+	if form.Encode() != want.Encode() {
+		t.Errorf("Request Want:%v\tHave:%v", want, form)
+	}
+	if sub.State != podcastmg.HubVerified || !sub.NextRenewal.Equal(now.Add(54*time.Minute)) {
+		t.Errorf("Unexpected subscription after request:%+v", sub)
+	}
+	renew(0)
+
+	// A failed renewal keeps the subscription until its lease runs out and is retried
+	h.mtx.Lock()
+	h.status = http.StatusInternalServerError
+	h.mtx.Unlock()
+	now = now.Add(time.Hour)
+	renew(1)
+	if sub = subscription(); sub.State != podcastmg.HubVerified || !strings.Contains(sub.LastError, "500") || !sub.NextRenewal.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("Unexpected subscription after failed renewal:%+v", sub)
+	}
+
+	// Topics without subscribers are unsubscribed
+	func() {
+		store.Connect()
+		defer store.Close()
+		store.Database.Where("podcast_id = ?", user.Podcasts[0].ID).Delete(&podcastmg.Subscription{})
+	}()
+	h.mtx.Lock()
+	h.status = http.StatusAccepted
+	h.mtx.Unlock()
+	now = now.Add(10 * time.Minute)
+	renew(1)
+	form, requests := h.lastRequest()
+	if requests != 3 || form.Get("hub.mode") != podcastmg.HubModeUnsubscribe || form.Get("hub.secret") != "" {
+		t.Errorf("Unexpected unsubscribe request %d:%v", requests, form)
+	}
+	if sub = subscription(); sub.State != podcastmg.HubUnsubscribing || sub.LastError != "" {
+		t.Errorf("Unexpected subscription after unsubscribe:%+v", sub)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	content := []byte("<rss/>")
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write(content)
+	sha1Signature := "sha1=" + hex.EncodeToString(mac.Sum(nil))
+
+	type signatureTestCase struct {
+		name      string
+		signature string
+		want      bool
+	}
+	testCases := []signatureTestCase{
+		{"SHA256", Sign("secret", content), true},
+		{"SHA1", sha1Signature, true},
+		{"Upper Case", strings.ToUpper(Sign("secret", content)), true},
+		{"Other Secret", Sign("other", content), false},
+		{"Unknown Method", "md5=" + strings.TrimPrefix(Sign("secret", content), "sha256="), false},
+		{"Missing", "", false},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if have := Verify("secret", content, test.signature); have != test.want {
+				t.Errorf("Want:%v\tHave:%v", test.want, have)
+			}
+		})
+	}
+}